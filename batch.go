@@ -0,0 +1,175 @@
+package godb
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/herott-ai/godb/ds/index"
+	"github.com/herott-ai/godb/logfile"
+)
+
+const (
+	// maxReadGap entries in the same log file are read in one IO if the gap between them is at most maxReadGap bytes.
+	maxReadGap = 4 << 10
+	// maxReadSpan max bytes read in one IO by a batch.
+	maxReadSpan = 1 << 20
+	// maxReadWorkers max number of IOs issued concurrently by a batch.
+	maxReadWorkers = 8
+)
+
+type (
+	// batchRead a value to be read from log file in a batch.
+	batchRead struct {
+		i    int // index of the value in results.
+		node *indexNode
+	}
+
+	// readSpan continuous bytes of a log file, which hold the entries of reads.
+	readSpan struct {
+		logFile    *logfile.LogFile
+		start, end int64
+		reads      []batchRead
+	}
+)
+
+// getVals get the values of keys in idxTree, results are in the order of keys, and the value of key not found is nil.
+// Values not in memory are read from log files in the order of fid and offset, close entries are read in one IO.
+func (db *GoDb) getVals(idxTree index.Index, keys [][]byte, dataType DataType) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	vals := make([][]byte, len(keys))
+	var reads []batchRead
+	ts := time.Now().UnixMilli()
+	for i, key := range keys {
+		idxNode, _ := idxTree.Get(key).(*indexNode)
+		if idxNode == nil {
+			if err := db.indexErr(idxTree); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if idxNode.expiredAt != 0 && idxNode.expiredAt <= ts {
+			continue
+		}
+		db.touch(idxNode)
+		if db.opts.IndexMode == KeyValueMemMode && len(idxNode.value) != 0 {
+			vals[i] = idxNode.value
+			continue
+		}
+		if db.valueCache != nil {
+			ck := cacheKey{dataType: dataType, fid: idxNode.fid, offset: idxNode.offset}
+			if val, ok := db.valueCache.get(ck); ok {
+				if val == nil {
+					val = []byte{}
+				}
+				vals[i] = val
+				continue
+			}
+		}
+		reads = append(reads, batchRead{i: i, node: idxNode})
+	}
+	if len(reads) == 0 {
+		return vals, nil
+	}
+	if err := db.readBatch(dataType, reads, vals, ts); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// readBatch read the values of reads from log files, and save them in vals.
+func (db *GoDb) readBatch(dataType DataType, reads []batchRead, vals [][]byte, ts int64) error {
+	sort.Slice(reads, func(i, j int) bool {
+		if reads[i].node.fid != reads[j].node.fid {
+			return reads[i].node.fid < reads[j].node.fid
+		}
+		return reads[i].node.offset < reads[j].node.offset
+	})
+
+	// log files won`t be sealed or deleted while reading.
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var spans []*readSpan
+	var span *readSpan
+	for _, r := range reads {
+		end := r.node.offset + int64(r.node.entrySize)
+		if span != nil && span.logFile.Fid == r.node.fid && r.node.entrySize > 0 &&
+			r.node.offset-span.end <= maxReadGap && end-span.start <= maxReadSpan {
+			span.reads = append(span.reads, r)
+			if end > span.end {
+				span.end = end
+			}
+			continue
+		}
+		logFile := db.logFile(dataType, r.node.fid)
+		if logFile == nil {
+			return ErrLogFileNotFound
+		}
+		span = &readSpan{logFile: logFile, start: r.node.offset, end: end, reads: []batchRead{r}}
+		spans = append(spans, span)
+	}
+
+	if len(spans) == 1 {
+		return db.readSpan(dataType, spans[0], vals, ts)
+	}
+	errs := make([]error, len(spans))
+	workers := make(chan struct{}, maxReadWorkers)
+	wg := new(sync.WaitGroup)
+	for i, span := range spans {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, span *readSpan) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			errs[i] = db.readSpan(dataType, span, vals, ts)
+		}(i, span)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSpan read the span in one IO, entries not held by it are read one by one.
+func (db *GoDb) readSpan(dataType DataType, span *readSpan, vals [][]byte, ts int64) error {
+	var buf []byte
+	if len(span.reads) > 1 {
+		// an error here is not fatal, the entries will be read one by one.
+		buf, _ = span.logFile.Read(span.start, uint32(span.end-span.start))
+	}
+	for _, r := range span.reads {
+		var ent *logfile.LogEntry
+		var err error = io.ErrUnexpectedEOF
+		if buf != nil {
+			ent, _, err = span.logFile.DecodeEntry(buf[r.node.offset-span.start:])
+		}
+		// the entry is not held by buf entirely, read it again.
+		if err != nil {
+			ent, _, err = span.logFile.ReadLogEntry(r.node.offset)
+		}
+		if err != nil {
+			return err
+		}
+		// key exists, but is invalid(deleted or expired)
+		if ent.Type == logfile.TypeDelete || (ent.ExpiredAt != 0 && ent.ExpiredAt < ts) {
+			continue
+		}
+		val := ent.Value
+		if val == nil {
+			val = []byte{}
+		}
+		if db.valueCache != nil {
+			db.valueCache.put(cacheKey{dataType: dataType, fid: r.node.fid, offset: r.node.offset}, val)
+		}
+		vals[r.i] = val
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package godb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoDb_getVals(t *testing.T) {
+	t.Run("fileio", func(t *testing.T) {
+		testGoDbGetVals(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testGoDbGetVals(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-value", func(t *testing.T) {
+		testGoDbGetVals(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func testGoDbGetVals(t *testing.T, ioType IOType, mode DataIndexMode) {
+	path := filepath.Join("/tmp", "godb-batch")
+	opts := DefaultOptions(path)
+	opts.IoType = ioType
+	opts.IndexMode = mode
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// values spread over several log files, some are larger than maxReadGap.
+	writeCount := 2000
+	for i := 0; i < writeCount; i++ {
+		val := GetValue16B()
+		if i%100 == 0 {
+			val = GetValue(maxReadGap * 2)
+		}
+		err := db.Set(GetKey(i), val)
+		assert.Nil(t, err)
+	}
+	for i := 0; i < writeCount; i += 7 {
+		err := db.Delete(GetKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.SetEX(GetKey(1), GetValue16B(), time.Millisecond*100)
+	assert.Nil(t, err)
+	err = db.Set(GetKey(2), []byte{})
+	assert.Nil(t, err)
+	assert.Greater(t, len(db.archivedLogFiles[String]), 1)
+	time.Sleep(time.Millisecond * 1100)
+
+	// keys in reverse order, with duplicated and not existing keys.
+	var keys [][]byte
+	for i := writeCount + 10; i >= 0; i-- {
+		keys = append(keys, GetKey(i))
+	}
+	keys = append(keys, GetKey(3), GetKey(3))
+
+	vals, err := db.getVals(db.strIndex, keys, String)
+	assert.Nil(t, err)
+	assert.Equal(t, len(keys), len(vals))
+	for i, key := range keys {
+		val, err := db.getVal(db.strIndex, key, String)
+		if err == ErrKeyNotFound {
+			assert.Nil(t, vals[i])
+			continue
+		}
+		assert.Nil(t, err)
+		assert.NotNil(t, vals[i])
+		assert.Equal(t, string(val), string(vals[i]))
+	}
+	// key 1 is expired, and key 2 has an empty value.
+	assert.Nil(t, vals[len(keys)-4])
+	assert.Equal(t, []byte{}, vals[len(keys)-5])
+
+	vals, err = db.getVals(db.strIndex, nil, String)
+	assert.Nil(t, err)
+	assert.Nil(t, vals)
+}
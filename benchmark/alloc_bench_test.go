@@ -0,0 +1,68 @@
+package benchmark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The alloc benchmarks prepare keys and values before the timer starts,
+// so the allocations per op reported are made by godb only.
+
+const allocBenchKeys = 1024
+
+func prepareKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = getKey(i)
+	}
+	return keys
+}
+
+func BenchmarkAllocs_Set(b *testing.B) {
+	keys, value := prepareKeys(allocBenchKeys), getValue128B()
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := roseDB.Set(keys[i%allocBenchKeys], value)
+		assert.Nil(b, err)
+	}
+}
+
+func BenchmarkAllocs_Get(b *testing.B) {
+	keys, value := prepareKeys(allocBenchKeys), getValue128B()
+	for _, key := range keys {
+		err := roseDB.Set(key, value)
+		assert.Nil(b, err)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := roseDB.Get(keys[i%allocBenchKeys])
+		assert.Nil(b, err)
+	}
+}
+
+func BenchmarkAllocs_HGet(b *testing.B) {
+	key, fields, value := []byte("my_hash-alloc"), prepareKeys(allocBenchKeys), getValue128B()
+	for _, field := range fields {
+		err := roseDB.HSet(key, field, value)
+		assert.Nil(b, err)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := roseDB.HGet(key, fields[i%allocBenchKeys])
+		assert.Nil(b, err)
+	}
+}
+
+func BenchmarkAllocs_ZAdd(b *testing.B) {
+	key, members := []byte("my_zset-alloc"), prepareKeys(allocBenchKeys)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := roseDB.ZAdd(key, float64(i), members[i%allocBenchKeys])
+		assert.Nil(b, err)
+	}
+}
@@ -84,3 +84,16 @@ func BenchmarkGoDb_ZAdd(b *testing.B) {
 		assert.Nil(b, err)
 	}
 }
+
+func BenchmarkGoDb_MGet(b *testing.B) {
+	keys := make([][]byte, 1000)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := range keys {
+			keys[j] = getKey(rand.Intn(800000))
+		}
+		_, err := roseDB.MGet(keys)
+		assert.Nil(b, err)
+	}
+}
@@ -0,0 +1,82 @@
+package benchmark
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/herott-ai/godb"
+	"github.com/stretchr/testify/assert"
+)
+
+// The memory benchmarks add a small collection of 3 members per op, and report the heap bytes retained per collection,
+// with packed encoding disabled and enabled.
+
+var smallMembers = [][]byte{[]byte("member-1"), []byte("member-2"), []byte("member-3")}
+
+func BenchmarkMemory_SmallHash(b *testing.B) {
+	benchmarkSmallCollections(b, func(opts *godb.Options, maxPacked int) {
+		opts.HashMaxPacked = maxPacked
+	}, func(db *godb.GoDb, key []byte) error {
+		for _, member := range smallMembers {
+			if err := db.HSet(key, member, member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func BenchmarkMemory_SmallSet(b *testing.B) {
+	benchmarkSmallCollections(b, func(opts *godb.Options, maxPacked int) {
+		opts.SetMaxPacked = maxPacked
+	}, func(db *godb.GoDb, key []byte) error {
+		return db.SAdd(key, smallMembers...)
+	})
+}
+
+func BenchmarkMemory_SmallZSet(b *testing.B) {
+	benchmarkSmallCollections(b, func(opts *godb.Options, maxPacked int) {
+		opts.ZSetMaxPacked = maxPacked
+	}, func(db *godb.GoDb, key []byte) error {
+		for i, member := range smallMembers {
+			if err := db.ZAdd(key, float64(i), member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func benchmarkSmallCollections(b *testing.B, setOpts func(opts *godb.Options, maxPacked int), add func(db *godb.GoDb, key []byte) error) {
+	for _, maxPacked := range []int{0, godb.DefaultOptions("").HashMaxPacked} {
+		b.Run(fmt.Sprintf("max-packed-%d", maxPacked), func(b *testing.B) {
+			path := filepath.Join("/tmp", "godb_bench_mem")
+			opts := godb.DefaultOptions(path)
+			setOpts(&opts, maxPacked)
+			db, err := godb.Open(opts)
+			assert.Nil(b, err)
+			defer func() {
+				_ = db.Close()
+				_ = os.RemoveAll(path)
+			}()
+
+			keys := prepareKeys(b.N)
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := add(db, keys[i])
+				assert.Nil(b, err)
+			}
+			b.StopTimer()
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-bytes/key")
+			runtime.KeepAlive(keys)
+		})
+	}
+}
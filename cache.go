@@ -0,0 +1,86 @@
+package godb
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/herott-ai/godb/ds/lru"
+)
+
+// valueCacheShards number of shards of value cache, must be a power of 2.
+const valueCacheShards = 16
+
+// valueCache caches the values read from log files in KeyOnlyMemMode and DiskIndexMode.
+// It is keyed by the position of entry, an entry in log file is never changed,
+// so there is no need to invalidate a key when updated or rewritten by log file gc, the stale one will be evicted in time.
+type valueCache struct {
+	shards [valueCacheShards]*cacheShard
+	hits   uint64
+	misses uint64
+}
+
+type cacheShard struct {
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+type cacheKey struct {
+	dataType DataType
+	fid      uint32
+	offset   int64
+}
+
+// newValueCacheIfEnabled returns nil if value cache is disabled or values are already in memory.
+func newValueCacheIfEnabled(opts Options) *valueCache {
+	if opts.ValueCacheSize <= 0 || opts.IndexMode == KeyValueMemMode {
+		return nil
+	}
+	return newValueCache(opts.ValueCacheSize)
+}
+
+func newValueCache(size int64) *valueCache {
+	vc := &valueCache{}
+	for i := 0; i < valueCacheShards; i++ {
+		vc.shards[i] = &cacheShard{cache: lru.New(size / valueCacheShards)}
+	}
+	return vc
+}
+
+func (vc *valueCache) get(key cacheKey) ([]byte, bool) {
+	shard := vc.shard(key)
+	shard.mu.Lock()
+	val, ok := shard.cache.Get(key)
+	shard.mu.Unlock()
+	if ok {
+		atomic.AddUint64(&vc.hits, 1)
+	} else {
+		atomic.AddUint64(&vc.misses, 1)
+	}
+	return val, ok
+}
+
+func (vc *valueCache) put(key cacheKey, value []byte) {
+	shard := vc.shard(key)
+	shard.mu.Lock()
+	shard.cache.Put(key, value)
+	shard.mu.Unlock()
+}
+
+// stats returns the number of entries and bytes in cache.
+func (vc *valueCache) stats() (count int, size int64) {
+	for _, shard := range vc.shards {
+		shard.mu.Lock()
+		count += shard.cache.Len()
+		size += shard.cache.Size()
+		shard.mu.Unlock()
+	}
+	return
+}
+
+func (vc *valueCache) shard(key cacheKey) *cacheShard {
+	h := uint64(key.offset)*31 + uint64(key.fid)*17 + uint64(key.dataType)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return vc.shards[h&(valueCacheShards-1)]
+}
@@ -0,0 +1,66 @@
+package godb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoDb_ValueCache(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-value-cache")
+	opts := DefaultOptions(path)
+	opts.ValueCacheSize = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	writeCount := 100
+	for i := 0; i < writeCount; i++ {
+		err := db.Set(GetKey(i), GetValue128B())
+		assert.Nil(t, err)
+	}
+	err = db.HSet([]byte("my_hash"), []byte("field"), []byte("value"))
+	assert.Nil(t, err)
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < writeCount; i++ {
+			_, err := db.Get(GetKey(i))
+			assert.Nil(t, err)
+		}
+		val, err := db.HGet([]byte("my_hash"), []byte("field"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), val)
+	}
+	stats := db.Stats()
+	assert.Equal(t, uint64(writeCount+1), stats.ValueCacheMisses)
+	assert.Equal(t, uint64(writeCount+1), stats.ValueCacheHits)
+	assert.Equal(t, writeCount+1, stats.ValueCacheCount)
+	assert.True(t, stats.ValueCacheBytes > 0)
+
+	// the updated value is at a new position, so it won`t be served from cache.
+	err = db.Set(GetKey(0), []byte("new-value"))
+	assert.Nil(t, err)
+	val, err := db.Get(GetKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new-value"), val)
+	assert.Equal(t, uint64(writeCount+2), db.Stats().ValueCacheMisses)
+}
+
+func TestGoDb_ValueCacheDisabled(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-value-cache")
+	opts := DefaultOptions(path)
+	opts.ValueCacheSize = 1 << 20
+	opts.IndexMode = KeyValueMemMode
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	err = db.Set(GetKey(0), GetValue128B())
+	assert.Nil(t, err)
+	_, err = db.Get(GetKey(0))
+	assert.Nil(t, err)
+	stats := db.Stats()
+	assert.Equal(t, uint64(0), stats.ValueCacheHits+stats.ValueCacheMisses)
+	assert.Equal(t, 0, stats.ValueCacheCount)
+}
@@ -83,8 +83,15 @@ var supportedCommands = map[string]cmdHandler{
 	"zrevrank":  zRevRank,
 
 	// generic commands
-	"type": keyType,
-	"del":  del,
+	"type":     keyType,
+	"del":      del,
+	"exists":   exists,
+	"expire":   expire,
+	"pexpire":  pExpire,
+	"expireat": expireAt,
+	"ttl":      ttl,
+	"pttl":     pTTL,
+	"persist":  persist,
 
 	// connection management commands
 	"select": selectDB,
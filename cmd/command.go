@@ -88,18 +88,144 @@ func del(cli *Client, args [][]byte) (interface{}, error) {
 	if len(args) < 1 {
 		return nil, newWrongNumOfArgsError("del")
 	}
-	for _, key := range args {
-		if err := cli.db.Delete(key); err != nil {
-			return 0, err
+	n, err := cli.db.Del(args...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func keyType(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumOfArgsError("type")
+	}
+	dataType, err := cli.db.Type(args[0])
+	if errors.Is(err, godb.ErrKeyNotFound) {
+		return "none", nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch dataType {
+	case godb.List:
+		return "list", nil
+	case godb.Hash:
+		return "hash", nil
+	case godb.Set:
+		return "set", nil
+	case godb.ZSet:
+		return "zset", nil
+	default:
+		return "string", nil
+	}
+}
+
+func exists(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumOfArgsError("exists")
+	}
+	return redcon.SimpleInt(cli.db.Exists(args...)), nil
+}
+
+func expire(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("expire")
+	}
+	second, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	return expireKeyAt(cli, args[0], time.Now().Add(time.Second*time.Duration(second)))
+}
+
+func pExpire(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("pexpire")
+	}
+	milliseconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	return expireKeyAt(cli, args[0], time.Now().Add(time.Millisecond*time.Duration(milliseconds)))
+}
+
+func expireAt(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("expireat")
+	}
+	timestamp, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	return expireKeyAt(cli, args[0], time.Unix(timestamp, 0))
+}
+
+func expireKeyAt(cli *Client, key []byte, t time.Time) (interface{}, error) {
+	if !t.After(time.Now()) {
+		// the key is deleted at once if the time is not in the future.
+		n, err := cli.db.Del(key)
+		if err != nil {
+			return nil, err
 		}
-		// delete other ds. todo
+		return redcon.SimpleInt(n), nil
+	}
+	err := cli.db.ExpireAt(key, t)
+	if errors.Is(err, godb.ErrKeyNotFound) {
+		return redcon.SimpleInt(0), nil
+	}
+	if err != nil {
+		return nil, err
 	}
 	return redcon.SimpleInt(1), nil
 }
 
-func keyType(cli *Client, args [][]byte) (interface{}, error) {
-	// todo
-	return "string", nil
+func ttl(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumOfArgsError("ttl")
+	}
+	return keyTTL(cli, args[0], time.Second)
+}
+
+func pTTL(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumOfArgsError("pttl")
+	}
+	return keyTTL(cli, args[0], time.Millisecond)
+}
+
+func keyTTL(cli *Client, key []byte, unit time.Duration) (interface{}, error) {
+	t, err := cli.db.ExpireTime(key)
+	if errors.Is(err, godb.ErrKeyNotFound) {
+		return redcon.SimpleInt(-2), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.IsZero() {
+		return redcon.SimpleInt(-1), nil
+	}
+	ttl := time.Until(t)
+	if ttl < 0 {
+		ttl = 0
+	}
+	return redcon.SimpleInt((ttl + unit/2) / unit), nil
+}
+
+func persist(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumOfArgsError("persist")
+	}
+	t, err := cli.db.ExpireTime(args[0])
+	if errors.Is(err, godb.ErrKeyNotFound) || (err == nil && t.IsZero()) {
+		return redcon.SimpleInt(0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = cli.db.Persist(args[0]); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(1), nil
 }
 
 // +-------+--------+----------+------------+-----------+-------+---------+
@@ -113,15 +239,21 @@ func set(cli *Client, args [][]byte) (interface{}, error) {
 
 	var setErr error
 	if len(args) > 2 {
-		ex := strings.ToLower(string(args[2]))
-		if ex != "ex" || len(args) != 4 {
+		var unit time.Duration
+		switch strings.ToLower(string(args[2])) {
+		case "ex":
+			unit = time.Second
+		case "px":
+			unit = time.Millisecond
+		}
+		if unit == 0 || len(args) != 4 {
 			return nil, errSyntax
 		}
-		second, err := strconv.Atoi(string(args[3]))
+		n, err := strconv.ParseInt(string(args[3]), 10, 64)
 		if err != nil {
 			return nil, errSyntax
 		}
-		setErr = cli.db.SetEX(key, value, time.Second*time.Duration(second))
+		setErr = cli.db.SetEX(key, value, unit*time.Duration(n))
 	} else {
 		setErr = cli.db.Set(key, value)
 	}
@@ -3,7 +3,9 @@ package godb
 import (
 	"encoding/binary"
 	"errors"
-	"github.com/herott-ai/godb/ds/art"
+	"fmt"
+	"github.com/herott-ai/godb/ds/bptree"
+	"github.com/herott-ai/godb/ds/index"
 	"github.com/herott-ai/godb/ds/zset"
 	"github.com/herott-ai/godb/filelock"
 	"github.com/herott-ai/godb/logfile"
@@ -45,6 +47,36 @@ var (
 
 	// ErrGCRunning log file gc is running
 	ErrGCRunning = errors.New("log file gc is running, retry later")
+
+	// ErrInMemory operation is not supported in InMemory mode
+	ErrInMemory = errors.New("operation is not supported in in-memory mode")
+
+	// ErrKeyTooLarge the key exceeds the max key size of index
+	ErrKeyTooLarge = errors.New("key is too large for the index")
+
+	// ErrReadOnly the db is opened in read-only mode
+	ErrReadOnly = errors.New("db is opened in read-only mode")
+
+	// ErrInvalidValueSize the size of value is negative
+	ErrInvalidValueSize = errors.New("invalid value size")
+
+	// ErrValueTooLarge the value exceeds the size of a log file
+	ErrValueTooLarge = errors.New("value is too large for a log file")
+
+	// ErrUnsortedInput keys are not added to segment writer in strictly increasing order
+	ErrUnsortedInput = errors.New("keys must be added in strictly increasing order")
+
+	// ErrSegmentType the data type is not supported by segment writer
+	ErrSegmentType = errors.New("data type is not supported by segment writer")
+
+	// ErrInvalidSegment the file is not a segment built by segment writer
+	ErrInvalidSegment = errors.New("invalid segment file")
+
+	// ErrWrongType the key holds a value of another data type
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	// ErrDBFailed db failed to finish a write which can`t be rolled back, it must be reopened to recover
+	ErrDBFailed = errors.New("db failed, reopen it to recover")
 )
 
 const (
@@ -53,25 +85,54 @@ const (
 	initialListSeq   = math.MaxUint32 / 2
 	discardFilePath  = "DISCARD"
 	lockFileName     = "FLOCK"
+
+	// maxPooledEntrySize buffers larger than it are not put back to entryBufPool.
+	maxPooledEntrySize = 64 << 10
 )
 
+// entryBufPool buffers for encoding entries before writing them to log file.
+var entryBufPool = sync.Pool{New: func() interface{} {
+	return new([]byte)
+}}
+
 type (
 	// GoDb a db instance.
 	GoDb struct {
+		memUsage         int64  // approximate memory used by index, updated atomically.
+		evictedKeys      uint64 // number of keys evicted because of MaxMemory.
+		expiredKeys      uint64 // number of expired keys deleted in background.
 		activeLogFiles   map[DataType]*logfile.LogFile
 		archivedLogFiles map[DataType]archivedFiles
 		fidMap           map[DataType][]uint32 // only used at startup, never update even though log files changed.
 		discards         map[DataType]*discard
+		manifest         *manifest
 		opts             Options
 		strIndex         *strIndex  // String indexes(adaptive-radix-tree).
 		listIndex        *listIndex // List indexes.
 		hashIndex        *hashIndex // Hash indexes.
 		setIndex         *setIndex  // Set indexes.
 		zsetIndex        *zsetIndex // Sorted set indexes.
+		valueCache       *valueCache
+		evictSignal      chan struct{}
+		evictStop        chan struct{}              // closed to stop evicting keys in background.
+		evictDone        chan struct{}              // closed when the eviction is stopped.
+		evictMu          sync.Mutex                 // only one eviction runs at a time, in background or before a write.
+		evictPool        evictionPool               // guarded by evictMu.
+		evictCursor      []byte                     // the String key to sample from in the next eviction, guarded by evictMu.
+		evictIdleUntil   int64                      // writes don`t evict until then, since there was no key can be evicted.
+		expires          *expiryIndex               // keys that have expiration time, nil if they are not deleted in background.
+		expireStop       chan struct{}              // closed to stop deleting expired keys in background.
+		expireDone       chan struct{}              // closed when the active expiration is stopped.
+		gcStop           chan struct{}              // closed to stop log files garbage collection.
+		gcDone           chan struct{}              // closed when log files garbage collection is stopped.
+		writeMu          [logFileTypeNum]sync.Mutex // serializes appends to the active log file of each data type.
+		indexLoadTime    time.Duration              // time spent on loading index from log files when opening.
+		dropWg           sync.WaitGroup             // waits for the dropped collections being discarded in background.
 		mu               sync.RWMutex
 		fileLock         *flock.FileLockGuard
 		closed           uint32
 		gcState          int32
+		failed           atomic.Value // the error db failed with, see fail.
 	}
 
 	archivedFiles map[uint32]*logfile.LogFile
@@ -82,84 +143,144 @@ type (
 		entrySize int
 	}
 
+	// strIndex String indexes, writes to the same key are serialized by locks.
+	// mu only guards idxTree, and it is held by the index methods of strIndex.
 	strIndex struct {
 		mu      *sync.RWMutex
-		idxTree *art.AdaptiveRadixTree
+		locks   *keyLocks
+		idxTree index.Index
+		loaded  bool         // the index is loaded from disk in DiskIndexMode, String log files needn`t be read when opening.
+		expires *expiryIndex // nil in DiskIndexMode, since String keys are not in memory.
 	}
 
 	indexNode struct {
-		value     []byte
-		fid       uint32
-		offset    int64
-		entrySize int
-		expiredAt int64
+		accessedAt int64  // last access time in nanoseconds, only recorded when MaxMemory is set.
+		freq       uint32 // logarithmic access counter, only recorded in LFU eviction policies.
+		value      []byte
+		fid        uint32
+		offset     int64
+		entrySize  int
+		expiredAt  int64
+	}
+
+	// collectionIndex index trees of collection keys(List, Hash, Set and ZSet).
+	// mu only guards the trees map, and the tree of a key is guarded by the key lock in locks.
+	collectionIndex struct {
+		mu      *sync.RWMutex
+		locks   *keyLocks
+		trees   map[string]*index.Tree
+		typ     index.Type
+		counter *int64
+		// trees with no more keys than maxPacked are packed, see index.NewPackedTree.
+		maxPacked int
+		// gens generations of keys that have been dropped or expired, guarded by mu like trees, see dropGenRecords.
+		gens     map[string]*keyGen
+		dataType DataType
+		expires  *expiryIndex
+	}
+
+	// keyGen the generation of a collection key, and the position of its latest record, which has the expiration time of key.
+	keyGen struct {
+		gen     uint32
+		node    *indexNode
+		members bool // entries of members have been written in gen, so gen is needed even if the collection is empty.
 	}
 
 	listIndex struct {
-		mu    *sync.RWMutex
-		trees map[string]*art.AdaptiveRadixTree
+		*collectionIndex
 	}
 
 	hashIndex struct {
-		mu    *sync.RWMutex
-		trees map[string]*art.AdaptiveRadixTree
+		*collectionIndex
 	}
 
 	setIndex struct {
-		mu      *sync.RWMutex
-		murhash *util.Murmur128
-		trees   map[string]*art.AdaptiveRadixTree
+		*collectionIndex
 	}
 
 	zsetIndex struct {
-		mu      *sync.RWMutex
+		*collectionIndex
 		indexes *zset.SortedSet
-		murhash *util.Murmur128
-		trees   map[string]*art.AdaptiveRadixTree
 	}
 )
 
-func newStrsIndex() *strIndex {
-	return &strIndex{idxTree: art.NewART(), mu: new(sync.RWMutex)}
+func newStrsIndex(typ index.Type, memCounter *int64, locks *keyLocks) *strIndex {
+	return &strIndex{idxTree: index.NewTree(typ, memCounter), mu: new(sync.RWMutex), locks: locks}
 }
 
-func newListIdx() *listIndex {
-	return &listIndex{trees: make(map[string]*art.AdaptiveRadixTree), mu: new(sync.RWMutex)}
+func newCollectionIndex(typ index.Type, memCounter *int64, locks *keyLocks, maxPacked int) *collectionIndex {
+	return &collectionIndex{
+		mu:        new(sync.RWMutex),
+		locks:     locks,
+		trees:     make(map[string]*index.Tree),
+		gens:      make(map[string]*keyGen),
+		typ:       typ,
+		counter:   memCounter,
+		maxPacked: maxPacked,
+	}
 }
 
-func newHashIdx() *hashIndex {
-	return &hashIndex{trees: make(map[string]*art.AdaptiveRadixTree), mu: new(sync.RWMutex)}
+func newListIdx(typ index.Type, memCounter *int64, locks *keyLocks) *listIndex {
+	return &listIndex{collectionIndex: newCollectionIndex(typ, memCounter, locks, 0)}
 }
 
-func newSetIdx() *setIndex {
-	return &setIndex{
-		murhash: util.NewMurmur128(),
-		trees:   make(map[string]*art.AdaptiveRadixTree),
-		mu:      new(sync.RWMutex),
-	}
+func newHashIdx(typ index.Type, memCounter *int64, locks *keyLocks, maxPacked int) *hashIndex {
+	return &hashIndex{collectionIndex: newCollectionIndex(typ, memCounter, locks, maxPacked)}
 }
 
-func newZSetIdx() *zsetIndex {
+func newSetIdx(typ index.Type, memCounter *int64, locks *keyLocks, maxPacked int) *setIndex {
+	return &setIndex{collectionIndex: newCollectionIndex(typ, memCounter, locks, maxPacked)}
+}
+
+func newZSetIdx(typ index.Type, memCounter *int64, locks *keyLocks, maxPacked int) *zsetIndex {
 	return &zsetIndex{
-		indexes: zset.New(),
-		murhash: util.NewMurmur128(),
-		trees:   make(map[string]*art.AdaptiveRadixTree),
-		mu:      new(sync.RWMutex),
+		collectionIndex: newCollectionIndex(typ, memCounter, locks, maxPacked),
+		indexes:         zset.NewPacked(maxPacked),
+	}
+}
+
+// initIndexes create the indexes of all data types.
+// They share the same key locks, so that a key is locked across data types, see Type.
+func (db *GoDb) initIndexes() {
+	locks := new(keyLocks)
+	db.strIndex = newStrsIndex(db.indexType(String), &db.memUsage, locks)
+	db.listIndex = newListIdx(db.indexType(List), &db.memUsage, locks)
+	db.hashIndex = newHashIdx(db.indexType(Hash), &db.memUsage, locks, db.opts.HashMaxPacked)
+	db.setIndex = newSetIdx(db.indexType(Set), &db.memUsage, locks, db.opts.SetMaxPacked)
+	db.zsetIndex = newZSetIdx(db.indexType(ZSet), &db.memUsage, locks, db.opts.ZSetMaxPacked)
+
+	// the expiry index is shared like the key locks, see handleActiveExpire.
+	db.expires = newExpiryIndex(db.opts)
+	if db.opts.IndexMode != DiskIndexMode {
+		db.strIndex.expires = db.expires
+	}
+	for dataType := List; dataType < logFileTypeNum; dataType++ {
+		c := db.collectionIndexOf(dataType)
+		c.dataType, c.expires = dataType, db.expires
 	}
 }
 
 // Open a godb instance. You must call Close after using it.
 func Open(opts Options) (*GoDb, error) {
-	// create the dir path if not exists.
-	if !util.PathExist(opts.DBPath) {
+	if opts.InMemory {
+		return openInMemory(opts)
+	}
+
+	// create the dir path if not exists, a read-only db must exist already.
+	if opts.ReadOnly {
+		if _, err := os.Stat(opts.DBPath); err != nil {
+			return nil, err
+		}
+	} else if !util.PathExist(opts.DBPath) {
 		if err := os.MkdirAll(opts.DBPath, os.ModePerm); err != nil {
 			return nil, err
 		}
 	}
 
 	// acquire file lock to prevent multiple processes from accessing the same directory.
+	// read-only instances take a shared lock, so they can coexist with each other.
 	lockPath := filepath.Join(opts.DBPath, lockFileName)
-	lockGuard, err := flock.AcquireFileLock(lockPath, false)
+	lockGuard, err := flock.AcquireFileLock(lockPath, opts.ReadOnly)
 	if err != nil {
 		return nil, err
 	}
@@ -169,35 +290,85 @@ func Open(opts Options) (*GoDb, error) {
 		archivedLogFiles: make(map[DataType]archivedFiles),
 		opts:             opts,
 		fileLock:         lockGuard,
-		strIndex:         newStrsIndex(),
-		listIndex:        newListIdx(),
-		hashIndex:        newHashIdx(),
-		setIndex:         newSetIdx(),
-		zsetIndex:        newZSetIdx(),
+		valueCache:       newValueCacheIfEnabled(opts),
+		evictSignal:      make(chan struct{}, 1),
 	}
+	db.initIndexes()
 
 	// init discard file.
 	if err := db.initDiscard(); err != nil {
 		return nil, err
 	}
 
+	// load the manifest, which records the size of log files.
+	m, err := openManifest(opts.DBPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	db.manifest = m
+
 	// load the log files from disk.
 	if err := db.loadLogFiles(); err != nil {
 		return nil, err
 	}
 
+	// open the String index file in DiskIndexMode.
+	if err := db.openDiskIndex(); err != nil {
+		return nil, err
+	}
+
 	// load indexes from log files.
 	if err := db.loadIndexFromLogFiles(); err != nil {
 		return nil, err
 	}
 
+	// handle log files garbage collection, log files are never changed in read-only mode.
+	if !opts.ReadOnly {
+		db.startLogFileGC()
+	}
+	// evict keys if memory usage exceeds MaxMemory, keys can`t be deleted in read-only mode.
+	if opts.MaxMemory > 0 && !opts.ReadOnly {
+		db.startEviction()
+		db.triggerEviction()
+	}
+	// delete expired keys in background, keys can`t be deleted in read-only mode either.
+	db.startActiveExpire()
+	return db, nil
+}
+
+// openInMemory open a godb instance without any disk files.
+func openInMemory(opts Options) (*GoDb, error) {
+	db := &GoDb{
+		activeLogFiles:   make(map[DataType]*logfile.LogFile),
+		archivedLogFiles: make(map[DataType]archivedFiles),
+		opts:             opts,
+		manifest:         newMemManifest(),
+		valueCache:       newValueCacheIfEnabled(opts),
+		evictSignal:      make(chan struct{}, 1),
+	}
+	db.initIndexes()
+	if err := db.initDiscard(); err != nil {
+		return nil, err
+	}
+	for dataType := String; dataType < logFileTypeNum; dataType++ {
+		db.archivedLogFiles[dataType] = make(archivedFiles)
+	}
+
 	// handle log files garbage collection.
-	go db.handleLogFileGC()
+	db.startLogFileGC()
+	if opts.MaxMemory > 0 {
+		db.startEviction()
+	}
+	db.startActiveExpire()
 	return db, nil
 }
 
 // Close db and save relative configs.
 func (db *GoDb) Close() error {
+	// stop evicting keys, deleting expired keys and log files gc first, they write log files.
+	db.stopEviction()
+	db.stopActiveExpire()
+	db.stopLogFileGC()
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -215,7 +386,12 @@ func (db *GoDb) Close() error {
 			_ = file.Close()
 		}
 	}
+	// close the String index file after log files, so the checkpoint never exceeds the synced data.
+	if err := db.closeDiskIndex(); err != nil {
+		logger.Errorf("close disk index err: %v", err)
+	}
 	// close discard channel.
+	db.dropWg.Wait()
 	for _, dis := range db.discards {
 		dis.closeChan()
 	}
@@ -251,6 +427,9 @@ func (db *GoDb) Sync() error {
 // Backup copies the db directory to the given path for backup.
 // It will create the path if it does not exist.
 func (db *GoDb) Backup(path string) error {
+	if db.opts.InMemory {
+		return ErrInMemory
+	}
 	// if log file gc is running, can not backuo the db.
 	if atomic.LoadInt32(&db.gcState) > 0 {
 		return ErrGCRunning
@@ -271,6 +450,9 @@ func (db *GoDb) Backup(path string) error {
 
 // RunLogFileGC run log file garbage collection manually.
 func (db *GoDb) RunLogFileGC(dataType DataType, fid int, gcRatio float64) error {
+	if db.opts.ReadOnly {
+		return ErrReadOnly
+	}
 	if atomic.LoadInt32(&db.gcState) > 0 {
 		return ErrGCRunning
 	}
@@ -281,6 +463,29 @@ func (db *GoDb) isClosed() bool {
 	return atomic.LoadUint32(&db.closed) == 1
 }
 
+// fail make db refuse all writes after an error which leaves log files and index inconsistent and can`t be rolled back.
+// The db must be reopened to recover from log files. It returns the error to be returned to the caller.
+func (db *GoDb) fail(err error) error {
+	err = fmt.Errorf("%w: %v", ErrDBFailed, err)
+	db.failed.Store(err)
+	logger.Errorf("%v", err)
+	return err
+}
+
+// failure returns the error db failed with, nil if it has not failed.
+// The db fails too once the String index on disk failed with an io error, it will be rebuilt on next opening.
+func (db *GoDb) failure() error {
+	if err, _ := db.failed.Load().(error); err != nil {
+		return err
+	}
+	if db.strIndex != nil {
+		if err := db.strIndex.Err(); err != nil {
+			return db.fail(err)
+		}
+	}
+	return nil
+}
+
 func (db *GoDb) getActiveLogFile(dataType DataType) *logfile.LogFile {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
@@ -297,63 +502,136 @@ func (db *GoDb) getArchivedLogFile(dataType DataType, fid uint32) *logfile.LogFi
 	return lf
 }
 
+// readLogEntry read the entry in log file fid at offset.
+// The log file won`t be sealed or deleted by others while reading.
+func (db *GoDb) readLogEntry(dataType DataType, fid uint32, offset int64) (*logfile.LogEntry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	logFile := db.logFile(dataType, fid)
+	if logFile == nil {
+		return nil, ErrLogFileNotFound
+	}
+	ent, _, err := logFile.ReadLogEntry(offset)
+	return ent, err
+}
+
+// logFile returns the active or archived log file fid, db.mu must be held.
+func (db *GoDb) logFile(dataType DataType, fid uint32) *logfile.LogFile {
+	logFile := db.activeLogFiles[dataType]
+	if logFile == nil || logFile.Fid != fid {
+		logFile = db.archivedLogFiles[dataType][fid]
+	}
+	return logFile
+}
+
 // write entry to log file.
+// It is safe for concurrent use, entries are encoded concurrently, and appended to the active log file one by one.
 func (db *GoDb) writeLogEntry(ent *logfile.LogEntry, dataType DataType) (*valuePos, error) {
-	if err := db.initLogFile(dataType); err != nil {
+	if db.opts.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if err := db.failure(); err != nil {
 		return nil, err
-	} //if not exist then create,otherwise open
+	}
+	if dataType == String && len(ent.Key) > bptree.MaxKeySize && db.strIndexOnDisk() {
+		return nil, ErrKeyTooLarge
+	}
+	db.evictBeforeWrite(ent.Type)
+	bufp := entryBufPool.Get().(*[]byte)
+	entBuf := logfile.AppendEntry((*bufp)[:0], ent)
+	esize := len(entBuf)
+	defer func() {
+		if cap(entBuf) <= maxPooledEntrySize {
+			*bufp = entBuf
+			entryBufPool.Put(bufp)
+		}
+	}()
 
-	activeLogFile := db.getActiveLogFile(dataType) // from db.initLogFile(dataType)
-	if activeLogFile == nil {
-		return nil, ErrLogFileNotFound
+	db.writeMu[dataType].Lock()
+	defer db.writeMu[dataType].Unlock()
+	activeLogFile, err := db.activeLogFileFor(dataType, int64(esize))
+	if err != nil {
+		return nil, err
 	}
 
-	opts := db.opts
-	entBuf, esize := logfile.EncodeEntry(ent)
-	if activeLogFile.WriteAt+int64(esize) > opts.LogFileSizeThreshold {
+	writeAt := atomic.LoadInt64(&activeLogFile.WriteAt)
+	// write entry and sync(if necessary)
+	if err := activeLogFile.Write(entBuf); err != nil {
+		return nil, err
+	}
+	if db.opts.Sync {
 		if err := activeLogFile.Sync(); err != nil {
 			return nil, err
 		}
+	}
 
-		db.mu.Lock()
-		// save the old log file in archived files.
-		activeFileId := activeLogFile.Fid
-		if db.archivedLogFiles[dataType] == nil {
-			// not exist yet,so make the first tt
-			db.archivedLogFiles[dataType] = make(archivedFiles)
-		}
-		db.archivedLogFiles[dataType][activeFileId] = activeLogFile // archive tt
-
-		// open a new log file.
-		ftype, iotype := logfile.FileType(dataType), logfile.IOType(opts.IoType)
-		
-		lf, err := logfile.OpenLogFile(opts.DBPath, activeFileId+1, opts.LogFileSizeThreshold, ftype, iotype)
-		if err != nil {
-			db.mu.Unlock()
-			return nil, err
-		}
+	// record valuePos tt
+	return &valuePos{fid: activeLogFile.Fid, offset: writeAt}, nil
+}
 
-		//to see
-		db.discards[dataType].setTotal(lf.Fid, uint32(opts.LogFileSizeThreshold))
+// writeLogEntryFrom write entry to log file, whose value is streamed from r and must be vSize bytes.
+// Other writes of the data type wait until the value is written.
+func (db *GoDb) writeLogEntryFrom(ent *logfile.LogEntry, r io.Reader, vSize int64, dataType DataType) (*valuePos, error) {
+	if db.opts.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if err := db.failure(); err != nil {
+		return nil, err
+	}
+	if dataType == String && len(ent.Key) > bptree.MaxKeySize && db.strIndexOnDisk() {
+		return nil, ErrKeyTooLarge
+	}
+	db.evictBeforeWrite(ent.Type)
+	esize := int64(logfile.EncodedSize(ent)) + vSize
 
-		db.activeLogFiles[dataType] = lf
-		activeLogFile = lf
-		db.mu.Unlock()
+	db.writeMu[dataType].Lock()
+	defer db.writeMu[dataType].Unlock()
+	activeLogFile, err := db.activeLogFileFor(dataType, esize)
+	if err != nil {
+		return nil, err
 	}
 
 	writeAt := atomic.LoadInt64(&activeLogFile.WriteAt)
-	// write entry and sync(if necessary)
-	if err := activeLogFile.Write(entBuf); err != nil {
+	size, err := activeLogFile.WriteFrom(ent, r, vSize)
+	if err != nil {
 		return nil, err
 	}
-	if opts.Sync {
+	if db.opts.Sync {
 		if err := activeLogFile.Sync(); err != nil {
 			return nil, err
 		}
 	}
+	return &valuePos{fid: activeLogFile.Fid, offset: writeAt, entrySize: int(size)}, nil
+}
 
-	// record valuePos tt
-	return &valuePos{fid: activeLogFile.Fid, offset: writeAt}, nil
+// activeLogFileFor returns the active log file to append an entry of esize bytes,
+// the active log file is archived and a new one is opened if there is no enough space left.
+// db.writeMu of the data type must be held.
+func (db *GoDb) activeLogFileFor(dataType DataType, esize int64) (*logfile.LogFile, error) {
+	if err := db.initLogFile(dataType); err != nil {
+		return nil, err
+	} //if not exist then create,otherwise open
+
+	activeLogFile := db.getActiveLogFile(dataType) // from db.initLogFile(dataType)
+	if activeLogFile == nil {
+		return nil, ErrLogFileNotFound
+	}
+
+	if activeLogFile.WriteAt+esize > activeLogFile.Size {
+		if err := activeLogFile.Sync(); err != nil {
+			return nil, err
+		}
+
+		db.mu.Lock()
+		lf, err := db.rotateLogFile(dataType, activeLogFile)
+		db.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		activeLogFile = lf
+	}
+
+	return activeLogFile, nil
 }
 
 func (db *GoDb) loadLogFiles() error {
@@ -366,6 +644,13 @@ func (db *GoDb) loadLogFiles() error {
 
 	fidMap := make(map[DataType][]uint32)
 	for _, file := range fileInfos {
+		// segments left by an interrupted Ingest, the committed ones are renamed to log files.
+		if strings.HasPrefix(file.Name(), ingestFilePrefix) && !db.opts.ReadOnly {
+			if dataType, fid, ok := db.recoverIngested(file.Name()); ok {
+				fidMap[dataType] = append(fidMap[dataType], fid)
+			}
+			continue
+		}
 		if strings.HasPrefix(file.Name(), logfile.FilePrefix) {
 			splitNames := strings.Split(file.Name(), ".")
 			fid, err := strconv.Atoi(splitNames[2])
@@ -377,6 +662,9 @@ func (db *GoDb) loadLogFiles() error {
 		}
 	}
 	db.fidMap = fidMap
+	if err := db.manifest.retainSegments(fidMap); err != nil {
+		return err
+	}
 
 	for dataType, fids := range fidMap {
 		if db.archivedLogFiles[dataType] == nil {
@@ -392,11 +680,19 @@ func (db *GoDb) loadLogFiles() error {
 
 		opts := db.opts
 		for i, fid := range fids {
-			ftype, iotype := logfile.FileType(dataType), logfile.IOType(opts.IoType)
-			lf, err := logfile.OpenLogFile(opts.DBPath, fid, opts.LogFileSizeThreshold, ftype, iotype)
+			fsize, err := db.logFileSize(dataType, fid)
+			if err != nil {
+				return err
+			}
+			ftype, iotype := logfile.FileType(dataType), db.logFileIOType()
+			if i < len(fids)-1 {
+				iotype = db.archivedLogFileIOType()
+			}
+			lf, err := logfile.OpenLogFile(opts.DBPath, fid, fsize, ftype, iotype)
 			if err != nil {
 				return err
 			}
+			lf.Version = db.manifest.segmentVersion(dataType, fid)
 			// latest one is active log file.
 			if i == len(fids)-1 {
 				db.activeLogFiles[dataType] = lf
@@ -404,30 +700,185 @@ func (db *GoDb) loadLogFiles() error {
 				db.archivedLogFiles[dataType][fid] = lf
 			}
 		}
+		if err := db.upgradeActiveLogFile(dataType); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// upgradeActiveLogFile archive the active log file if it is in an older format version,
+// and open a new one in the current version, since entries of different versions can`t be written to the same file.
+// db.mu must be held.
+func (db *GoDb) upgradeActiveLogFile(dataType DataType) error {
+	active := db.activeLogFiles[dataType]
+	if db.opts.ReadOnly || active == nil || active.Version >= logfile.FormatVersion {
+		return nil
+	}
+	lf, err := db.rotateLogFile(dataType, active)
+	if err != nil {
+		return err
+	}
+	db.fidMap[dataType] = append(db.fidMap[dataType], lf.Fid)
+	return nil
+}
+
+// rotateLogFile save the active log file in archived files, and open a new one as the active log file.
+// The new one is opened first, so the active log file is kept if anything fails. db.mu must be held.
+func (db *GoDb) rotateLogFile(dataType DataType, active *logfile.LogFile) (*logfile.LogFile, error) {
+	// new log files always use the latest threshold.
+	lf, err := db.openNewLogFile(dataType, active.Fid+1)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := db.sealLogFile(dataType, active)
+	if err != nil {
+		_ = lf.Close()
+		return nil, err
+	}
+	if db.archivedLogFiles[dataType] == nil {
+		db.archivedLogFiles[dataType] = make(archivedFiles)
+	}
+	db.archivedLogFiles[dataType][active.Fid] = archived
+	db.activeLogFiles[dataType] = lf
+	db.closeSealedLogFile(dataType, active, archived)
+	return lf, nil
+}
+
 func (db *GoDb) initLogFile(dataType DataType) error {
+	if db.getActiveLogFile(dataType) != nil {
+		return nil
+	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	if db.activeLogFiles[dataType] != nil { // it must be nil cause we do not init
 		return nil
 	}
-	opts := db.opts
-	ftype, iotype := logfile.FileType(dataType), logfile.IOType(opts.IoType)
-	lf, err := logfile.OpenLogFile(opts.DBPath, logfile.InitialLogFileId, opts.LogFileSizeThreshold, ftype, iotype)
+	lf, err := db.openNewLogFile(dataType, logfile.InitialLogFileId)
 	if err != nil {
 		return err
 	}
-
-	db.discards[dataType].setTotal(lf.Fid, uint32(opts.LogFileSizeThreshold))
 	db.activeLogFiles[dataType] = lf
 	return nil
 }
 
+// openNewLogFile create a new log file with the current LogFileSizeThreshold, and record it in manifest.
+func (db *GoDb) openNewLogFile(dataType DataType, fid uint32) (*logfile.LogFile, error) {
+	opts := db.opts
+	ftype, iotype := logfile.FileType(dataType), db.logFileIOType()
+	lf, err := logfile.OpenLogFile(opts.DBPath, fid, opts.LogFileSizeThreshold, ftype, iotype)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.manifest.addSegment(dataType, fid, lf.Size); err != nil {
+		_ = lf.Close()
+		return nil, err
+	}
+	db.discards[dataType].setTotal(lf.Fid, uint32(lf.Size))
+	return lf, nil
+}
+
+// logFileIOType returns the io type of active log files.
+func (db *GoDb) logFileIOType() logfile.IOType {
+	if db.opts.InMemory {
+		return logfile.Memory
+	}
+	if db.opts.ReadOnly {
+		return logfile.MMapReadOnly
+	}
+	switch db.opts.IoType {
+	case MMap:
+		return logfile.MMap
+	case DirectIO:
+		return logfile.DirectIO
+	default:
+		return logfile.FileIO
+	}
+}
+
+// indexType returns the in-memory index type of the data type.
+func (db *GoDb) indexType(dataType DataType) index.Type {
+	switch db.opts.IndexTypes[dataType] {
+	case BTreeIndex:
+		return index.BTree
+	case HashMapIndex:
+		return index.HashMap
+	default:
+		return index.ART
+	}
+}
+
+// archivedLogFileIOType returns the io type of archived log files, they are never written again.
+func (db *GoDb) archivedLogFileIOType() logfile.IOType {
+	if !db.opts.InMemory && db.opts.IoType == Hybrid {
+		return logfile.MMapReadOnly
+	}
+	return db.logFileIOType()
+}
+
+// sealLogFile reopen a full active log file with the io type of archived log files if they are different.
+// The old log file must have been synced, and it is kept open, so it is still usable until it is replaced by the new one,
+// then it is closed by closeSealedLogFile.
+func (db *GoDb) sealLogFile(dataType DataType, lf *logfile.LogFile) (*logfile.LogFile, error) {
+	iotype := db.archivedLogFileIOType()
+	if iotype == db.logFileIOType() {
+		return lf, nil
+	}
+	archived, err := logfile.OpenLogFile(db.opts.DBPath, lf.Fid, lf.Size, logfile.FileType(dataType), iotype)
+	if err != nil {
+		return nil, err
+	}
+	archived.WriteAt = lf.WriteAt
+	archived.Version = lf.Version
+	return archived, nil
+}
+
+// closeSealedLogFile close the old log file replaced by the one returned by sealLogFile.
+func (db *GoDb) closeSealedLogFile(dataType DataType, lf, archived *logfile.LogFile) {
+	if lf == archived {
+		return
+	}
+	// the content is synced and readable from the new one, the old one is not used anymore.
+	if err := lf.Close(); err != nil {
+		logger.Errorf("close sealed log file err, dataType: [%v], fid: [%d], err: [%v]", dataType, lf.Fid, err)
+	}
+}
+
+// logFileSize returns the size of an existing log file.
+// Log files created by older versions have no record in manifest,
+// their sizes on disk will be used and recorded.
+func (db *GoDb) logFileSize(dataType DataType, fid uint32) (int64, error) {
+	if size, ok := db.manifest.segmentSize(dataType, fid); ok {
+		return size, nil
+	}
+	size := db.opts.LogFileSizeThreshold
+	fname := logfile.FileNamesMap[logfile.FileType(dataType)] + fmt.Sprintf("%09d", fid)
+	if stat, err := os.Stat(filepath.Join(db.opts.DBPath, fname)); err == nil && stat.Size() > 0 {
+		size = stat.Size()
+	}
+	seg := segmentMeta{Type: dataType, Fid: fid, Size: size, Version: legacyFormatVersion}
+	if err := db.manifest.addSegments([]segmentMeta{seg}); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 func (db *GoDb) initDiscard() error {
+	// discard files are only used by log file gc, there is no need to load them in read-only mode.
+	if db.opts.InMemory || db.opts.ReadOnly {
+		discards := make(map[DataType]*discard)
+		for i := String; i < logFileTypeNum; i++ {
+			dis, err := newMemDiscard(db.opts.DiscardBufferSize)
+			if err != nil {
+				return err
+			}
+			discards[i] = dis
+		}
+		db.discards = discards
+		return nil
+	}
+
 	discardPath := filepath.Join(db.opts.DBPath, discardFilePath)
 	if !util.PathExist(discardPath) {
 		if err := os.MkdirAll(discardPath, os.ModePerm); err != nil {
@@ -448,20 +899,19 @@ func (db *GoDb) initDiscard() error {
 	return nil
 }
 
+// encodeKey encode key and subKey into one buffer, it allocates only once.
 func (db *GoDb) encodeKey(key, subKey []byte) []byte {
-	header := make([]byte, encodeHeaderSize)
+	return encodeKey(key, subKey)
+}
+
+func encodeKey(key, subKey []byte) []byte {
+	buf := make([]byte, encodeHeaderSize+len(key)+len(subKey))
 	var index int
-	index += binary.PutVarint(header[index:], int64(len(key)))
-	index += binary.PutVarint(header[index:], int64(len(subKey)))
-	length := len(key) + len(subKey)
-	if length > 0 {
-		buf := make([]byte, length+index)
-		copy(buf[:index], header[:index])
-		copy(buf[index:index+len(key)], key)
-		copy(buf[index+len(key):], subKey)
-		return buf
-	}
-	return header[:index]
+	index += binary.PutVarint(buf[index:], int64(len(key)))
+	index += binary.PutVarint(buf[index:], int64(len(subKey)))
+	index += copy(buf[index:], key)
+	index += copy(buf[index:], subKey)
+	return buf[:index]
 }
 
 func (db *GoDb) decodeKey(key []byte) ([]byte, []byte) {
@@ -489,13 +939,34 @@ func (db *GoDb) sendDiscard(oldVal interface{}, updated bool, dataType DataType)
 	}
 }
 
-func (db *GoDb) handleLogFileGC() {
+// startLogFileGC start log files garbage collection in background, see Options.LogFileGCInterval.
+func (db *GoDb) startLogFileGC() {
 	if db.opts.LogFileGCInterval <= 0 {
 		return
 	}
+	db.gcStop = make(chan struct{})
+	db.gcDone = make(chan struct{})
+	go db.handleLogFileGC()
+}
+
+// stopLogFileGC stop log files garbage collection in background, and wait for the running round.
+func (db *GoDb) stopLogFileGC() {
+	if db.gcStop == nil {
+		return
+	}
+	select {
+	case <-db.gcStop:
+	default:
+		close(db.gcStop)
+	}
+	<-db.gcDone
+}
 
+func (db *GoDb) handleLogFileGC() {
+	defer close(db.gcDone)
 	quitSig := make(chan os.Signal, 1)
 	signal.Notify(quitSig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(quitSig)
 	ticker := time.NewTicker(db.opts.LogFileGCInterval)
 	defer ticker.Stop()
 	for {
@@ -505,16 +976,23 @@ func (db *GoDb) handleLogFileGC() {
 				logger.Warn("log file gc is running, skip it")
 				break
 			}
+			// wait for all data types, so the round is finished when gc is stopped.
+			var wg sync.WaitGroup
 			for dType := String; dType < logFileTypeNum; dType++ {
+				wg.Add(1)
 				go func(dataType DataType) {
+					defer wg.Done()
 					err := db.doRunGC(dataType, -1, db.opts.LogFileGCRatio)
 					if err != nil {
 						logger.Errorf("log file gc err, dataType: [%v], err: [%v]", dataType, err)
 					}
 				}(dType)
 			}
+			wg.Wait()
 		case <-quitSig:
 			return
+		case <-db.gcStop:
+			return
 		}
 	}
 }
@@ -524,11 +1002,11 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 	defer atomic.AddInt32(&db.gcState, -1)
 
 	maybeRewriteStrs := func(fid uint32, offset int64, ent *logfile.LogEntry) error {
-		db.strIndex.mu.Lock()
-		defer db.strIndex.mu.Unlock()
-		indexVal := db.strIndex.idxTree.Get(ent.Key)
+		db.strIndex.locks.lock(ent.Key)
+		defer db.strIndex.locks.unlock(ent.Key)
+		indexVal := db.strIndex.Get(ent.Key)
 		if indexVal == nil {
-			return nil
+			return db.indexErr(db.strIndex)
 		}
 
 		node, _ := indexVal.(*indexNode)
@@ -539,7 +1017,7 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 				return err
 			}
 			// update index
-			if err = db.updateIndexTree(db.strIndex.idxTree, ent, valuePos, false, String); err != nil {
+			if err = db.updateIndexTree(db.strIndex, ent, valuePos, false, String); err != nil {
 				return err
 			}
 		}
@@ -547,16 +1025,16 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 	}
 
 	maybeRewriteList := func(fid uint32, offset int64, ent *logfile.LogEntry) error {
-		db.listIndex.mu.Lock()
-		defer db.listIndex.mu.Unlock()
 		var listKey = ent.Key
 		if ent.Type != logfile.TypeListMeta {
 			listKey, _ = db.decodeListKey(ent.Key)
 		}
-		if db.listIndex.trees[string(listKey)] == nil {
+		db.listIndex.locks.lock(listKey)
+		defer db.listIndex.locks.unlock(listKey)
+		idxTree := db.listIndex.tree(listKey)
+		if idxTree == nil {
 			return nil
 		}
-		idxTree := db.listIndex.trees[string(listKey)]
 		indexVal := idxTree.Get(ent.Key)
 		if indexVal == nil {
 			return nil
@@ -564,7 +1042,7 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 
 		node, _ := indexVal.(*indexNode)
 		if node != nil && node.fid == fid && node.offset == offset {
-			valuePos, err := db.writeLogEntry(ent, List)
+			valuePos, err := db.writeMember(List, listKey, ent)
 			if err != nil {
 				return err
 			}
@@ -576,13 +1054,13 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 	}
 
 	maybeRewriteHash := func(fid uint32, offset int64, ent *logfile.LogEntry) error {
-		db.hashIndex.mu.Lock()
-		defer db.hashIndex.mu.Unlock()
 		key, field := db.decodeKey(ent.Key)
-		if db.hashIndex.trees[string(key)] == nil {
+		db.hashIndex.locks.lock(key)
+		defer db.hashIndex.locks.unlock(key)
+		idxTree := db.hashIndex.tree(key)
+		if idxTree == nil {
 			return nil
 		}
-		idxTree := db.hashIndex.trees[string(key)]
 		indexVal := idxTree.Get(field)
 		if indexVal == nil {
 			return nil
@@ -591,14 +1069,12 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 		node, _ := indexVal.(*indexNode)
 		if node != nil && node.fid == fid && node.offset == offset {
 			// rewrite entry
-			valuePos, err := db.writeLogEntry(ent, Hash)
+			valuePos, err := db.writeMember(Hash, key, ent)
 			if err != nil {
 				return err
 			}
 			// update index
-			entry := &logfile.LogEntry{Key: field, Value: ent.Value}
-			_, size := logfile.EncodeEntry(ent)
-			valuePos.entrySize = size
+			entry := &logfile.LogEntry{Key: field, Value: ent.Value, ExpiredAt: ent.ExpiredAt}
 			if err = db.updateIndexTree(idxTree, entry, valuePos, false, Hash); err != nil {
 				return err
 			}
@@ -607,17 +1083,13 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 	}
 
 	maybeRewriteSets := func(fid uint32, offset int64, ent *logfile.LogEntry) error {
-		db.setIndex.mu.Lock()
-		defer db.setIndex.mu.Unlock()
-		if db.setIndex.trees[string(ent.Key)] == nil {
+		db.setIndex.locks.lock(ent.Key)
+		defer db.setIndex.locks.unlock(ent.Key)
+		idxTree := db.setIndex.tree(ent.Key)
+		if idxTree == nil {
 			return nil
 		}
-		idxTree := db.setIndex.trees[string(ent.Key)]
-		if err := db.setIndex.murhash.Write(ent.Value); err != nil {
-			logger.Fatalf("fail to write murmur hash: %v", err)
-		}
-		sum := db.setIndex.murhash.EncodeSum128()
-		db.setIndex.murhash.Reset()
+		sum := util.Sum128(ent.Value)
 
 		indexVal := idxTree.Get(sum)
 		if indexVal == nil {
@@ -626,14 +1098,12 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 		node, _ := indexVal.(*indexNode)
 		if node != nil && node.fid == fid && node.offset == offset {
 			// rewrite entry
-			valuePos, err := db.writeLogEntry(ent, Set)
+			valuePos, err := db.writeMember(Set, ent.Key, ent)
 			if err != nil {
 				return err
 			}
 			// update index
 			entry := &logfile.LogEntry{Key: sum, Value: ent.Value}
-			_, size := logfile.EncodeEntry(ent)
-			valuePos.entrySize = size
 			if err = db.updateIndexTree(idxTree, entry, valuePos, false, Set); err != nil {
 				return err
 			}
@@ -642,18 +1112,14 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 	}
 
 	maybeRewriteZSet := func(fid uint32, offset int64, ent *logfile.LogEntry) error {
-		db.zsetIndex.mu.Lock()
-		defer db.zsetIndex.mu.Unlock()
 		key, _ := db.decodeKey(ent.Key)
-		if db.zsetIndex.trees[string(key)] == nil {
+		db.zsetIndex.locks.lock(key)
+		defer db.zsetIndex.locks.unlock(key)
+		idxTree := db.zsetIndex.tree(key)
+		if idxTree == nil {
 			return nil
 		}
-		idxTree := db.zsetIndex.trees[string(key)]
-		if err := db.zsetIndex.murhash.Write(ent.Value); err != nil {
-			logger.Fatalf("fail to write murmur hash: %v", err)
-		}
-		sum := db.zsetIndex.murhash.EncodeSum128()
-		db.zsetIndex.murhash.Reset()
+		sum := util.Sum128(ent.Value)
 
 		indexVal := idxTree.Get(sum)
 		if indexVal == nil {
@@ -661,13 +1127,11 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 		}
 		node, _ := indexVal.(*indexNode)
 		if node != nil && node.fid == fid && node.offset == offset {
-			valuePos, err := db.writeLogEntry(ent, ZSet)
+			valuePos, err := db.writeMember(ZSet, key, ent)
 			if err != nil {
 				return err
 			}
 			entry := &logfile.LogEntry{Key: sum, Value: ent.Value}
-			_, size := logfile.EncodeEntry(ent)
-			valuePos.entrySize = size
 			if err = db.updateIndexTree(idxTree, entry, valuePos, false, ZSet); err != nil {
 				return err
 			}
@@ -675,6 +1139,31 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 		return nil
 	}
 
+	// the latest record of the current generation of a collection is kept even if it is expired, the older ones are discarded.
+	// It is not needed if nothing else of the collection is left once the log file is deleted, see dropGenRecords.
+	var droppedGens map[string]*indexNode
+	maybeRewriteGen := func(fid uint32, offset int64, ent *logfile.LogEntry, gen uint32, oldest bool) error {
+		c := db.collectionIndexOf(dataType)
+		c.locks.lock(ent.Key)
+		defer c.locks.unlock(ent.Key)
+		cur, node := c.genNode(ent.Key)
+		if cur != gen || node == nil || node.fid != fid || node.offset != offset {
+			return nil
+		}
+		if oldest && c.genDroppable(ent.Key, node) {
+			droppedGens[string(ent.Key)] = node
+			return nil
+		}
+		genEnt := &logfile.LogEntry{Key: appendGen(ent.Key, gen), Type: logfile.TypeGenMeta, ExpiredAt: ent.ExpiredAt}
+		valuePos, err := db.writeLogEntry(genEnt, dataType)
+		if err != nil {
+			return err
+		}
+		valuePos.entrySize = logfile.EncodedSize(genEnt)
+		c.setGen(ent.Key, gen, db.newIndexNode(genEnt, valuePos, valuePos.entrySize))
+		return nil
+	}
+
 	activeLogFile := db.getActiveLogFile(dataType)
 	if activeLogFile == nil {
 		return nil
@@ -697,6 +1186,9 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 		}
 
 		var offset int64
+		withGen := db.hasGen(dataType, fid)
+		oldest := withGen && db.isOldestLogFile(dataType, fid)
+		droppedGens = make(map[string]*indexNode)
 		for {
 			ent, size, err := archivedFile.ReadLogEntry(offset)
 			if err != nil {
@@ -710,7 +1202,17 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 			if ent.Type == logfile.TypeDelete {
 				continue
 			}
-			ts := time.Now().Unix()
+			var gen uint32
+			if withGen {
+				ent.Key, gen, _ = splitGen(ent.Key)
+			}
+			if ent.Type == logfile.TypeGenMeta {
+				if err := maybeRewriteGen(archivedFile.Fid, off, ent, gen, oldest); err != nil {
+					return err
+				}
+				continue
+			}
+			ts := time.Now().UnixMilli()
 			if ent.ExpiredAt != 0 && ent.ExpiredAt <= ts {
 				continue
 			}
@@ -736,10 +1238,13 @@ func (db *GoDb) doRunGC(dataType DataType, specifiedFid int, gcRatio float64) er
 		db.mu.Lock()
 		delete(db.archivedLogFiles[dataType], fid)
 		_ = archivedFile.Delete()
-		
+		if err := db.manifest.removeSegment(dataType, fid); err != nil {
+			logger.Errorf("remove log file from manifest err: %v", err)
+		}
 		db.mu.Unlock()
 		// clear discard state.
 		db.discards[dataType].clear(fid)
+		db.dropGenRecords(dataType, droppedGens)
 	}
 	return nil
 }
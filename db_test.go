@@ -3,12 +3,17 @@ package godb
 import (
 	"bytes"
 	"fmt"
+	"github.com/herott-ai/godb/ioselector"
+	"github.com/herott-ai/godb/logfile"
 	"github.com/herott-ai/godb/logger"
 	"github.com/stretchr/testify/assert"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -31,6 +36,578 @@ func TestOpen(t *testing.T) {
 		assert.Nil(t, err)
 		assert.NotNil(t, db)
 	})
+
+	t.Run("mmap-reopen", func(t *testing.T) {
+		opts := DefaultOptions(path)
+		opts.IoType = MMap
+		opts.LogFileSizeThreshold = 4 << 20
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		writeCount := 30000
+		for i := 0; i < writeCount; i++ {
+			err := db.Set(GetKey(i), GetValue128B())
+			assert.Nil(t, err)
+		}
+		_ = db.Close()
+
+		// log files are truncated to the written size when closed.
+		active := db.getActiveLogFile(String)
+		stat, err := os.Stat(filepath.Join(path, logfile.FileNamesMap[logfile.Strs]+fmt.Sprintf("%09d", active.Fid)))
+		assert.Nil(t, err)
+		assert.Equal(t, active.WriteAt, stat.Size())
+
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		defer destroyDB(db)
+		for i := 0; i < writeCount; i++ {
+			val, err := db.Get(GetKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, 128, len(val))
+		}
+		err = db.Set(GetKey(writeCount), GetValue128B())
+		assert.Nil(t, err)
+	})
+
+	t.Run("directio", func(t *testing.T) {
+		opts := DefaultOptions(path)
+		opts.IoType = DirectIO
+		opts.LogFileSizeThreshold = 1 << 20
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		writeCount := 10000
+		for i := 0; i < writeCount; i++ {
+			err := db.Set(GetKey(i), GetValue128B())
+			assert.Nil(t, err)
+		}
+		_ = db.Close()
+
+		// reopen and load index from the log files.
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		defer destroyDB(db)
+		for i := 0; i < writeCount; i++ {
+			val, err := db.Get(GetKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, 128, len(val))
+		}
+	})
+}
+
+func TestOpen_InMemory(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-in-memory")
+	opts := DefaultOptions(path)
+	opts.InMemory = true
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	writeCount := 20000
+	for i := 0; i < writeCount; i++ {
+		err := db.Set(GetKey(i), GetValue128B())
+		assert.Nil(t, err)
+	}
+	err = db.HSet([]byte("my_hash"), []byte("field"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.LPush([]byte("my_list"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.SAdd([]byte("my_set"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.ZAdd([]byte("my_zset"), 10, []byte("value"))
+	assert.Nil(t, err)
+
+	// log files rotated in memory.
+	assert.True(t, len(db.archivedLogFiles[String]) > 0)
+	for i := 0; i < writeCount; i++ {
+		val, err := db.Get(GetKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, 128, len(val))
+	}
+	val, err := db.HGet([]byte("my_hash"), []byte("field"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), val)
+	assert.Equal(t, 1, db.LLen([]byte("my_list")))
+	assert.True(t, db.SIsMember([]byte("my_set"), []byte("value")))
+	ok, score := db.ZScore([]byte("my_zset"), []byte("value"))
+	assert.True(t, ok)
+	assert.Equal(t, float64(10), score)
+
+	// gc works in memory too.
+	for i := 0; i < writeCount/2; i++ {
+		err := db.Delete(GetKey(i))
+		assert.Nil(t, err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	assert.NotNil(t, db.archivedLogFiles[String][0])
+	err = db.RunLogFileGC(String, -1, 0.1)
+	assert.Nil(t, err)
+	// the first log file only holds deleted keys, it is reclaimed.
+	assert.Nil(t, db.archivedLogFiles[String][0])
+	for i := writeCount / 2; i < writeCount; i++ {
+		_, err := db.Get(GetKey(i))
+		assert.Nil(t, err)
+	}
+
+	// nothing is written to disk.
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, ErrInMemory, db.Backup(filepath.Join("/tmp", "godb-backup")))
+}
+
+func TestOpen_Hybrid(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-hybrid")
+	opts := DefaultOptions(path)
+	opts.IoType = Hybrid
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	writeCount := 20000
+	for i := 0; i < writeCount; i++ {
+		err := db.Set(GetKey(i), GetValue128B())
+		assert.Nil(t, err)
+	}
+	// the active log file is written by file io, and the archived ones are mapped read-only.
+	_, ok := db.getActiveLogFile(String).IoSelector.(*ioselector.FileIOSelector)
+	assert.True(t, ok)
+	assert.True(t, len(db.archivedLogFiles[String]) > 0)
+	for _, lf := range db.archivedLogFiles[String] {
+		_, ok := lf.IoSelector.(*ioselector.MMapSelector)
+		assert.True(t, ok)
+	}
+	for i := 0; i < writeCount; i++ {
+		val, err := db.Get(GetKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, 128, len(val))
+	}
+	_ = db.Close()
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	for _, lf := range db.archivedLogFiles[String] {
+		_, ok := lf.IoSelector.(*ioselector.MMapSelector)
+		assert.True(t, ok)
+	}
+	for i := 0; i < writeCount; i++ {
+		val, err := db.Get(GetKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, 128, len(val))
+	}
+
+	// archived log files can be rewritten and deleted by gc.
+	for i := 0; i < writeCount/2; i++ {
+		err := db.Delete(GetKey(i))
+		assert.Nil(t, err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	err = db.RunLogFileGC(String, -1, 0.1)
+	assert.Nil(t, err)
+	for i := writeCount / 2; i < writeCount; i++ {
+		_, err := db.Get(GetKey(i))
+		assert.Nil(t, err)
+	}
+}
+
+func TestOpen_HybridSealFailed(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-hybrid")
+	opts := DefaultOptions(path)
+	opts.IoType = Hybrid
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Set(GetKey(0), GetValue128B()))
+	// the active log file can't be mapped read-only when it is full.
+	active := db.getActiveLogFile(String)
+	assert.Nil(t, os.Remove(filepath.Join(path, logfile.FileNamesMap[logfile.Strs]+fmt.Sprintf("%09d", active.Fid))))
+	for i := 1; i < 20000; i++ {
+		if err = db.Set(GetKey(i), GetValue128B()); err != nil {
+			break
+		}
+	}
+	assert.NotNil(t, err)
+
+	// the active log file is kept and still usable.
+	assert.Equal(t, active, db.getActiveLogFile(String))
+	assert.Equal(t, 0, len(db.archivedLogFiles[String]))
+	val, err := db.Get(GetKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, 128, len(val))
+}
+
+func TestOpen_ReadOnly(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-read-only")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 1 << 20
+
+	// the db must exist.
+	opts.ReadOnly = true
+	_, err := Open(opts)
+	assert.True(t, os.IsNotExist(err))
+
+	opts.ReadOnly = false
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	writeCount := 10000
+	for i := 0; i < writeCount; i++ {
+		err := db.Set(GetKey(i), GetValue128B())
+		assert.Nil(t, err)
+	}
+	err = db.HSet([]byte("my_hash"), []byte("field"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.LPush([]byte("my_list"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.SAdd([]byte("my_set"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.ZAdd([]byte("my_zset"), 10, []byte("value"))
+	assert.Nil(t, err)
+	_ = db.Close()
+
+	// multiple read-only instances can coexist.
+	opts.ReadOnly = true
+	db1, err := Open(opts)
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	for _, rdb := range []*GoDb{db1, db2} {
+		for i := 0; i < writeCount; i++ {
+			val, err := rdb.Get(GetKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, 128, len(val))
+		}
+		val, err := rdb.HGet([]byte("my_hash"), []byte("field"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), val)
+	}
+
+	// but not together with a writable one.
+	opts.ReadOnly = false
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+
+	// mutating methods are rejected, and nothing is changed.
+	assert.Equal(t, ErrReadOnly, db1.Set(GetKey(0), GetValue16B()))
+	assert.Equal(t, ErrReadOnly, db1.Delete(GetKey(0)))
+	assert.Equal(t, ErrReadOnly, db1.HSet([]byte("my_hash"), []byte("field"), []byte("value")))
+	_, err = db1.HDel([]byte("my_hash"), []byte("field"))
+	assert.Equal(t, ErrReadOnly, err)
+	_, err = db1.LPop([]byte("my_list"))
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Equal(t, ErrReadOnly, db1.SRem([]byte("my_set"), []byte("value")))
+	assert.Equal(t, ErrReadOnly, db1.ZRem([]byte("my_zset"), []byte("value")))
+	assert.Equal(t, ErrReadOnly, db1.RunLogFileGC(String, -1, 0.1))
+
+	_, err = db1.Get(GetKey(0))
+	assert.Nil(t, err)
+	_, err = db1.HGet([]byte("my_hash"), []byte("field"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, db1.LLen([]byte("my_list")))
+	assert.True(t, db1.SIsMember([]byte("my_set"), []byte("value")))
+	ok, _ := db1.ZScore([]byte("my_zset"), []byte("value"))
+	assert.True(t, ok)
+
+	_ = db1.Close()
+	_ = db2.Close()
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	_, err = db.Get(GetKey(0))
+	assert.Nil(t, err)
+}
+
+func TestOpen_DiskIndexMode(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-disk-index")
+	opts := DefaultOptions(path)
+	opts.IndexMode = DiskIndexMode
+	opts.IndexCacheSize = 0
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	writeCount := 20000
+	for i := 0; i < writeCount; i++ {
+		err := db.Set(GetKey(i), GetValue16B())
+		assert.Nil(t, err)
+	}
+	for i := 0; i < writeCount; i += 2 {
+		err := db.Delete(GetKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Set(make([]byte, 2048), GetValue16B())
+	assert.Equal(t, ErrKeyTooLarge, err)
+	// collections are still indexed in memory.
+	err = db.HSet([]byte("my_hash"), []byte("field"), []byte("value"))
+	assert.Nil(t, err)
+	_ = db.Close()
+
+	checkDB := func(db *GoDb, count int) {
+		assert.Equal(t, count/2, db.Count())
+		for i := 0; i < count; i++ {
+			_, err := db.Get(GetKey(i))
+			if i%2 == 0 {
+				assert.Equal(t, ErrKeyNotFound, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		}
+		val, err := db.HGet([]byte("my_hash"), []byte("field"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), val)
+	}
+
+	// the index file is reused if closed properly.
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.True(t, db.strIndex.loaded)
+	checkDB(db, writeCount)
+	err = db.Set(GetKey(writeCount+1), GetValue16B())
+	assert.Nil(t, err)
+	_ = db.Close()
+
+	// the log files are changed without the index, so it is rebuilt.
+	opts.IndexMode = KeyOnlyMemMode
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	err = db.Set(GetKey(writeCount+3), GetValue16B())
+	assert.Nil(t, err)
+	_ = db.Close()
+
+	opts.IndexMode = DiskIndexMode
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	assert.False(t, db.strIndex.loaded)
+	checkDB(db, writeCount+4)
+}
+
+func TestOpen_DiskIndexFailed(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-disk-index")
+	opts := DefaultOptions(path)
+	opts.IndexMode = DiskIndexMode
+	opts.IndexCacheSize = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	writeCount := 20000
+	for i := 0; i < writeCount; i++ {
+		err := db.Set(GetKey(i), GetValue16B())
+		assert.Nil(t, err)
+	}
+	// pages not cached can't be read after the index file is closed.
+	_ = db.strIndex.idxTree.(*diskIndex).tree.Close(nil)
+	_, err = db.Get(GetKey(0))
+	assert.ErrorIs(t, err, ErrDBFailed)
+	err = db.Set(GetKey(writeCount), GetValue16B())
+	assert.ErrorIs(t, err, ErrDBFailed)
+	_ = db.Close()
+
+	// the index is rebuilt from log files.
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	assert.False(t, db.strIndex.loaded)
+	assert.Equal(t, writeCount, db.Count())
+	_, err = db.Get(GetKey(0))
+	assert.Nil(t, err)
+}
+
+func TestOpen_IndexTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		indexType IndexType
+	}{
+		{"art", ARTIndex},
+		{"btree", BTreeIndex},
+		{"hashmap", HashMapIndex},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "godb-index-types")
+			opts := DefaultOptions(path)
+			opts.IndexTypes = map[DataType]IndexType{
+				String: tt.indexType, List: tt.indexType, Hash: tt.indexType, Set: tt.indexType, ZSet: tt.indexType,
+			}
+			db, err := Open(opts)
+			assert.Nil(t, err)
+
+			for i := 0; i < 100; i++ {
+				err := db.Set(GetKey(i), GetKey(i))
+				assert.Nil(t, err)
+				err = db.HSet([]byte("my_hash"), GetKey(i), GetKey(i))
+				assert.Nil(t, err)
+				err = db.SAdd([]byte("my_set"), GetKey(i))
+				assert.Nil(t, err)
+				err = db.ZAdd([]byte("my_zset"), float64(i), GetKey(i))
+				assert.Nil(t, err)
+				err = db.RPush([]byte("my_list"), GetKey(i))
+				assert.Nil(t, err)
+			}
+			err = db.Delete(GetKey(0))
+			assert.Nil(t, err)
+			_, err = db.HDel([]byte("my_hash"), GetKey(0))
+			assert.Nil(t, err)
+			_ = db.Close()
+
+			// the indexes are rebuilt with the same type.
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			defer destroyDB(db)
+
+			_, err = db.Get(GetKey(0))
+			assert.Equal(t, ErrKeyNotFound, err)
+			val, err := db.Get(GetKey(1))
+			assert.Nil(t, err)
+			assert.Equal(t, GetKey(1), val)
+			// scan returns keys in order whatever the index type is.
+			values, err := db.Scan(GetKey(1)[:len(GetKey(1))-1], "", 5)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{GetKey(1), GetKey(1), GetKey(2), GetKey(2), GetKey(3), GetKey(3), GetKey(4), GetKey(4),
+				GetKey(5), GetKey(5)}, values)
+
+			pairs, err := db.HGetAll([]byte("my_hash"))
+			assert.Nil(t, err)
+			assert.Equal(t, 99*2, len(pairs))
+			fields, err := db.HScan([]byte("my_hash"), nil, "", 3)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{GetKey(1), GetKey(1), GetKey(2), GetKey(2), GetKey(3), GetKey(3)}, fields)
+
+			members, err := db.SMembers([]byte("my_set"))
+			assert.Nil(t, err)
+			assert.Equal(t, 100, len(members))
+			ok, score := db.ZScore([]byte("my_zset"), GetKey(10))
+			assert.True(t, ok)
+			assert.Equal(t, float64(10), score)
+			list, err := db.LRange([]byte("my_list"), 0, 1)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{GetKey(0), GetKey(1)}, list)
+		})
+	}
+}
+
+func TestOpen_PackedCollections(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-packed")
+	opts := DefaultOptions(path)
+	opts.HashMaxPacked, opts.SetMaxPacked, opts.ZSetMaxPacked = 4, 4, 4
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// small collections are packed, and large ones are converted while growing.
+	sizes := map[string]int{"small": 3, "large": 10}
+	hashKey := func(name string) []byte { return []byte("hash-" + name) }
+	setKey := func(name string) []byte { return []byte("set-" + name) }
+	zsetKey := func(name string) []byte { return []byte("zset-" + name) }
+	for name, size := range sizes {
+		for i := 0; i < size; i++ {
+			err = db.HSet(hashKey(name), GetKey(i), GetKey(i))
+			assert.Nil(t, err)
+			err = db.SAdd(setKey(name), GetKey(i))
+			assert.Nil(t, err)
+			err = db.ZAdd(zsetKey(name), float64(size-i), GetKey(i))
+			assert.Nil(t, err)
+		}
+	}
+	_, err = db.HDel(hashKey("large"), GetKey(0))
+	assert.Nil(t, err)
+
+	check := func(db *GoDb) {
+		for name, size := range sizes {
+			packed := size <= 4
+			assert.Equal(t, packed, db.hashIndex.tree(hashKey(name)).Packed())
+			assert.Equal(t, packed, db.setIndex.tree(setKey(name)).Packed())
+			assert.Equal(t, packed, db.zsetIndex.tree(zsetKey(name)).Packed())
+
+			val, err := db.HGet(hashKey(name), GetKey(1))
+			assert.Nil(t, err)
+			assert.Equal(t, GetKey(1), val)
+			fields, err := db.HKeys(hashKey(name))
+			assert.Nil(t, err)
+			assert.Equal(t, GetKey(size-1), fields[len(fields)-1])
+			assert.Equal(t, size, db.SCard(setKey(name)))
+			assert.True(t, db.SIsMember(setKey(name), GetKey(size-1)))
+			members, err := db.ZRange(zsetKey(name), 0, 0)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{GetKey(size - 1)}, members)
+		}
+		assert.Equal(t, 9, db.HLen(hashKey("large")))
+	}
+	check(db)
+
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
+func TestOpen_ParallelLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		indexMode DataIndexMode
+	}{
+		{"key-only", KeyOnlyMemMode},
+		{"key-value", KeyValueMemMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "godb-parallel-load")
+			opts := DefaultOptions(path)
+			opts.IndexMode = tt.indexMode
+			opts.LogFileSizeThreshold = 256 << 10
+			db, err := Open(opts)
+			assert.Nil(t, err)
+
+			// every key is rewritten in later log files, the last write wins.
+			writeCount := 3000
+			for round := 0; round < 3; round++ {
+				for i := 0; i < writeCount; i++ {
+					err := db.Set(GetKey(i), []byte(fmt.Sprintf("%s-%d", GetValue128B(), round)))
+					assert.Nil(t, err)
+					if round == 1 {
+						err = db.SAdd([]byte("my_set"), GetKey(i))
+						assert.Nil(t, err)
+					}
+				}
+			}
+			for i := 0; i < writeCount; i += 2 {
+				err := db.Delete(GetKey(i))
+				assert.Nil(t, err)
+				err = db.SRem([]byte("my_set"), GetKey(i))
+				assert.Nil(t, err)
+			}
+			assert.Greater(t, len(db.archivedLogFiles[String]), 4)
+			_ = db.Close()
+
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			defer destroyDB(db)
+			assert.Greater(t, db.Stats().IndexLoadTime, time.Duration(0))
+			for i := 0; i < writeCount; i++ {
+				val, err := db.Get(GetKey(i))
+				if i%2 == 0 {
+					assert.Equal(t, ErrKeyNotFound, err)
+					assert.False(t, db.SIsMember([]byte("my_set"), GetKey(i)))
+					continue
+				}
+				assert.Nil(t, err)
+				assert.True(t, strings.HasSuffix(string(val), "-2"))
+				assert.True(t, db.SIsMember([]byte("my_set"), GetKey(i)))
+			}
+			assert.Equal(t, writeCount/2, db.SCard([]byte("my_set")))
+
+			// new writes go to the end of active log file.
+			err = db.Set(GetKey(0), GetValue16B())
+			assert.Nil(t, err)
+			_, err = db.Get(GetKey(0))
+			assert.Nil(t, err)
+		})
+	}
 }
 
 func TestLogFileGC(t *testing.T) {
@@ -95,6 +672,56 @@ func TestGoDb_Backup(t *testing.T) {
 	assert.NotNil(t, val)
 }
 
+func TestGoDb_ConcurrentWrites(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-concurrent")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	workers, writeCount := 8, 500
+	wg := new(sync.WaitGroup)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writeCount; i++ {
+				key := []byte(fmt.Sprintf("key-%d-%d", w, i))
+				member := GetKey(w*writeCount + i)
+				assert.Nil(t, db.Set(key, member))
+				// shared keys are written by all workers.
+				_, err := db.Incr([]byte("counter"))
+				assert.Nil(t, err)
+				_, err = db.HIncrBy([]byte("my_hash"), []byte("counter"), 1)
+				assert.Nil(t, err)
+				assert.Nil(t, db.HSet([]byte("my_hash"), member, GetValue16B()))
+				assert.Nil(t, db.SAdd([]byte("my_set"), member))
+				assert.Nil(t, db.ZAdd([]byte("my_zset"), float64(i), member))
+				assert.Nil(t, db.LPush([]byte("my_list"), member))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := workers * writeCount
+	counter, err := db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(total), string(counter))
+	hashCounter, err := db.HGet([]byte("my_hash"), []byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(total), string(hashCounter))
+	assert.Equal(t, total+1, db.HLen([]byte("my_hash")))
+	assert.Equal(t, total, db.SCard([]byte("my_set")))
+	assert.Equal(t, total, db.ZCard([]byte("my_zset")))
+	assert.Equal(t, total, db.LLen([]byte("my_list")))
+	for w := 0; w < workers; w++ {
+		val, err := db.Get([]byte(fmt.Sprintf("key-%d-%d", w, writeCount-1)))
+		assert.Nil(t, err)
+		assert.Equal(t, GetKey((w+1)*writeCount-1), val)
+	}
+}
+
 func destroyDB(db *GoDb) {
 	if db != nil {
 		_ = db.Close()
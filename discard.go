@@ -29,6 +29,7 @@ type discard struct {
 	sync.Mutex
 	once     *sync.Once
 	valChan  chan *indexNode
+	closed   chan struct{} // closed when the discard file is closed by listenUpdates.
 	file     ioselector.IOSelector
 	freeList []int64          // contains file offset that can be allocated
 	location map[uint32]int64 // offset of each fid
@@ -40,11 +41,24 @@ func newDiscard(path, name string, bufferSize int) (*discard, error) {
 	if err != nil {
 		return nil, err
 	}
+	return loadDiscard(file, bufferSize)
+}
 
+// newMemDiscard create a discard whose records are kept in memory, used in InMemory mode.
+func newMemDiscard(bufferSize int) (*discard, error) {
+	file, err := ioselector.NewMemSelector(discardFileSize)
+	if err != nil {
+		return nil, err
+	}
+	return loadDiscard(file, bufferSize)
+}
+
+func loadDiscard(file ioselector.IOSelector, bufferSize int) (*discard, error) {
 	var freeList []int64
 	var offset int64
 	location := make(map[uint32]int64)
-	for {
+	// a partial record at the end of file is never used, incr would fail on it.
+	for offset+discardRecordSize <= discardFileSize {
 		// read fid and total is enough.
 		buf := make([]byte, 8)
 		if _, err := file.Read(buf, offset); err != nil {
@@ -66,6 +80,7 @@ func newDiscard(path, name string, bufferSize int) (*discard, error) {
 	d := &discard{
 		valChan:  make(chan *indexNode, bufferSize),
 		once:     new(sync.Once),
+		closed:   make(chan struct{}),
 		file:     file,
 		freeList: freeList,
 		location: location,
@@ -128,6 +143,7 @@ func (d *discard) listenUpdates() {
 				if err := d.file.Close(); err != nil {
 					logger.Errorf("close discard file err: %v", err)
 				}
+				close(d.closed)
 				return
 			}
 			d.incrDiscard(idxNode.fid, idxNode.entrySize)
@@ -135,8 +151,11 @@ func (d *discard) listenUpdates() {
 	}
 }
 
+// closeChan close the channel and wait until the discard file is closed.
+// The file is truncated when closed, so it must not be reopened before that.
 func (d *discard) closeChan() {
 	d.once.Do(func() { close(d.valChan) })
+	<-d.closed
 }
 
 func (d *discard) setTotal(fid uint32, totalSize uint32) {
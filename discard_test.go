@@ -45,6 +45,15 @@ func TestDiscard_newDiscard(t *testing.T) {
 		assert.Equal(t, len(dis.location), 0)
 	})
 
+	t.Run("in-memory", func(t *testing.T) {
+		dis, err := newMemDiscard(4096)
+		assert.Nil(t, err)
+		defer dis.closeChan()
+
+		assert.Equal(t, len(dis.freeList), 682)
+		assert.Equal(t, len(dis.location), 0)
+	})
+
 	t.Run("with-data", func(t *testing.T) {
 		path := filepath.Join("/tmp", "godb-discard")
 		_ = os.MkdirAll(path, os.ModePerm)
@@ -0,0 +1,237 @@
+package godb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/herott-ai/godb/ds/bptree"
+	"github.com/herott-ai/godb/ds/index"
+	"github.com/herott-ai/godb/logfile"
+	"github.com/herott-ai/godb/logger"
+)
+
+// strIndexFileName the b+tree file of String keys in DiskIndexMode.
+const strIndexFileName = "INDEX.strs"
+
+// diskIndex String index in DiskIndexMode, index nodes are encoded and stored in a disk-backed b+tree.
+// The index can always be rebuilt from log files, so an io error of it fails the db, and the db will rebuild it on next opening.
+// The index methods can`t return errors, so the first error is kept in err, see strIndex.Err.
+type diskIndex struct {
+	tree    *bptree.Tree
+	err     atomic.Value
+	errOnce sync.Once
+}
+
+type diskIndexIterator struct {
+	idx  *diskIndex
+	iter *bptree.Iterator
+}
+
+// openDiskIndex open the String index file in DiskIndexMode.
+// If the index file was closed properly at the end of String log files, it is used directly and the String log files won`t be read.
+// Otherwise it is rebuilt from log files, or String keys are indexed in memory in read-only mode.
+func (db *GoDb) openDiskIndex() error {
+	if db.opts.IndexMode != DiskIndexMode {
+		return nil
+	}
+	tree, err := bptree.Open(filepath.Join(db.opts.DBPath, strIndexFileName), db.opts.IndexCacheSize, db.opts.ReadOnly)
+	if err != nil {
+		if db.opts.ReadOnly {
+			logger.Warnf("open disk index err: %v, String keys will be indexed in memory", err)
+			return nil
+		}
+		return err
+	}
+
+	if db.diskIndexUpToDate(tree) {
+		db.strIndex.idxTree = &diskIndex{tree: tree}
+		db.strIndex.loaded = true
+		return nil
+	}
+	if db.opts.ReadOnly {
+		logger.Warnf("disk index is out of date, String keys will be indexed in memory")
+		return tree.Close(nil)
+	}
+	if err := tree.Reset(); err != nil {
+		return err
+	}
+	db.strIndex.idxTree = &diskIndex{tree: tree}
+	return nil
+}
+
+// diskIndexUpToDate whether the tree covers all the String log files.
+// The checkpoint is the position of active String log file when closed, nothing should be written after it.
+func (db *GoDb) diskIndexUpToDate(tree *bptree.Tree) bool {
+	checkpoint, clean := tree.Checkpoint()
+	activeFile := db.activeLogFiles[String]
+	if !clean || len(checkpoint) != 12 {
+		return false
+	}
+	// expiration time of index nodes is in the unit of the format version.
+	if activeFile != nil && activeFile.Version < logfile.FormatVersion {
+		return false
+	}
+	fid := binary.LittleEndian.Uint32(checkpoint[:4])
+	offset := int64(binary.LittleEndian.Uint64(checkpoint[4:]))
+	if activeFile == nil {
+		return tree.Size() == 0
+	}
+	if activeFile.Fid != fid {
+		return false
+	}
+	if _, _, err := activeFile.ReadLogEntry(offset); err != io.EOF && err != logfile.ErrEndOfEntry {
+		return false
+	}
+	atomic.StoreInt64(&activeFile.WriteAt, offset)
+	return true
+}
+
+// indexErr returns the error db failed with, if idxTree is the String index and it failed with an io error on disk.
+// Reads return it instead of ErrKeyNotFound, since the key may not be found because of the error.
+func (db *GoDb) indexErr(idxTree index.Index) error {
+	if si, ok := idxTree.(*strIndex); ok && si.Err() != nil {
+		return db.failure()
+	}
+	return nil
+}
+
+// strIndexOnDisk whether String keys are indexed on disk.
+func (db *GoDb) strIndexOnDisk() bool {
+	_, ok := db.strIndex.idxTree.(*diskIndex)
+	return ok
+}
+
+// closeDiskIndex close the String index file, the position of active String log file is saved as checkpoint.
+func (db *GoDb) closeDiskIndex() error {
+	if db.strIndex == nil {
+		return nil
+	}
+	idx, ok := db.strIndex.idxTree.(*diskIndex)
+	if !ok {
+		return nil
+	}
+	// the index is out of date after an io error, it will be rebuilt without the checkpoint.
+	if idx.Err() != nil {
+		return idx.tree.Close(nil)
+	}
+	checkpoint := make([]byte, 12)
+	if activeFile := db.activeLogFiles[String]; activeFile != nil {
+		binary.LittleEndian.PutUint32(checkpoint[:4], activeFile.Fid)
+		binary.LittleEndian.PutUint64(checkpoint[4:], uint64(activeFile.WriteAt))
+	}
+	return idx.tree.Close(checkpoint)
+}
+
+// fail keep the first io error of the index.
+func (idx *diskIndex) fail(op string, err error) {
+	idx.errOnce.Do(func() {
+		err = fmt.Errorf("%s disk index err: %w", op, err)
+		idx.err.Store(err)
+		logger.Errorf("%v", err)
+	})
+}
+
+// Err returns the first io error of the index, nil if there is none.
+func (idx *diskIndex) Err() error {
+	err, _ := idx.err.Load().(error)
+	return err
+}
+
+func (idx *diskIndex) Put(key []byte, value interface{}) (oldVal interface{}, updated bool) {
+	old, updated, err := idx.tree.Put(key, encodeIndexNode(value.(*indexNode)))
+	if err != nil {
+		idx.fail("put key into", err)
+		return nil, false
+	}
+	if updated {
+		oldVal = decodeIndexNode(old)
+	}
+	return
+}
+
+func (idx *diskIndex) Get(key []byte) interface{} {
+	buf, err := idx.tree.Get(key)
+	if err != nil {
+		idx.fail("get key from", err)
+		return nil
+	}
+	if buf == nil {
+		return nil
+	}
+	return decodeIndexNode(buf)
+}
+
+func (idx *diskIndex) Delete(key []byte) (val interface{}, updated bool) {
+	old, updated, err := idx.tree.Delete(key)
+	if err != nil {
+		idx.fail("delete key from", err)
+		return nil, false
+	}
+	if updated {
+		val = decodeIndexNode(old)
+	}
+	return
+}
+
+func (idx *diskIndex) Iterator() index.Iterator {
+	return &diskIndexIterator{idx: idx, iter: idx.tree.Iterator()}
+}
+
+func (idx *diskIndex) Seek(key []byte) index.Iterator {
+	iter := idx.tree.Iterator()
+	iter.Seek(key)
+	return &diskIndexIterator{idx: idx, iter: iter}
+}
+
+func (idx *diskIndex) PrefixScan(prefix []byte, count int) [][]byte {
+	keys, err := idx.tree.PrefixScan(prefix, count)
+	if err != nil {
+		idx.fail("scan", err)
+		return nil
+	}
+	return keys
+}
+
+func (idx *diskIndex) Size() int {
+	return idx.tree.Size()
+}
+
+func (it *diskIndexIterator) HasNext() bool {
+	return it.iter.HasNext()
+}
+
+func (it *diskIndexIterator) Next() ([]byte, interface{}) {
+	key, value := it.iter.Next()
+	if err := it.iter.Err(); err != nil {
+		it.idx.fail("iterate", err)
+		return nil, nil
+	}
+	if key == nil {
+		return nil, nil
+	}
+	return key, decodeIndexNode(value)
+}
+
+// encodeIndexNode encode the position of an index node, the value is never stored in DiskIndexMode.
+func encodeIndexNode(node *indexNode) []byte {
+	buf := make([]byte, 4*binary.MaxVarintLen64)
+	index := binary.PutUvarint(buf, uint64(node.fid))
+	index += binary.PutVarint(buf[index:], node.offset)
+	index += binary.PutVarint(buf[index:], int64(node.entrySize))
+	index += binary.PutVarint(buf[index:], node.expiredAt)
+	return buf[:index]
+}
+
+func decodeIndexNode(buf []byte) *indexNode {
+	fid, index := binary.Uvarint(buf)
+	offset, n := binary.Varint(buf[index:])
+	index += n
+	entrySize, n := binary.Varint(buf[index:])
+	index += n
+	expiredAt, _ := binary.Varint(buf[index:])
+	return &indexNode{fid: uint32(fid), offset: offset, entrySize: int(entrySize), expiredAt: expiredAt}
+}
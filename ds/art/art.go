@@ -52,6 +52,55 @@ func (art *AdaptiveRadixTree) PrefixScan(prefix []byte, count int) (keys [][]byt
 	return
 }
 
+// SeekScan calls fn with the keys greater than or equal to key in order, until fn returns false.
+// The keys less than key are skipped by walking the prefixes of key, instead of iterating them one by one.
+func (art *AdaptiveRadixTree) SeekScan(key []byte, fn func(key []byte, value interface{}) bool) {
+	stopped := false
+	cb := func(node goart.Node) bool {
+		if node.Kind() != goart.Leaf {
+			return true
+		}
+		if !fn(node.Key(), node.Value()) {
+			stopped = true
+		}
+		return !stopped
+	}
+	scan := func(prefix []byte) {
+		// no key matches an empty prefix in ForEachPrefix.
+		if len(prefix) == 0 {
+			art.tree.ForEach(cb)
+		} else {
+			art.tree.ForEachPrefix(prefix, cb)
+		}
+	}
+
+	// the keys with key as prefix are the smallest ones, then the keys greater than key at each byte from the last one.
+	scan(key)
+	prefix := make([]byte, len(key))
+	for i := len(key) - 1; i >= 0 && !stopped; i-- {
+		if !art.hasPrefix(key[:i]) {
+			continue
+		}
+		copy(prefix, key[:i])
+		for c := int(key[i]) + 1; c <= 0xff && !stopped; c++ {
+			prefix[i] = byte(c)
+			scan(prefix[:i+1])
+		}
+	}
+}
+
+func (art *AdaptiveRadixTree) hasPrefix(prefix []byte) bool {
+	if len(prefix) == 0 {
+		return art.tree.Size() > 0
+	}
+	var found bool
+	art.tree.ForEachPrefix(prefix, func(node goart.Node) bool {
+		found = node.Kind() == goart.Leaf
+		return !found
+	})
+	return found
+}
+
 func (art *AdaptiveRadixTree) Size() int {
 	return art.tree.Size()
 }
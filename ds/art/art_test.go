@@ -2,6 +2,7 @@ package art
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"reflect"
 	"sort"
@@ -168,3 +169,41 @@ func TestAdaptiveRadixTree_Iterator(t *testing.T) {
 	}
 	assert.Equal(t, keys, targes)
 }
+
+func TestAdaptiveRadixTree_SeekScan(t *testing.T) {
+	art := NewART()
+	var keys [][]byte
+	for _, key := range []string{"a", "ab", "abc", "abd", "acde", "acse", "b", "bbfc", "bbfe", "cced", "eefs"} {
+		art.Put([]byte(key), key)
+		keys = append(keys, []byte(key))
+	}
+	// keys sharing a long prefix.
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("f-common-prefix-%05d", i)
+		art.Put([]byte(key), key)
+		keys = append(keys, []byte(key))
+	}
+
+	seek := func(key []byte, count int) [][]byte {
+		var got [][]byte
+		art.SeekScan(key, func(k []byte, value interface{}) bool {
+			assert.Equal(t, string(k), value)
+			got = append(got, k)
+			return len(got) < count
+		})
+		return got
+	}
+	assert.Equal(t, keys, seek(nil, len(keys)))
+	for _, key := range []string{"", "a", "aa", "abc", "abcd", "ac", "acz", "bbfd", "c", "d", "eefs", "f-common-prefix-00123", "f-common-prefix-002", "z"} {
+		want := [][]byte(nil)
+		for _, k := range keys {
+			if bytes.Compare(k, []byte(key)) >= 0 {
+				want = append(want, k)
+			}
+		}
+		assert.Equal(t, want, seek([]byte(key), len(keys)), key)
+		if len(want) > 2 {
+			assert.Equal(t, want[:2], seek([]byte(key), 2), key)
+		}
+	}
+}
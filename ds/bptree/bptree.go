@@ -0,0 +1,442 @@
+package bptree
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+)
+
+// bptree is a B+tree stored in a file of fixed size pages, only the hot pages are cached in memory.
+// Pages are never merged or freed, the space left by deleted keys is reused by the keys inserted later into the same page.
+
+const (
+	// PageSize size of a page, it is also the unit of disk io.
+	PageSize = 4096
+	// MaxKeySize max size of a key, a page must be able to hold several entries.
+	MaxKeySize = 1024
+	// MaxValueSize max size of a value.
+	MaxValueSize = 256
+	// MaxCheckpointSize max size of the checkpoint saved in meta page.
+	MaxCheckpointSize = 64
+
+	magic   uint32 = 0x47425054
+	version uint32 = 1
+
+	// magic(4) + version(4) + clean(1) + root(8) + page count(8) + size(8) + checkpoint length(2)
+	metaHeaderSize = 35
+	minCachePages  = 16
+)
+
+var (
+	// ErrKeyTooLarge the key exceeds MaxKeySize.
+	ErrKeyTooLarge = errors.New("key exceeds the max key size of b+tree")
+
+	// ErrValueTooLarge the value exceeds MaxValueSize.
+	ErrValueTooLarge = errors.New("value exceeds the max value size of b+tree")
+
+	// ErrCheckpointTooLarge the checkpoint exceeds MaxCheckpointSize.
+	ErrCheckpointTooLarge = errors.New("checkpoint exceeds the max checkpoint size of b+tree")
+
+	// ErrInvalidFile the file is not a b+tree file or it is corrupted.
+	ErrInvalidFile = errors.New("invalid b+tree file")
+
+	// ErrReadOnly the tree is opened in read-only mode.
+	ErrReadOnly = errors.New("b+tree is opened in read-only mode")
+)
+
+// Tree a disk-backed B+tree, keys are sorted in bytes order. It is safe for concurrent use.
+type Tree struct {
+	mu         sync.Mutex
+	fd         *os.File
+	readOnly   bool
+	clean      bool // whether the tree was closed cleanly last time.
+	root       uint64
+	pageCount  uint64
+	size       uint64
+	checkpoint []byte
+
+	capacity int // max number of cached pages.
+	lru      *list.List
+	cache    map[uint64]*list.Element
+	buf      []byte
+}
+
+// Open a tree file, it will be created if not exists.
+// At most cacheSize bytes of pages are kept in memory, and dirty pages are written back when evicted or the tree is closed.
+func Open(path string, cacheSize int64, readOnly bool) (*Tree, error) {
+	flag := os.O_CREATE | os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	fd, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	capacity := int(cacheSize / PageSize)
+	if capacity < minCachePages {
+		capacity = minCachePages
+	}
+	t := &Tree{
+		fd:       fd,
+		readOnly: readOnly,
+		capacity: capacity,
+		lru:      list.New(),
+		cache:    make(map[uint64]*list.Element),
+		buf:      make([]byte, PageSize),
+	}
+	if stat.Size() == 0 {
+		if readOnly {
+			_ = fd.Close()
+			return nil, ErrInvalidFile
+		}
+		t.init()
+	} else if err := t.readMeta(); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	// the tree is not clean until it is closed, so a crash can be detected next time.
+	if !readOnly {
+		if err := t.writeMeta(false); err != nil {
+			_ = fd.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Checkpoint returns the checkpoint saved by the last Close, and whether the tree was closed cleanly.
+// The checkpoint is meaningless if the tree wasn`t closed cleanly, the tree may miss some changes.
+func (t *Tree) Checkpoint() ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.checkpoint, t.clean
+}
+
+// Put key and value into tree, returns the old value if key exists.
+func (t *Tree) Put(key, value []byte) (oldVal []byte, updated bool, err error) {
+	if len(key) > MaxKeySize {
+		return nil, false, ErrKeyTooLarge
+	}
+	if len(value) > MaxValueSize {
+		return nil, false, ErrValueTooLarge
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.readOnly {
+		return nil, false, ErrReadOnly
+	}
+
+	root, err := t.load(t.root)
+	if err != nil {
+		return nil, false, err
+	}
+	oldVal, updated, sep, right, err := t.insert(root, key, value)
+	if err != nil {
+		return nil, false, err
+	}
+	if right != nil {
+		newRoot := t.newNode(false)
+		newRoot.keys = [][]byte{sep}
+		newRoot.children = []uint64{root.id, right.id}
+		t.root = newRoot.id
+	}
+	if !updated {
+		t.size++
+	}
+	return oldVal, updated, t.shrink()
+}
+
+// Get the value of key, returns nil if not found.
+func (t *Tree) Get(key []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	leaf, err := t.findLeaf(key)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	if i, found := leaf.search(key); found {
+		value = append([]byte(nil), leaf.values[i]...)
+	}
+	return value, t.shrink()
+}
+
+// Delete key from tree, returns the old value if key exists.
+func (t *Tree) Delete(key []byte) (oldVal []byte, deleted bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.readOnly {
+		return nil, false, ErrReadOnly
+	}
+	leaf, err := t.findLeaf(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if i, found := leaf.search(key); found {
+		oldVal, deleted = leaf.values[i], true
+		leaf.keys = append(leaf.keys[:i], leaf.keys[i+1:]...)
+		leaf.values = append(leaf.values[:i], leaf.values[i+1:]...)
+		leaf.dirty = true
+		t.size--
+	}
+	return oldVal, deleted, t.shrink()
+}
+
+// PrefixScan returns at most count keys with the prefix in order.
+func (t *Tree) PrefixScan(prefix []byte, count int) ([][]byte, error) {
+	var keys [][]byte
+	iter := t.Iterator()
+	iter.Seek(prefix)
+	for count > 0 && iter.HasNext() {
+		key, _ := iter.Next()
+		if !hasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+		count--
+	}
+	return keys, iter.Err()
+}
+
+// Size returns the number of keys in tree.
+func (t *Tree) Size() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return int(t.size)
+}
+
+// Reset remove all keys in tree, the file is truncated.
+func (t *Tree) Reset() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.readOnly {
+		return ErrReadOnly
+	}
+	if err := t.fd.Truncate(0); err != nil {
+		return err
+	}
+	t.lru.Init()
+	t.cache = make(map[uint64]*list.Element)
+	t.init()
+	return t.writeMeta(false)
+}
+
+// Close write back all dirty pages and save checkpoint in the meta page, then the tree is marked as clean.
+// The checkpoint is an opaque position of caller, which tells how much data the tree has covered.
+func (t *Tree) Close(checkpoint []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.readOnly {
+		return t.fd.Close()
+	}
+	if len(checkpoint) > MaxCheckpointSize {
+		return ErrCheckpointTooLarge
+	}
+	for elem := t.lru.Front(); elem != nil; elem = elem.Next() {
+		if err := t.writeNode(elem.Value.(*node)); err != nil {
+			return err
+		}
+	}
+	if err := t.fd.Sync(); err != nil {
+		return err
+	}
+	t.checkpoint = checkpoint
+	if err := t.writeMeta(true); err != nil {
+		return err
+	}
+	return t.fd.Close()
+}
+
+// init an empty tree whose root is an empty leaf.
+// must hold the lock before invoking.
+func (t *Tree) init() {
+	t.root, t.pageCount, t.size = 1, 1, 0
+	t.newNode(true)
+}
+
+func (t *Tree) insert(n *node, key, value []byte) (oldVal []byte, updated bool, sep []byte, right *node, err error) {
+	if n.leaf {
+		i, found := n.search(key)
+		if found {
+			oldVal, updated = n.values[i], true
+			n.values[i] = append([]byte(nil), value...)
+		} else {
+			n.keys = append(n.keys, nil)
+			n.values = append(n.values, nil)
+			copy(n.keys[i+1:], n.keys[i:])
+			copy(n.values[i+1:], n.values[i:])
+			n.keys[i] = append([]byte(nil), key...)
+			n.values[i] = append([]byte(nil), value...)
+		}
+		n.dirty = true
+	} else {
+		i := n.childIndex(key)
+		child, err := t.load(n.children[i])
+		if err != nil {
+			return nil, false, nil, nil, err
+		}
+		var childSep []byte
+		var childRight *node
+		oldVal, updated, childSep, childRight, err = t.insert(child, key, value)
+		if err != nil || childRight == nil {
+			return oldVal, updated, nil, nil, err
+		}
+		n.keys = append(n.keys, nil)
+		n.children = append(n.children, 0)
+		copy(n.keys[i+1:], n.keys[i:])
+		copy(n.children[i+2:], n.children[i+1:])
+		n.keys[i] = childSep
+		n.children[i+1] = childRight.id
+		n.dirty = true
+	}
+
+	if n.size() > PageSize {
+		sep, right = t.split(n)
+	}
+	return
+}
+
+// split the node into two, returns the separator key and the right one.
+func (t *Tree) split(n *node) ([]byte, *node) {
+	mid := n.splitIndex()
+	right := t.newNode(n.leaf)
+	if n.leaf {
+		right.keys = append(right.keys, n.keys[mid:]...)
+		right.values = append(right.values, n.values[mid:]...)
+		n.keys, n.values = n.keys[:mid], n.values[:mid]
+		right.next, n.next = n.next, right.id
+		return right.keys[0], right
+	}
+
+	sep := n.keys[mid]
+	right.keys = append(right.keys, n.keys[mid+1:]...)
+	right.children = append(right.children, n.children[mid+1:]...)
+	n.keys, n.children = n.keys[:mid], n.children[:mid+1]
+	return sep, right
+}
+
+// findLeaf returns the leaf which may contain key.
+// must hold the lock before invoking.
+func (t *Tree) findLeaf(key []byte) (*node, error) {
+	n, err := t.load(t.root)
+	for err == nil && !n.leaf {
+		n, err = t.load(n.children[n.childIndex(key)])
+	}
+	return n, err
+}
+
+// newNode allocate a new page at the end of file.
+// must hold the lock before invoking.
+func (t *Tree) newNode(leaf bool) *node {
+	n := &node{id: t.pageCount, leaf: leaf, dirty: true}
+	if !leaf {
+		n.children = []uint64{}
+	}
+	t.pageCount++
+	t.cache[n.id] = t.lru.PushFront(n)
+	return n
+}
+
+// load a page from cache or file.
+// must hold the lock before invoking.
+func (t *Tree) load(id uint64) (*node, error) {
+	if elem, ok := t.cache[id]; ok {
+		t.lru.MoveToFront(elem)
+		return elem.Value.(*node), nil
+	}
+	if id == 0 || id >= t.pageCount {
+		return nil, ErrInvalidFile
+	}
+	if _, err := t.fd.ReadAt(t.buf, int64(id*PageSize)); err != nil {
+		return nil, err
+	}
+	n, err := decodeNode(id, t.buf)
+	if err != nil {
+		return nil, err
+	}
+	t.cache[id] = t.lru.PushFront(n)
+	return n, nil
+}
+
+// shrink evict the least recently used pages until the cache is not over capacity.
+// The pages are only evicted after an operation is done, so the nodes used in an operation are always valid.
+// must hold the lock before invoking.
+func (t *Tree) shrink() error {
+	for t.lru.Len() > t.capacity {
+		elem := t.lru.Back()
+		n := elem.Value.(*node)
+		if err := t.writeNode(n); err != nil {
+			return err
+		}
+		t.lru.Remove(elem)
+		delete(t.cache, n.id)
+	}
+	return nil
+}
+
+// writeNode write the node to its page if it is dirty.
+func (t *Tree) writeNode(n *node) error {
+	if !n.dirty {
+		return nil
+	}
+	for i := range t.buf {
+		t.buf[i] = 0
+	}
+	n.encode(t.buf)
+	if _, err := t.fd.WriteAt(t.buf, int64(n.id*PageSize)); err != nil {
+		return err
+	}
+	n.dirty = false
+	return nil
+}
+
+func (t *Tree) readMeta() error {
+	buf := make([]byte, PageSize)
+	if _, err := t.fd.ReadAt(buf, 0); err != nil {
+		return ErrInvalidFile
+	}
+	if binary.LittleEndian.Uint32(buf[0:4]) != magic || binary.LittleEndian.Uint32(buf[4:8]) != version {
+		return ErrInvalidFile
+	}
+	t.clean = buf[8] == 1
+	t.root = binary.LittleEndian.Uint64(buf[9:17])
+	t.pageCount = binary.LittleEndian.Uint64(buf[17:25])
+	t.size = binary.LittleEndian.Uint64(buf[25:33])
+	cpLen := int(binary.LittleEndian.Uint16(buf[33:35]))
+	if cpLen > MaxCheckpointSize || t.root == 0 || t.root >= t.pageCount {
+		return ErrInvalidFile
+	}
+	t.checkpoint = append([]byte(nil), buf[metaHeaderSize:metaHeaderSize+cpLen]...)
+	return nil
+}
+
+func (t *Tree) writeMeta(clean bool) error {
+	buf := make([]byte, PageSize)
+	binary.LittleEndian.PutUint32(buf[0:4], magic)
+	binary.LittleEndian.PutUint32(buf[4:8], version)
+	if clean {
+		buf[8] = 1
+	}
+	binary.LittleEndian.PutUint64(buf[9:17], t.root)
+	binary.LittleEndian.PutUint64(buf[17:25], t.pageCount)
+	binary.LittleEndian.PutUint64(buf[25:33], t.size)
+	binary.LittleEndian.PutUint16(buf[33:35], uint16(len(t.checkpoint)))
+	copy(buf[metaHeaderSize:], t.checkpoint)
+	if _, err := t.fd.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	return t.fd.Sync()
+}
+
+func hasPrefix(key, prefix []byte) bool {
+	return len(key) >= len(prefix) && string(key[:len(prefix)]) == string(prefix)
+}
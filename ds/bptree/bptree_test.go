@@ -0,0 +1,209 @@
+package bptree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openTree(t *testing.T, cacheSize int64) (*Tree, string) {
+	path := filepath.Join("/tmp", "bptree-test")
+	_ = os.Remove(path)
+	tree, err := Open(path, cacheSize, false)
+	assert.Nil(t, err)
+	return tree, path
+}
+
+func getKey(i int) []byte {
+	return []byte(fmt.Sprintf("bptree-test-key-%09d", i))
+}
+
+func TestTree_PutGetDelete(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheSize int64
+	}{
+		{"no-eviction", 64 << 20},
+		{"eviction", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, path := openTree(t, tt.cacheSize)
+			defer os.Remove(path)
+
+			n := 20000
+			expected := make(map[string][]byte)
+			for _, i := range rand.Perm(n) {
+				val := []byte(fmt.Sprintf("value-%d", i))
+				_, updated, err := tree.Put(getKey(i), val)
+				assert.Nil(t, err)
+				assert.False(t, updated)
+				expected[string(getKey(i))] = val
+			}
+			// update and delete some keys.
+			for i := 0; i < n; i += 3 {
+				old, updated, err := tree.Put(getKey(i), []byte("updated"))
+				assert.Nil(t, err)
+				assert.True(t, updated)
+				assert.Equal(t, expected[string(getKey(i))], old)
+				expected[string(getKey(i))] = []byte("updated")
+			}
+			for i := 1; i < n; i += 3 {
+				old, deleted, err := tree.Delete(getKey(i))
+				assert.Nil(t, err)
+				assert.True(t, deleted)
+				assert.Equal(t, expected[string(getKey(i))], old)
+				delete(expected, string(getKey(i)))
+			}
+			_, deleted, err := tree.Delete([]byte("not-exist"))
+			assert.Nil(t, err)
+			assert.False(t, deleted)
+			assert.Equal(t, len(expected), tree.Size())
+
+			for i := 0; i < n; i++ {
+				val, err := tree.Get(getKey(i))
+				assert.Nil(t, err)
+				assert.Equal(t, expected[string(getKey(i))], val)
+			}
+			assert.Nil(t, tree.Close(nil))
+		})
+	}
+}
+
+func TestTree_Iterator(t *testing.T) {
+	tree, path := openTree(t, 0)
+	defer os.Remove(path)
+
+	var keys []string
+	for _, i := range rand.Perm(5000) {
+		key := getKey(i)
+		_, _, err := tree.Put(key, key)
+		assert.Nil(t, err)
+		if i%2 == 0 {
+			keys = append(keys, string(key))
+		}
+	}
+	for i := 1; i < 5000; i += 2 {
+		_, _, err := tree.Delete(getKey(i))
+		assert.Nil(t, err)
+	}
+	sort.Strings(keys)
+
+	iter := tree.Iterator()
+	var got []string
+	for iter.HasNext() {
+		key, value := iter.Next()
+		assert.Equal(t, key, value)
+		got = append(got, string(key))
+	}
+	assert.Nil(t, iter.Err())
+	assert.Equal(t, keys, got)
+
+	iter.Seek(getKey(4001))
+	assert.True(t, iter.HasNext())
+	key, _ := iter.Next()
+	assert.Equal(t, getKey(4002), key)
+
+	iter.Seek([]byte("zzz"))
+	assert.False(t, iter.HasNext())
+	assert.Nil(t, tree.Close(nil))
+}
+
+func TestTree_PrefixScan(t *testing.T) {
+	tree, path := openTree(t, 0)
+	defer os.Remove(path)
+
+	for i := 0; i < 3000; i++ {
+		_, _, err := tree.Put(getKey(i), []byte("v"))
+		assert.Nil(t, err)
+	}
+	keys, err := tree.PrefixScan([]byte("bptree-test-key-0000001"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(keys))
+	assert.Equal(t, getKey(100), keys[0])
+	assert.True(t, sort.SliceIsSorted(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	}))
+
+	keys, err = tree.PrefixScan([]byte("bptree-test-key-00000002"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(keys))
+
+	keys, err = tree.PrefixScan([]byte("not-exist"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Nil(t, tree.Close(nil))
+}
+
+func TestTree_Reopen(t *testing.T) {
+	tree, path := openTree(t, 0)
+	defer os.Remove(path)
+
+	for i := 0; i < 10000; i++ {
+		_, _, err := tree.Put(getKey(i), getKey(i))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tree.Close([]byte("checkpoint")))
+
+	tree, err := Open(path, 0, false)
+	assert.Nil(t, err)
+	cp, clean := tree.Checkpoint()
+	assert.True(t, clean)
+	assert.Equal(t, []byte("checkpoint"), cp)
+	assert.Equal(t, 10000, tree.Size())
+	for i := 0; i < 10000; i++ {
+		val, err := tree.Get(getKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, getKey(i), val)
+	}
+
+	// not closed, it won`t be clean.
+	tree2, err := Open(path, 0, true)
+	assert.Nil(t, err)
+	_, clean = tree2.Checkpoint()
+	assert.False(t, clean)
+	_, _, err = tree2.Put(getKey(0), nil)
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Nil(t, tree2.Close(nil))
+
+	assert.Nil(t, tree.Reset())
+	assert.Equal(t, 0, tree.Size())
+	val, err := tree.Get(getKey(0))
+	assert.Nil(t, err)
+	assert.Nil(t, val)
+	assert.Nil(t, tree.Close(nil))
+}
+
+func TestTree_Limits(t *testing.T) {
+	tree, path := openTree(t, 0)
+	defer os.Remove(path)
+
+	_, _, err := tree.Put(make([]byte, MaxKeySize+1), nil)
+	assert.Equal(t, ErrKeyTooLarge, err)
+	_, _, err = tree.Put([]byte("key"), make([]byte, MaxValueSize+1))
+	assert.Equal(t, ErrValueTooLarge, err)
+	assert.Equal(t, ErrCheckpointTooLarge, tree.Close(make([]byte, MaxCheckpointSize+1)))
+	assert.Nil(t, tree.Close(nil))
+
+	// big keys split pages as well.
+	tree, err = Open(path, 0, false)
+	assert.Nil(t, err)
+	for i := 0; i < 500; i++ {
+		key := append(bytes.Repeat([]byte("k"), MaxKeySize-10), getKey(i)[len(getKey(i))-9:]...)
+		_, _, err := tree.Put(key, make([]byte, MaxValueSize))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 500, tree.Size())
+	assert.Nil(t, tree.Close(nil))
+
+	err = os.WriteFile(path, []byte("not a b+tree file"), 0644)
+	assert.Nil(t, err)
+	_, err = Open(path, 0, false)
+	assert.Equal(t, ErrInvalidFile, err)
+}
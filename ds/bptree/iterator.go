@@ -0,0 +1,97 @@
+package bptree
+
+// Iterator iterates keys of tree in order by following the linked leaves.
+// The tree must not be modified while iterating, it is not a snapshot.
+type Iterator struct {
+	t    *Tree
+	leaf uint64
+	idx  int
+	err  error
+}
+
+// Iterator returns an iterator positioned at the first key of tree.
+func (t *Tree) Iterator() *Iterator {
+	return &Iterator{t: t}
+}
+
+// Seek position the iterator at the first key which is greater than or equal to key.
+func (it *Iterator) Seek(key []byte) {
+	t := it.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	leaf, err := t.findLeaf(key)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.leaf = leaf.id
+	it.idx, _ = leaf.search(key)
+	it.err = t.shrink()
+}
+
+// HasNext returns whether there are more keys, it returns false if an error occurs.
+func (it *Iterator) HasNext() bool {
+	t := it.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := it.current()
+	if err := t.shrink(); err != nil && it.err == nil {
+		it.err = err
+	}
+	return ok && it.err == nil
+}
+
+// Next returns the current key and value, and moves to the next one.
+func (it *Iterator) Next() (key, value []byte) {
+	t := it.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	leaf, ok := it.current()
+	if ok {
+		key = append([]byte(nil), leaf.keys[it.idx]...)
+		value = append([]byte(nil), leaf.values[it.idx]...)
+		it.idx++
+	}
+	if err := t.shrink(); err != nil && it.err == nil {
+		it.err = err
+	}
+	return
+}
+
+// Err returns the error occurred while iterating.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// current returns the leaf of current key, empty leaves are skipped.
+// must hold the lock of tree before invoking.
+func (it *Iterator) current() (*node, bool) {
+	if it.err != nil {
+		return nil, false
+	}
+	if it.leaf == 0 {
+		n, err := it.t.load(it.t.root)
+		for err == nil && !n.leaf {
+			n, err = it.t.load(n.children[0])
+		}
+		if err != nil {
+			it.err = err
+			return nil, false
+		}
+		it.leaf, it.idx = n.id, 0
+	}
+	for {
+		leaf, err := it.t.load(it.leaf)
+		if err != nil {
+			it.err = err
+			return nil, false
+		}
+		if it.idx < len(leaf.keys) {
+			return leaf, true
+		}
+		if leaf.next == 0 {
+			return nil, false
+		}
+		it.leaf, it.idx = leaf.next, 0
+	}
+}
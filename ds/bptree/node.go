@@ -0,0 +1,173 @@
+package bptree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+const (
+	kindLeaf     byte = 1
+	kindInternal byte = 2
+
+	// kind(1) + count(2) + next(8)
+	nodeHeaderSize = 11
+	childSize      = 8
+)
+
+// node is a page of tree decoded in memory.
+// A leaf holds keys and values, an internal node holds keys and len(keys)+1 children.
+type node struct {
+	id       uint64
+	leaf     bool
+	keys     [][]byte
+	values   [][]byte
+	children []uint64
+	next     uint64 // the next leaf, 0 means this is the last one.
+	dirty    bool
+}
+
+// search returns the position of key in node, and whether it is found.
+func (n *node) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) >= 0
+	})
+	return i, i < len(n.keys) && bytes.Equal(n.keys[i], key)
+}
+
+// childIndex returns the index of child which may contain key, keys[i-1] <= key < keys[i].
+func (n *node) childIndex(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) > 0
+	})
+}
+
+func (n *node) entrySize(i int) int {
+	size := uvarintSize(len(n.keys[i])) + len(n.keys[i])
+	if n.leaf {
+		return size + uvarintSize(len(n.values[i])) + len(n.values[i])
+	}
+	return size + childSize
+}
+
+func (n *node) size() int {
+	size := nodeHeaderSize
+	if !n.leaf {
+		size += childSize
+	}
+	for i := range n.keys {
+		size += n.entrySize(i)
+	}
+	return size
+}
+
+// splitIndex returns the index where node is split, so that both halves have about the same bytes.
+func (n *node) splitIndex() int {
+	half, acc := n.size()/2, nodeHeaderSize
+	for i := range n.keys {
+		acc += n.entrySize(i)
+		if acc > half {
+			if i == 0 {
+				return 1
+			}
+			if i >= len(n.keys)-1 {
+				return len(n.keys) - 1
+			}
+			return i
+		}
+	}
+	return len(n.keys) / 2
+}
+
+func (n *node) encode(buf []byte) {
+	if n.leaf {
+		buf[0] = kindLeaf
+	} else {
+		buf[0] = kindInternal
+	}
+	binary.LittleEndian.PutUint16(buf[1:3], uint16(len(n.keys)))
+	binary.LittleEndian.PutUint64(buf[3:11], n.next)
+
+	index := nodeHeaderSize
+	if !n.leaf {
+		binary.LittleEndian.PutUint64(buf[index:], n.children[0])
+		index += childSize
+	}
+	for i, key := range n.keys {
+		index += binary.PutUvarint(buf[index:], uint64(len(key)))
+		index += copy(buf[index:], key)
+		if n.leaf {
+			index += binary.PutUvarint(buf[index:], uint64(len(n.values[i])))
+			index += copy(buf[index:], n.values[i])
+		} else {
+			binary.LittleEndian.PutUint64(buf[index:], n.children[i+1])
+			index += childSize
+		}
+	}
+}
+
+func decodeNode(id uint64, buf []byte) (*node, error) {
+	if len(buf) < nodeHeaderSize || (buf[0] != kindLeaf && buf[0] != kindInternal) {
+		return nil, ErrInvalidFile
+	}
+	count := int(binary.LittleEndian.Uint16(buf[1:3]))
+	n := &node{
+		id:   id,
+		leaf: buf[0] == kindLeaf,
+		keys: make([][]byte, count),
+		next: binary.LittleEndian.Uint64(buf[3:11]),
+	}
+
+	index := nodeHeaderSize
+	readBytes := func() ([]byte, bool) {
+		size, i := binary.Uvarint(buf[index:])
+		if i <= 0 || index+i+int(size) > len(buf) {
+			return nil, false
+		}
+		index += i
+		b := make([]byte, size)
+		index += copy(b, buf[index:])
+		return b, true
+	}
+	readChild := func() (uint64, bool) {
+		if index+childSize > len(buf) {
+			return 0, false
+		}
+		child := binary.LittleEndian.Uint64(buf[index:])
+		index += childSize
+		return child, true
+	}
+
+	var ok bool
+	if n.leaf {
+		n.values = make([][]byte, count)
+	} else {
+		n.children = make([]uint64, count+1)
+		if n.children[0], ok = readChild(); !ok {
+			return nil, ErrInvalidFile
+		}
+	}
+	for i := 0; i < count; i++ {
+		if n.keys[i], ok = readBytes(); !ok {
+			return nil, ErrInvalidFile
+		}
+		if n.leaf {
+			n.values[i], ok = readBytes()
+		} else {
+			n.children[i+1], ok = readChild()
+		}
+		if !ok {
+			return nil, ErrInvalidFile
+		}
+	}
+	return n, nil
+}
+
+func uvarintSize(x int) int {
+	size := 1
+	for x >= 0x80 {
+		x >>= 7
+		size++
+	}
+	return size
+}
@@ -0,0 +1,348 @@
+package btree
+
+import (
+	"bytes"
+	"sort"
+)
+
+// btree is an in-memory B-tree, keys are sorted in bytes order.
+
+// degree the minimum degree of tree, every node except root holds [degree-1, 2*degree-1] items.
+const degree = 32
+
+const maxItems = 2*degree - 1
+
+type (
+	// BTree an in-memory B-tree, it is not safe for concurrent use.
+	BTree struct {
+		root *node
+		size int
+	}
+
+	item struct {
+		key   []byte
+		value interface{}
+	}
+
+	node struct {
+		items    []item
+		children []*node
+	}
+
+	// Iterator iterates the items of tree in order, the tree must not be modified while iterating.
+	Iterator struct {
+		stack []frame
+	}
+
+	// frame the next item of node to be iterated, the children on its left are done.
+	frame struct {
+		n *node
+		i int
+	}
+)
+
+// New create an empty B-tree.
+func New() *BTree {
+	return &BTree{}
+}
+
+// Put key and value into tree, returns the old value if key exists.
+func (t *BTree) Put(key []byte, value interface{}) (oldVal interface{}, updated bool) {
+	if t.root == nil {
+		t.root = &node{items: []item{{key: key, value: value}}}
+		t.size++
+		return nil, false
+	}
+	if len(t.root.items) >= maxItems {
+		root := &node{children: []*node{t.root}}
+		root.splitChild(0)
+		t.root = root
+	}
+	oldVal, updated = t.root.insert(key, value)
+	if !updated {
+		t.size++
+	}
+	return
+}
+
+// Get the value of key, returns nil if not found.
+func (t *BTree) Get(key []byte) interface{} {
+	n := t.root
+	for n != nil {
+		i, found := n.search(key)
+		if found {
+			return n.items[i].value
+		}
+		if n.leaf() {
+			return nil
+		}
+		n = n.children[i]
+	}
+	return nil
+}
+
+// Delete key from tree, returns the old value if key exists.
+func (t *BTree) Delete(key []byte) (val interface{}, deleted bool) {
+	if t.root == nil {
+		return nil, false
+	}
+	val, deleted = t.root.remove(key)
+	if len(t.root.items) == 0 {
+		if t.root.leaf() {
+			t.root = nil
+		} else {
+			t.root = t.root.children[0]
+		}
+	}
+	if deleted {
+		t.size--
+	}
+	return
+}
+
+// Size returns the number of keys in tree.
+func (t *BTree) Size() int {
+	return t.size
+}
+
+// Iterator returns an iterator positioned at the first key of tree.
+func (t *BTree) Iterator() *Iterator {
+	return t.Seek(nil)
+}
+
+// Seek returns an iterator positioned at the first key which is greater than or equal to key.
+func (t *BTree) Seek(key []byte) *Iterator {
+	it := &Iterator{}
+	for n := t.root; n != nil; {
+		i, found := n.search(key)
+		it.stack = append(it.stack, frame{n: n, i: i})
+		if found || n.leaf() {
+			break
+		}
+		n = n.children[i]
+	}
+	return it
+}
+
+// PrefixScan returns at most count keys with the prefix in order.
+func (t *BTree) PrefixScan(prefix []byte, count int) (keys [][]byte) {
+	it := t.Seek(prefix)
+	for count > 0 && it.HasNext() {
+		key, _ := it.Next()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+		count--
+	}
+	return
+}
+
+// HasNext returns whether there are more items.
+func (it *Iterator) HasNext() bool {
+	for len(it.stack) > 0 {
+		top := it.stack[len(it.stack)-1]
+		if top.i < len(top.n.items) {
+			return true
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	return false
+}
+
+// Next returns the current key and value, and moves to the next one.
+func (it *Iterator) Next() ([]byte, interface{}) {
+	if !it.HasNext() {
+		return nil, nil
+	}
+	top := &it.stack[len(it.stack)-1]
+	n, cur := top.n, top.n.items[top.i]
+	top.i++
+	if !n.leaf() {
+		for child := n.children[top.i]; child != nil; {
+			it.stack = append(it.stack, frame{n: child})
+			if child.leaf() {
+				break
+			}
+			child = child.children[0]
+		}
+	}
+	return cur.key, cur.value
+}
+
+func (n *node) leaf() bool {
+	return len(n.children) == 0
+}
+
+// search returns the position of key in node, and whether it is found.
+func (n *node) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool {
+		return bytes.Compare(n.items[i].key, key) >= 0
+	})
+	return i, i < len(n.items) && bytes.Equal(n.items[i].key, key)
+}
+
+// insert key into the subtree, the node must not be full.
+func (n *node) insert(key []byte, value interface{}) (interface{}, bool) {
+	i, found := n.search(key)
+	if found {
+		oldVal := n.items[i].value
+		n.items[i].value = value
+		return oldVal, true
+	}
+	if n.leaf() {
+		n.insertItem(i, item{key: key, value: value})
+		return nil, false
+	}
+	if len(n.children[i].items) >= maxItems {
+		n.splitChild(i)
+		switch cmp := bytes.Compare(key, n.items[i].key); {
+		case cmp == 0:
+			oldVal := n.items[i].value
+			n.items[i].value = value
+			return oldVal, true
+		case cmp > 0:
+			i++
+		}
+	}
+	return n.children[i].insert(key, value)
+}
+
+// splitChild split the full child at i into two, the middle item moves up to node.
+func (n *node) splitChild(i int) {
+	child := n.children[i]
+	mid := child.items[degree-1]
+	right := &node{items: append([]item(nil), child.items[degree:]...)}
+	if !child.leaf() {
+		right.children = append([]*node(nil), child.children[degree:]...)
+		child.children = truncateChildren(child.children, degree)
+	}
+	child.items = truncateItems(child.items, degree-1)
+
+	n.insertItem(i, mid)
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = right
+}
+
+// remove key from the subtree, it makes sure the child descended into has at least degree items.
+func (n *node) remove(key []byte) (interface{}, bool) {
+	i, found := n.search(key)
+	if n.leaf() {
+		if !found {
+			return nil, false
+		}
+		val := n.items[i].value
+		n.removeItem(i)
+		return val, true
+	}
+
+	if found {
+		val := n.items[i].value
+		switch {
+		case len(n.children[i].items) >= degree:
+			pred := n.children[i].max()
+			n.children[i].remove(pred.key)
+			n.items[i] = pred
+		case len(n.children[i+1].items) >= degree:
+			succ := n.children[i+1].min()
+			n.children[i+1].remove(succ.key)
+			n.items[i] = succ
+		default:
+			n.merge(i)
+			n.children[i].remove(key)
+		}
+		return val, true
+	}
+
+	if len(n.children[i].items) < degree {
+		switch {
+		case i > 0 && len(n.children[i-1].items) >= degree:
+			n.borrowFromLeft(i)
+		case i < len(n.children)-1 && len(n.children[i+1].items) >= degree:
+			n.borrowFromRight(i)
+		case i < len(n.children)-1:
+			n.merge(i)
+		default:
+			n.merge(i - 1)
+			i--
+		}
+	}
+	return n.children[i].remove(key)
+}
+
+// borrowFromLeft move an item from the left sibling to child i through node.
+func (n *node) borrowFromLeft(i int) {
+	child, left := n.children[i], n.children[i-1]
+	child.insertItem(0, n.items[i-1])
+	n.items[i-1] = left.items[len(left.items)-1]
+	left.items = truncateItems(left.items, len(left.items)-1)
+	if !left.leaf() {
+		child.children = append([]*node{left.children[len(left.children)-1]}, child.children...)
+		left.children = truncateChildren(left.children, len(left.children)-1)
+	}
+}
+
+// borrowFromRight move an item from the right sibling to child i through node.
+func (n *node) borrowFromRight(i int) {
+	child, right := n.children[i], n.children[i+1]
+	child.items = append(child.items, n.items[i])
+	n.items[i] = right.items[0]
+	right.removeItem(0)
+	if !right.leaf() {
+		child.children = append(child.children, right.children[0])
+		copy(right.children, right.children[1:])
+		right.children = truncateChildren(right.children, len(right.children)-1)
+	}
+}
+
+// merge child i, item i and child i+1 into child i.
+func (n *node) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	n.removeItem(i)
+	copy(n.children[i+1:], n.children[i+2:])
+	n.children = truncateChildren(n.children, len(n.children)-1)
+}
+
+func (n *node) min() item {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.items[0]
+}
+
+func (n *node) max() item {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.items[len(n.items)-1]
+}
+
+func (n *node) insertItem(i int, it item) {
+	n.items = append(n.items, item{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = it
+}
+
+func (n *node) removeItem(i int) {
+	copy(n.items[i:], n.items[i+1:])
+	n.items = truncateItems(n.items, len(n.items)-1)
+}
+
+// truncateItems clear the references beyond size, so they can be collected by gc.
+func truncateItems(items []item, size int) []item {
+	for i := size; i < len(items); i++ {
+		items[i] = item{}
+	}
+	return items[:size]
+}
+
+func truncateChildren(children []*node, size int) []*node {
+	for i := size; i < len(children); i++ {
+		children[i] = nil
+	}
+	return children[:size]
+}
@@ -0,0 +1,96 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getKey(i int) []byte {
+	return []byte(fmt.Sprintf("btree-test-key-%09d", i))
+}
+
+func TestBTree_PutGetDelete(t *testing.T) {
+	tree := New()
+	expected := make(map[string]interface{})
+	for i := 0; i < 50000; i++ {
+		k := rand.Intn(10000)
+		key := getKey(k)
+		switch rand.Intn(3) {
+		case 0, 1:
+			old, updated := tree.Put(key, i)
+			want, ok := expected[string(key)]
+			assert.Equal(t, ok, updated)
+			assert.Equal(t, want, old)
+			expected[string(key)] = i
+		case 2:
+			val, deleted := tree.Delete(key)
+			want, ok := expected[string(key)]
+			assert.Equal(t, ok, deleted)
+			assert.Equal(t, want, val)
+			delete(expected, string(key))
+		}
+	}
+	assert.Equal(t, len(expected), tree.Size())
+	for i := 0; i < 10000; i++ {
+		assert.Equal(t, expected[string(getKey(i))], tree.Get(getKey(i)))
+	}
+
+	// delete all keys.
+	for key := range expected {
+		_, deleted := tree.Delete([]byte(key))
+		assert.True(t, deleted)
+	}
+	assert.Equal(t, 0, tree.Size())
+	assert.Nil(t, tree.root)
+	assert.False(t, tree.Iterator().HasNext())
+}
+
+func TestBTree_Iterator(t *testing.T) {
+	tree := New()
+	var keys [][]byte
+	for _, i := range rand.Perm(10000) {
+		tree.Put(getKey(i), i)
+		if i%3 != 0 {
+			keys = append(keys, getKey(i))
+		}
+	}
+	for i := 0; i < 10000; i += 3 {
+		tree.Delete(getKey(i))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+
+	var got [][]byte
+	iter := tree.Iterator()
+	for iter.HasNext() {
+		key, _ := iter.Next()
+		got = append(got, key)
+	}
+	assert.Equal(t, keys, got)
+
+	iter = tree.Seek(getKey(3000))
+	key, value := iter.Next()
+	assert.Equal(t, getKey(3001), key)
+	assert.Equal(t, 3001, value)
+	assert.False(t, tree.Seek([]byte("zzz")).HasNext())
+}
+
+func TestBTree_PrefixScan(t *testing.T) {
+	tree := New()
+	for i := 0; i < 3000; i++ {
+		tree.Put(getKey(i), i)
+	}
+	keys := tree.PrefixScan([]byte("btree-test-key-0000001"), 50)
+	assert.Equal(t, 50, len(keys))
+	assert.Equal(t, getKey(100), keys[0])
+
+	assert.Equal(t, 10, len(tree.PrefixScan([]byte("btree-test-key-00000002"), 100)))
+	assert.Equal(t, 0, len(tree.PrefixScan(nil, 0)))
+	assert.Equal(t, 0, len(tree.PrefixScan([]byte("not-exist"), 10)))
+}
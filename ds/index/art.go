@@ -0,0 +1,101 @@
+package index
+
+import (
+	"github.com/herott-ai/godb/ds/art"
+	goart "github.com/plar/go-adaptive-radix-tree"
+)
+
+type (
+	artIndex struct {
+		*art.AdaptiveRadixTree
+	}
+
+	artIterator struct {
+		iter    goart.Iterator
+		pending bool // the key read ahead by HasNext is not returned yet.
+		key     []byte
+		value   interface{}
+		done    bool
+	}
+
+	artSeekIterator struct {
+		tree   *art.AdaptiveRadixTree
+		from   []byte // the key to read the next batch from.
+		keys   [][]byte
+		values []interface{}
+		done   bool
+	}
+)
+
+// artSeekBatch number of keys read by a seek iterator at a time.
+const artSeekBatch = 64
+
+func newARTIndex() *artIndex {
+	return &artIndex{AdaptiveRadixTree: art.NewART()}
+}
+
+func (idx *artIndex) Iterator() Iterator {
+	return &artIterator{iter: idx.AdaptiveRadixTree.Iterator()}
+}
+
+// Seek returns an iterator which reads the keys greater than or equal to key in batches, see art.SeekScan.
+func (idx *artIndex) Seek(key []byte) Iterator {
+	return &artSeekIterator{tree: idx.AdaptiveRadixTree, from: key}
+}
+
+// HasNext reads the next leaf ahead, the HasNext of goart.Iterator moves to the next leaf too.
+func (it *artIterator) HasNext() bool {
+	if it.pending {
+		return true
+	}
+	if it.done || !it.iter.HasNext() {
+		it.done = true
+		return false
+	}
+	node, err := it.iter.Next()
+	if err != nil || node == nil {
+		it.done = true
+		return false
+	}
+	it.pending, it.key, it.value = true, node.Key(), node.Value()
+	return true
+}
+
+func (it *artIterator) Next() ([]byte, interface{}) {
+	if !it.HasNext() {
+		return nil, nil
+	}
+	it.pending = false
+	return it.key, it.value
+}
+
+func (it *artSeekIterator) HasNext() bool {
+	if len(it.keys) > 0 {
+		return true
+	}
+	if it.done {
+		return false
+	}
+	it.tree.SeekScan(it.from, func(key []byte, value interface{}) bool {
+		it.keys = append(it.keys, key)
+		it.values = append(it.values, value)
+		return len(it.keys) < artSeekBatch
+	})
+	if len(it.keys) < artSeekBatch {
+		it.done = true
+	} else {
+		// the smallest key greater than the last one.
+		last := it.keys[len(it.keys)-1]
+		it.from = append(last[:len(last):len(last)], 0)
+	}
+	return len(it.keys) > 0
+}
+
+func (it *artSeekIterator) Next() ([]byte, interface{}) {
+	if !it.HasNext() {
+		return nil, nil
+	}
+	key, value := it.keys[0], it.values[0]
+	it.keys, it.values = it.keys[1:], it.values[1:]
+	return key, value
+}
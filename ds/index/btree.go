@@ -0,0 +1,19 @@
+package index
+
+import "github.com/herott-ai/godb/ds/btree"
+
+type btreeIndex struct {
+	*btree.BTree
+}
+
+func newBTreeIndex() *btreeIndex {
+	return &btreeIndex{BTree: btree.New()}
+}
+
+func (idx *btreeIndex) Iterator() Iterator {
+	return idx.BTree.Iterator()
+}
+
+func (idx *btreeIndex) Seek(key []byte) Iterator {
+	return idx.BTree.Seek(key)
+}
@@ -0,0 +1,110 @@
+package index
+
+import (
+	"bytes"
+	"sort"
+)
+
+type (
+	hashMapIndex struct {
+		m map[string]interface{}
+	}
+
+	// hashMapIterator iterates a snapshot of keys.
+	hashMapIterator struct {
+		m    map[string]interface{}
+		keys []string
+	}
+)
+
+func newHashMapIndex() *hashMapIndex {
+	return &hashMapIndex{m: make(map[string]interface{})}
+}
+
+func (idx *hashMapIndex) Put(key []byte, value interface{}) (oldVal interface{}, updated bool) {
+	oldVal, updated = idx.m[string(key)]
+	idx.m[string(key)] = value
+	return
+}
+
+func (idx *hashMapIndex) Get(key []byte) interface{} {
+	return idx.m[string(key)]
+}
+
+func (idx *hashMapIndex) Delete(key []byte) (val interface{}, updated bool) {
+	val, updated = idx.m[string(key)]
+	if updated {
+		delete(idx.m, string(key))
+	}
+	return
+}
+
+// Iterator returns keys in random order.
+func (idx *hashMapIndex) Iterator() Iterator {
+	keys := make([]string, 0, len(idx.m))
+	for key := range idx.m {
+		keys = append(keys, key)
+	}
+	return &hashMapIterator{m: idx.m, keys: keys}
+}
+
+// Seek scan all keys, and sort the keys greater than or equal to key.
+func (idx *hashMapIndex) Seek(key []byte) Iterator {
+	var keys []string
+	for k := range idx.m {
+		if k >= string(key) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return &hashMapIterator{m: idx.m, keys: keys}
+}
+
+// Sample returns at most n keys, they are picked randomly by the iteration of map.
+func (idx *hashMapIndex) Sample(n int) [][]byte {
+	keys := make([][]byte, 0, n)
+	for k := range idx.m {
+		if len(keys) >= n {
+			break
+		}
+		keys = append(keys, []byte(k))
+	}
+	return keys
+}
+
+// PrefixScan scan all keys, and sort the keys with the prefix.
+func (idx *hashMapIndex) PrefixScan(prefix []byte, count int) [][]byte {
+	if count <= 0 {
+		return nil
+	}
+	var keys [][]byte
+	for k := range idx.m {
+		if len(k) >= len(prefix) && k[:len(prefix)] == string(prefix) {
+			keys = append(keys, []byte(k))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	if len(keys) > count {
+		keys = keys[:count]
+	}
+	return keys
+}
+
+func (idx *hashMapIndex) Size() int {
+	return len(idx.m)
+}
+
+func (it *hashMapIterator) HasNext() bool {
+	return len(it.keys) > 0
+}
+
+func (it *hashMapIterator) Next() ([]byte, interface{}) {
+	if len(it.keys) == 0 {
+		return nil, nil
+	}
+	key := it.keys[0]
+	it.keys = it.keys[1:]
+	return []byte(key), it.m[key]
+}
@@ -0,0 +1,209 @@
+package index
+
+import "sync/atomic"
+
+// Type the data structure of an index.
+type Type int8
+
+const (
+	// ART adaptive radix tree, keys are ordered and common prefixes are shared.
+	ART Type = iota
+	// BTree in-memory B-tree, keys are ordered and Seek is cheap.
+	BTree
+	// HashMap keys are unordered, Put, Get and Delete are the cheapest.
+	// But Seek and PrefixScan have to scan all keys, so it is suitable for workloads that never scan.
+	HashMap
+)
+
+// leafOverhead approximate memory used by a key in index besides the key and value.
+const leafOverhead = 64
+
+type (
+	// Index maps keys to values in memory, it is not safe for concurrent use.
+	Index interface {
+		// Put key and value, returns the old value if key exists.
+		Put(key []byte, value interface{}) (oldVal interface{}, updated bool)
+		// Get the value of key, returns nil if not found.
+		Get(key []byte) interface{}
+		// Delete key, returns the old value if key exists.
+		Delete(key []byte) (val interface{}, updated bool)
+		// Iterator returns an iterator of all keys, keys are in order if the index is ordered.
+		Iterator() Iterator
+		// Seek returns an iterator of the keys greater than or equal to key in order.
+		Seek(key []byte) Iterator
+		// PrefixScan returns at most count keys with the prefix in order.
+		PrefixScan(prefix []byte, count int) [][]byte
+		// Size returns the number of keys.
+		Size() int
+	}
+
+	// Sampler is implemented by the unordered indexes, which can pick some keys randomly without Seek.
+	Sampler interface {
+		// Sample returns at most n keys.
+		Sample(n int) [][]byte
+	}
+
+	// Iterator iterates keys of an index, the index must not be modified while iterating.
+	Iterator interface {
+		HasNext() bool
+		Next() (key []byte, value interface{})
+	}
+
+	// Sizer is implemented by values that know their approximate memory usage.
+	Sizer interface {
+		MemSize() int64
+	}
+
+	// Expirer is implemented by values that may expire, ExpiredAt returns 0 if the value never expires.
+	Expirer interface {
+		ExpiredAt() int64
+	}
+
+	// Tree an index whose memory usage is accounted, MemSize can be called concurrently with the updates.
+	// A tree created by NewPackedTree keeps its keys in a sorted slice until it has more than maxPacked keys,
+	// then it is converted to the index of its type, and never converted back.
+	Tree struct {
+		memSize int64
+		Index
+		typ       Type
+		maxPacked int
+		packed    bool
+		counter   *int64 // shared by many trees, the memory changes are also added to it.
+		volatile  int    // number of values that may expire, see Expirer.
+	}
+)
+
+// New create an empty index of the type.
+func New(typ Type) Index {
+	switch typ {
+	case BTree:
+		return newBTreeIndex()
+	case HashMap:
+		return newHashMapIndex()
+	default:
+		return newARTIndex()
+	}
+}
+
+// NewTree create an empty index of the type, whose memory changes are also added to counter atomically if it is not nil.
+func NewTree(typ Type, counter *int64) *Tree {
+	return &Tree{Index: New(typ), typ: typ, counter: counter}
+}
+
+// NewPackedTree create an empty tree which is packed until it has more than maxPacked keys, see NewTree.
+// Small trees are much more compact when packed, and a few keys can be found by binary search quickly.
+func NewPackedTree(typ Type, counter *int64, maxPacked int) *Tree {
+	if maxPacked <= 0 {
+		return NewTree(typ, counter)
+	}
+	return &Tree{Index: newPackedIndex(), typ: typ, maxPacked: maxPacked, packed: true, counter: counter}
+}
+
+// Put key and value, returns the old value if key exists.
+func (t *Tree) Put(key []byte, value interface{}) (oldVal interface{}, updated bool) {
+	// indexes of different types treat empty key differently, keep the behavior of tree type.
+	if t.packed && len(key) == 0 {
+		t.unpack()
+	}
+	oldVal, updated = t.Index.Put(key, value)
+	delta := t.leafSize(key, value)
+	t.volatile += volatile(value)
+	if updated {
+		delta -= t.leafSize(key, oldVal)
+		t.volatile -= volatile(oldVal)
+	}
+	t.addMemSize(delta)
+	if t.packed && t.Index.Size() > t.maxPacked {
+		t.unpack()
+	}
+	return
+}
+
+// Delete key, returns the old value if key exists.
+func (t *Tree) Delete(key []byte) (val interface{}, updated bool) {
+	val, updated = t.Index.Delete(key)
+	if updated {
+		t.addMemSize(-t.leafSize(key, val))
+		t.volatile -= volatile(val)
+	}
+	return
+}
+
+// Volatile returns the number of values that may expire, see Expirer.
+// If it is 0, none of the values has expired, and they needn`t be checked one by one.
+func (t *Tree) Volatile() int {
+	return t.volatile
+}
+
+// Packed returns whether the keys are kept in a sorted slice.
+func (t *Tree) Packed() bool {
+	return t.packed
+}
+
+// Sample returns at most n keys picked randomly if the index is unordered, ok is false if it can`t sample keys, see Sampler.
+func (t *Tree) Sample(n int) (keys [][]byte, ok bool) {
+	sampler, ok := t.Index.(Sampler)
+	if !ok {
+		return nil, false
+	}
+	return sampler.Sample(n), true
+}
+
+// MemSize returns the approximate memory used by keys and values in tree.
+func (t *Tree) MemSize() int64 {
+	return atomic.LoadInt64(&t.memSize)
+}
+
+// Clear remove all keys in tree, it is used when the tree is dropped.
+func (t *Tree) Clear() {
+	if t.maxPacked > 0 {
+		t.Index, t.packed = newPackedIndex(), true
+	} else {
+		t.Index = New(t.typ)
+	}
+	t.volatile = 0
+	t.addMemSize(-atomic.LoadInt64(&t.memSize))
+}
+
+// unpack convert the packed keys to the index of tree type.
+func (t *Tree) unpack() {
+	idx := New(t.typ)
+	iter := t.Index.Iterator()
+	for iter.HasNext() {
+		key, value := iter.Next()
+		idx.Put(key, value)
+	}
+	t.Index, t.packed = idx, false
+	t.addMemSize(int64(idx.Size()) * (leafOverhead - packedOverhead))
+}
+
+func (t *Tree) leafSize(key []byte, value interface{}) int64 {
+	if t.packed {
+		return LeafSize(key, value) - (leafOverhead - packedOverhead)
+	}
+	return LeafSize(key, value)
+}
+
+func (t *Tree) addMemSize(delta int64) {
+	atomic.AddInt64(&t.memSize, delta)
+	if t.counter != nil && delta != 0 {
+		atomic.AddInt64(t.counter, delta)
+	}
+}
+
+// volatile returns 1 if value may expire, otherwise 0.
+func volatile(value interface{}) int {
+	if expirer, ok := value.(Expirer); ok && expirer.ExpiredAt() != 0 {
+		return 1
+	}
+	return 0
+}
+
+// LeafSize returns the approximate memory used by a key and its value in index.
+func LeafSize(key []byte, value interface{}) int64 {
+	size := int64(leafOverhead + len(key))
+	if sizer, ok := value.(Sizer); ok {
+		size += sizer.MemSize()
+	}
+	return size
+}
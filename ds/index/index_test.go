@@ -0,0 +1,241 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var types = []struct {
+	name string
+	typ  Type
+}{
+	{"art", ART},
+	{"btree", BTree},
+	{"hashmap", HashMap},
+}
+
+func getKey(i int) []byte {
+	return []byte(fmt.Sprintf("index-test-key-%09d", i))
+}
+
+func TestIndex_PutGetDelete(t *testing.T) {
+	for _, tt := range types {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := New(tt.typ)
+			old, updated := idx.Put(getKey(1), 1)
+			assert.Nil(t, old)
+			assert.False(t, updated)
+			old, updated = idx.Put(getKey(1), 2)
+			assert.Equal(t, 1, old)
+			assert.True(t, updated)
+			idx.Put(getKey(2), 3)
+
+			assert.Equal(t, 2, idx.Get(getKey(1)))
+			assert.Nil(t, idx.Get(getKey(3)))
+			assert.Equal(t, 2, idx.Size())
+
+			val, deleted := idx.Delete(getKey(1))
+			assert.Equal(t, 2, val)
+			assert.True(t, deleted)
+			val, deleted = idx.Delete(getKey(1))
+			assert.Nil(t, val)
+			assert.False(t, deleted)
+			assert.Equal(t, 1, idx.Size())
+		})
+	}
+}
+
+func TestIndex_Iterator(t *testing.T) {
+	for _, tt := range types {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := New(tt.typ)
+			var keys [][]byte
+			for _, i := range rand.Perm(1000) {
+				idx.Put(getKey(i), i)
+				keys = append(keys, getKey(i))
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				return bytes.Compare(keys[i], keys[j]) < 0
+			})
+
+			var got [][]byte
+			iter := idx.Iterator()
+			for iter.HasNext() {
+				key, value := iter.Next()
+				assert.Equal(t, getKey(value.(int)), key)
+				got = append(got, key)
+			}
+			// hash map is unordered.
+			if tt.typ == HashMap {
+				sort.Slice(got, func(i, j int) bool {
+					return bytes.Compare(got[i], got[j]) < 0
+				})
+			}
+			assert.Equal(t, keys, got)
+
+			got = nil
+			iter = idx.Seek([]byte("index-test-key-0000009"))
+			for iter.HasNext() {
+				key, _ := iter.Next()
+				got = append(got, key)
+			}
+			assert.Equal(t, keys[900:], got)
+			assert.False(t, idx.Seek([]byte("zzz")).HasNext())
+		})
+	}
+}
+
+func TestIndex_PrefixScan(t *testing.T) {
+	for _, tt := range types {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := New(tt.typ)
+			for _, i := range rand.Perm(1000) {
+				idx.Put(getKey(i), i)
+			}
+			keys := idx.PrefixScan([]byte("index-test-key-0000001"), 20)
+			assert.Equal(t, 20, len(keys))
+			assert.Equal(t, getKey(100), keys[0])
+			assert.Equal(t, getKey(119), keys[19])
+
+			assert.Equal(t, 10, len(idx.PrefixScan([]byte("index-test-key-00000002"), 100)))
+			assert.Equal(t, 0, len(idx.PrefixScan(nil, 0)))
+			assert.Equal(t, 0, len(idx.PrefixScan([]byte("not-exist"), 10)))
+		})
+	}
+}
+
+func TestTree_MemSize(t *testing.T) {
+	for _, tt := range types {
+		t.Run(tt.name, func(t *testing.T) {
+			var counter int64
+			tree := NewTree(tt.typ, &counter)
+			tree.Put([]byte("a"), 1)
+			tree.Put([]byte("b"), 2)
+			assert.Equal(t, int64(2*(leafOverhead+1)), tree.MemSize())
+			assert.Equal(t, tree.MemSize(), counter)
+
+			// update doesn`t change the size.
+			tree.Put([]byte("a"), 3)
+			assert.Equal(t, int64(2*(leafOverhead+1)), tree.MemSize())
+
+			tree.Delete([]byte("a"))
+			tree.Delete([]byte("not-exist"))
+			assert.Equal(t, int64(leafOverhead+1), tree.MemSize())
+			assert.Equal(t, tree.MemSize(), counter)
+
+			tree2 := NewTree(tt.typ, &counter)
+			tree2.Put([]byte("key"), 1)
+			tree.Clear()
+			assert.Equal(t, int64(0), tree.MemSize())
+			assert.Equal(t, 0, tree.Size())
+			assert.Equal(t, int64(leafOverhead+3), counter)
+		})
+	}
+}
+
+type expiringValue int64
+
+func (v expiringValue) ExpiredAt() int64 { return int64(v) }
+
+func TestTree_Volatile(t *testing.T) {
+	for _, tt := range types {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewPackedTree(tt.typ, nil, 2)
+			tree.Put([]byte("a"), expiringValue(10))
+			tree.Put([]byte("b"), expiringValue(0))
+			tree.Put([]byte("c"), 1)
+			assert.Equal(t, 1, tree.Volatile())
+
+			// updates and deletes, the tree is unpacked.
+			tree.Put([]byte("b"), expiringValue(20))
+			tree.Put([]byte("c"), expiringValue(30))
+			tree.Put([]byte("a"), expiringValue(0))
+			assert.Equal(t, 2, tree.Volatile())
+			tree.Delete([]byte("b"))
+			tree.Delete([]byte("a"))
+			tree.Delete([]byte("not-exist"))
+			assert.Equal(t, 1, tree.Volatile())
+
+			tree.Clear()
+			assert.Equal(t, 0, tree.Volatile())
+		})
+	}
+}
+
+func TestTree_Sample(t *testing.T) {
+	for _, tt := range types {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewTree(tt.typ, nil)
+			for i := 0; i < 100; i++ {
+				tree.Put(getKey(i), i)
+			}
+			keys, ok := tree.Sample(10)
+			// only the unordered index samples keys.
+			assert.Equal(t, tt.typ == HashMap, ok)
+			if ok {
+				assert.Equal(t, 10, len(keys))
+				for _, key := range keys {
+					assert.NotNil(t, tree.Get(key))
+				}
+			}
+		})
+	}
+}
+
+func TestPackedTree(t *testing.T) {
+	var counter int64
+	tree := NewPackedTree(ART, &counter, 4)
+	assert.True(t, tree.Packed())
+	for _, i := range []int{3, 1, 2, 0} {
+		tree.Put(getKey(i), i)
+	}
+	old, updated := tree.Put(getKey(1), 10)
+	assert.Equal(t, 1, old)
+	assert.True(t, updated)
+	assert.True(t, tree.Packed())
+	assert.Equal(t, int64(4*(packedOverhead+len(getKey(0)))), tree.MemSize())
+
+	var got []int
+	iter := tree.Iterator()
+	for iter.HasNext() {
+		_, value := iter.Next()
+		got = append(got, value.(int))
+	}
+	assert.Equal(t, []int{0, 10, 2, 3}, got)
+	iter = tree.Seek(getKey(2))
+	key, _ := iter.Next()
+	assert.Equal(t, getKey(2), key)
+	assert.Equal(t, [][]byte{getKey(0), getKey(1)}, tree.PrefixScan([]byte("index-test-key"), 2))
+
+	val, deleted := tree.Delete(getKey(2))
+	assert.Equal(t, 2, val)
+	assert.True(t, deleted)
+	assert.Nil(t, tree.Get(getKey(2)))
+
+	// converted to the full index when it grows larger.
+	for i := 4; i < 6; i++ {
+		tree.Put(getKey(i), i)
+	}
+	assert.False(t, tree.Packed())
+	assert.Equal(t, 5, tree.Size())
+	assert.Equal(t, 10, tree.Get(getKey(1)))
+	assert.Equal(t, int64(5*(leafOverhead+len(getKey(0)))), tree.MemSize())
+	assert.Equal(t, tree.MemSize(), counter)
+	tree.Delete(getKey(4))
+	assert.False(t, tree.Packed())
+
+	tree.Clear()
+	assert.True(t, tree.Packed())
+	assert.Equal(t, int64(0), counter)
+	assert.False(t, NewPackedTree(ART, nil, 0).Packed())
+
+	// empty key is handled by the index of tree type.
+	tree = NewPackedTree(ART, nil, 4)
+	tree.Put(nil, 1)
+	assert.False(t, tree.Packed())
+}
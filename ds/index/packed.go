@@ -0,0 +1,110 @@
+package index
+
+import (
+	"bytes"
+	"sort"
+)
+
+// packedOverhead approximate memory used by a key in packed index besides the key and value.
+const packedOverhead = 40
+
+type (
+	// packedIndex keys and values in a slice sorted by key, it is compact and fast enough for a few keys.
+	packedIndex struct {
+		entries []packedEntry
+	}
+
+	packedEntry struct {
+		key   []byte
+		value interface{}
+	}
+
+	packedIterator struct {
+		entries []packedEntry
+	}
+)
+
+func newPackedIndex() *packedIndex {
+	return &packedIndex{}
+}
+
+// search returns the position of key, and whether key exists.
+func (idx *packedIndex) search(key []byte) (int, bool) {
+	i := sort.Search(len(idx.entries), func(i int) bool {
+		return bytes.Compare(idx.entries[i].key, key) >= 0
+	})
+	return i, i < len(idx.entries) && bytes.Equal(idx.entries[i].key, key)
+}
+
+func (idx *packedIndex) Put(key []byte, value interface{}) (oldVal interface{}, updated bool) {
+	i, ok := idx.search(key)
+	if ok {
+		oldVal = idx.entries[i].value
+		idx.entries[i].value = value
+		return oldVal, true
+	}
+	idx.entries = append(idx.entries, packedEntry{})
+	copy(idx.entries[i+1:], idx.entries[i:])
+	idx.entries[i] = packedEntry{key: key, value: value}
+	return nil, false
+}
+
+func (idx *packedIndex) Get(key []byte) interface{} {
+	if i, ok := idx.search(key); ok {
+		return idx.entries[i].value
+	}
+	return nil
+}
+
+func (idx *packedIndex) Delete(key []byte) (val interface{}, updated bool) {
+	i, ok := idx.search(key)
+	if !ok {
+		return nil, false
+	}
+	val = idx.entries[i].value
+	copy(idx.entries[i:], idx.entries[i+1:])
+	idx.entries[len(idx.entries)-1] = packedEntry{}
+	idx.entries = idx.entries[:len(idx.entries)-1]
+	return val, true
+}
+
+func (idx *packedIndex) Iterator() Iterator {
+	return &packedIterator{entries: idx.entries}
+}
+
+func (idx *packedIndex) Seek(key []byte) Iterator {
+	i, _ := idx.search(key)
+	return &packedIterator{entries: idx.entries[i:]}
+}
+
+func (idx *packedIndex) PrefixScan(prefix []byte, count int) [][]byte {
+	if count <= 0 {
+		return nil
+	}
+	var keys [][]byte
+	i, _ := idx.search(prefix)
+	for ; i < len(idx.entries) && len(keys) < count; i++ {
+		if !bytes.HasPrefix(idx.entries[i].key, prefix) {
+			break
+		}
+		keys = append(keys, idx.entries[i].key)
+	}
+	return keys
+}
+
+func (idx *packedIndex) Size() int {
+	return len(idx.entries)
+}
+
+func (it *packedIterator) HasNext() bool {
+	return len(it.entries) > 0
+}
+
+func (it *packedIterator) Next() ([]byte, interface{}) {
+	if len(it.entries) == 0 {
+		return nil, nil
+	}
+	e := it.entries[0]
+	it.entries = it.entries[1:]
+	return e.key, e.value
+}
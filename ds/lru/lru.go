@@ -0,0 +1,88 @@
+package lru
+
+import "container/list"
+
+// entryOverhead approximate memory used by an entry besides the value, including the list element and map slot.
+const entryOverhead = 96
+
+// Cache is a LRU cache whose capacity is limited by the total bytes of values.
+// It is not safe for concurrent use, callers must synchronize it themselves.
+type Cache struct {
+	capacity int64
+	size     int64
+	ll       *list.List
+	items    map[interface{}]*list.Element
+}
+
+type entry struct {
+	key   interface{}
+	value []byte
+	cost  int64
+}
+
+// New create a LRU cache which holds at most capacity bytes.
+func New(capacity int64) *Cache {
+	return &Cache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[interface{}]*list.Element),
+	}
+}
+
+// Get returns the value of key and marks it as the most recently used one.
+func (c *Cache) Get(key interface{}) ([]byte, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*entry).value, true
+}
+
+// Put add or update a value, the least recently used ones will be evicted if the capacity is exceeded.
+// A value bigger than the capacity won`t be cached.
+func (c *Cache) Put(key interface{}, value []byte) {
+	cost := int64(len(value)) + entryOverhead
+	if cost > c.capacity {
+		c.Remove(key)
+		return
+	}
+	if elem, ok := c.items[key]; ok {
+		ent := elem.Value.(*entry)
+		c.size += cost - ent.cost
+		ent.value, ent.cost = value, cost
+		c.ll.MoveToFront(elem)
+	} else {
+		c.items[key] = c.ll.PushFront(&entry{key: key, value: value, cost: cost})
+		c.size += cost
+	}
+	for c.size > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove the value of key, returns whether it exists.
+func (c *Cache) Remove(key interface{}) bool {
+	elem, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	c.removeElement(elem)
+	return true
+}
+
+// Len returns the number of values in cache.
+func (c *Cache) Len() int {
+	return c.ll.Len()
+}
+
+// Size returns the bytes used by values in cache.
+func (c *Cache) Size() int64 {
+	return c.size
+}
+
+func (c *Cache) removeElement(elem *list.Element) {
+	ent := c.ll.Remove(elem).(*entry)
+	delete(c.items, ent.key)
+	c.size -= ent.cost
+}
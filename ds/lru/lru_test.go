@@ -0,0 +1,63 @@
+package lru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Get(t *testing.T) {
+	cache := New(1024)
+	_, ok := cache.Get(1)
+	assert.False(t, ok)
+
+	cache.Put(1, []byte("lotusdb"))
+	val, ok := cache.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("lotusdb"), val)
+
+	// update.
+	cache.Put(1, []byte("godb"))
+	val, ok = cache.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("godb"), val)
+	assert.Equal(t, 1, cache.Len())
+	assert.Equal(t, int64(4+entryOverhead), cache.Size())
+}
+
+func TestCache_Put(t *testing.T) {
+	cache := New(3 * (entryOverhead + 10))
+	value := []byte("0123456789")
+	for i := 0; i < 3; i++ {
+		cache.Put(i, value)
+	}
+	assert.Equal(t, 3, cache.Len())
+
+	// key 0 is the most recently used one now, so key 1 will be evicted.
+	_, ok := cache.Get(0)
+	assert.True(t, ok)
+	cache.Put(3, value)
+	assert.Equal(t, 3, cache.Len())
+	_, ok = cache.Get(1)
+	assert.False(t, ok)
+	for _, key := range []int{0, 2, 3} {
+		_, ok := cache.Get(key)
+		assert.True(t, ok)
+	}
+
+	// too big to be cached.
+	cache.Put(0, make([]byte, 1024))
+	_, ok = cache.Get(0)
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int64(2*(entryOverhead+10)), cache.Size())
+}
+
+func TestCache_Remove(t *testing.T) {
+	cache := New(1024)
+	cache.Put("a", []byte("lotusdb"))
+	assert.True(t, cache.Remove("a"))
+	assert.False(t, cache.Remove("a"))
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, int64(0), cache.Size())
+}
@@ -0,0 +1,72 @@
+package zset
+
+import "sort"
+
+// packedMember a member of packed sorted set.
+type packedMember struct {
+	member string
+	score  float64
+}
+
+// lessMember the order of members, by score and then member, the same as skip list.
+func lessMember(score1 float64, member1 string, score2 float64, member2 string) bool {
+	return score1 < score2 || (score1 == score2 && member1 < member2)
+}
+
+// indexPacked returns the position of member in packed members, -1 if not found.
+// Members are found by scanning, there are only a few of them.
+func (n *SortedSetNode) indexPacked(member string) int {
+	for i := range n.packed {
+		if n.packed[i].member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// addPacked add or update member in packed members, it returns false if the node is full.
+func (n *SortedSetNode) addPacked(score float64, member string, maxPacked int) bool {
+	if i := n.indexPacked(member); i >= 0 {
+		if n.packed[i].score == score {
+			return true
+		}
+		n.removePacked(i)
+	} else if len(n.packed) >= maxPacked {
+		return false
+	}
+	i := sort.Search(len(n.packed), func(i int) bool {
+		return !lessMember(n.packed[i].score, n.packed[i].member, score, member)
+	})
+	n.packed = append(n.packed, packedMember{})
+	copy(n.packed[i+1:], n.packed[i:])
+	n.packed[i] = packedMember{member: member, score: score}
+	return true
+}
+
+func (n *SortedSetNode) removePacked(i int) {
+	copy(n.packed[i:], n.packed[i+1:])
+	n.packed = n.packed[:len(n.packed)-1]
+}
+
+// unpack convert packed members to dict and skl.
+func (n *SortedSetNode) unpack() {
+	n.dict = make(map[string]*sklNode, len(n.packed))
+	n.skl = newSkipList()
+	for _, m := range n.packed {
+		n.dict[m.member] = n.skl.sklInsert(m.score, m.member)
+	}
+	n.packed = nil
+}
+
+// each calls fn for every member in order.
+func (n *SortedSetNode) each(fn func(member string, score float64)) {
+	if n.skl == nil {
+		for _, m := range n.packed {
+			fn(m.member, m.score)
+		}
+		return
+	}
+	for e := n.skl.head.level[0].forward; e != nil; e = e.level[0].forward {
+		fn(e.member, e.score)
+	}
+}
@@ -3,6 +3,7 @@ package zset
 import (
 	"math"
 	"math/rand"
+	"sync"
 
 	"github.com/herott-ai/godb/logfile"
 	"github.com/herott-ai/godb/util"
@@ -13,20 +14,29 @@ import (
 const (
 	maxLevel    = 32
 	probability = 0.25
+
+	// DefaultMaxPacked default max number of members of a packed sorted set.
+	DefaultMaxPacked = 128
 )
 
 type EncodeKey func(key, subKey []byte) []byte
 
 type (
-	// SortedSet sorted set struct
+	// SortedSet sorted set struct.
+	// It is safe to access different keys concurrently, operations on the same key must be serialized by the caller.
 	SortedSet struct {
-		record map[string]*SortedSetNode
+		mu        sync.RWMutex
+		record    map[string]*SortedSetNode
+		maxPacked int
 	}
 
 	// SortedSetNode node of sorted set
+	// A small sorted set keeps its members in a slice ordered by score and member, which is much more compact than dict and skl.
+	// It is converted to dict and skl when it has more than maxPacked members, and never converted back.
 	SortedSetNode struct {
-		dict map[string]*sklNode
-		skl  *skipList
+		dict   map[string]*sklNode
+		skl    *skipList
+		packed []packedMember
 	}
 
 	sklLevel struct {
@@ -49,40 +59,54 @@ type (
 	}
 )
 
-// New create a new sorted set.
+// New create a new sorted set, sets with no more than DefaultMaxPacked members are packed.
 func New() *SortedSet {
+	return NewPacked(DefaultMaxPacked)
+}
+
+// NewPacked create a new sorted set, sets with no more than maxPacked members are packed.
+// Sets are never packed if maxPacked is not positive.
+func NewPacked(maxPacked int) *SortedSet {
 	return &SortedSet{
-		make(map[string]*SortedSetNode),
+		record:    make(map[string]*SortedSetNode),
+		maxPacked: maxPacked,
 	}
 }
 
 func (z *SortedSet) IterateAndSend(chn chan *logfile.LogEntry, encode EncodeKey) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
 	for key, ss := range z.record {
 		zsetKey := []byte(key)
-		if ss.skl.head == nil {
-			return
-		}
-		for e := ss.skl.head.level[0].forward; e != nil; e = e.level[0].forward {
-			scoreBuf := []byte(util.Float64ToStr(e.score))
+		ss.each(func(member string, score float64) {
+			scoreBuf := []byte(util.Float64ToStr(score))
 			encKey := encode(zsetKey, scoreBuf)
-			chn <- &logfile.LogEntry{Key: encKey, Value: []byte(e.member)}
-		}
+			chn <- &logfile.LogEntry{Key: encKey, Value: []byte(member)}
+		})
 	}
 	return
 }
 
 // ZAdd Adds the specified member with the specified score to the sorted set stored at key.
 func (z *SortedSet) ZAdd(key string, score float64, member string) {
-	if !z.exist(key) {
+	item := z.get(key)
+	if item == nil {
+		item = &SortedSetNode{}
+		if z.maxPacked <= 0 {
+			item.unpack()
+		}
+		z.mu.Lock()
+		z.record[key] = item
+		z.mu.Unlock()
+	}
 
-		node := &SortedSetNode{
-			dict: make(map[string]*sklNode),
-			skl:  newSkipList(),
+	if item.skl == nil {
+		if item.addPacked(score, member, z.maxPacked) {
+			return
 		}
-		z.record[key] = node
+		item.unpack()
 	}
 
-	item := z.record[key]
 	v, exist := item.dict[member]
 
 	var node *sklNode
@@ -106,7 +130,15 @@ func (z *SortedSet) ZScore(key string, member string) (ok bool, score float64) {
 		return
 	}
 
-	node, exist := z.record[key].dict[member]
+	item := z.get(key)
+	if item.skl == nil {
+		if i := item.indexPacked(member); i >= 0 {
+			return true, item.packed[i].score
+		}
+		return
+	}
+
+	node, exist := item.dict[member]
 	if !exist {
 		return
 	}
@@ -120,7 +152,11 @@ func (z *SortedSet) ZCard(key string) int {
 		return 0
 	}
 
-	return len(z.record[key].dict)
+	item := z.get(key)
+	if item.skl == nil {
+		return len(item.packed)
+	}
+	return len(item.dict)
 }
 
 // ZRank returns the rank of member in the sorted set stored at key, with the scores ordered from low to high.
@@ -130,12 +166,17 @@ func (z *SortedSet) ZRank(key, member string) int64 {
 		return -1
 	}
 
-	v, exist := z.record[key].dict[member]
+	item := z.get(key)
+	if item.skl == nil {
+		return int64(item.indexPacked(member))
+	}
+
+	v, exist := item.dict[member]
 	if !exist {
 		return -1
 	}
 
-	rank := z.record[key].skl.sklGetRank(v.score, member)
+	rank := item.skl.sklGetRank(v.score, member)
 	rank--
 
 	return rank
@@ -148,25 +189,31 @@ func (z *SortedSet) ZRevRank(key, member string) int64 {
 		return -1
 	}
 
-	v, exist := z.record[key].dict[member]
+	item := z.get(key)
+	if item.skl == nil {
+		i := item.indexPacked(member)
+		if i < 0 {
+			return -1
+		}
+		return int64(len(item.packed) - 1 - i)
+	}
+
+	v, exist := item.dict[member]
 	if !exist {
 		return -1
 	}
 
-	rank := z.record[key].skl.sklGetRank(v.score, member)
+	rank := item.skl.sklGetRank(v.score, member)
 
-	return z.record[key].skl.length - rank
+	return item.skl.length - rank
 }
 
 // ZIncrBy increments the score of member in the sorted set stored at key by increment.
 // If member does not exist in the sorted set, it is added with increment as its score (as if its previous score was 0.0).
 // If key does not exist, a new sorted set with the specified member as its sole member is created.
 func (z *SortedSet) ZIncrBy(key string, increment float64, member string) float64 {
-	if z.exist(key) {
-		node, exist := z.record[key].dict[member]
-		if exist {
-			increment += node.score
-		}
+	if ok, score := z.ZScore(key, member); ok {
+		increment += score
 	}
 
 	z.ZAdd(key, increment, member)
@@ -220,10 +267,20 @@ func (z *SortedSet) ZRem(key, member string) bool {
 		return false
 	}
 
-	v, exist := z.record[key].dict[member]
+	item := z.get(key)
+	if item.skl == nil {
+		i := item.indexPacked(member)
+		if i < 0 {
+			return false
+		}
+		item.removePacked(i)
+		return true
+	}
+
+	v, exist := item.dict[member]
 	if exist {
-		z.record[key].skl.sklDelete(v.score, member)
-		delete(z.record[key].dict, member)
+		item.skl.sklDelete(v.score, member)
+		delete(item.dict, member)
 		return true
 	}
 
@@ -261,7 +318,16 @@ func (z *SortedSet) ZScoreRange(key string, min, max float64) (val []interface{}
 		return
 	}
 
-	item := z.record[key].skl
+	if node := z.get(key); node.skl == nil {
+		for _, m := range node.packed {
+			if m.score >= min && m.score <= max {
+				val = append(val, m.member, m.score)
+			}
+		}
+		return
+	}
+
+	item := z.get(key).skl
 	minScore := item.head.level[0].forward.score
 	if min < minScore {
 		min = minScore
@@ -299,7 +365,16 @@ func (z *SortedSet) ZRevScoreRange(key string, max, min float64) (val []interfac
 		return
 	}
 
-	item := z.record[key].skl
+	if node := z.get(key); node.skl == nil {
+		for i := len(node.packed) - 1; i >= 0; i-- {
+			if m := node.packed[i]; m.score >= min && m.score <= max {
+				val = append(val, m.member, m.score)
+			}
+		}
+		return
+	}
+
+	item := z.get(key).skl
 	minScore := item.head.level[0].forward.score
 	if min < minScore {
 		min = minScore
@@ -336,19 +411,35 @@ func (z *SortedSet) ZKeyExists(key string) bool {
 
 // ZClear clear the key in zset.
 func (z *SortedSet) ZClear(key string) {
-	if z.ZKeyExists(key) {
-		delete(z.record, key)
-	}
+	z.mu.Lock()
+	delete(z.record, key)
+	z.mu.Unlock()
 }
 
 func (z *SortedSet) exist(key string) bool {
-	_, exist := z.record[key]
-	return exist
+	return z.get(key) != nil
+}
+
+// get returns the node of key, nil if key does not exist.
+func (z *SortedSet) get(key string) *SortedSetNode {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.record[key]
 }
 
 func (z *SortedSet) getByRank(key string, rank int64, reverse bool) (string, float64) {
+	if item := z.get(key); item.skl == nil {
+		length := int64(len(item.packed))
+		if rank < 0 || rank >= length {
+			return "", math.MinInt64
+		}
+		if reverse {
+			rank = length - 1 - rank
+		}
+		return item.packed[rank].member, item.packed[rank].score
+	}
 
-	skl := z.record[key].skl
+	skl := z.get(key).skl
 	if rank < 0 || rank > skl.length {
 		return "", math.MinInt64
 	}
@@ -364,7 +455,7 @@ func (z *SortedSet) getByRank(key string, rank int64, reverse bool) (string, flo
 		return "", math.MinInt64
 	}
 
-	node := z.record[key].dict[n.member]
+	node := z.get(key).dict[n.member]
 	if node == nil {
 		return "", math.MinInt64
 	}
@@ -373,8 +464,11 @@ func (z *SortedSet) getByRank(key string, rank int64, reverse bool) (string, flo
 }
 
 func (z *SortedSet) findRange(key string, start, stop int64, reverse bool, withScores bool) (val []interface{}) {
-	skl := z.record[key].skl
-	length := skl.length
+	item := z.get(key)
+	length := int64(len(item.packed))
+	if item.skl != nil {
+		length = item.skl.length
+	}
 
 	if start < 0 {
 		start += length
@@ -396,6 +490,22 @@ func (z *SortedSet) findRange(key string, start, stop int64, reverse bool, withS
 	}
 	span := (stop - start) + 1
 
+	if item.skl == nil {
+		for i := start; i <= stop; i++ {
+			m := item.packed[i]
+			if reverse {
+				m = item.packed[length-1-i]
+			}
+			if withScores {
+				val = append(val, m.member, m.score)
+			} else {
+				val = append(val, m.member)
+			}
+		}
+		return
+	}
+
+	skl := item.skl
 	var node *sklNode
 	if reverse {
 		node = skl.tail
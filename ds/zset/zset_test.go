@@ -1,8 +1,11 @@
 package zset
 
 import (
-	"github.com/stretchr/testify/assert"
+	"fmt"
+	"math/rand"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func InitZSet() *SortedSet {
@@ -149,3 +152,45 @@ func TestSortedSet_ZGetByRank(t *testing.T) {
 	getRank(4)
 	getRank(6)
 }
+
+func TestSortedSet_Packed(t *testing.T) {
+	key := "myzset"
+	packed, full := NewPacked(16), NewPacked(0)
+	for i := 0; i < 1000; i++ {
+		member := fmt.Sprintf("member-%d", rand.Intn(40))
+		score := float64(rand.Intn(20))
+		switch rand.Intn(4) {
+		case 0:
+			assert.Equal(t, full.ZRem(key, member), packed.ZRem(key, member))
+		case 1:
+			assert.Equal(t, full.ZIncrBy(key, score, member), packed.ZIncrBy(key, score, member))
+		default:
+			full.ZAdd(key, score, member)
+			packed.ZAdd(key, score, member)
+		}
+
+		assert.Equal(t, full.ZCard(key), packed.ZCard(key))
+		assert.Equal(t, full.ZRangeWithScores(key, 0, -1), packed.ZRangeWithScores(key, 0, -1))
+		assert.Equal(t, full.ZRevRange(key, 1, 5), packed.ZRevRange(key, 1, 5))
+		assert.Equal(t, full.ZRank(key, member), packed.ZRank(key, member))
+		assert.Equal(t, full.ZRevRank(key, member), packed.ZRevRank(key, member))
+		assert.Equal(t, full.ZGetByRank(key, 2), packed.ZGetByRank(key, 2))
+		assert.Equal(t, full.ZRevGetByRank(key, 2), packed.ZRevGetByRank(key, 2))
+		if full.ZCard(key) > 0 {
+			assert.Equal(t, full.ZScoreRange(key, 5, 10), packed.ZScoreRange(key, 5, 10))
+			assert.Equal(t, full.ZRevScoreRange(key, 10, 5), packed.ZRevScoreRange(key, 10, 5))
+		}
+		ok1, s1 := full.ZScore(key, member)
+		ok2, s2 := packed.ZScore(key, member)
+		assert.Equal(t, ok1, ok2)
+		assert.Equal(t, s1, s2)
+	}
+	// converted when it grows larger, and never converted back.
+	for i := 0; i < 17; i++ {
+		packed.ZAdd("big", float64(i), fmt.Sprintf("member-%d", i))
+	}
+	assert.NotNil(t, packed.get("big").skl)
+	packed.ZRem("big", "member-1")
+	assert.NotNil(t, packed.get("big").skl)
+	assert.Nil(t, New().get(key))
+}
@@ -0,0 +1,430 @@
+package godb
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/herott-ai/godb/ds/index"
+	"github.com/herott-ai/godb/logfile"
+	"github.com/herott-ai/godb/logger"
+)
+
+const (
+	// the initial and max value of lfu counter, same as redis.
+	lfuInitVal = 5
+	lfuMaxVal  = 255
+	// the bigger the factor is, the harder the counter increases.
+	lfuLogFactor = 10
+	// lfu counter decreases by one every decay time.
+	lfuDecayTime = int64(time.Minute)
+
+	// keys will be evicted until the memory usage is lower than this ratio of MaxMemory.
+	evictTargetRatio = 0.95
+	// number of keys sampled from each index before evicting a key, like maxmemory-samples of redis.
+	evictionSamples = 5
+	// number of candidates kept across the evictions, same as redis.
+	evictionPoolSize = 16
+	// evictor wakes up at this interval even if there is no signal, and writes don`t evict in it after finding no key can be evicted.
+	evictCheckInterval = time.Second
+	// eviction gives up after this number of candidates in a row are locked by others, they may be waiting for it.
+	evictMaxLocked = evictionPoolSize
+)
+
+var indexNodeSize = int64(unsafe.Sizeof(indexNode{}))
+
+// MemSize returns the approximate memory used by index node, implements index.Sizer.
+func (n *indexNode) MemSize() int64 {
+	return indexNodeSize + int64(len(n.value))
+}
+
+func (p EvictionPolicy) isLFU() bool {
+	return p == AllKeysLFU || p == VolatileLFU
+}
+
+func (p EvictionPolicy) isRandom() bool {
+	return p == AllKeysRandom || p == VolatileRandom
+}
+
+func (p EvictionPolicy) isVolatile() bool {
+	return p == VolatileLRU || p == VolatileLFU || p == VolatileRandom || p == VolatileTTL
+}
+
+// touch record an access of index node, only works when MaxMemory is set.
+// It may be called with a read lock, so the fields are updated atomically.
+func (db *GoDb) touch(node *indexNode) {
+	if db.opts.MaxMemory <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	if db.opts.EvictionPolicy.isLFU() {
+		freq := lfuDecr(atomic.LoadUint32(&node.freq), atomic.LoadInt64(&node.accessedAt), now)
+		atomic.StoreUint32(&node.freq, lfuIncr(freq))
+	}
+	atomic.StoreInt64(&node.accessedAt, now)
+}
+
+// inheritAccess copy the access info of an old index node to the new one when a key is updated.
+func inheritAccess(node *indexNode, oldVal interface{}) {
+	old, _ := oldVal.(*indexNode)
+	if old == nil {
+		return
+	}
+	node.accessedAt = atomic.LoadInt64(&old.accessedAt)
+	node.freq = atomic.LoadUint32(&old.freq)
+}
+
+// lfuIncr increase the counter logarithmically, the more it was accessed, the harder it increases.
+func lfuIncr(freq uint32) uint32 {
+	if freq >= lfuMaxVal {
+		return lfuMaxVal
+	}
+	base := float64(0)
+	if freq > lfuInitVal {
+		base = float64(freq - lfuInitVal)
+	}
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		freq++
+	}
+	return freq
+}
+
+// lfuDecr decrease the counter according to the time elapsed since last access.
+func lfuDecr(freq uint32, accessedAt, now int64) uint32 {
+	if accessedAt <= 0 {
+		return freq
+	}
+	periods := (now - accessedAt) / lfuDecayTime
+	if periods <= 0 {
+		return freq
+	}
+	if int64(freq) <= periods {
+		return 0
+	}
+	return freq - uint32(periods)
+}
+
+// evictCandidate a key that may be evicted, lower score will be evicted first.
+type evictCandidate struct {
+	dataType DataType
+	key      []byte
+	score    int64
+}
+
+// evictionPool keeps the sampled candidates with the lowest scores in ascending order.
+// It is kept across the evictions like redis, so the candidates get better as more keys are sampled.
+type evictionPool struct {
+	candidates []*evictCandidate
+}
+
+// offer a candidate to the pool, it replaces the one of the same key.
+func (p *evictionPool) offer(c *evictCandidate) {
+	for i, old := range p.candidates {
+		if old.dataType == c.dataType && bytes.Equal(old.key, c.key) {
+			p.candidates = append(p.candidates[:i], p.candidates[i+1:]...)
+			break
+		}
+	}
+	// candidates with the same score are evicted in the order of being sampled.
+	i := sort.Search(len(p.candidates), func(i int) bool {
+		return p.candidates[i].score > c.score
+	})
+	if i >= evictionPoolSize {
+		return
+	}
+	p.candidates = append(p.candidates, nil)
+	copy(p.candidates[i+1:], p.candidates[i:])
+	p.candidates[i] = c
+	if len(p.candidates) > evictionPoolSize {
+		p.candidates[evictionPoolSize] = nil
+		p.candidates = p.candidates[:evictionPoolSize]
+	}
+}
+
+// pop remove and returns the candidate with the lowest score, nil if the pool is empty.
+func (p *evictionPool) pop() *evictCandidate {
+	if len(p.candidates) == 0 {
+		return nil
+	}
+	c := p.candidates[0]
+	p.candidates[0] = nil
+	p.candidates = p.candidates[1:]
+	return c
+}
+
+// keyStat access info of a key, collections are aggregated by their members.
+type keyStat struct {
+	accessedAt int64
+	freq       uint32
+	expiredAt  int64
+	count      int
+}
+
+func (s *keyStat) add(node *indexNode) {
+	if accessedAt := atomic.LoadInt64(&node.accessedAt); accessedAt > s.accessedAt {
+		s.accessedAt = accessedAt
+	}
+	if freq := atomic.LoadUint32(&node.freq); freq > s.freq {
+		s.freq = freq
+	}
+	if node.expiredAt != 0 && (s.expiredAt == 0 || node.expiredAt < s.expiredAt) {
+		s.expiredAt = node.expiredAt
+	}
+	s.count++
+}
+
+// score returns the eviction score of a key, and whether it can be evicted under the policy.
+func (db *GoDb) score(stat *keyStat, now int64) (int64, bool) {
+	policy := db.opts.EvictionPolicy
+	if policy.isVolatile() && stat.expiredAt == 0 {
+		return 0, false
+	}
+	switch policy {
+	case AllKeysLFU, VolatileLFU:
+		return int64(lfuDecr(stat.freq, stat.accessedAt, now)), true
+	case AllKeysRandom, VolatileRandom:
+		return rand.Int63(), true
+	case VolatileTTL:
+		return stat.expiredAt, true
+	default:
+		return stat.accessedAt, true
+	}
+}
+
+// triggerEviction wake up the evictor if memory usage exceeds MaxMemory.
+func (db *GoDb) triggerEviction() {
+	if db.opts.MaxMemory <= 0 || atomic.LoadInt64(&db.memUsage) <= db.opts.MaxMemory {
+		return
+	}
+	select {
+	case db.evictSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (db *GoDb) handleEviction() {
+	defer close(db.evictDone)
+	ticker := time.NewTicker(evictCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.evictSignal:
+		case <-ticker.C:
+		case <-db.evictStop:
+			return
+		}
+		if atomic.LoadInt64(&db.memUsage) > db.opts.MaxMemory {
+			db.evictMu.Lock()
+			db.evict(true)
+			db.evictMu.Unlock()
+		}
+	}
+}
+
+// evictBeforeWrite evict keys if memory usage exceeds MaxMemory before writing an entry of the type, like redis does before each command,
+// so writes wait for the eviction instead of outpacing it. Delete entries and generation records free memory,
+// and they are written by the eviction itself, so they never wait.
+func (db *GoDb) evictBeforeWrite(typ logfile.EntryType) {
+	if db.opts.MaxMemory <= 0 || typ == logfile.TypeDelete || typ == logfile.TypeGenMeta {
+		return
+	}
+	if atomic.LoadInt64(&db.memUsage) <= db.opts.MaxMemory || atomic.LoadInt64(&db.evictIdleUntil) > time.Now().UnixNano() {
+		return
+	}
+	db.evictMu.Lock()
+	defer db.evictMu.Unlock()
+	// the memory may have been freed by the eviction waited for.
+	if atomic.LoadInt64(&db.memUsage) > db.opts.MaxMemory {
+		db.evict(false)
+	}
+}
+
+// startEviction start evicting keys in background, see Options.MaxMemory.
+func (db *GoDb) startEviction() {
+	db.evictStop = make(chan struct{})
+	db.evictDone = make(chan struct{})
+	go db.handleEviction()
+}
+
+// stopEviction stop evicting keys in background, and wait for the running round.
+func (db *GoDb) stopEviction() {
+	if db.evictStop == nil {
+		return
+	}
+	select {
+	case <-db.evictStop:
+	default:
+		close(db.evictStop)
+	}
+	<-db.evictDone
+}
+
+// evictStopped returns whether the eviction is stopped, the running round exits as soon as possible.
+func (db *GoDb) evictStopped() bool {
+	select {
+	case <-db.evictStop:
+		return true
+	default:
+		return false
+	}
+}
+
+// evict keys until memory usage is lower than the target, evictMu must be held.
+// Only the background round exits when the eviction is stopped, writes still evict keys before them.
+// A fixed number of keys are sampled before evicting each key like redis, instead of scanning all the indexes.
+// Keys locked by others are skipped instead of being waited for, since the holders may be waiting for the eviction.
+func (db *GoDb) evict(background bool) {
+	target := int64(float64(db.opts.MaxMemory) * evictTargetRatio)
+	locked := 0
+	for !(background && db.evictStopped()) && locked < evictMaxLocked {
+		usage := atomic.LoadInt64(&db.memUsage)
+		if usage <= target {
+			return
+		}
+		now := time.Now().UnixNano()
+		db.sampleEvictCandidates(now)
+		c := db.evictPool.pop()
+		if c == nil {
+			atomic.StoreInt64(&db.evictIdleUntil, now+int64(evictCheckInterval))
+			logger.Warnf("memory usage %d exceeds max memory %d, but there is no key can be evicted", usage, db.opts.MaxMemory)
+			return
+		}
+
+		// the candidate may be changed after it was sampled.
+		stat := db.keyStatOf(c.dataType, c.key)
+		if stat == nil {
+			continue
+		}
+		score, ok := db.score(stat, now)
+		if !ok {
+			continue
+		}
+		if !db.opts.EvictionPolicy.isRandom() && score > c.score {
+			c.score = score
+			db.evictPool.offer(c)
+			continue
+		}
+		evicted, err := db.evictKey(c.dataType, c.key)
+		if err != nil {
+			logger.Errorf("evict key err, dataType: [%v], err: [%v]", c.dataType, err)
+			return
+		}
+		if !evicted {
+			locked++
+			continue
+		}
+		locked = 0
+		atomic.AddUint64(&db.evictedKeys, 1)
+	}
+}
+
+// sampleEvictCandidates sample keys of all data types, and offer them to the eviction pool.
+// Keys are sampled from the expiry index in volatile policies if it is enabled, since only keys in it can be evicted.
+func (db *GoDb) sampleEvictCandidates(now int64) {
+	offer := func(dataType DataType, key []byte) {
+		stat := db.keyStatOf(dataType, key)
+		if stat == nil {
+			return
+		}
+		if score, ok := db.score(stat, now); ok {
+			db.evictPool.offer(&evictCandidate{dataType: dataType, key: key, score: score})
+		}
+	}
+
+	if db.opts.EvictionPolicy.isVolatile() && db.expires != nil {
+		for _, k := range db.expires.sample(evictionSamples * logFileTypeNum) {
+			offer(k.dataType, []byte(k.key))
+		}
+		return
+	}
+	// String keys are not in memory in DiskIndexMode.
+	if !db.strIndexOnDisk() {
+		for _, key := range db.sampleStrKeys(evictionSamples) {
+			offer(String, key)
+		}
+	}
+	for dataType := List; dataType < logFileTypeNum; dataType++ {
+		for _, key := range db.collectionIndexOf(dataType).sample(evictionSamples) {
+			offer(dataType, key)
+		}
+	}
+}
+
+// sampleStrKeys returns at most n String keys after the last sampled one, it starts over after reaching the end.
+// Keys are picked randomly instead if the index is unordered.
+func (db *GoDb) sampleStrKeys(n int) [][]byte {
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+	if tree, ok := db.strIndex.idxTree.(*index.Tree); ok {
+		if keys, ok := tree.Sample(n); ok {
+			return keys
+		}
+	}
+	var keys [][]byte
+	iter := db.strIndex.Seek(db.evictCursor)
+	for len(keys) < n {
+		if !iter.HasNext() {
+			// the whole index is sampled in this round.
+			if db.evictCursor == nil {
+				break
+			}
+			db.evictCursor = nil
+			iter = db.strIndex.Iterator()
+			continue
+		}
+		key, _ := iter.Next()
+		keys = append(keys, key)
+		db.evictCursor = append(key[:len(key):len(key)], 0)
+	}
+	return keys
+}
+
+// keyStatOf returns the access info of a key, nil if it does not exist or is locked by others.
+// At most evictionSamples members of a collection are read, to limit the time of holding the key lock.
+func (db *GoDb) keyStatOf(dataType DataType, key []byte) *keyStat {
+	stat := &keyStat{}
+	if dataType == String {
+		idxNode, _ := db.strIndex.Get(key).(*indexNode)
+		if idxNode == nil {
+			return nil
+		}
+		stat.add(idxNode)
+		return stat
+	}
+
+	idx := db.collectionIndexOf(dataType)
+	if !idx.locks.tryRLock(key) {
+		return nil
+	}
+	defer idx.locks.rUnlock(key)
+	tree := idx.rawTree(key)
+	if tree == nil || tree.Size() == 0 {
+		return nil
+	}
+	// the expiration time of a collection is kept in its generation, and its members may expire earlier.
+	stat.expiredAt = idx.expiredAt(key)
+	iter := tree.Iterator()
+	for i := 0; i < evictionSamples && iter.HasNext(); i++ {
+		_, value := iter.Next()
+		if idxNode, _ := value.(*indexNode); idxNode != nil {
+			stat.add(idxNode)
+		}
+	}
+	return stat
+}
+
+// evictKey delete a key by writing delete entries, a collection is dropped as a whole.
+// It returns false if the key is locked by others.
+func (db *GoDb) evictKey(dataType DataType, key []byte) (bool, error) {
+	if !db.strIndex.locks.tryLock(key) {
+		return false, nil
+	}
+	defer db.strIndex.locks.unlock(key)
+	if dataType == String {
+		return true, db.deleteInternal(key)
+	}
+	return true, db.dropInternal(dataType, key)
+}
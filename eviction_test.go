@@ -0,0 +1,221 @@
+package godb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoDb_MaxMemory(t *testing.T) {
+	t.Run("lru", func(t *testing.T) {
+		testGoDbMaxMemory(t, AllKeysLRU)
+	})
+	t.Run("lfu", func(t *testing.T) {
+		testGoDbMaxMemory(t, AllKeysLFU)
+	})
+	t.Run("random", func(t *testing.T) {
+		testGoDbMaxMemory(t, AllKeysRandom)
+	})
+}
+
+func testGoDbMaxMemory(t *testing.T, policy EvictionPolicy) {
+	path := filepath.Join("/tmp", "godb-eviction")
+	opts := DefaultOptions(path)
+	opts.MaxMemory = 64 << 10
+	opts.EvictionPolicy = policy
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// the hot key is read after every write.
+	hotKey := []byte("hot-key")
+	err = db.Set(hotKey, GetValue16B())
+	assert.Nil(t, err)
+	for i := 0; i < 5000; i++ {
+		err := db.Set(GetKey(i), GetValue16B())
+		assert.Nil(t, err)
+		// the hot key may be evicted under random policy.
+		_, _ = db.Get(hotKey)
+	}
+	waitEviction(db)
+
+	stats := db.Stats()
+	assert.True(t, stats.EvictedKeys > 0)
+	assert.True(t, stats.MemoryUsage <= opts.MaxMemory)
+	if policy != AllKeysRandom {
+		_, err = db.Get(hotKey)
+		assert.Nil(t, err)
+		_, err = db.Get(GetKey(0))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+}
+
+func TestGoDb_MaxMemory_BeforeWrite(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-eviction")
+	opts := DefaultOptions(path)
+	opts.MaxMemory = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	// keys are evicted by writes without the evictor.
+	db.stopEviction()
+
+	for i := 0; i < 5000; i++ {
+		assert.Nil(t, db.Set(GetKey(i), GetValue16B()))
+		assert.Nil(t, db.HSet([]byte(fmt.Sprintf("hash-%d", i)), []byte("f"), GetValue16B()))
+		// only the entries written after the last eviction exceed.
+		assert.True(t, db.Stats().MemoryUsage <= opts.MaxMemory+1<<10, db.Stats().MemoryUsage)
+	}
+	assert.True(t, db.Stats().EvictedKeys > 0)
+}
+
+func TestGoDb_MaxMemory_Volatile(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-eviction")
+	opts := DefaultOptions(path)
+	opts.MaxMemory = 64 << 10
+	opts.EvictionPolicy = VolatileTTL
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 0; i < 200; i++ {
+		err := db.Set(GetKey(i), GetValue16B())
+		assert.Nil(t, err)
+	}
+	for i := 200; i < 5000; i++ {
+		err := db.SetEX(GetKey(i), GetValue16B(), time.Hour+time.Duration(i)*time.Second)
+		assert.Nil(t, err)
+	}
+	waitEviction(db)
+
+	assert.True(t, db.Stats().EvictedKeys > 0)
+	// keys without ttl are never evicted, and keys expire earlier are evicted first.
+	for i := 0; i < 200; i++ {
+		_, err := db.Get(GetKey(i))
+		assert.Nil(t, err)
+	}
+	_, err = db.Get(GetKey(200))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get(GetKey(4999))
+	assert.Nil(t, err)
+}
+
+func TestGoDb_MaxMemory_Collections(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-eviction")
+	opts := DefaultOptions(path)
+	opts.MaxMemory = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := []byte("my_hash")
+	for i := 0; i < 100; i++ {
+		err := db.HSet(key, GetKey(i), GetValue16B())
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		err := db.SAdd([]byte("my_set"), GetKey(i))
+		assert.Nil(t, err)
+		err = db.ZAdd([]byte("my_zset"), float64(i), GetKey(i))
+		assert.Nil(t, err)
+		err = db.LPush([]byte("my_list"), GetKey(i))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 5000; i++ {
+		err := db.Set(GetKey(i), GetValue16B())
+		assert.Nil(t, err)
+	}
+	waitEviction(db)
+
+	// the collections are least recently used, they are evicted as a whole.
+	assert.Equal(t, 0, db.HLen(key))
+	assert.Equal(t, 0, db.SCard([]byte("my_set")))
+	assert.Equal(t, 0, db.ZCard([]byte("my_zset")))
+	assert.Equal(t, 0, db.LLen([]byte("my_list")))
+	assert.True(t, db.Stats().MemoryUsage <= opts.MaxMemory)
+}
+
+func TestGoDb_MaxMemory_VolatileCollections(t *testing.T) {
+	tests := []struct {
+		name                 string
+		activeExpireInterval time.Duration
+	}{
+		// keys are sampled from the expiry index.
+		{"expiry-index", time.Millisecond * 100},
+		{"keyspace", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "godb-eviction")
+			opts := DefaultOptions(path)
+			opts.MaxMemory = 64 << 10
+			opts.EvictionPolicy = VolatileTTL
+			opts.ActiveExpireInterval = tt.activeExpireInterval
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			defer destroyDB(db)
+
+			for i := 0; i < 100; i++ {
+				assert.Nil(t, db.HSet([]byte("expiring"), GetKey(i), GetValue16B()))
+				assert.Nil(t, db.HSet([]byte("persist"), GetKey(i), GetValue16B()))
+			}
+			assert.Nil(t, db.Expire([]byte("expiring"), time.Hour))
+			for i := 0; i < 1000; i++ {
+				err := db.SetEX(GetKey(i), GetValue16B(), time.Hour*2+time.Duration(i)*time.Second)
+				assert.Nil(t, err)
+			}
+			waitEviction(db)
+
+			// the hash expires earliest, and the one without ttl is never evicted.
+			assert.True(t, db.Stats().EvictedKeys > 0)
+			assert.Equal(t, 0, db.HLen([]byte("expiring")))
+			assert.Equal(t, 100, db.HLen([]byte("persist")))
+		})
+	}
+}
+
+func TestEvictionPool(t *testing.T) {
+	pool := &evictionPool{}
+	for i := 0; i < evictionPoolSize*2; i++ {
+		pool.offer(&evictCandidate{dataType: String, key: GetKey(i), score: int64(evictionPoolSize*2 - i)})
+	}
+	assert.Equal(t, evictionPoolSize, len(pool.candidates))
+	// the same key is replaced, and candidates with the same score are popped in the order of being offered.
+	pool.offer(&evictCandidate{dataType: String, key: GetKey(evictionPoolSize*2 - 1), score: 100})
+	pool.offer(&evictCandidate{dataType: Hash, key: GetKey(0), score: 2})
+	assert.Equal(t, GetKey(evictionPoolSize*2-2), pool.pop().key)
+	c := pool.pop()
+	assert.Equal(t, Hash, c.dataType)
+	assert.Equal(t, GetKey(0), c.key)
+	assert.Equal(t, GetKey(evictionPoolSize*2-3), pool.pop().key)
+
+	for pool.pop() != nil {
+	}
+	assert.Nil(t, pool.pop())
+}
+
+func TestLFUCounter(t *testing.T) {
+	freq := uint32(lfuInitVal)
+	for i := 0; i < 100000; i++ {
+		freq = lfuIncr(freq)
+	}
+	assert.True(t, freq > lfuInitVal && freq <= lfuMaxVal)
+	assert.Equal(t, uint32(lfuMaxVal), lfuIncr(lfuMaxVal))
+
+	now := time.Now().UnixNano()
+	assert.Equal(t, uint32(10), lfuDecr(10, now, now))
+	assert.Equal(t, uint32(7), lfuDecr(10, now-3*lfuDecayTime, now))
+	assert.Equal(t, uint32(0), lfuDecr(10, now-30*lfuDecayTime, now))
+}
+
+// waitEviction wait until memory usage is not more than MaxMemory, or the deadline is exceeded.
+func waitEviction(db *GoDb) {
+	deadline := time.Now().Add(30 * time.Second)
+	for db.Stats().MemoryUsage > db.opts.MaxMemory && time.Now().Before(deadline) {
+		db.triggerEviction()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,311 @@
+package godb
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/herott-ai/godb/logger"
+)
+
+const (
+	// activeExpireBatch number of expired keys deleted between two checks of the time budget.
+	activeExpireBatch = 20
+	// activeExpireBudget max percentage of ActiveExpireInterval taken by a round of active expiration, same as redis.
+	activeExpireBudget = 25
+)
+
+type (
+	// expiryIndex keys and hash fields that have expiration time, ordered by it, so the expired ones can be found without scanning indexes.
+	// It is shared by the indexes of all data types like keyLocks, and a nil expiryIndex ignores all updates.
+	expiryIndex struct {
+		mu     sync.Mutex
+		items  expiryHeap
+		keys   map[expiryKey]*expiryItem
+		fields map[string]map[string]struct{} // hash fields in the index of each key, so they can be removed when the hash is dropped.
+	}
+
+	expiryKey struct {
+		dataType DataType
+		key      string
+		field    string
+		isField  bool // a field of the Hash stored at key, which expires by itself, see HExpire.
+	}
+
+	expiryItem struct {
+		expiryKey
+		expiredAt int64
+		index     int // index in expiryHeap.
+	}
+
+	// expiryHeap a min heap of expiration time.
+	expiryHeap []*expiryItem
+)
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiredAt < h[j].expiredAt }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *expiryHeap) Push(x interface{}) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// newExpiryIndex returns nil if expired keys are not deleted in background, see Options.ActiveExpireInterval.
+func newExpiryIndex(opts Options) *expiryIndex {
+	if opts.ReadOnly || opts.ActiveExpireInterval <= 0 {
+		return nil
+	}
+	return &expiryIndex{keys: make(map[expiryKey]*expiryItem), fields: make(map[string]map[string]struct{})}
+}
+
+// ExpiredAt returns the expiration time of index node, implements index.Expirer.
+func (n *indexNode) ExpiredAt() int64 {
+	return n.expiredAt
+}
+
+// set the expiration time of key, 0 means it never expires and key is removed.
+func (e *expiryIndex) set(dataType DataType, key []byte, expiredAt int64) {
+	if e == nil {
+		return
+	}
+	e.update(expiryKey{dataType: dataType, key: string(key)}, expiredAt)
+}
+
+// setField set the expiration time of a field in the Hash stored at key, see set.
+func (e *expiryIndex) setField(key, field []byte, expiredAt int64) {
+	if e == nil {
+		return
+	}
+	e.update(expiryKey{dataType: Hash, key: string(key), field: string(field), isField: true}, expiredAt)
+}
+
+func (e *expiryIndex) update(k expiryKey, expiredAt int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	item := e.keys[k]
+	switch {
+	case item == nil && expiredAt == 0:
+	case item == nil:
+		item = &expiryItem{expiryKey: k, expiredAt: expiredAt}
+		heap.Push(&e.items, item)
+		e.keys[k] = item
+		if k.isField {
+			if e.fields[k.key] == nil {
+				e.fields[k.key] = make(map[string]struct{})
+			}
+			e.fields[k.key][k.field] = struct{}{}
+		}
+	case expiredAt == 0:
+		heap.Remove(&e.items, item.index)
+		e.remove(k)
+	default:
+		item.expiredAt = expiredAt
+		heap.Fix(&e.items, item.index)
+	}
+}
+
+// removeFields remove all fields of the Hash stored at key, it is called when the hash is dropped.
+func (e *expiryIndex) removeFields(key []byte) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for field := range e.fields[string(key)] {
+		k := expiryKey{dataType: Hash, key: string(key), field: field, isField: true}
+		heap.Remove(&e.items, e.keys[k].index)
+		delete(e.keys, k)
+	}
+	delete(e.fields, string(key))
+}
+
+// remove k from keys and fields after its item is removed from the heap, mu must be held.
+func (e *expiryIndex) remove(k expiryKey) {
+	delete(e.keys, k)
+	if !k.isField {
+		return
+	}
+	if fields := e.fields[k.key]; fields != nil {
+		delete(fields, k.field)
+		if len(fields) == 0 {
+			delete(e.fields, k.key)
+		}
+	}
+}
+
+// popExpired remove and returns at most n keys expired at ts, in the order of expiration time.
+func (e *expiryIndex) popExpired(ts int64, n int) []*expiryItem {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var items []*expiryItem
+	for len(items) < n && len(e.items) > 0 && e.items[0].expiredAt <= ts {
+		item := heap.Pop(&e.items).(*expiryItem)
+		e.remove(item.expiryKey)
+		items = append(items, item)
+	}
+	return items
+}
+
+// len returns the number of keys and hash fields that have expiration time.
+func (e *expiryIndex) len() int {
+	if e == nil {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.items)
+}
+
+// sample returns at most n keys that have expiration time, they are picked randomly by the iteration of map.
+func (e *expiryIndex) sample(n int) []expiryKey {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	keys := make([]expiryKey, 0, n)
+	for k := range e.keys {
+		if len(keys) >= n {
+			break
+		}
+		if !k.isField {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// handleActiveExpire delete expired keys periodically until db is closed, see Options.ActiveExpireInterval.
+func (db *GoDb) handleActiveExpire() {
+	defer close(db.expireDone)
+	ticker := time.NewTicker(db.opts.ActiveExpireInterval)
+	defer ticker.Stop()
+	budget := db.opts.ActiveExpireInterval * activeExpireBudget / 100
+	for {
+		select {
+		case <-ticker.C:
+			db.activeExpire(budget)
+		case <-db.expireStop:
+			return
+		}
+	}
+}
+
+// startActiveExpire start deleting expired keys in background if the expiry index is enabled.
+func (db *GoDb) startActiveExpire() {
+	if db.expires == nil {
+		return
+	}
+	db.expireStop = make(chan struct{})
+	db.expireDone = make(chan struct{})
+	go db.handleActiveExpire()
+}
+
+// stopActiveExpire stop deleting expired keys in background, and wait for the running round.
+func (db *GoDb) stopActiveExpire() {
+	if db.expireStop == nil {
+		return
+	}
+	select {
+	case <-db.expireStop:
+	default:
+		close(db.expireStop)
+	}
+	<-db.expireDone
+}
+
+// activeExpire delete expired keys in the order of expiration time, until there is none or the time budget is used up.
+func (db *GoDb) activeExpire(budget time.Duration) {
+	start := time.Now()
+	for time.Since(start) < budget {
+		items := db.expires.popExpired(time.Now().UnixMilli(), activeExpireBatch)
+		if len(items) == 0 {
+			return
+		}
+		var lastErr error
+		for _, item := range items {
+			var deleted bool
+			var err error
+			if item.isField {
+				deleted, err = db.deleteExpiredField([]byte(item.key), []byte(item.field))
+			} else {
+				deleted, err = db.deleteExpired(item.dataType, []byte(item.key))
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if deleted {
+				atomic.AddUint64(&db.expiredKeys, 1)
+			}
+		}
+		if lastErr != nil {
+			logger.Errorf("active expire err: %v", lastErr)
+			return
+		}
+	}
+}
+
+// deleteExpired delete key by writing delete entries like Del, if it holds a value of the data type which has expired.
+// The key is put back to the expiry index if it fails, to be deleted in the next round.
+func (db *GoDb) deleteExpired(dataType DataType, key []byte) (bool, error) {
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
+
+	var expiredAt int64
+	if dataType == String {
+		if node, _ := db.strIndex.Get(key).(*indexNode); node != nil {
+			expiredAt = node.expiredAt
+		}
+		if err := db.indexErr(db.strIndex); err != nil {
+			return false, err
+		}
+	} else {
+		expiredAt = db.collectionIndexOf(dataType).expiredAt(key)
+	}
+	// the expiration time has been changed after the key was popped.
+	if expiredAt == 0 || expiredAt > time.Now().UnixMilli() {
+		return false, nil
+	}
+	if err := db.deleteType(dataType, key); err != nil {
+		db.expires.set(dataType, key, expiredAt)
+		return false, err
+	}
+	return true, nil
+}
+
+// deleteExpiredField delete a field of the Hash stored at key by writing a delete entry like HDel, if it has expired.
+// The field is put back to the expiry index if it fails, to be deleted in the next round.
+func (db *GoDb) deleteExpiredField(key, field []byte) (bool, error) {
+	db.hashIndex.locks.lock(key)
+	defer db.hashIndex.locks.unlock(key)
+
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
+		return false, nil
+	}
+	node, _ := idxTree.Get(field).(*indexNode)
+	// the field has been deleted, or written again after it was popped.
+	if node == nil || node.expiredAt == 0 || node.expiredAt > time.Now().UnixMilli() {
+		return false, nil
+	}
+	if _, err := db.hDelInternal(key, idxTree, field); err != nil {
+		db.expires.setField(key, field, node.expiredAt)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,198 @@
+package godb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiryIndex(t *testing.T) {
+	e := newExpiryIndex(DefaultOptions(""))
+	e.set(String, []byte("a"), 30)
+	e.set(String, []byte("b"), 10)
+	e.set(Hash, []byte("a"), 20)
+	e.set(String, []byte("c"), 40)
+	assert.Equal(t, 4, e.len())
+
+	// update and remove.
+	e.set(String, []byte("c"), 5)
+	e.set(String, []byte("b"), 0)
+	e.set(String, []byte("not-exist"), 0)
+	assert.Equal(t, 3, e.len())
+
+	pop := func(ts int64, n int) []string {
+		var keys []string
+		for _, item := range e.popExpired(ts, n) {
+			keys = append(keys, item.key)
+		}
+		return keys
+	}
+	assert.Nil(t, pop(1, 10))
+	assert.Equal(t, []string{"c", "a"}, pop(30, 2))
+	assert.Equal(t, []string{"a"}, pop(30, 2))
+	assert.Equal(t, 0, e.len())
+
+	// fields of a hash are removed when it is dropped.
+	e.set(Hash, []byte("h"), 10)
+	e.setField([]byte("h"), []byte("f1"), 20)
+	e.setField([]byte("h"), []byte("f2"), 30)
+	e.setField([]byte("other"), []byte("f1"), 40)
+	e.removeFields([]byte("h"))
+	assert.Equal(t, 2, e.len())
+	assert.Equal(t, 1, len(e.fields))
+	assert.Equal(t, []string{"h", "other"}, pop(40, 10))
+	assert.Equal(t, 0, len(e.fields))
+
+	// nil expiry index ignores all updates.
+	var disabled *expiryIndex
+	disabled.set(String, []byte("a"), 10)
+	disabled.removeFields([]byte("a"))
+	assert.Nil(t, disabled.popExpired(20, 10))
+	assert.Equal(t, 0, disabled.len())
+}
+
+func TestGoDb_ActiveExpire(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-expire")
+	opts := DefaultOptions(path)
+	// expired keys are deleted by calling activeExpire in the test.
+	opts.ActiveExpireInterval = time.Hour
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.SetEX(GetKey(i), GetValue16B(), time.Millisecond*50))
+	}
+	assert.Nil(t, db.Set([]byte("persist"), GetValue16B()))
+	assert.Nil(t, db.SetEX([]byte("later"), GetValue16B(), time.Hour))
+	// keys whose expiration time is removed or changed are not deleted.
+	assert.Nil(t, db.SetEX([]byte("removed"), GetValue16B(), time.Millisecond*50))
+	assert.Nil(t, db.Persist([]byte("removed")))
+	assert.Nil(t, db.SetEX([]byte("changed"), GetValue16B(), time.Millisecond*50))
+	assert.Nil(t, db.Expire([]byte("changed"), time.Hour))
+	for name, ops := range testCollectionOps {
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, ops.add(db, []byte(name), i))
+		}
+		assert.Nil(t, db.PExpire([]byte(name), 50))
+	}
+	assert.Equal(t, 106, db.Stats().VolatileKeys)
+
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, 104, db.strIndex.Size())
+	// nothing is deleted without time budget.
+	db.activeExpire(0)
+	assert.Equal(t, uint64(0), db.Stats().ExpiredKeys)
+
+	db.activeExpire(time.Second)
+	stats := db.Stats()
+	assert.Equal(t, uint64(104), stats.ExpiredKeys)
+	assert.Equal(t, 2, stats.VolatileKeys)
+	// index nodes of expired keys are freed.
+	assert.Equal(t, 4, db.strIndex.Size())
+	for name, ops := range testCollectionOps {
+		assert.Nil(t, db.collectionIndexOf(ops.dataType).rawTree([]byte(name)), name)
+		assert.Equal(t, int64(0), db.collectionIndexOf(ops.dataType).expiredAt([]byte(name)), name)
+	}
+	assert.Equal(t, 4, db.Exists([]byte("persist"), []byte("later"), []byte("removed"), []byte("changed")))
+
+	// expired keys stay deleted after reopening, and keys with expiration time are loaded into the expiry index.
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, db.strIndex.Size())
+	assert.Equal(t, 2, db.Stats().VolatileKeys)
+	for name, ops := range testCollectionOps {
+		assert.Equal(t, 0, ops.size(db, []byte(name)), name)
+	}
+}
+
+func TestGoDb_ActiveExpireInBackground(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-expire")
+	opts := DefaultOptions(path)
+	opts.ActiveExpireInterval = time.Millisecond * 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.SetEX(GetKey(i), GetValue16B(), time.Millisecond*20))
+	}
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f"), GetValue16B()))
+	assert.Nil(t, db.PExpire([]byte("hash"), 20))
+
+	deadline := time.Now().Add(time.Second * 5)
+	for db.Stats().ExpiredKeys < 1001 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, uint64(1001), db.Stats().ExpiredKeys)
+	assert.Equal(t, 0, db.strIndex.Size())
+	assert.Nil(t, db.hashIndex.rawTree([]byte("hash")))
+}
+
+func TestGoDb_ActiveExpireDisabled(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-expire")
+	opts := DefaultOptions(path)
+	opts.ActiveExpireInterval = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.SetEX([]byte("a"), GetValue16B(), time.Millisecond*10))
+	assert.Equal(t, 0, db.Stats().VolatileKeys)
+	time.Sleep(time.Millisecond * 20)
+	db.activeExpire(time.Second)
+	assert.Equal(t, uint64(0), db.Stats().ExpiredKeys)
+	assert.Equal(t, 0, db.Exists([]byte("a")))
+}
+
+func TestGoDb_ActiveExpireHashFields(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-expire")
+	opts := DefaultOptions(path)
+	opts.ActiveExpireInterval = time.Hour
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("user")
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.HSetEX(key, time.Millisecond*50, GetKey(i), GetValue16B()))
+	}
+	assert.Nil(t, db.HSetEX(key, time.Hour, []byte("later"), GetValue16B()))
+	assert.Nil(t, db.HSet(key, []byte("persist"), GetValue16B()))
+	// fields whose expiration time is removed or changed are not deleted.
+	_, err = db.HPersist(key, GetKey(0))
+	assert.Nil(t, err)
+	_, err = db.HExpire(key, time.Hour, GetKey(1))
+	assert.Nil(t, err)
+	_, err = db.HDel(key, GetKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, 9, db.Stats().VolatileKeys)
+
+	time.Sleep(time.Millisecond * 100)
+	db.activeExpire(time.Second)
+	stats := db.Stats()
+	assert.Equal(t, uint64(7), stats.ExpiredKeys)
+	assert.Equal(t, 2, stats.VolatileKeys)
+	// index nodes of expired fields are freed.
+	assert.Equal(t, 4, db.hashIndex.tree(key).Size())
+	assert.Equal(t, 4, db.HLen(key))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, db.hashIndex.tree(key).Size())
+	assert.Equal(t, 2, db.Stats().VolatileKeys)
+
+	// fields of a dropped hash are removed from the expiry index.
+	n, err := db.Del(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, db.Stats().VolatileKeys)
+}
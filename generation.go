@@ -0,0 +1,219 @@
+package godb
+
+import (
+	"encoding/binary"
+
+	"github.com/herott-ai/godb/ds/index"
+	"github.com/herott-ai/godb/logfile"
+)
+
+// Every collection key(List, Hash, Set and ZSet) has a generation, which starts from 0.
+// Dropping a collection writes one TypeGenMeta record with the next generation, instead of deleting its members one by one.
+// Entries of collections are written with the generation of their key appended to the key,
+// so the entries of older generations are ignored when loading index, and reclaimed by log file gc.
+// Setting the expiration time of a collection writes the record of its current generation again with ExpiredAt,
+// an expired collection is hidden from reads, and dropped by the next write.
+// Log file gc rewrites the latest record of a collection, until it is in the oldest log file and nothing else needs it,
+// then the record is deleted with the log file, and the key starts from generation 0 again.
+
+const (
+	// genSize size of the generation appended to keys of collection entries.
+	genSize = 4
+	// genFormatVersion the first log file format version whose collection entries have generations.
+	genFormatVersion uint32 = 2
+)
+
+// appendGen returns a copy of key with gen appended.
+func appendGen(key []byte, gen uint32) []byte {
+	buf := make([]byte, len(key)+genSize)
+	copy(buf, key)
+	binary.LittleEndian.PutUint32(buf[len(key):], gen)
+	return buf
+}
+
+// splitGen split the generation appended to key, it returns false if key is too short to have one.
+func splitGen(key []byte) ([]byte, uint32, bool) {
+	if len(key) < genSize {
+		return key, 0, false
+	}
+	n := len(key) - genSize
+	return key[:n], binary.LittleEndian.Uint32(key[n:]), true
+}
+
+// hasGen returns whether keys of entries in the log file have generations appended.
+// String entries never have, and neither do collection entries in log files of older format versions.
+func (db *GoDb) hasGen(dataType DataType, fid uint32) bool {
+	return dataType != String && db.manifest.segmentVersion(dataType, fid) >= genFormatVersion
+}
+
+// collectionIndexOf returns the index of a collection data type.
+func (db *GoDb) collectionIndexOf(dataType DataType) *collectionIndex {
+	switch dataType {
+	case List:
+		return db.listIndex.collectionIndex
+	case Hash:
+		return db.hashIndex.collectionIndex
+	case Set:
+		return db.setIndex.collectionIndex
+	case ZSet:
+		return db.zsetIndex.collectionIndex
+	}
+	return nil
+}
+
+// writeMember write an entry of the collection stored at key, with the current generation of key appended to the key of entry.
+// The size of the written entry is set in the returned position.
+func (db *GoDb) writeMember(dataType DataType, key []byte, ent *logfile.LogEntry) (*valuePos, error) {
+	c := db.collectionIndexOf(dataType)
+	gen, mark := c.genMembers(key)
+	genEnt := *ent
+	genEnt.Key = appendGen(ent.Key, gen)
+	pos, err := db.writeLogEntry(&genEnt, dataType)
+	if err != nil {
+		return nil, err
+	}
+	if mark {
+		c.markMembers(key, gen)
+	}
+	pos.entrySize = logfile.EncodedSize(&genEnt)
+	return pos, nil
+}
+
+// dropCollection delete the collection stored at key as a whole, by writing one record which starts a new generation of key.
+func (db *GoDb) dropCollection(dataType DataType, key []byte) error {
+	c := db.collectionIndexOf(dataType)
+	c.locks.lock(key)
+	defer c.locks.unlock(key)
+	return db.dropInternal(dataType, key)
+}
+
+// dropInternal is the same as dropCollection, but the key lock must be held.
+// The new generation has no expiration time, an expired collection or an empty one that has expiration time is also dropped.
+func (db *GoDb) dropInternal(dataType DataType, key []byte) error {
+	c := db.collectionIndexOf(dataType)
+	if c.rawTree(key) == nil && c.expiredAt(key) == 0 {
+		return nil
+	}
+	gen := c.gen(key) + 1
+	ent := &logfile.LogEntry{Key: appendGen(key, gen), Type: logfile.TypeGenMeta}
+	pos, err := db.writeLogEntry(ent, dataType)
+	if err != nil {
+		return err
+	}
+	pos.entrySize = logfile.EncodedSize(ent)
+	old := c.setGen(key, gen, db.newIndexNode(ent, pos, pos.entrySize))
+	db.sendDiscard(old, old != nil, dataType)
+
+	tree := c.detachTree(key)
+	switch dataType {
+	case ZSet:
+		db.zsetIndex.indexes.ZClear(string(key))
+	case Hash:
+		c.expires.removeFields(key)
+	}
+	db.discardTree(dataType, tree)
+	return nil
+}
+
+// expireInternal set the expiration time of the collection stored at key, 0 means it never expires.
+// The record of the current generation is written again with the expiration time, the key lock must be held.
+func (db *GoDb) expireInternal(dataType DataType, key []byte, expiredAt int64) error {
+	c := db.collectionIndexOf(dataType)
+	gen := c.gen(key)
+	ent := &logfile.LogEntry{Key: appendGen(key, gen), Type: logfile.TypeGenMeta, ExpiredAt: expiredAt}
+	pos, err := db.writeLogEntry(ent, dataType)
+	if err != nil {
+		return err
+	}
+	pos.entrySize = logfile.EncodedSize(ent)
+	old := c.setGen(key, gen, db.newIndexNode(ent, pos, pos.entrySize))
+	db.sendDiscard(old, old != nil, dataType)
+	return nil
+}
+
+// expired returns whether the collection expired at ts.
+func (kg *keyGen) expired(ts int64) bool {
+	return kg.node != nil && kg.node.expiredAt != 0 && kg.node.expiredAt <= ts
+}
+
+// discardTree mark all entries in a dropped tree as discarded and clear it in background,
+// so that dropping a large collection returns immediately.
+func (db *GoDb) discardTree(dataType DataType, tree *index.Tree) {
+	if tree == nil {
+		return
+	}
+	db.dropWg.Add(1)
+	go func() {
+		defer db.dropWg.Done()
+		discarded := make(map[uint32]int)
+		iter := tree.Iterator()
+		for iter.HasNext() {
+			_, value := iter.Next()
+			if node, _ := value.(*indexNode); node != nil && node.entrySize > 0 {
+				discarded[node.fid] += node.entrySize
+			}
+		}
+		tree.Clear()
+		for fid, size := range discarded {
+			db.discards[dataType].incrDiscard(fid, size)
+		}
+	}()
+}
+
+// isOldestLogFile returns whether no archived log file of the data type is older than fid.
+// Entries written before the latest record of a collection are all in it or older ones.
+func (db *GoDb) isOldestLogFile(dataType DataType, fid uint32) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for id := range db.archivedLogFiles[dataType] {
+		if id < fid {
+			return false
+		}
+	}
+	return true
+}
+
+// dropGenRecords remove the generations whose records are not rewritten by log file gc, after their log file is deleted.
+// Nothing is left in log files about the collections, so they start from generation 0 again.
+func (db *GoDb) dropGenRecords(dataType DataType, records map[string]*indexNode) {
+	c := db.collectionIndexOf(dataType)
+	for key, node := range records {
+		c.locks.lock([]byte(key))
+		c.dropGen([]byte(key), node)
+		c.locks.unlock([]byte(key))
+	}
+}
+
+// acceptMember is the same as acceptGen for an entry of a member, which also marks that gen has members.
+func (db *GoDb) acceptMember(dataType DataType, key []byte, gen uint32) bool {
+	if !db.acceptGen(dataType, key, gen) {
+		return false
+	}
+	c := db.collectionIndexOf(dataType)
+	if _, mark := c.genMembers(key); mark {
+		c.markMembers(key, gen)
+	}
+	return true
+}
+
+// acceptGen check the generation of an entry of the collection stored at key when loading index.
+// Entries of older generations are ignored, and an entry of a newer generation drops the collection built so far.
+func (db *GoDb) acceptGen(dataType DataType, key []byte, gen uint32) bool {
+	c := db.collectionIndexOf(dataType)
+	cur := c.gen(key)
+	if gen < cur {
+		return false
+	}
+	if gen > cur {
+		// the record that started gen has been moved behind by log file gc, it will be set when loaded.
+		c.setGen(key, gen, nil)
+		c.removeTree(key)
+		switch dataType {
+		case ZSet:
+			db.zsetIndex.indexes.ZClear(string(key))
+		case Hash:
+			c.expires.removeFields(key)
+		}
+	}
+	return true
+}
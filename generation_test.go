@@ -0,0 +1,295 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/herott-ai/godb/logfile"
+	"github.com/stretchr/testify/assert"
+)
+
+type collectionOps struct {
+	dataType DataType
+	add      func(db *GoDb, key []byte, i int) error
+	size     func(db *GoDb, key []byte) int
+	clear    func(db *GoDb, key []byte) error
+}
+
+var testCollectionOps = map[string]collectionOps{
+	"hash": {
+		dataType: Hash,
+		add: func(db *GoDb, key []byte, i int) error {
+			return db.HSet(key, GetKey(i), GetValue16B())
+		},
+		size:  func(db *GoDb, key []byte) int { return db.HLen(key) },
+		clear: func(db *GoDb, key []byte) error { return db.HClear(key) },
+	},
+	"set": {
+		dataType: Set,
+		add: func(db *GoDb, key []byte, i int) error {
+			return db.SAdd(key, GetKey(i))
+		},
+		size:  func(db *GoDb, key []byte) int { return db.SCard(key) },
+		clear: func(db *GoDb, key []byte) error { return db.SClear(key) },
+	},
+	"zset": {
+		dataType: ZSet,
+		add: func(db *GoDb, key []byte, i int) error {
+			return db.ZAdd(key, float64(i), GetKey(i))
+		},
+		size:  func(db *GoDb, key []byte) int { return db.ZCard(key) },
+		clear: func(db *GoDb, key []byte) error { return db.ZClear(key) },
+	},
+	"list": {
+		dataType: List,
+		add: func(db *GoDb, key []byte, i int) error {
+			return db.RPush(key, GetKey(i))
+		},
+		size:  func(db *GoDb, key []byte) int { return db.LLen(key) },
+		clear: func(db *GoDb, key []byte) error { return db.LClear(key) },
+	},
+}
+
+func TestGoDb_DropCollections(t *testing.T) {
+	for name, ops := range testCollectionOps {
+		t.Run(name, func(t *testing.T) {
+			testGoDbDropCollection(t, ops)
+		})
+	}
+}
+
+func testGoDbDropCollection(t *testing.T, ops collectionOps) {
+	path := filepath.Join("/tmp", "godb-drop")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key, other := []byte("key"), []byte("other")
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, ops.add(db, key, i))
+	}
+	assert.Nil(t, ops.add(db, other, 0))
+
+	active := db.getActiveLogFile(ops.dataType)
+	writeAt := active.WriteAt
+	err = ops.clear(db, key)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, ops.size(db, key))
+	assert.Equal(t, 1, ops.size(db, other))
+	// only one record is written.
+	genEnt := &logfile.LogEntry{Key: appendGen(key, 1), Type: logfile.TypeGenMeta}
+	assert.Equal(t, writeAt+int64(logfile.EncodedSize(genEnt)), active.WriteAt)
+	assert.Equal(t, uint32(1), db.collectionIndexOf(ops.dataType).gen(key))
+
+	// dropping a collection not exists is a no-op.
+	err = ops.clear(db, []byte("not-exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), db.collectionIndexOf(ops.dataType).gen([]byte("not-exist")))
+
+	// stale members are ignored after reopening.
+	reopen := func() {
+		assert.Nil(t, db.Close())
+		db, err = Open(opts)
+		assert.Nil(t, err)
+	}
+	reopen()
+	assert.Equal(t, 0, ops.size(db, key))
+	assert.Equal(t, 1, ops.size(db, other))
+
+	// a new collection starts from empty.
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, ops.add(db, key, i))
+	}
+	assert.Equal(t, 10, ops.size(db, key))
+	reopen()
+	assert.Equal(t, 10, ops.size(db, key))
+	assert.Equal(t, uint32(1), db.collectionIndexOf(ops.dataType).gen(key))
+
+	// drop it again.
+	assert.Nil(t, ops.clear(db, key))
+	reopen()
+	assert.Equal(t, 0, ops.size(db, key))
+	assert.Equal(t, uint32(2), db.collectionIndexOf(ops.dataType).gen(key))
+}
+
+func TestGoDb_DropCollectionGC(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-drop")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("my_hash")
+	for i := 0; i < 50000; i++ {
+		err := db.HSet(key, GetKey(i), GetValue16B())
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.HClear(key))
+	assert.Nil(t, db.HSet(key, []byte("new"), []byte("value")))
+	_, node := db.hashIndex.genNode(key)
+	genFid := node.fid
+	// overwrite some fields until the log file of the record which starts generation 1 is archived.
+	for i := 0; db.getActiveLogFile(Hash).Fid <= genFid+1; i++ {
+		assert.Nil(t, db.HSet([]byte("filler"), GetKey(i%100), GetValue128B()))
+	}
+	db.dropWg.Wait()
+
+	archived := len(db.archivedLogFiles[Hash])
+	err = db.RunLogFileGC(Hash, -1, 0.5)
+	assert.Nil(t, err)
+	assert.True(t, len(db.archivedLogFiles[Hash]) < archived)
+	// the record is rewritten, but the stale fields are not.
+	_, node = db.hashIndex.genNode(key)
+	assert.True(t, node.fid > genFid)
+
+	v, err := db.HGet(key, []byte("new"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), v)
+	assert.Equal(t, 1, db.HLen(key))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, db.HLen(key))
+	assert.Equal(t, uint32(1), db.hashIndex.gen(key))
+}
+
+func TestGoDb_DropCollectionGensBounded(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-drop")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	rounds, keys := 20, 1000
+	hashKey := func(round, i int) []byte {
+		return []byte(fmt.Sprintf("hash-%d-%d", round, i))
+	}
+	same := []byte("same")
+	for round := 0; round < rounds; round++ {
+		for i := 0; i < keys; i++ {
+			assert.Nil(t, db.HSet(hashKey(round, i), []byte("f"), GetValue128B()))
+			assert.Nil(t, db.HClear(hashKey(round, i)))
+		}
+		// a key written again after being dropped keeps its generation, it does not exist in the first round.
+		assert.Nil(t, db.HClear(same))
+		assert.Nil(t, db.HSet(same, []byte("f"), []byte("v")))
+		db.dropWg.Wait()
+		time.Sleep(time.Millisecond * 50)
+		assert.Nil(t, db.RunLogFileGC(Hash, -1, 0.5))
+	}
+	// records of the dropped keys are deleted with the oldest log files instead of being rewritten forever.
+	assert.True(t, len(db.hashIndex.gens) <= 3*keys, len(db.hashIndex.gens))
+	assert.True(t, len(db.archivedLogFiles[Hash]) <= 2, len(db.archivedLogFiles[Hash]))
+	assert.Equal(t, uint32(0), db.hashIndex.gen(hashKey(0, 0)))
+	assert.Equal(t, uint32(rounds-1), db.hashIndex.gen(same))
+
+	// a key whose generation is dropped starts from generation 0 again.
+	assert.Nil(t, db.HSet(hashKey(0, 0), []byte("f"), []byte("v")))
+	gens := len(db.hashIndex.gens)
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, gens, len(db.hashIndex.gens))
+	v, err := db.HGet(hashKey(0, 0), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), v)
+	assert.Equal(t, 0, db.HLen(hashKey(rounds-1, 0)))
+	assert.Equal(t, uint32(rounds-1), db.hashIndex.gen(same))
+	assert.Equal(t, 1, db.HLen(same))
+}
+
+func TestOpen_LegacyLogFiles(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-legacy")
+	assert.Nil(t, os.MkdirAll(path, os.ModePerm))
+	defer os.RemoveAll(path)
+
+	// a log file written before generations were added, which has no record in manifest.
+	lf, err := logfile.OpenLogFile(path, 0, 1<<20, logfile.Hash, logfile.FileIO)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		buf, _ := logfile.EncodeEntry(&logfile.LogEntry{Key: encodeKey([]byte("h"), GetKey(i)), Value: []byte("v")})
+		assert.Nil(t, lf.Write(buf))
+	}
+	assert.Nil(t, lf.Close())
+
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+	assert.Equal(t, 10, db.HLen([]byte("h")))
+	assert.Equal(t, legacyFormatVersion, db.manifest.segmentVersion(Hash, 0))
+	// entries of the current version are written to a new log file.
+	assert.Equal(t, uint32(1), db.getActiveLogFile(Hash).Fid)
+
+	assert.Nil(t, db.HSet([]byte("h"), []byte("f"), []byte("v")))
+	assert.Nil(t, db.HClear([]byte("h")))
+	assert.Nil(t, db.HSet([]byte("h"), []byte("g"), []byte("v")))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), db.getActiveLogFile(Hash).Fid)
+	fields, err := db.HKeys([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("g")}, fields)
+}
+
+func TestGoDb_ExpireCollectionGC(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-drop")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 1 << 20
+	// the expired hash is left to log file gc instead of being dropped in background.
+	opts.ActiveExpireInterval = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("session")
+	for i := 0; i < 20000; i++ {
+		assert.Nil(t, db.HSet(key, GetKey(i), GetValue16B()))
+	}
+	assert.Nil(t, db.Expire(key, time.Second))
+	_, node := db.hashIndex.genNode(key)
+	genFid := node.fid
+	for i := 0; db.getActiveLogFile(Hash).Fid <= genFid; i++ {
+		assert.Nil(t, db.HSet([]byte("filler"), GetKey(i%100), GetValue128B()))
+	}
+	time.Sleep(time.Second)
+
+	err = db.RunLogFileGC(Hash, -1, 0)
+	assert.Nil(t, err)
+	// the members are reclaimed, but the record with the expiration time is kept.
+	var size int64
+	for _, lf := range db.archivedLogFiles[Hash] {
+		size += lf.WriteAt
+	}
+	assert.True(t, size < 1<<19)
+	_, node = db.hashIndex.genNode(key)
+	assert.True(t, node.fid > genFid)
+	assert.NotEqual(t, int64(0), node.expiredAt)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.HLen(key))
+	assert.Equal(t, 100, db.HLen([]byte("filler")))
+	assert.Nil(t, db.HSet(key, []byte("f"), []byte("v")))
+	assert.Equal(t, 1, db.HLen(key))
+}
@@ -3,7 +3,7 @@ package godb
 import (
 	"bytes"
 	"errors"
-	"github.com/herott-ai/godb/ds/art"
+	"github.com/herott-ai/godb/ds/index"
 	"github.com/herott-ai/godb/logfile"
 	"github.com/herott-ai/godb/logger"
 	"github.com/herott-ai/godb/util"
@@ -19,52 +19,82 @@ import (
 // Return num of elements in hash of the specified key.
 // Multiple field-value pair is accepted. Parameter order should be like "key", "field", "value", "field", "value"...
 func (db *GoDb) HSet(key []byte, args ...[]byte) error {
-	db.hashIndex.mu.Lock()
-	defer db.hashIndex.mu.Unlock()
+	db.hashIndex.locks.lock(key)
+	defer db.hashIndex.locks.unlock(key)
 
 	if len(args) == 0 || len(args)&1 == 1 {
 		return ErrWrongNumberOfArgs
 	}
-	if db.hashIndex.trees[string(key)] == nil {
-		db.hashIndex.trees[string(key)] = art.NewART()
+	if err := db.checkWrite(key, Hash); err != nil {
+		return err
 	}
-	idxTree := db.hashIndex.trees[string(key)]
+	idxTree := db.hashIndex.treeOrCreate(key)
 
 	// add multiple field value pairs
 	for i := 0; i < len(args); i += 2 {
-		field, value := args[i], args[i+1]
-		hashKey := db.encodeKey(key, field)
-		// key, field as a new key tt
-		entry := &logfile.LogEntry{Key: hashKey, Value: value}
-		valuePos, err := db.writeLogEntry(entry, Hash)
-		if err != nil {
+		if err := db.hSetField(key, idxTree, args[i], args[i+1], 0); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		ent := &logfile.LogEntry{Key: field, Value: value}
-		_, size := logfile.EncodeEntry(entry)
-		valuePos.entrySize = size
-		err = db.updateIndexTree(idxTree, ent, valuePos, true, Hash)
-		if err != nil {
+// HSetEX is the same as HSet, but the fields expire after the given duration, see HExpire.
+func (db *GoDb) HSetEX(key []byte, duration time.Duration, args ...[]byte) error {
+	db.hashIndex.locks.lock(key)
+	defer db.hashIndex.locks.unlock(key)
+
+	if len(args) == 0 || len(args)&1 == 1 {
+		return ErrWrongNumberOfArgs
+	}
+	if err := db.checkWrite(key, Hash); err != nil {
+		return err
+	}
+	idxTree := db.hashIndex.treeOrCreate(key)
+	expiredAt := time.Now().Add(duration).UnixMilli()
+	for i := 0; i < len(args); i += 2 {
+		if err := db.hSetField(key, idxTree, args[i], args[i+1], expiredAt); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// hSetField set field in the hash stored at key to value, which expires at expiredAt, 0 means it never expires.
+// idxTree is the index of the hash, and the key lock must be held.
+func (db *GoDb) hSetField(key []byte, idxTree *index.Tree, field, value []byte, expiredAt int64) error {
+	// the field may have expiration time before.
+	volatile := idxTree.Volatile() > 0
+	// key, field as a new key tt
+	entry := &logfile.LogEntry{Key: db.encodeKey(key, field), Value: value, ExpiredAt: expiredAt}
+	valuePos, err := db.writeMember(Hash, key, entry)
+	if err != nil {
+		return err
+	}
+
+	ent := &logfile.LogEntry{Key: field, Value: value, ExpiredAt: expiredAt}
+	if err = db.updateIndexTree(idxTree, ent, valuePos, true, Hash); err != nil {
+		return err
+	}
+	if expiredAt != 0 || volatile {
+		db.expires.setField(key, field, expiredAt)
+	}
+	return nil
+}
+
 // HSetNX sets the given value only if the field doesn't exist.
 // If the key doesn't exist, new hash is created.
 // If field already exist, HSetNX doesn't have side effect.
 func (db *GoDb) HSetNX(key, field, value []byte) (bool, error) {
-	db.hashIndex.mu.Lock()
-	defer db.hashIndex.mu.Unlock()
+	db.hashIndex.locks.lock(key)
+	defer db.hashIndex.locks.unlock(key)
 
-	if db.hashIndex.trees[string(key)] == nil {
-		db.hashIndex.trees[string(key)] = art.NewART()
+	if err := db.checkWrite(key, Hash); err != nil {
+		return false, err
 	}
-	idxTree := db.hashIndex.trees[string(key)]
+	idxTree := db.hashIndex.treeOrCreate(key)
 	val, err := db.getVal(idxTree, field, Hash)
-	if err != nil {
+	if err != nil && err != ErrKeyNotFound {
 		return false, err
 	}
 
@@ -72,18 +102,7 @@ func (db *GoDb) HSetNX(key, field, value []byte) (bool, error) {
 	if val != nil {
 		return false, nil
 	}
-	hashKey := db.encodeKey(key, field)
-	ent := &logfile.LogEntry{Key: hashKey, Value: value}
-	valuePos, err := db.writeLogEntry(ent, Hash)
-	if err != nil {
-		return false, err
-	}
-
-	entry := &logfile.LogEntry{Key: field, Value: value}
-	_, size := logfile.EncodeEntry(ent)
-	valuePos.entrySize = size
-	err = db.updateIndexTree(idxTree, entry, valuePos, true, Hash)
-	if err != nil {
+	if err = db.hSetField(key, idxTree, field, value, 0); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -91,13 +110,13 @@ func (db *GoDb) HSetNX(key, field, value []byte) (bool, error) {
 
 // HGet returns the value associated with field in the hash stored at key.
 func (db *GoDb) HGet(key, field []byte) ([]byte, error) {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
 
-	if db.hashIndex.trees[string(key)] == nil {
-		return nil, nil
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
+		return nil, db.checkType(key, Hash)
 	}
-	idxTree := db.hashIndex.trees[string(key)]
 	val, err := db.getVal(idxTree, field, Hash)
 	if err == ErrKeyNotFound {
 		return nil, nil
@@ -110,48 +129,46 @@ func (db *GoDb) HGet(key, field []byte) ([]byte, error) {
 // Because non-existing keys are treated as empty hashes,
 // running HMGET against a non-existing key will return a list of nil values.
 func (db *GoDb) HMGet(key []byte, fields ...[]byte) (vals [][]byte, err error) {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
 
 	length := len(fields)
+	idxTree := db.hashIndex.tree(key)
 	// key not exist
-	if db.hashIndex.trees[string(key)] == nil {
+	if idxTree == nil {
+		if err := db.checkType(key, Hash); err != nil {
+			return nil, err
+		}
 		for i := 0; i < length; i++ {
 			vals = append(vals, nil)
 		}
 		return vals, nil
 	}
-	// key exist
-	idxTree := db.hashIndex.trees[string(key)]
 
-	for _, field := range fields {
-		val, err := db.getVal(idxTree, field, Hash)
-		if err == ErrKeyNotFound {
-			vals = append(vals, nil)
-		} else {
-			vals = append(vals, val)
-		}
-	}
-	return
+	return db.getVals(idxTree, fields, Hash)
 }
 
 // HDel removes the specified fields from the hash stored at key.
 // Specified fields that do not exist within this hash are ignored.
 // If key does not exist, it is treated as an empty hash and this command returns false.
 func (db *GoDb) HDel(key []byte, fields ...[]byte) (int, error) {
-	db.hashIndex.mu.Lock()
-	defer db.hashIndex.mu.Unlock()
+	db.hashIndex.locks.lock(key)
+	defer db.hashIndex.locks.unlock(key)
 
-	if db.hashIndex.trees[string(key)] == nil {
-		return 0, nil
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
+		return 0, db.checkType(key, Hash)
 	}
-	idxTree := db.hashIndex.trees[string(key)]
+	return db.hDelInternal(key, idxTree, fields...)
+}
 
+// hDelInternal is the same as HDel, but the key lock must be held, and idxTree is the index of the hash.
+func (db *GoDb) hDelInternal(key []byte, idxTree *index.Tree, fields ...[]byte) (int, error) {
 	var count int
 	for _, field := range fields {
 		hashKey := db.encodeKey(key, field)
 		entry := &logfile.LogEntry{Key: hashKey, Type: logfile.TypeDelete}
-		valuePos, err := db.writeLogEntry(entry, Hash)
+		valuePos, err := db.writeMember(Hash, key, entry)
 		if err != nil {
 			return 0, err
 		}
@@ -159,11 +176,11 @@ func (db *GoDb) HDel(key []byte, fields ...[]byte) (int, error) {
 		val, updated := idxTree.Delete(field)
 		if updated {
 			count++
+			db.updateFieldExpiry(key, field, val, nil)
 		}
 		db.sendDiscard(val, updated, Hash)
 		// The deleted entry itself is also invalid.
-		_, size := logfile.EncodeEntry(entry)
-		node := &indexNode{fid: valuePos.fid, entrySize: size}
+		node := &indexNode{fid: valuePos.fid, entrySize: valuePos.entrySize}
 		select {
 		case db.discards[Hash].valChan <- node:
 		default:
@@ -173,17 +190,23 @@ func (db *GoDb) HDel(key []byte, fields ...[]byte) (int, error) {
 	return count, nil
 }
 
+// HClear deletes the hash stored at key with all its fields.
+// It writes only one record no matter how many fields the hash has, the fields are reclaimed by log file gc later.
+func (db *GoDb) HClear(key []byte) error {
+	return db.dropCollection(Hash, key)
+}
+
 // HExists returns whether the field exists in the hash stored at key.
 // If the hash contains field, it returns true.
 // If the hash does not contain field, or key does not exist, it returns false.
 func (db *GoDb) HExists(key, field []byte) (bool, error) {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
 
-	if db.hashIndex.trees[string(key)] == nil {
-		return false, nil
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
+		return false, db.checkType(key, Hash)
 	}
-	idxTree := db.hashIndex.trees[string(key)]
 	val, err := db.getVal(idxTree, field, Hash)
 	if err != nil && err != ErrKeyNotFound {
 		return false, err
@@ -193,55 +216,57 @@ func (db *GoDb) HExists(key, field []byte) (bool, error) {
 
 // HLen returns the number of fields contained in the hash stored at key.
 func (db *GoDb) HLen(key []byte) int {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
 
-	if db.hashIndex.trees[string(key)] == nil {
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
 		return 0
 	}
-	idxTree := db.hashIndex.trees[string(key)]
-	return idxTree.Size()
+	return hashLen(idxTree, 0)
 }
 
 // HKeys returns all field names in the hash stored at key.
 func (db *GoDb) HKeys(key []byte) ([][]byte, error) {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
 
 	var keys [][]byte
-	tree, ok := db.hashIndex.trees[string(key)]
-	if !ok {
-		return keys, nil
+	tree := db.hashIndex.tree(key)
+	if tree == nil {
+		return keys, db.checkType(key, Hash)
 	}
+	ts := time.Now().UnixMilli()
 	iter := tree.Iterator()
 	for iter.HasNext() {
-		node, err := iter.Next()
-		if err != nil {
-			return nil, err
+		field, value := iter.Next()
+		if fieldExpired(value, ts) {
+			continue
 		}
-		keys = append(keys, node.Key())
+		keys = append(keys, field)
 	}
 	return keys, nil
 }
 
 // HVals return all values in the hash stored at key.
 func (db *GoDb) HVals(key []byte) ([][]byte, error) {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
 
 	var values [][]byte
-	tree, ok := db.hashIndex.trees[string(key)]
-	if !ok {
-		return values, nil
+	tree := db.hashIndex.tree(key)
+	if tree == nil {
+		return values, db.checkType(key, Hash)
 	}
 
+	ts := time.Now().UnixMilli()
 	iter := tree.Iterator()
 	for iter.HasNext() {
-		node, err := iter.Next()
-		if err != nil {
-			return nil, err
+		field, value := iter.Next()
+		if fieldExpired(value, ts) {
+			continue
 		}
-		val, err := db.getVal(tree, node.Key(), Hash)
+		val, err := db.getVal(tree, field, Hash)
 		if err != nil && err != ErrKeyNotFound {
 			return nil, err
 		}
@@ -252,28 +277,39 @@ func (db *GoDb) HVals(key []byte) ([][]byte, error) {
 
 // HGetAll return all fields and values of the hash stored at key.
 func (db *GoDb) HGetAll(key []byte) ([][]byte, error) {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
 
-	tree, ok := db.hashIndex.trees[string(key)]
-	if !ok {
+	tree := db.hashIndex.tree(key)
+	if tree == nil {
+		if err := db.checkType(key, Hash); err != nil {
+			return nil, err
+		}
 		return [][]byte{}, nil
 	}
 
-	var index int
-	pairs := make([][]byte, tree.Size()*2)
+	fields := make([][]byte, 0, tree.Size())
+	ts := time.Now().UnixMilli()
 	iter := tree.Iterator()
 	for iter.HasNext() {
-		node, err := iter.Next()
-		if err != nil {
-			return nil, err
+		field, value := iter.Next()
+		if fieldExpired(value, ts) {
+			continue
 		}
-		field := node.Key()
-		val, err := db.getVal(tree, field, Hash)
-		if err != nil && err != ErrKeyNotFound {
-			return nil, err
+		fields = append(fields, field)
+	}
+	vals, err := db.getVals(tree, fields, Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var index int
+	pairs := make([][]byte, len(fields)*2)
+	for i, field := range fields {
+		if vals[i] == nil {
+			continue
 		}
-		pairs[index], pairs[index+1] = field, val
+		pairs[index], pairs[index+1] = field, vals[i]
 		index += 2
 	}
 	return pairs[:index], nil
@@ -282,13 +318,13 @@ func (db *GoDb) HGetAll(key []byte) ([][]byte, error) {
 // HStrLen returns the string length of the value associated with field in the hash stored at key.
 // If the key or the field do not exist, 0 is returned.
 func (db *GoDb) HStrLen(key, field []byte) int {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
 
-	if db.hashIndex.trees[string(key)] == nil {
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
 		return 0
 	}
-	idxTree := db.hashIndex.trees[string(key)]
 	val, err := db.getVal(idxTree, field, Hash)
 	if err == ErrKeyNotFound {
 		return 0
@@ -305,13 +341,24 @@ func (db *GoDb) HScan(key []byte, prefix []byte, pattern string, count int) ([][
 		return nil, nil
 	}
 
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
-	if db.hashIndex.trees[string(key)] == nil {
-		return nil, nil
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
+		return nil, db.checkType(key, Hash)
+	}
+	// expired fields are skipped, so scan as many more fields as may expire.
+	fields := idxTree.PrefixScan(prefix, count+idxTree.Volatile())
+	if idxTree.Volatile() > 0 {
+		ts := time.Now().UnixMilli()
+		unexpired := fields[:0]
+		for _, field := range fields {
+			if !fieldExpired(idxTree.Get(field), ts) && len(unexpired) < count {
+				unexpired = append(unexpired, field)
+			}
+		}
+		fields = unexpired
 	}
-	idxTree := db.hashIndex.trees[string(key)]
-	fields := idxTree.PrefixScan(prefix, count)
 	if len(fields) == 0 {
 		return nil, nil
 	}
@@ -345,14 +392,13 @@ func (db *GoDb) HScan(key []byte, prefix []byte, pattern string, count int) ([][
 // the value is set to 0 before the operation is performed. The range of values supported
 // by HINCRBY is limited to 64bit signed integers.
 func (db *GoDb) HIncrBy(key, field []byte, incr int64) (int64, error) {
-	db.hashIndex.mu.Lock()
-	defer db.hashIndex.mu.Unlock()
+	db.hashIndex.locks.lock(key)
+	defer db.hashIndex.locks.unlock(key)
 
-	if db.hashIndex.trees[string(key)] == nil {
-		db.hashIndex.trees[string(key)] = art.NewART()
+	if err := db.checkWrite(key, Hash); err != nil {
+		return 0, err
 	}
-
-	idxTree := db.hashIndex.trees[string(key)]
+	idxTree := db.hashIndex.treeOrCreate(key)
 	val, err := db.getVal(idxTree, field, Hash)
 	if err != nil && !errors.Is(err, ErrKeyNotFound) {
 		return 0, err
@@ -371,20 +417,13 @@ func (db *GoDb) HIncrBy(key, field []byte, incr int64) (int64, error) {
 	}
 
 	valInt64 += incr
-	val = []byte(strconv.FormatInt(valInt64, 10))
-
-	hashKey := db.encodeKey(key, field)
-	ent := &logfile.LogEntry{Key: hashKey, Value: val}
-	valuePos, err := db.writeLogEntry(ent, Hash)
-	if err != nil {
-		return 0, err
+	// the expiration time of an existing field is kept.
+	var expiredAt int64
+	if node, _ := idxTree.Get(field).(*indexNode); node != nil && !fieldExpired(node, time.Now().UnixMilli()) {
+		expiredAt = node.expiredAt
 	}
-
-	entry := &logfile.LogEntry{Key: field, Value: val}
-	_, size := logfile.EncodeEntry(ent)
-	valuePos.entrySize = size
-	err = db.updateIndexTree(idxTree, entry, valuePos, true, Hash)
-	if err != nil {
+	val = []byte(strconv.FormatInt(valInt64, 10))
+	if err = db.hSetField(key, idxTree, field, val, expiredAt); err != nil {
 		return 0, err
 	}
 	return valInt64, nil
@@ -441,3 +480,112 @@ func (db *GoDb) HRandField(key []byte, count int, withValues bool) ([][]byte, er
 	}
 	return dupValues, nil
 }
+
+// HExpire set the expiration time for the given fields in the hash stored at key, each field expires by itself.
+// It returns the number of fields that exist and whose expiration time is set. The expiration time of a field
+// is removed when it is set again by HSet, and fields are also removed when the whole hash is deleted or expired.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) HExpire(key []byte, duration time.Duration, fields ...[]byte) (int, error) {
+	if duration <= 0 {
+		return 0, nil
+	}
+	db.hashIndex.locks.lock(key)
+	defer db.hashIndex.locks.unlock(key)
+	return db.hExpireAt(key, time.Now().Add(duration).UnixMilli(), fields)
+}
+
+// HTTL get ttl(time to live) in seconds for the given field in the hash stored at key, it is 0 if the field never expires.
+// The ttl is rounded to the nearest second like TTL.
+// If the key or the field does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) HTTL(key, field []byte) (int64, error) {
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
+
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
+		return 0, db.keyNotFound(key, Hash)
+	}
+	now := time.Now().UnixMilli()
+	node, _ := idxTree.Get(field).(*indexNode)
+	if node == nil || fieldExpired(node, now) {
+		return 0, ErrKeyNotFound
+	}
+	if node.expiredAt == 0 {
+		return 0, nil
+	}
+	return (node.expiredAt - now + 500) / 1000, nil
+}
+
+// HPersist remove the expiration time for the given fields in the hash stored at key.
+// It returns the number of fields whose expiration time is removed.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) HPersist(key []byte, fields ...[]byte) (int, error) {
+	db.hashIndex.locks.lock(key)
+	defer db.hashIndex.locks.unlock(key)
+	return db.hExpireAt(key, 0, fields)
+}
+
+// hExpireAt set the expiration time of fields that exist, 0 means they never expire. The key lock must be held.
+func (db *GoDb) hExpireAt(key []byte, expiredAt int64, fields [][]byte) (int, error) {
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
+		return 0, db.keyNotFound(key, Hash)
+	}
+	var count int
+	for _, field := range fields {
+		node, _ := idxTree.Get(field).(*indexNode)
+		if node == nil || fieldExpired(node, time.Now().UnixMilli()) || node.expiredAt == expiredAt {
+			continue
+		}
+		val, err := db.getVal(idxTree, field, Hash)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		if err = db.hSetField(key, idxTree, field, val, expiredAt); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// updateFieldExpiry update the expiry index after the index node of a hash field is changed from oldVal to val,
+// val is nil if the field is deleted, see strIndex.updateExpiry.
+func (db *GoDb) updateFieldExpiry(key, field []byte, oldVal, val interface{}) {
+	var oldExpiredAt, expiredAt int64
+	if node, _ := oldVal.(*indexNode); node != nil {
+		oldExpiredAt = node.expiredAt
+	}
+	if node, _ := val.(*indexNode); node != nil {
+		expiredAt = node.expiredAt
+	}
+	if oldExpiredAt != 0 || expiredAt != 0 {
+		db.expires.setField(key, field, expiredAt)
+	}
+}
+
+// hashLen returns the number of fields in the hash which are not expired, and stops counting at limit if it is positive.
+func hashLen(tree *index.Tree, limit int) int {
+	if tree.Volatile() == 0 {
+		return tree.Size()
+	}
+	ts := time.Now().UnixMilli()
+	var count int
+	iter := tree.Iterator()
+	for iter.HasNext() && (limit <= 0 || count < limit) {
+		_, value := iter.Next()
+		if !fieldExpired(value, ts) {
+			count++
+		}
+	}
+	return count
+}
+
+// fieldExpired returns whether the index node of a hash field expired at ts.
+func fieldExpired(value interface{}, ts int64) bool {
+	node, _ := value.(*indexNode)
+	return node != nil && node.expiredAt != 0 && node.expiredAt <= ts
+}
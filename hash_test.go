@@ -6,6 +6,7 @@ import (
 	"math"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestGoDb_HSet(t *testing.T) {
@@ -895,3 +896,122 @@ func TestGoDb_HRandField(t *testing.T) {
 		runWithValues(t, opts)
 	}
 }
+
+func TestGoDb_HExpire(t *testing.T) {
+	t.Run("key-only", func(t *testing.T) {
+		testGoDbHExpire(t, KeyOnlyMemMode)
+	})
+	t.Run("key-value", func(t *testing.T) {
+		testGoDbHExpire(t, KeyValueMemMode)
+	})
+}
+
+func testGoDbHExpire(t *testing.T, mode DataIndexMode) {
+	path := filepath.Join("/tmp", "godb")
+	opts := DefaultOptions(path)
+	opts.IndexMode = mode
+	// expired fields are filtered on read without active expiration.
+	opts.ActiveExpireInterval = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("user")
+	assert.Nil(t, db.HSet(key, []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"), []byte("f3"), []byte("v3")))
+	assert.Nil(t, db.HSetEX(key, time.Hour, []byte("token"), []byte("t")))
+	n, err := db.HExpire(key, time.Millisecond*100, []byte("f1"), []byte("f2"), []byte("not-exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.HPersist(key, []byte("f2"), []byte("f3"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = db.HExpire([]byte("not-exist"), time.Second, []byte("f1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, err = db.HExpire([]byte("str"), time.Second, []byte("f1"))
+	assert.Equal(t, ErrWrongType, err)
+
+	ttl, err := db.HTTL(key, []byte("token"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3600), ttl)
+	ttl, err = db.HTTL(key, []byte("f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), ttl)
+	_, err = db.HTTL(key, []byte("not-exist"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	check := func() {
+		assert.Equal(t, 3, db.HLen(key))
+		v, err := db.HGet(key, []byte("f1"))
+		assert.Nil(t, err)
+		assert.Nil(t, v)
+		ok, err := db.HExists(key, []byte("f1"))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		_, err = db.HTTL(key, []byte("f1"))
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		keys, err := db.HKeys(key)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("f2"), []byte("f3"), []byte("token")}, keys)
+		vals, err := db.HVals(key)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("v2"), []byte("v3"), []byte("t")}, vals)
+		all, err := db.HGetAll(key)
+		assert.Nil(t, err)
+		assert.Equal(t, 6, len(all))
+		scanned, err := db.HScan(key, []byte("f"), "", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("f2"), []byte("v2")}, scanned)
+	}
+	time.Sleep(time.Millisecond * 150)
+	check()
+
+	// expired fields stay expired after reopening.
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check()
+
+	// HIncrBy keeps the expiration time, while HSet removes it.
+	assert.Nil(t, db.HSetEX(key, time.Hour, []byte("n"), []byte("1")))
+	_, err = db.HIncrBy(key, []byte("n"), 1)
+	assert.Nil(t, err)
+	ttl, err = db.HTTL(key, []byte("n"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3600), ttl)
+	assert.Nil(t, db.HSet(key, []byte("token"), []byte("t")))
+	ttl, err = db.HTTL(key, []byte("token"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), ttl)
+	// an expired field is written again without expiration time.
+	assert.Nil(t, db.HSet(key, []byte("f1"), []byte("v1")))
+	assert.Equal(t, 5, db.HLen(key))
+}
+
+func TestGoDb_HExpireAllFields(t *testing.T) {
+	path := filepath.Join("/tmp", "godb")
+	opts := DefaultOptions(path)
+	opts.ActiveExpireInterval = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := []byte("user")
+	assert.Nil(t, db.HSetEX(key, time.Millisecond*50, []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2")))
+	assert.Equal(t, 1, db.Exists(key))
+	time.Sleep(time.Millisecond * 100)
+
+	// a hash whose fields have all expired does not exist.
+	assert.Equal(t, 0, db.Exists(key))
+	assert.Equal(t, 0, db.HLen(key))
+	_, err = db.Type(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Set(key, []byte("v")))
+	dataType, err := db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, String, dataType)
+}
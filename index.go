@@ -1,11 +1,12 @@
 package godb
 
 import (
-	"github.com/herott-ai/godb/ds/art"
+	"github.com/herott-ai/godb/ds/index"
 	"github.com/herott-ai/godb/logfile"
 	"github.com/herott-ai/godb/logger"
 	"github.com/herott-ai/godb/util"
 	"io"
+	"runtime"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -24,208 +25,354 @@ const (
 	ZSet
 )
 
-func (db *GoDb) buildIndex(dataType DataType, ent *logfile.LogEntry, pos *valuePos) {
+// buildIndex apply an entry loaded from log file to index, gen is the generation of collection entries.
+func (db *GoDb) buildIndex(dataType DataType, ent *logfile.LogEntry, pos *valuePos, gen uint32) {
+	if ent.Type == logfile.TypeGenMeta {
+		db.buildGenMeta(dataType, ent, pos, gen)
+		return
+	}
 	switch dataType {
 	case String:
 		db.buildStrsIndex(ent, pos)
 	case List:
-		db.buildListIndex(ent, pos)
+		db.buildListIndex(ent, pos, gen)
 	case Hash:
-		db.buildHashIndex(ent, pos)
+		db.buildHashIndex(ent, pos, gen)
 	case Set:
-		db.buildSetsIndex(ent, pos)
+		db.buildSetsIndex(ent, pos, gen)
 	case ZSet:
-		db.buildZSetIndex(ent, pos)
+		db.buildZSetIndex(ent, pos, gen)
+	}
+}
+
+// buildGenMeta apply a record which starts a generation of the collection stored at ent.Key.
+func (db *GoDb) buildGenMeta(dataType DataType, ent *logfile.LogEntry, pos *valuePos, gen uint32) {
+	if !db.acceptGen(dataType, ent.Key, gen) {
+		return
 	}
+	db.collectionIndexOf(dataType).setGen(ent.Key, gen, db.newIndexNode(ent, pos, pos.entrySize))
 }
 
 func (db *GoDb) buildStrsIndex(ent *logfile.LogEntry, pos *valuePos) {
-	ts := time.Now().Unix()
+	ts := time.Now().UnixMilli()
 	if ent.Type == logfile.TypeDelete || (ent.ExpiredAt != 0 && ent.ExpiredAt < ts) {
-		db.strIndex.idxTree.Delete(ent.Key)
+		oldVal, _ := db.strIndex.idxTree.Delete(ent.Key)
+		db.strIndex.updateExpiry(ent.Key, oldVal, nil)
 		return
 	}
-	_, size := logfile.EncodeEntry(ent)
-	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: size}
-	if db.opts.IndexMode == KeyValueMemMode {
-		idxNode.value = ent.Value
-	}
-	if ent.ExpiredAt != 0 {
-		idxNode.expiredAt = ent.ExpiredAt
-	}
-	db.strIndex.idxTree.Put(ent.Key, idxNode)
+	idxNode := db.newIndexNode(ent, pos, pos.entrySize)
+	oldVal, _ := db.strIndex.idxTree.Put(ent.Key, idxNode)
+	db.strIndex.updateExpiry(ent.Key, oldVal, idxNode)
 }
 
-func (db *GoDb) buildListIndex(ent *logfile.LogEntry, pos *valuePos) {
+func (db *GoDb) buildListIndex(ent *logfile.LogEntry, pos *valuePos, gen uint32) {
 	var listKey = ent.Key
 	if ent.Type != logfile.TypeListMeta {
 		listKey, _ = db.decodeListKey(ent.Key)
 	}
-	if db.listIndex.trees[string(listKey)] == nil {
-		db.listIndex.trees[string(listKey)] = art.NewART()
+	if !db.acceptMember(List, listKey, gen) {
+		return
 	}
-	idxTree := db.listIndex.trees[string(listKey)]
+	idxTree := db.listIndex.treeOrCreate(listKey)
 
 	if ent.Type == logfile.TypeDelete {
 		idxTree.Delete(ent.Key)
 		return
 	}
-	_, size := logfile.EncodeEntry(ent)
-	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: size}
-	if db.opts.IndexMode == KeyValueMemMode {
-		idxNode.value = ent.Value
-	}
-	if ent.ExpiredAt != 0 {
-		idxNode.expiredAt = ent.ExpiredAt
-	}
+	idxNode := db.newIndexNode(ent, pos, pos.entrySize)
 	idxTree.Put(ent.Key, idxNode)
 }
 
-func (db *GoDb) buildHashIndex(ent *logfile.LogEntry, pos *valuePos) {
+func (db *GoDb) buildHashIndex(ent *logfile.LogEntry, pos *valuePos, gen uint32) {
 	key, field := db.decodeKey(ent.Key)
-	if db.hashIndex.trees[string(key)] == nil {
-		db.hashIndex.trees[string(key)] = art.NewART()
+	if !db.acceptMember(Hash, key, gen) {
+		return
 	}
-	idxTree := db.hashIndex.trees[string(key)]
+	idxTree := db.hashIndex.treeOrCreate(key)
 
-	if ent.Type == logfile.TypeDelete {
-		idxTree.Delete(field)
+	if ent.Type == logfile.TypeDelete || (ent.ExpiredAt != 0 && ent.ExpiredAt < time.Now().UnixMilli()) {
+		oldVal, _ := idxTree.Delete(field)
+		db.updateFieldExpiry(key, field, oldVal, nil)
 		return
 	}
 
-	_, size := logfile.EncodeEntry(ent)
-	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: size}
-	if db.opts.IndexMode == KeyValueMemMode {
-		idxNode.value = ent.Value
-	}
-	if ent.ExpiredAt != 0 {
-		idxNode.expiredAt = ent.ExpiredAt
-	}
-	idxTree.Put(field, idxNode)
+	idxNode := db.newIndexNode(ent, pos, pos.entrySize)
+	oldVal, _ := idxTree.Put(field, idxNode)
+	db.updateFieldExpiry(key, field, oldVal, idxNode)
 }
 
-func (db *GoDb) buildSetsIndex(ent *logfile.LogEntry, pos *valuePos) {
-	if db.setIndex.trees[string(ent.Key)] == nil {
-		db.setIndex.trees[string(ent.Key)] = art.NewART()
+func (db *GoDb) buildSetsIndex(ent *logfile.LogEntry, pos *valuePos, gen uint32) {
+	if !db.acceptMember(Set, ent.Key, gen) {
+		return
 	}
-	idxTree := db.setIndex.trees[string(ent.Key)]
+	idxTree := db.setIndex.treeOrCreate(ent.Key)
 
 	if ent.Type == logfile.TypeDelete {
 		idxTree.Delete(ent.Value)
 		return
 	}
 
-	if err := db.setIndex.murhash.Write(ent.Value); err != nil {
-		logger.Fatalf("fail to write murmur hash: %v", err)
-	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
+	sum := util.Sum128(ent.Value)
 
-	_, size := logfile.EncodeEntry(ent)
-	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: size}
-	if db.opts.IndexMode == KeyValueMemMode {
-		idxNode.value = ent.Value
-	}
-	if ent.ExpiredAt != 0 {
-		idxNode.expiredAt = ent.ExpiredAt
-	}
+	idxNode := db.newIndexNode(ent, pos, pos.entrySize)
 	idxTree.Put(sum, idxNode)
 }
 
-func (db *GoDb) buildZSetIndex(ent *logfile.LogEntry, pos *valuePos) {
+func (db *GoDb) buildZSetIndex(ent *logfile.LogEntry, pos *valuePos, gen uint32) {
 	if ent.Type == logfile.TypeDelete {
+		if !db.acceptMember(ZSet, ent.Key, gen) {
+			return
+		}
 		db.zsetIndex.indexes.ZRem(string(ent.Key), string(ent.Value))
-		if db.zsetIndex.trees[string(ent.Key)] != nil {
-			db.zsetIndex.trees[string(ent.Key)].Delete(ent.Value)
+		if idxTree := db.zsetIndex.rawTree(ent.Key); idxTree != nil {
+			idxTree.Delete(ent.Value)
 		}
 		return
 	}
 
 	key, scoreBuf := db.decodeKey(ent.Key)
-	score, _ := util.StrToFloat64(string(scoreBuf))
-	if err := db.zsetIndex.murhash.Write(ent.Value); err != nil {
-		logger.Fatalf("fail to write murmur hash: %v", err)
+	if !db.acceptMember(ZSet, key, gen) {
+		return
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
+	score, _ := util.StrToFloat64(string(scoreBuf))
+	sum := util.Sum128(ent.Value)
 
-	idxTree := db.zsetIndex.trees[string(key)]
-	if idxTree == nil {
-		idxTree = art.NewART()
-		db.zsetIndex.trees[string(key)] = idxTree
-	}
+	idxTree := db.zsetIndex.treeOrCreate(key)
 
-	_, size := logfile.EncodeEntry(ent)
-	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: size}
-	if db.opts.IndexMode == KeyValueMemMode {
-		idxNode.value = ent.Value
-	}
-	if ent.ExpiredAt != 0 {
-		idxNode.expiredAt = ent.ExpiredAt
-	}
+	idxNode := db.newIndexNode(ent, pos, pos.entrySize)
 	db.zsetIndex.indexes.ZAdd(string(key), score, string(sum))
 	idxTree.Put(sum, idxNode)
 }
 
-func (db *GoDb) loadIndexFromLogFiles() error {
-	iterateAndHandle := func(dataType DataType, wg *sync.WaitGroup) {
-		defer wg.Done()
+const (
+	// loadBatchSize number of decoded entries sent to the index builder at a time.
+	loadBatchSize = 1024
+	// loadBatchBuffer number of batches a log file can be decoded ahead of the index builder.
+	loadBatchBuffer = 16
+	// loadProgressInterval interval of logging the progress while loading index.
+	loadProgressInterval = 5 * time.Second
+)
 
-		fids := db.fidMap[dataType]
-		if len(fids) == 0 {
-			return
-		}
-		sort.Slice(fids, func(i, j int) bool {
-			return fids[i] < fids[j]
-		})
-
-		for i, fid := range fids {
-			var logFile *logfile.LogFile
-			if i == len(fids)-1 {
-				logFile = db.activeLogFiles[dataType]
-			} else {
-				logFile = db.archivedLogFiles[dataType][fid]
-			}
-			if logFile == nil {
-				logger.Fatalf("log file is nil, failed to open db")
-			}
+type (
+	// loadedEntry an entry decoded from log file, waiting to be applied to index.
+	loadedEntry struct {
+		ent *logfile.LogEntry
+		pos *valuePos
+		gen uint32 // generation of collection entries, which has been split from the key.
+	}
 
-			var offset int64
-			for {
-				entry, esize, err := logFile.ReadLogEntry(offset)
-				if err != nil {
-					if err == io.EOF || err == logfile.ErrEndOfEntry {
-						break
-					}
-					logger.Fatalf("read log entry from file err, failed to open db")
-				}
-				pos := &valuePos{fid: fid, offset: offset}
-				db.buildIndex(dataType, entry, pos)
-				offset += esize
-			}
-			// set latest log file`s WriteAt.
-			if i == len(fids)-1 {
-				atomic.StoreInt64(&logFile.WriteAt, offset)
-			}
+	// segmentLoader decodes a log file in background, its batches are applied to index in fid order.
+	segmentLoader struct {
+		logFile *logfile.LogFile
+		batches chan []loadedEntry
+		// end and err are valid after batches closed.
+		end int64
+		err error
+	}
+
+	// loadProgress progress of loading index from log files.
+	loadProgress struct {
+		total       int64
+		loadedFiles int64
+		loadedBytes int64
+	}
+)
+
+// loadIndexFromLogFiles build index of all data types from log files.
+// Log files are read and decoded by at most NumCPU workers concurrently, and entries of a data type are applied in fid order.
+func (db *GoDb) loadIndexFromLogFiles() error {
+	start := time.Now()
+	progress := &loadProgress{}
+	for dataType, fids := range db.fidMap {
+		if dataType == String && db.strIndex.loaded {
+			continue
 		}
+		progress.total += int64(len(fids))
 	}
+	done := make(chan struct{})
+	go progress.report(start, done)
 
+	workers := make(chan struct{}, runtime.NumCPU())
+	errs := make([]error, logFileTypeNum)
 	wg := new(sync.WaitGroup)
 	wg.Add(logFileTypeNum)
 	for i := 0; i < logFileTypeNum; i++ {
-		go iterateAndHandle(DataType(i), wg)
+		go func(dataType DataType) {
+			defer wg.Done()
+			errs[dataType] = db.loadIndex(dataType, workers, progress)
+		}(DataType(i))
 	}
 	wg.Wait()
+	close(done)
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	if err := db.strIndex.Err(); err != nil {
+		return err
+	}
+
+	db.indexLoadTime = time.Since(start)
+	if progress.total > 0 {
+		logger.Infof("index loaded from %d log files(%d bytes) in %v",
+			progress.total, atomic.LoadInt64(&progress.loadedBytes), db.indexLoadTime)
+	}
 	return nil
 }
 
-func (db *GoDb) updateIndexTree(idxTree *art.AdaptiveRadixTree,
+// loadIndex build index of the data type, workers limits the number of log files being decoded at the same time.
+func (db *GoDb) loadIndex(dataType DataType, workers chan struct{}, progress *loadProgress) error {
+	if dataType == String && db.strIndex.loaded {
+		return nil
+	}
+	fids := db.fidMap[dataType]
+	if len(fids) == 0 {
+		return nil
+	}
+	sort.Slice(fids, func(i, j int) bool {
+		return fids[i] < fids[j]
+	})
+
+	loaders := make([]*segmentLoader, len(fids))
+	for i, fid := range fids {
+		var logFile *logfile.LogFile
+		if i == len(fids)-1 {
+			logFile = db.activeLogFiles[dataType]
+		} else {
+			logFile = db.archivedLogFiles[dataType][fid]
+		}
+		if logFile == nil {
+			return ErrLogFileNotFound
+		}
+		loaders[i] = &segmentLoader{logFile: logFile, batches: make(chan []loadedEntry, loadBatchBuffer)}
+	}
+
+	// log files acquire workers in fid order, so the one being applied is always decoding or done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for _, l := range loaders {
+			select {
+			case workers <- struct{}{}:
+			case <-stop:
+				return
+			}
+			go func(l *segmentLoader) {
+				defer func() { <-workers }()
+				db.decodeLogFile(dataType, l, stop)
+				atomic.AddInt64(&progress.loadedFiles, 1)
+				atomic.AddInt64(&progress.loadedBytes, l.end)
+			}(l)
+		}
+	}()
+
+	for _, l := range loaders {
+		for batch := range l.batches {
+			for _, e := range batch {
+				db.buildIndex(dataType, e.ent, e.pos, e.gen)
+			}
+		}
+		if l.err != nil {
+			return l.err
+		}
+	}
+	// set latest log file`s WriteAt.
+	last := loaders[len(loaders)-1]
+	atomic.StoreInt64(&last.logFile.WriteAt, last.end)
+	return nil
+}
+
+// decodeLogFile read all entries of the log file, and send them to the index builder in batches.
+func (db *GoDb) decodeLogFile(dataType DataType, l *segmentLoader, stop <-chan struct{}) {
+	defer close(l.batches)
+	// the value is only needed by index of Set and ZSet, or in KeyValueMemMode.
+	keepValue := db.opts.IndexMode == KeyValueMemMode || dataType == Set || dataType == ZSet
+	withGen := db.hasGen(dataType, l.logFile.Fid)
+
+	var offset int64
+	batch := make([]loadedEntry, 0, loadBatchSize)
+	send := func() bool {
+		select {
+		case l.batches <- batch:
+			batch = make([]loadedEntry, 0, loadBatchSize)
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for {
+		entry, esize, err := l.logFile.ReadLogEntry(offset)
+		if err != nil {
+			if err == io.EOF || err == logfile.ErrEndOfEntry {
+				break
+			}
+			l.err = err
+			return
+		}
+		var gen uint32
+		if withGen {
+			entry.Key, gen, _ = splitGen(entry.Key)
+		}
+		if !keepValue {
+			// key and value share one buffer, copy the key so that the value can be collected.
+			entry.Key = append([]byte(nil), entry.Key...)
+			entry.Value = nil
+		}
+		pos := &valuePos{fid: l.logFile.Fid, offset: offset, entrySize: int(esize)}
+		batch = append(batch, loadedEntry{ent: entry, pos: pos, gen: gen})
+		offset += esize
+		if len(batch) == loadBatchSize && !send() {
+			return
+		}
+	}
+	if len(batch) > 0 && !send() {
+		return
+	}
+	l.end = offset
+}
+
+// report log the progress periodically until done.
+func (p *loadProgress) report(start time.Time, done <-chan struct{}) {
+	ticker := time.NewTicker(loadProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			logger.Infof("loading index: %d/%d log files, %d bytes, elapsed %v",
+				atomic.LoadInt64(&p.loadedFiles), p.total, atomic.LoadInt64(&p.loadedBytes), time.Since(start))
+		}
+	}
+}
+
+func (db *GoDb) updateIndexTree(idxTree index.Index,
 	ent *logfile.LogEntry, pos *valuePos, sendDiscard bool, dType DataType) error {
 
 	var size = pos.entrySize
-	if dType == String || dType == List {
-		_, size = logfile.EncodeEntry(ent)
+	if size == 0 && (dType == String || dType == List) {
+		size = logfile.EncodedSize(ent)
 	}
+	idxNode := db.newIndexNode(ent, pos, size)
+	oldVal, updated := idxTree.Put(ent.Key, idxNode) // imp tt like orignal model
+	if err := db.indexErr(idxTree); err != nil {
+		return err
+	}
+	if updated {
+		inheritAccess(idxNode, oldVal)
+	}
+	// it is a write from user if sendDiscard, but not a rewrite of log file gc.
+	if sendDiscard {
+		db.touch(idxNode)
+		db.sendDiscard(oldVal, updated, dType)
+	}
+	db.triggerEviction()
+	return nil
+}
+
+// newIndexNode create an index node of the entry at pos.
+func (db *GoDb) newIndexNode(ent *logfile.LogEntry, pos *valuePos, size int) *indexNode {
 	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: size}
 	// in KeyValueMemMode, both key and value will store in memory.
 	if db.opts.IndexMode == KeyValueMemMode {
@@ -234,67 +381,80 @@ func (db *GoDb) updateIndexTree(idxTree *art.AdaptiveRadixTree,
 	if ent.ExpiredAt != 0 {
 		idxNode.expiredAt = ent.ExpiredAt
 	}
-
-	oldVal, updated := idxTree.Put(ent.Key, idxNode) // imp tt like orignal model
-	if sendDiscard {
-		db.sendDiscard(oldVal, updated, dType)
+	if db.opts.MaxMemory > 0 {
+		idxNode.accessedAt = time.Now().UnixNano()
+		idxNode.freq = lfuInitVal
 	}
-	return nil
+	return idxNode
 }
 
 // get index node info from an adaptive radix tree in memory.
-func (db *GoDb) getIndexNode(idxTree *art.AdaptiveRadixTree, key []byte) (*indexNode, error) {
+func (db *GoDb) getIndexNode(idxTree index.Index, key []byte) (*indexNode, error) {
 	rawValue := idxTree.Get(key)
 	if rawValue == nil {
+		if err := db.indexErr(idxTree); err != nil {
+			return nil, err
+		}
 		return nil, ErrKeyNotFound
 	}
 	idxNode, _ := rawValue.(*indexNode)
 	if idxNode == nil {
 		return nil, ErrKeyNotFound
 	}
+	db.touch(idxNode)
 	return idxNode, nil
 }
 
-func (db *GoDb) getVal(idxTree *art.AdaptiveRadixTree,
+func (db *GoDb) getVal(idxTree index.Index,
 	key []byte, dataType DataType) ([]byte, error) {
 
-	// Get index info from an adaptive radix tree in memory.
-	rawValue := idxTree.Get(key)
-	if rawValue == nil {
+	idxNode, val, err := db.getMemVal(idxTree, key, dataType)
+	if err != nil || idxNode == nil {
+		return val, err
+	}
+
+	// In KeyOnlyMemMode, the value not in memory, so get the value from log file at the offset.
+	ent, err := db.readLogEntry(dataType, idxNode.fid, idxNode.offset)
+	if err != nil {
+		return nil, err
+	}
+	// key exists, but is invalid(deleted or expired)
+	if ent.Type == logfile.TypeDelete || (ent.ExpiredAt != 0 && ent.ExpiredAt < time.Now().UnixMilli()) {
 		return nil, ErrKeyNotFound
 	}
-	idxNode, _ := rawValue.(*indexNode)
+	if db.valueCache != nil {
+		db.valueCache.put(cacheKey{dataType: dataType, fid: idxNode.fid, offset: idxNode.offset}, ent.Value)
+	}
+	return ent.Value, nil
+}
+
+// getMemVal get the value of key from index or value cache.
+// It returns the index node instead if the value must be read from log file.
+func (db *GoDb) getMemVal(idxTree index.Index, key []byte, dataType DataType) (*indexNode, []byte, error) {
+	// Get index info from an adaptive radix tree in memory.
+	idxNode, _ := idxTree.Get(key).(*indexNode)
 	if idxNode == nil {
-		return nil, ErrKeyNotFound
+		if err := db.indexErr(idxTree); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrKeyNotFound
 	}
 
-	ts := time.Now().Unix()
+	ts := time.Now().UnixMilli()
 	if idxNode.expiredAt != 0 && idxNode.expiredAt <= ts {
-		return nil, ErrKeyNotFound
+		return nil, nil, ErrKeyNotFound
 	}
+	db.touch(idxNode)
 	// In KeyValueMemMode, the value will be stored in memory.
 	// So get the value from the index info.
 	if db.opts.IndexMode == KeyValueMemMode && len(idxNode.value) != 0 {
-		return idxNode.value, nil
-	}
-
-	// In KeyOnlyMemMode, the value not in memory, so get the value from log file at the offset.
-	logFile := db.getActiveLogFile(dataType) // from concrete type about file tt
-	if logFile.Fid != idxNode.fid {  // I want to get the fid(idxNode.fid) that is in ArchivedLogFile tt
-		logFile = db.getArchivedLogFile(dataType, idxNode.fid)
-	}
-	if logFile == nil {
-		return nil, ErrLogFileNotFound
+		return nil, idxNode.value, nil
 	}
-
-	// already get the corresponding LogFile,then read Entry from the file tt
-	ent, _, err := logFile.ReadLogEntry(idxNode.offset) // read entry tt
-	if err != nil {
-		return nil, err
-	}
-	// key exists, but is invalid(deleted or expired)
-	if ent.Type == logfile.TypeDelete || (ent.ExpiredAt != 0 && ent.ExpiredAt < ts) {
-		return nil, ErrKeyNotFound
+	if db.valueCache != nil {
+		ck := cacheKey{dataType: dataType, fid: idxNode.fid, offset: idxNode.offset}
+		if val, ok := db.valueCache.get(ck); ok {
+			return nil, val, nil
+		}
 	}
-	return ent.Value, nil
+	return idxNode, nil, nil
 }
@@ -0,0 +1,720 @@
+package godb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/herott-ai/godb/ds/bptree"
+	"github.com/herott-ai/godb/logfile"
+	"github.com/herott-ai/godb/logger"
+	"github.com/herott-ai/godb/util"
+)
+
+const (
+	// hintFileSuffix suffix of the hint file of a segment, which holds keys and positions of the entries in it.
+	hintFileSuffix = ".hint"
+	// ingestFilePrefix prefix of segments moved into db path but not attached yet.
+	ingestFilePrefix = "ingest."
+	// segmentPadding zero bytes appended to a segment, they mark the end of entries.
+	segmentPadding = logfile.MaxHeaderSize
+	// segmentBufferSize buffer size of writing segments and reading hint files.
+	segmentBufferSize = 1 << 20
+)
+
+// SegmentWriter builds log files of a data type offline, from keys added in strictly increasing order.
+// The log files built can be attached to a db by Ingest, which is much faster than writing them one by one.
+// It is not safe for concurrent use.
+type SegmentWriter struct {
+	dir         string
+	dataType    DataType
+	segmentSize int64
+	fid         uint32
+	file        *os.File
+	hint        *os.File
+	w           *bufio.Writer
+	hw          *bufio.Writer
+	offset      int64
+	hasLast     bool
+	lastKey     []byte
+	lastSub     []byte
+	buf         []byte
+	hintBuf     []byte
+	files       []string
+	closed      bool
+}
+
+// NewSegmentWriter create a segment writer of the data type, which writes log files and their hint files in dir.
+// segmentSize is the max size of each log file, usually the LogFileSizeThreshold of the db to ingest them,
+// and the default threshold is used if it is not positive.
+// List is not supported, since its keys depend on the sequence of existing elements.
+func NewSegmentWriter(dir string, dataType DataType, segmentSize int64) (*SegmentWriter, error) {
+	if dataType != String && dataType != Hash && dataType != Set && dataType != ZSet {
+		return nil, ErrSegmentType
+	}
+	if segmentSize <= 0 {
+		segmentSize = DefaultOptions("").LogFileSizeThreshold
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &SegmentWriter{
+		dir:         dir,
+		dataType:    dataType,
+		segmentSize: segmentSize,
+	}, nil
+}
+
+// Put add a String key and its value, see GoDb.Set.
+func (w *SegmentWriter) Put(key, value []byte) error {
+	if w.dataType != String {
+		return ErrSegmentType
+	}
+	return w.add(key, nil, &logfile.LogEntry{Key: key, Value: value})
+}
+
+// HSet add a field and its value of the hash stored at key, see GoDb.HSet.
+// Keys are sorted by key first and then field.
+func (w *SegmentWriter) HSet(key, field, value []byte) error {
+	if w.dataType != Hash {
+		return ErrSegmentType
+	}
+	return w.add(key, field, &logfile.LogEntry{Key: encodeKey(key, field), Value: value})
+}
+
+// SAdd add a member of the set stored at key, see GoDb.SAdd.
+// Keys are sorted by key first and then member.
+func (w *SegmentWriter) SAdd(key, member []byte) error {
+	if w.dataType != Set {
+		return ErrSegmentType
+	}
+	if len(member) == 0 {
+		return nil
+	}
+	return w.add(key, member, &logfile.LogEntry{Key: key, Value: member})
+}
+
+// ZAdd add a member with score of the sorted set stored at key, see GoDb.ZAdd.
+// Keys are sorted by key first and then member.
+func (w *SegmentWriter) ZAdd(key []byte, score float64, member []byte) error {
+	if w.dataType != ZSet {
+		return ErrSegmentType
+	}
+	scoreBuf := []byte(util.Float64ToStr(score))
+	return w.add(key, member, &logfile.LogEntry{Key: encodeKey(key, scoreBuf), Value: member})
+}
+
+// Close finish the segment being written, and returns the paths of all the log files written, in the order of keys.
+// Hint files are written next to them, with the suffix ".hint".
+func (w *SegmentWriter) Close() ([]string, error) {
+	if w.closed {
+		return w.files, nil
+	}
+	w.closed = true
+	if err := w.finishSegment(); err != nil {
+		return nil, err
+	}
+	return w.files, nil
+}
+
+func (w *SegmentWriter) add(key, sub []byte, ent *logfile.LogEntry) error {
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.hasLast {
+		cmp := bytes.Compare(key, w.lastKey)
+		if cmp < 0 || (cmp == 0 && bytes.Compare(sub, w.lastSub) <= 0) {
+			return ErrUnsortedInput
+		}
+	}
+
+	// entries of collections are in generation 0, see Ingest.
+	if w.dataType != String {
+		ent.Key = appendGen(ent.Key, 0)
+	}
+	w.buf = logfile.AppendEntry(w.buf[:0], ent)
+	esize := int64(len(w.buf))
+	// an entry larger than segment size is written to a segment alone.
+	if w.file == nil || (w.offset > 0 && w.offset+esize+segmentPadding > w.segmentSize) {
+		if err := w.finishSegment(); err != nil {
+			return err
+		}
+		if err := w.openSegment(); err != nil {
+			return err
+		}
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+
+	// hint: offset and size of the entry, and the value if it is needed by index.
+	var hintVal [2 * binary.MaxVarintLen64]byte
+	n := binary.PutVarint(hintVal[:], w.offset)
+	n += binary.PutVarint(hintVal[n:], esize)
+	hint := &logfile.LogEntry{Key: ent.Key, Value: hintVal[:n], ExpiredAt: ent.ExpiredAt}
+	if w.dataType == Set || w.dataType == ZSet {
+		hint.Value = append(hint.Value, ent.Value...)
+	}
+	w.hintBuf = logfile.AppendEntry(w.hintBuf[:0], hint)
+	if _, err := w.hw.Write(w.hintBuf); err != nil {
+		return err
+	}
+
+	w.offset += esize
+	w.hasLast = true
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.lastSub = append(w.lastSub[:0], sub...)
+	return nil
+}
+
+func (w *SegmentWriter) openSegment() error {
+	name := logfile.FileNamesMap[logfile.FileType(w.dataType)] + fmt.Sprintf("%09d", w.fid)
+	path := filepath.Join(w.dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	hint, err := os.OpenFile(path+hintFileSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.file, w.hint = file, hint
+	w.w = bufio.NewWriterSize(file, segmentBufferSize)
+	w.hw = bufio.NewWriterSize(hint, segmentBufferSize)
+	w.offset = 0
+	w.fid++
+	w.files = append(w.files, path)
+	return nil
+}
+
+// finishSegment flush and sync the segment being written.
+func (w *SegmentWriter) finishSegment() error {
+	if w.file == nil {
+		return nil
+	}
+	file, hint := w.file, w.hint
+	w.file, w.hint = nil, nil
+	defer func() {
+		_ = file.Close()
+		_ = hint.Close()
+	}()
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := file.Truncate(w.offset + segmentPadding); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := w.hw.Flush(); err != nil {
+		return err
+	}
+	return hint.Sync()
+}
+
+// ingestSegment a segment to be attached to db, entries are loaded before attaching.
+type ingestSegment struct {
+	path     string
+	dataType DataType
+	size     int64
+	fid      uint32 // fid in db, assigned when attached.
+	entries  []loadedEntry
+}
+
+// ingestEntry an entry of an attached segment, to be put into index.
+type ingestEntry struct {
+	seg *ingestSegment
+	loadedEntry
+}
+
+// Ingest attach log files built by SegmentWriter to db, they are moved into db path and get fresh fids.
+// Files are attached in the order given, and the entries in them overwrite existing ones, like they are written just now.
+// All the files are loaded and verified first, so none of them is attached if any error occurs,
+// and it is all or nothing even if the process crashes while attaching.
+// If it fails after the files are committed, ErrDBFailed is returned and db must be reopened, which finishes attaching them.
+// Members of collections which have been dropped or expired before are written again, see dropCollection.
+// Ingested keys are not checked against other data types, see Type.
+// Operations on all keys wait until the segments are attached, and then on the keys of a lock shard
+// until the entries in the shard are put into index.
+func (db *GoDb) Ingest(files ...string) error {
+	if db.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if db.opts.InMemory {
+		return ErrInMemory
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	if err := db.failure(); err != nil {
+		return err
+	}
+
+	segs := make([]*ingestSegment, 0, len(files))
+	var typeMask [logFileTypeNum]bool
+	for _, path := range files {
+		seg, err := db.loadSegment(path)
+		if err != nil {
+			return err
+		}
+		segs = append(segs, seg)
+		typeMask[seg.dataType] = true
+	}
+
+	// entries are applied shard by shard, in the order of segments and then entries for the same key.
+	var shards [lockShards][]ingestEntry
+	locks := db.strIndex.locks
+	for _, seg := range segs {
+		for _, e := range seg.entries {
+			shard := locks.shard(db.ingestedKey(seg.dataType, e.ent.Key))
+			shards[shard] = append(shards[shard], ingestEntry{seg: seg, loadedEntry: e})
+		}
+	}
+
+	// same lock order as writes: key locks, writeMu and then db.mu.
+	// writeMu is released after attaching, members of dropped collections may be written again while applying.
+	// A key lock is released once its shard is applied, writes after that always overwrite the ingested entries.
+	for i := range locks.shards {
+		locks.shards[i].Lock()
+	}
+	applied := 0
+	defer func() {
+		for i := applied; i < lockShards; i++ {
+			locks.shards[i].Unlock()
+		}
+	}()
+	for dataType := String; dataType < logFileTypeNum; dataType++ {
+		if typeMask[dataType] {
+			db.writeMu[dataType].Lock()
+		}
+	}
+	db.mu.Lock()
+	err := db.attachSegments(segs)
+	db.mu.Unlock()
+	for dataType := String; dataType < logFileTypeNum; dataType++ {
+		if typeMask[dataType] {
+			db.writeMu[dataType].Unlock()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// the segments are committed, the index would be partly applied if it fails.
+	for ; applied < lockShards; applied++ {
+		err := db.applyEntries(shards[applied])
+		shards[applied] = nil
+		locks.shards[applied].Unlock()
+		if err != nil {
+			applied++
+			return db.fail(err)
+		}
+	}
+	for _, seg := range segs {
+		// the segment has been moved, its hint file is useless.
+		_ = os.Remove(seg.path + hintFileSuffix)
+	}
+	db.triggerEviction()
+	return nil
+}
+
+// loadSegment load the entries of a segment, from its hint file if possible.
+func (db *GoDb) loadSegment(path string) (*ingestSegment, error) {
+	dataType, fid, ok := parseLogFileName(filepath.Base(path))
+	if !ok || dataType == List {
+		return nil, ErrInvalidSegment
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	seg := &ingestSegment{path: path, dataType: dataType, size: stat.Size()}
+
+	// values are needed by index in KeyValueMemMode, which are not in hint files.
+	hintPath := path + hintFileSuffix
+	if db.opts.IndexMode != KeyValueMemMode && util.PathExist(hintPath) {
+		err = seg.loadHints(hintPath)
+	} else {
+		err = seg.loadEntries(filepath.Dir(path), fid, db.opts.IndexMode == KeyValueMemMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dataType != String {
+		for _, e := range seg.entries {
+			key, gen, ok := splitGen(e.ent.Key)
+			if !ok || gen != 0 {
+				return nil, ErrInvalidSegment
+			}
+			e.ent.Key = key
+		}
+	}
+	if dataType == String && db.strIndexOnDisk() {
+		for _, e := range seg.entries {
+			if len(e.ent.Key) > bptree.MaxKeySize {
+				return nil, ErrKeyTooLarge
+			}
+		}
+	}
+	return seg, nil
+}
+
+// loadHints read the entries of segment from its hint file.
+func (seg *ingestSegment) loadHints(hintPath string) error {
+	file, err := os.Open(hintPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var buf []byte
+	chunk := make([]byte, segmentBufferSize)
+	for {
+		n, err := io.ReadFull(file, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		buf = append(buf, chunk[:n]...)
+		eof := err != nil
+
+		var off int64
+		for {
+			hint, size, decodeErr := logfile.DecodeEntry(buf[off:])
+			if decodeErr == io.ErrUnexpectedEOF {
+				break
+			}
+			if decodeErr != nil {
+				return ErrInvalidSegment
+			}
+			pos, ok := seg.decodeHint(hint)
+			if !ok {
+				return ErrInvalidSegment
+			}
+			seg.entries = append(seg.entries, loadedEntry{ent: hint, pos: pos})
+			off += size
+		}
+		buf = append(buf[:0], buf[off:]...)
+		if eof {
+			break
+		}
+	}
+	if len(buf) > 0 {
+		return ErrInvalidSegment
+	}
+	return nil
+}
+
+// decodeHint decode the position in hint entry, and leave the value of the entry in it.
+func (seg *ingestSegment) decodeHint(hint *logfile.LogEntry) (*valuePos, bool) {
+	offset, n := binary.Varint(hint.Value)
+	if n <= 0 {
+		return nil, false
+	}
+	esize, m := binary.Varint(hint.Value[n:])
+	if m <= 0 || offset < 0 || esize <= 0 || offset+esize > seg.size {
+		return nil, false
+	}
+	hint.Value = hint.Value[n+m:]
+	if len(hint.Value) == 0 {
+		hint.Value = nil
+	}
+	return &valuePos{offset: offset, entrySize: int(esize)}, true
+}
+
+// loadEntries read the entries of segment from the segment itself.
+func (seg *ingestSegment) loadEntries(dir string, fid uint32, keepValue bool) error {
+	lf, err := logfile.OpenLogFile(dir, fid, seg.size, logfile.FileType(seg.dataType), logfile.FileIO)
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+
+	keepValue = keepValue || seg.dataType == Set || seg.dataType == ZSet
+	var offset int64
+	for {
+		ent, esize, err := lf.ReadLogEntry(offset)
+		if err != nil {
+			if err == io.EOF || err == logfile.ErrEndOfEntry {
+				break
+			}
+			return err
+		}
+		if ent.Type != 0 {
+			return ErrInvalidSegment
+		}
+		if !keepValue {
+			ent.Key = append([]byte(nil), ent.Key...)
+			ent.Value = nil
+		}
+		seg.entries = append(seg.entries, loadedEntry{ent: ent, pos: &valuePos{offset: offset, entrySize: int(esize)}})
+		offset += esize
+	}
+	return nil
+}
+
+// attachSegments move segments into db path and open them as archived log files, whose fids follow the active log file.
+// A new active log file is opened after them, so they are older than any entry written later.
+// Everything that may fail is done before the segments are committed in manifest, and rolled back on error.
+// The db fails if anything goes wrong after the commit, see fail. db.mu and writeMu of the data types must be held.
+func (db *GoDb) attachSegments(segs []*ingestSegment) error {
+	var nextFid [logFileTypeNum]uint32
+	var attached [logFileTypeNum]bool
+	for _, seg := range segs {
+		if !attached[seg.dataType] {
+			attached[seg.dataType] = true
+			if active := db.activeLogFiles[seg.dataType]; active != nil {
+				nextFid[seg.dataType] = active.Fid + 1
+			}
+		}
+		seg.fid = nextFid[seg.dataType]
+		nextFid[seg.dataType]++
+	}
+
+	// move the segments into db path with a temporary name, they are ignored when opening until committed.
+	metas := make([]segmentMeta, 0, len(segs)+logFileTypeNum)
+	unstage := func(moved []*ingestSegment) {
+		for _, seg := range moved {
+			name := ingestFilePrefix + logFileName(seg.dataType, seg.fid)
+			_ = moveFile(filepath.Join(db.opts.DBPath, name), seg.path)
+		}
+	}
+	for i, seg := range segs {
+		stagingPath := filepath.Join(db.opts.DBPath, ingestFilePrefix+logFileName(seg.dataType, seg.fid))
+		if err := moveFile(seg.path, stagingPath); err != nil {
+			unstage(segs[:i])
+			return err
+		}
+		metas = append(metas, segmentMeta{Type: seg.dataType, Fid: seg.fid, Size: seg.size})
+	}
+
+	// open the new active log files and seal the old ones, which are kept until the segments are committed.
+	var actives, sealed [logFileTypeNum]*logfile.LogFile
+	rollback := func(err error) error {
+		for dataType := String; dataType < logFileTypeNum; dataType++ {
+			if lf := actives[dataType]; lf != nil {
+				_ = lf.Delete()
+			}
+			if lf := sealed[dataType]; lf != nil && lf != db.activeLogFiles[dataType] {
+				_ = lf.Close()
+			}
+		}
+		unstage(segs)
+		return err
+	}
+	for dataType := String; dataType < logFileTypeNum; dataType++ {
+		if !attached[dataType] {
+			continue
+		}
+		if active := db.activeLogFiles[dataType]; active != nil {
+			if err := active.Sync(); err != nil {
+				return rollback(err)
+			}
+			archived, err := db.sealLogFile(dataType, active)
+			if err != nil {
+				return rollback(err)
+			}
+			sealed[dataType] = archived
+		}
+		ftype, iotype := logfile.FileType(dataType), db.logFileIOType()
+		lf, err := logfile.OpenLogFile(db.opts.DBPath, nextFid[dataType], db.opts.LogFileSizeThreshold, ftype, iotype)
+		if err != nil {
+			return rollback(err)
+		}
+		actives[dataType] = lf
+		metas = append(metas, segmentMeta{Type: dataType, Fid: lf.Fid, Size: lf.Size})
+	}
+	// recording them in manifest is the commit point, see recoverIngested.
+	if err := db.manifest.addSegments(metas); err != nil {
+		return rollback(err)
+	}
+
+	for dataType := String; dataType < logFileTypeNum; dataType++ {
+		if !attached[dataType] {
+			continue
+		}
+		if db.archivedLogFiles[dataType] == nil {
+			db.archivedLogFiles[dataType] = make(archivedFiles)
+		}
+		if active := db.activeLogFiles[dataType]; active != nil {
+			db.archivedLogFiles[dataType][active.Fid] = sealed[dataType]
+			db.closeSealedLogFile(dataType, active, sealed[dataType])
+		}
+		lf := actives[dataType]
+		db.activeLogFiles[dataType] = lf
+		db.discards[dataType].setTotal(lf.Fid, uint32(lf.Size))
+	}
+	for _, seg := range segs {
+		name := logFileName(seg.dataType, seg.fid)
+		if err := os.Rename(filepath.Join(db.opts.DBPath, ingestFilePrefix+name), filepath.Join(db.opts.DBPath, name)); err != nil {
+			return db.fail(err)
+		}
+		ftype, iotype := logfile.FileType(seg.dataType), db.archivedLogFileIOType()
+		lf, err := logfile.OpenLogFile(db.opts.DBPath, seg.fid, seg.size, ftype, iotype)
+		if err != nil {
+			return db.fail(err)
+		}
+		db.archivedLogFiles[seg.dataType][seg.fid] = lf
+		db.discards[seg.dataType].setTotal(seg.fid, uint32(seg.size))
+		for _, e := range seg.entries {
+			e.pos.fid = seg.fid
+		}
+	}
+	return nil
+}
+
+// ingestedKey returns the key to lock of an ingested entry key, which is the key of collection for members.
+func (db *GoDb) ingestedKey(dataType DataType, entKey []byte) []byte {
+	if dataType == Hash || dataType == ZSet {
+		key, _ := db.decodeKey(entKey)
+		return key
+	}
+	return entKey
+}
+
+// applyEntries put entries of attached segments into index, key locks of them must be held.
+func (db *GoDb) applyEntries(entries []ingestEntry) error {
+	var discarded [logFileTypeNum]map[uint32]int
+	defer func() {
+		for dataType, sizes := range discarded {
+			for fid, size := range sizes {
+				db.discards[DataType(dataType)].incrDiscard(fid, size)
+			}
+		}
+	}()
+	for _, e := range entries {
+		var oldVal interface{}
+		var updated bool
+		seg := e.seg
+		if discarded[seg.dataType] == nil {
+			discarded[seg.dataType] = make(map[uint32]int)
+		}
+		pos, err := db.ingestedPos(seg.dataType, e.loadedEntry)
+		if err != nil {
+			return err
+		}
+		if pos != e.pos {
+			discarded[seg.dataType][e.pos.fid] += e.pos.entrySize
+		}
+		idxNode := db.newIndexNode(e.ent, pos, pos.entrySize)
+		switch seg.dataType {
+		case String:
+			oldVal, updated = db.strIndex.Put(e.ent.Key, idxNode)
+			if err := db.indexErr(db.strIndex); err != nil {
+				return err
+			}
+		case Hash:
+			key, field := db.decodeKey(e.ent.Key)
+			oldVal, updated = db.hashIndex.treeOrCreate(key).Put(field, idxNode)
+		case Set:
+			oldVal, updated = db.setIndex.treeOrCreate(e.ent.Key).Put(util.Sum128(e.ent.Value), idxNode)
+		case ZSet:
+			key, scoreBuf := db.decodeKey(e.ent.Key)
+			score, _ := util.StrToFloat64(string(scoreBuf))
+			sum := util.Sum128(e.ent.Value)
+			oldVal, updated = db.zsetIndex.treeOrCreate(key).Put(sum, idxNode)
+			db.zsetIndex.indexes.ZAdd(string(key), score, string(sum))
+		}
+		if !updated {
+			continue
+		}
+		inheritAccess(idxNode, oldVal)
+		if old, _ := oldVal.(*indexNode); old != nil && old.entrySize > 0 {
+			discarded[seg.dataType][old.fid] += old.entrySize
+		}
+	}
+	return nil
+}
+
+// ingestedPos returns the position of an ingested entry in index.
+// Entries of collections are in generation 0, they would be ignored when loading index if the collection has been dropped,
+// so they are written again with the current generation. An expired collection is dropped before, like written by HSet.
+func (db *GoDb) ingestedPos(dataType DataType, e loadedEntry) (*valuePos, error) {
+	var key []byte
+	switch dataType {
+	case Hash, ZSet:
+		key, _ = db.decodeKey(e.ent.Key)
+	case Set:
+		key = e.ent.Key
+	default:
+		return e.pos, nil
+	}
+	c := db.collectionIndexOf(dataType)
+	if c.tree(key) == nil && c.expiredAt(key) != 0 {
+		if err := db.dropInternal(dataType, key); err != nil {
+			return nil, err
+		}
+	}
+	if c.gen(key) == 0 {
+		return e.pos, nil
+	}
+	ent, err := db.readLogEntry(dataType, e.pos.fid, e.pos.offset)
+	if err != nil {
+		return nil, err
+	}
+	ent.Key, _, _ = splitGen(ent.Key)
+	return db.writeMember(dataType, key, ent)
+}
+
+// recoverIngested finish or roll back the segments left by Ingest when the process crashed,
+// the ones recorded in manifest are committed, and the others are removed.
+// It returns the data type and fid of the log file if it is attached.
+func (db *GoDb) recoverIngested(name string) (DataType, uint32, bool) {
+	path := filepath.Join(db.opts.DBPath, name)
+	dataType, fid, ok := parseLogFileName(strings.TrimPrefix(name, ingestFilePrefix))
+	if ok {
+		if _, committed := db.manifest.segmentSize(dataType, fid); committed {
+			if err := os.Rename(path, filepath.Join(db.opts.DBPath, logFileName(dataType, fid))); err != nil {
+				logger.Errorf("attach ingested log file %s err: %v", name, err)
+				return 0, 0, false
+			}
+			return dataType, fid, true
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		logger.Errorf("remove uncommitted ingested file %s err: %v", name, err)
+	}
+	return 0, 0, false
+}
+
+// logFileName returns the name of log file fid of the data type.
+func logFileName(dataType DataType, fid uint32) string {
+	return logfile.FileNamesMap[logfile.FileType(dataType)] + fmt.Sprintf("%09d", fid)
+}
+
+// parseLogFileName parse the data type and fid of a log file name like "log.strs.000000001".
+func parseLogFileName(name string) (DataType, uint32, bool) {
+	parts := strings.Split(name, ".")
+	if len(parts) != 3 || parts[0]+"." != logfile.FilePrefix {
+		return 0, 0, false
+	}
+	ftype, ok := logfile.FileTypesMap[parts[1]]
+	if !ok {
+		return 0, 0, false
+	}
+	fid, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return DataType(ftype), uint32(fid), true
+}
+
+// moveFile rename src to dst, or copy it if they are on different devices.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := util.CopyFile(src, dst); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
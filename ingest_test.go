@@ -0,0 +1,425 @@
+package godb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/herott-ai/godb/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentWriter_Add(t *testing.T) {
+	dir := filepath.Join("/tmp", "godb-segment")
+	defer os.RemoveAll(dir)
+
+	w, err := NewSegmentWriter(dir, Hash, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, w.HSet([]byte("a"), []byte("f1"), []byte("v1")))
+	assert.Nil(t, w.HSet([]byte("a"), []byte("f2"), []byte("v2")))
+	assert.Nil(t, w.HSet([]byte("b"), []byte("f1"), []byte("v1")))
+
+	assert.Equal(t, ErrUnsortedInput, w.HSet([]byte("b"), []byte("f1"), []byte("v1")))
+	assert.Equal(t, ErrUnsortedInput, w.HSet([]byte("a"), []byte("f3"), []byte("v3")))
+	assert.Equal(t, ErrSegmentType, w.Put([]byte("c"), []byte("v")))
+
+	files, err := w.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "log.hash.000000000")}, files)
+	assert.True(t, util.PathExist(files[0]+hintFileSuffix))
+	assert.Equal(t, os.ErrClosed, w.HSet([]byte("c"), []byte("f1"), []byte("v1")))
+
+	_, err = NewSegmentWriter(dir, List, 0)
+	assert.Equal(t, ErrSegmentType, err)
+}
+
+func TestGoDb_Ingest(t *testing.T) {
+	tests := []struct {
+		name      string
+		ioType    IOType
+		mode      DataIndexMode
+		withHints bool
+	}{
+		{"fileio", FileIO, KeyOnlyMemMode, true},
+		{"mmap", MMap, KeyOnlyMemMode, true},
+		{"key-value", FileIO, KeyValueMemMode, true},
+		{"no-hints", FileIO, KeyOnlyMemMode, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testGoDbIngest(t, tt.ioType, tt.mode, tt.withHints)
+		})
+	}
+}
+
+func testGoDbIngest(t *testing.T, ioType IOType, mode DataIndexMode, withHints bool) {
+	path := filepath.Join("/tmp", "godb-ingest")
+	segDir := filepath.Join("/tmp", "godb-ingest-segments")
+	defer os.RemoveAll(segDir)
+	opts := DefaultOptions(path)
+	opts.IoType = ioType
+	opts.IndexMode = mode
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// existing keys are overwritten by ingested ones.
+	for i := 0; i < 100; i++ {
+		err = db.Set(GetKey(i), []byte("old"))
+		assert.Nil(t, err)
+	}
+
+	w, err := NewSegmentWriter(segDir, String, 64<<10)
+	assert.Nil(t, err)
+	values := make(map[int][]byte)
+	for i := 50; i < 5000; i++ {
+		values[i] = GetValue128B()
+		err = w.Put(GetKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	files, err := w.Close()
+	assert.Nil(t, err)
+	assert.True(t, len(files) > 1)
+	if !withHints {
+		for _, file := range files {
+			assert.Nil(t, os.Remove(file+hintFileSuffix))
+		}
+	}
+
+	activeFid := db.getActiveLogFile(String).Fid
+	err = db.Ingest(files...)
+	assert.Nil(t, err)
+	for _, file := range files {
+		assert.False(t, util.PathExist(file))
+		assert.False(t, util.PathExist(file+hintFileSuffix))
+	}
+	assert.Equal(t, activeFid+uint32(len(files))+1, db.getActiveLogFile(String).Fid)
+
+	// writes after ingesting are newer.
+	err = db.Set(GetKey(60), []byte("new"))
+	assert.Nil(t, err)
+	values[60] = []byte("new")
+
+	check := func(db *GoDb) {
+		for i := 0; i < 50; i++ {
+			v, err := db.Get(GetKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("old"), v)
+		}
+		for i := 50; i < 5000; i++ {
+			v, err := db.Get(GetKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, values[i], v)
+		}
+	}
+	check(db)
+
+	// reopen.
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
+func TestGoDb_IngestConcurrentWrites(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-ingest")
+	segDir := filepath.Join("/tmp", "godb-ingest-segments")
+	defer os.RemoveAll(segDir)
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	w, err := NewSegmentWriter(segDir, String, 0)
+	assert.Nil(t, err)
+	for i := 0; i < 50000; i++ {
+		assert.Nil(t, w.Put(GetKey(i), []byte("ingested")))
+	}
+	files, err := w.Close()
+	assert.Nil(t, err)
+
+	// keys written while ingesting are either overwritten by the ingested entries or newer than them.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50000; i += 7 {
+			assert.Nil(t, db.Set(GetKey(i), []byte("written")))
+		}
+	}()
+	assert.Nil(t, db.Ingest(files...))
+	<-done
+
+	values := make(map[int][]byte)
+	for i := 0; i < 50000; i += 7 {
+		values[i], err = db.Get(GetKey(i))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 50000; i += 7 {
+		v, err := db.Get(GetKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], v, i)
+	}
+}
+
+func TestGoDb_IngestCollections(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-ingest")
+	segDir := filepath.Join("/tmp", "godb-ingest-segments")
+	defer os.RemoveAll(segDir)
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	err = db.HSet([]byte("h"), []byte("a"), []byte("old"), []byte("z"), []byte("old"))
+	assert.Nil(t, err)
+	err = db.ZAdd([]byte("z"), 100, []byte("m1"))
+	assert.Nil(t, err)
+
+	var files []string
+	hw, err := NewSegmentWriter(filepath.Join(segDir, "hash"), Hash, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, hw.HSet([]byte("h"), []byte("a"), []byte("v1")))
+	assert.Nil(t, hw.HSet([]byte("h"), []byte("b"), []byte("v2")))
+	hashFiles, err := hw.Close()
+	assert.Nil(t, err)
+	files = append(files, hashFiles...)
+
+	sw, err := NewSegmentWriter(filepath.Join(segDir, "sets"), Set, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, sw.SAdd([]byte("s"), []byte("m1")))
+	assert.Nil(t, sw.SAdd([]byte("s"), []byte("m2")))
+	setFiles, err := sw.Close()
+	assert.Nil(t, err)
+	files = append(files, setFiles...)
+
+	zw, err := NewSegmentWriter(filepath.Join(segDir, "zset"), ZSet, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, zw.ZAdd([]byte("z"), 1, []byte("m1")))
+	assert.Nil(t, zw.ZAdd([]byte("z"), 2, []byte("m2")))
+	zsetFiles, err := zw.Close()
+	assert.Nil(t, err)
+	files = append(files, zsetFiles...)
+
+	err = db.Ingest(files...)
+	assert.Nil(t, err)
+
+	check := func(db *GoDb) {
+		v, err := db.HGet([]byte("h"), []byte("a"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v1"), v)
+		v, err = db.HGet([]byte("h"), []byte("z"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("old"), v)
+		assert.Equal(t, 3, db.HLen([]byte("h")))
+
+		assert.True(t, db.SIsMember([]byte("s"), []byte("m2")))
+		assert.Equal(t, 2, db.SCard([]byte("s")))
+
+		ok, score := db.ZScore([]byte("z"), []byte("m1"))
+		assert.True(t, ok)
+		assert.Equal(t, float64(1), score)
+		members, err := db.ZRange([]byte("z"), 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("m1"), []byte("m2")}, members)
+	}
+	check(db)
+
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
+func TestGoDb_IngestInvalid(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-ingest")
+	segDir := filepath.Join("/tmp", "godb-ingest-segments")
+	defer os.RemoveAll(segDir)
+	db, err := Open(DefaultOptions(path))
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	w, err := NewSegmentWriter(segDir, String, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Put([]byte("a"), []byte("v")))
+	files, err := w.Close()
+	assert.Nil(t, err)
+
+	// nothing is attached if any of the files is invalid.
+	invalid := filepath.Join(segDir, "not-a-segment")
+	assert.Nil(t, os.WriteFile(invalid, []byte("x"), 0644))
+	err = db.Ingest(files[0], invalid)
+	assert.Equal(t, ErrInvalidSegment, err)
+	assert.True(t, util.PathExist(files[0]))
+
+	// corrupted hint file.
+	assert.Nil(t, os.WriteFile(files[0]+hintFileSuffix, []byte("corrupted hint"), 0644))
+	err = db.Ingest(files[0])
+	assert.Equal(t, ErrInvalidSegment, err)
+	assert.True(t, util.PathExist(files[0]))
+
+	_, err = db.Get([]byte("a"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestGoDb_IngestRecover(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-ingest")
+	segDir := filepath.Join("/tmp", "godb-ingest-segments")
+	defer os.RemoveAll(segDir)
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	err = db.Set([]byte("a"), []byte("old"))
+	assert.Nil(t, err)
+
+	w, err := NewSegmentWriter(segDir, String, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Put([]byte("a"), []byte("v1")))
+	assert.Nil(t, w.Put([]byte("b"), []byte("v2")))
+	files, err := w.Close()
+	assert.Nil(t, err)
+	stat, err := os.Stat(files[0])
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// crashed before committing, the segment is removed.
+	uncommitted := filepath.Join(path, ingestFilePrefix+logFileName(String, 5))
+	assert.Nil(t, util.CopyFile(files[0], uncommitted))
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.False(t, util.PathExist(uncommitted))
+	_, err = db.Get([]byte("b"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// crashed after committing, the segment is attached.
+	activeFid := db.getActiveLogFile(String).Fid
+	committed := filepath.Join(path, ingestFilePrefix+logFileName(String, activeFid+1))
+	assert.Nil(t, os.Rename(files[0], committed))
+	err = db.manifest.addSegments([]segmentMeta{{Type: String, Fid: activeFid + 1, Size: stat.Size()}})
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.False(t, util.PathExist(committed))
+	v, err := db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), v)
+	v, err = db.Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), v)
+}
+
+func TestGoDb_IngestFailed(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-ingest")
+	segDir := filepath.Join("/tmp", "godb-ingest-segments")
+	defer os.RemoveAll(segDir)
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+	assert.Nil(t, db.Set([]byte("a"), []byte("old")))
+
+	w, err := NewSegmentWriter(segDir, String, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Put([]byte("a"), []byte("v1")))
+	assert.Nil(t, w.Put([]byte("b"), []byte("v2")))
+	files, err := w.Close()
+	assert.Nil(t, err)
+
+	// the new active log file can't be created, nothing is attached and db is still usable.
+	activeFid := db.getActiveLogFile(String).Fid
+	blocker := filepath.Join(path, logFileName(String, activeFid+2))
+	assert.Nil(t, os.Mkdir(blocker, os.ModePerm))
+	assert.NotNil(t, db.Ingest(files...))
+	assert.True(t, util.PathExist(files[0]))
+	assert.Equal(t, activeFid, db.getActiveLogFile(String).Fid)
+	_, ok := db.manifest.segmentSize(String, activeFid+1)
+	assert.False(t, ok)
+	assert.Nil(t, db.Set([]byte("c"), []byte("v3")))
+	_, err = db.Get([]byte("b"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, os.Remove(blocker))
+
+	// the segment can't be renamed after it is committed, db fails and attaches it when reopened.
+	blocker = filepath.Join(path, logFileName(String, activeFid+1), "blocker")
+	assert.Nil(t, os.MkdirAll(blocker, os.ModePerm))
+	err = db.Ingest(files...)
+	assert.True(t, errors.Is(err, ErrDBFailed))
+	assert.True(t, errors.Is(db.Set([]byte("d"), []byte("v4")), ErrDBFailed))
+	assert.True(t, errors.Is(db.Ingest(files...), ErrDBFailed))
+	assert.Nil(t, db.Close())
+	assert.Nil(t, os.RemoveAll(filepath.Dir(blocker)))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for key, want := range map[string]string{"a": "v1", "b": "v2", "c": "v3"} {
+		v, err := db.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(want), v)
+	}
+	assert.Nil(t, db.Set([]byte("d"), []byte("v4")))
+}
+
+func TestGoDb_IngestDropped(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-ingest")
+	segDir := filepath.Join("/tmp", "godb-ingest-segments")
+	defer os.RemoveAll(segDir)
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	err = db.HSet([]byte("h"), []byte("a"), []byte("old"), []byte("z"), []byte("old"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.HClear([]byte("h")))
+
+	w, err := NewSegmentWriter(segDir, Hash, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, w.HSet([]byte("g"), []byte("a"), []byte("v0")))
+	assert.Nil(t, w.HSet([]byte("h"), []byte("a"), []byte("v1")))
+	assert.Nil(t, w.HSet([]byte("h"), []byte("b"), []byte("v2")))
+	files, err := w.Close()
+	assert.Nil(t, err)
+	err = db.Ingest(files...)
+	assert.Nil(t, err)
+
+	// members of the dropped hash are written again in its current generation.
+	check := func(db *GoDb) {
+		pairs, err := db.HGetAll([]byte("h"))
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("a"), []byte("v1"), []byte("b"), []byte("v2")}, pairs)
+		v, err := db.HGet([]byte("g"), []byte("a"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v0"), v)
+	}
+	check(db)
+
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
@@ -0,0 +1,166 @@
+package ioselector
+
+import (
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+// BlockSize alignment of offset, length and memory address required by direct io.
+const BlockSize = 4096
+
+// DirectIOSelector represents using direct file I/O, reads and writes bypass the OS page cache.
+// So godb won`t evict the page cache of other processes, and the read latency is predictable.
+// The alignment required by direct io is handled internally, callers can read and write at any offset.
+type DirectIOSelector struct {
+	fd   *os.File // system file descriptor.
+	mu   sync.Mutex
+	size int64 // logical size of the file, the aligned writes may exceed it.
+
+	// the last written block, appending writes can skip reading it from disk.
+	tail    []byte
+	tailOff int64
+}
+
+// NewDirectIOSelector create a new direct io selector.
+func NewDirectIOSelector(fName string, fsize int64) (IOSelector, error) {
+	if fsize <= 0 {
+		return nil, ErrInvalidFsize
+	}
+	file, err := openDirectFile(fName, fsize)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &DirectIOSelector{fd: file, size: stat.Size(), tail: alignedBlock(BlockSize), tailOff: -1}, nil
+}
+
+// Write slice b at offset. The blocks partially covered by b will be read before written.
+func (dio *DirectIOSelector) Write(b []byte, offset int64) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if offset < 0 {
+		return 0, io.EOF
+	}
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	end := offset + int64(len(b))
+	start, alignedEnd := alignDown(offset), alignUp(end)
+	buf := alignedBlock(int(alignedEnd - start))
+
+	// fill the first and the last block with the existing data.
+	if offset != start {
+		if err := dio.readBlock(buf[:BlockSize], start); err != nil {
+			return 0, err
+		}
+	}
+	if lastOff := alignedEnd - BlockSize; end != alignedEnd && (lastOff != start || offset == start) {
+		if err := dio.readBlock(buf[len(buf)-BlockSize:], lastOff); err != nil {
+			return 0, err
+		}
+	}
+	copy(buf[offset-start:], b)
+
+	if _, err := dio.fd.WriteAt(buf, start); err != nil {
+		return 0, err
+	}
+	// keep the logical size, the padding of aligned writes shouldn`t change the file size.
+	if alignedEnd > dio.size {
+		size := dio.size
+		if end > size {
+			size = end
+		}
+		if err := dio.fd.Truncate(size); err != nil {
+			return 0, err
+		}
+		dio.size = size
+	}
+	copy(dio.tail, buf[len(buf)-BlockSize:])
+	dio.tailOff = alignedEnd - BlockSize
+	return len(b), nil
+}
+
+// Read slice b from offset.
+func (dio *DirectIOSelector) Read(b []byte, offset int64) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if offset < 0 {
+		return 0, io.EOF
+	}
+	start, alignedEnd := alignDown(offset), alignUp(offset+int64(len(b)))
+	buf := alignedBlock(int(alignedEnd - start))
+	n, err := dio.fd.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	skip := int(offset - start)
+	if n <= skip {
+		return 0, io.EOF
+	}
+	n = copy(b, buf[skip:n])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Sync is a wrapper of os.File Sync, direct io doesn`t guarantee the file metadata is persisted.
+func (dio *DirectIOSelector) Sync() error {
+	return dio.fd.Sync()
+}
+
+// Close is a wrapper of os.File Close.
+func (dio *DirectIOSelector) Close() error {
+	return dio.fd.Close()
+}
+
+// Delete file descriptor if we don`t use it anymore.
+func (dio *DirectIOSelector) Delete() error {
+	if err := dio.fd.Close(); err != nil {
+		return err
+	}
+	return os.Remove(dio.fd.Name())
+}
+
+// read a block at offset into buf, a block beyond the end of file is all zero.
+// must hold the lock before invoking.
+func (dio *DirectIOSelector) readBlock(buf []byte, offset int64) error {
+	if offset == dio.tailOff {
+		copy(buf, dio.tail)
+		return nil
+	}
+	n, err := dio.fd.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	for i := n; i < len(buf); i++ {
+		buf[i] = 0
+	}
+	return nil
+}
+
+// alignedBlock returns a byte slice whose address is aligned to BlockSize.
+func alignedBlock(size int) []byte {
+	buf := make([]byte, size+BlockSize)
+	var offset int
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (BlockSize - 1)); rem != 0 {
+		offset = BlockSize - rem
+	}
+	return buf[offset : offset+size : offset+size]
+}
+
+func alignDown(n int64) int64 {
+	return n &^ (BlockSize - 1)
+}
+
+func alignUp(n int64) int64 {
+	return (n + BlockSize - 1) &^ (BlockSize - 1)
+}
@@ -0,0 +1,20 @@
+package ioselector
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDirectFile open file and turn off data caching by F_NOCACHE, there is no O_DIRECT on darwin.
+func openDirectFile(fName string, fsize int64) (*os.File, error) {
+	fd, err := os.OpenFile(fName, os.O_CREATE|os.O_RDWR, FilePerm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unix.FcntlInt(fd.Fd(), unix.F_NOCACHE, 1); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return truncateFile(fd, fsize)
+}
@@ -0,0 +1,15 @@
+package ioselector
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDirectFile open file with O_DIRECT, and truncate it if necessary.
+func openDirectFile(fName string, fsize int64) (*os.File, error) {
+	fd, err := os.OpenFile(fName, os.O_CREATE|os.O_RDWR|syscall.O_DIRECT, FilePerm)
+	if err != nil {
+		return nil, err
+	}
+	return truncateFile(fd, fsize)
+}
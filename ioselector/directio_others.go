@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package ioselector
+
+import "os"
+
+// openDirectFile open file in the normal way, direct io is not supported on this platform.
+// The alignment is still handled, so it works the same as other platforms except the page cache.
+func openDirectFile(fName string, fsize int64) (*os.File, error) {
+	fd, err := os.OpenFile(fName, os.O_CREATE|os.O_RDWR, FilePerm)
+	if err != nil {
+		return nil, err
+	}
+	return truncateFile(fd, fsize)
+}
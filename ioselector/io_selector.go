@@ -8,10 +8,13 @@ import (
 // ErrInvalidFsize invalid file size.
 var ErrInvalidFsize = errors.New("fsize can`t be zero or negative")
 
+// ErrReadOnly the file is opened read-only and can`t be written.
+var ErrReadOnly = errors.New("file is opened read-only")
+
 // FilePerm default permission of the newly created log file.
 const FilePerm = 0644
 
-// IOSelector io selector for fileio and mmap, used by wal and value log right now.
+// IOSelector io selector for fileio, mmap, direct io and memory, used by wal and value log right now.
 type IOSelector interface {
 	// Write a slice to log file at offset.
 	// It returns the number of bytes written and an error, if any.
@@ -35,13 +38,29 @@ type IOSelector interface {
 	Delete() error
 }
 
+// Viewer is implemented by io selectors whose content can be accessed without copying, only MMapSelector now.
+type Viewer interface {
+	// Pin holds off remapping and unmapping of the content until Unpin is called.
+	Pin()
+
+	// Unpin release the pin acquired by Pin.
+	Unpin()
+
+	// View returns at most n bytes at offset, the slice aliases the content and is valid while pinned.
+	View(offset int64, n int) ([]byte, error)
+}
+
 // open file and truncate it if necessary.
 func openFile(fName string, fsize int64) (*os.File, error) {
 	fd, err := os.OpenFile(fName, os.O_CREATE|os.O_RDWR, FilePerm)
 	if err != nil {
 		return nil, err
 	}
+	return truncateFile(fd, fsize)
+}
 
+// truncate the file to fsize if it is smaller.
+func truncateFile(fd *os.File, fsize int64) (*os.File, error) {
 	stat, err := fd.Stat()
 	if err != nil {
 		return nil, err
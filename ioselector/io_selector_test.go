@@ -3,9 +3,11 @@ package ioselector
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNewFileIOSelector(t *testing.T) {
@@ -16,6 +18,14 @@ func TestNewMMapSelector(t *testing.T) {
 	testNewIOSelector(t, 1)
 }
 
+func TestNewMemSelector(t *testing.T) {
+	testNewIOSelector(t, 2)
+}
+
+func TestNewDirectIOSelector(t *testing.T) {
+	testNewIOSelector(t, 3)
+}
+
 func TestFileIOSelector_Write(t *testing.T) {
 	testIOSelectorWrite(t, 0)
 }
@@ -24,6 +34,14 @@ func TestMMapSelector_Write(t *testing.T) {
 	testIOSelectorWrite(t, 1)
 }
 
+func TestMemSelector_Write(t *testing.T) {
+	testIOSelectorWrite(t, 2)
+}
+
+func TestDirectIOSelector_Write(t *testing.T) {
+	testIOSelectorWrite(t, 3)
+}
+
 func TestFileIOSelector_Read(t *testing.T) {
 	testIOSelectorRead(t, 0)
 }
@@ -32,6 +50,14 @@ func TestMMapSelector_Read(t *testing.T) {
 	testIOSelectorRead(t, 1)
 }
 
+func TestMemSelector_Read(t *testing.T) {
+	testIOSelectorRead(t, 2)
+}
+
+func TestDirectIOSelector_Read(t *testing.T) {
+	testIOSelectorRead(t, 3)
+}
+
 func TestFileIOSelector_Sync(t *testing.T) {
 	testIOSelectorSync(t, 0)
 }
@@ -40,6 +66,14 @@ func TestMMapSelector_Sync(t *testing.T) {
 	testIOSelectorSync(t, 1)
 }
 
+func TestMemSelector_Sync(t *testing.T) {
+	testIOSelectorSync(t, 2)
+}
+
+func TestDirectIOSelector_Sync(t *testing.T) {
+	testIOSelectorSync(t, 3)
+}
+
 func TestFileIOSelector_Close(t *testing.T) {
 	testIOSelectorClose(t, 0)
 }
@@ -48,6 +82,14 @@ func TestMMapSelector_Close(t *testing.T) {
 	testIOSelectorClose(t, 1)
 }
 
+func TestMemSelector_Close(t *testing.T) {
+	testIOSelectorClose(t, 2)
+}
+
+func TestDirectIOSelector_Close(t *testing.T) {
+	testIOSelectorClose(t, 3)
+}
+
 func TestFileIOSelector_Delete(t *testing.T) {
 	testIOSelectorDelete(t, 0)
 }
@@ -56,6 +98,14 @@ func TestMMapSelector_Delete(t *testing.T) {
 	testIOSelectorDelete(t, 1)
 }
 
+func TestMemSelector_Delete(t *testing.T) {
+	testIOSelectorDelete(t, 2)
+}
+
+func TestDirectIOSelector_Delete(t *testing.T) {
+	testIOSelectorDelete(t, 3)
+}
+
 func testNewIOSelector(t *testing.T, ioType uint8) {
 	type args struct {
 		fName string
@@ -87,6 +137,12 @@ func testNewIOSelector(t *testing.T, ioType uint8) {
 			if ioType == 1 {
 				got, err = NewMMapSelector(absPath, tt.args.fsize)
 			}
+			if ioType == 2 {
+				got, err = NewMemSelector(tt.args.fsize)
+			}
+			if ioType == 3 {
+				got, err = NewDirectIOSelector(absPath, tt.args.fsize)
+			}
 			defer func() {
 				if got != nil {
 					err = got.Delete()
@@ -115,6 +171,12 @@ func testIOSelectorWrite(t *testing.T, ioType uint8) {
 	if ioType == 1 {
 		selector, err = NewMMapSelector(absPath, size)
 	}
+	if ioType == 2 {
+		selector, err = NewMemSelector(size)
+	}
+	if ioType == 3 {
+		selector, err = NewDirectIOSelector(absPath, size)
+	}
 	assert.Nil(t, err)
 	defer func() {
 		if selector != nil {
@@ -159,8 +221,8 @@ func testIOSelectorWrite(t *testing.T, ioType uint8) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := tt.fields.selector.Write(tt.args.b, tt.args.offset)
-			// io.EOF err in mmmap.
-			if tt.want == 1048577 && ioType == 1 {
+			// io.EOF err in mmmap and memory.
+			if tt.want == 1048577 && (ioType == 1 || ioType == 2) {
 				tt.wantErr = true
 				tt.want = 0
 			}
@@ -184,6 +246,12 @@ func testIOSelectorRead(t *testing.T, ioType uint8) {
 	if ioType == 1 {
 		selector, err = NewMMapSelector(absPath, 100)
 	}
+	if ioType == 2 {
+		selector, err = NewMemSelector(100)
+	}
+	if ioType == 3 {
+		selector, err = NewDirectIOSelector(absPath, 100)
+	}
 	assert.Nil(t, err)
 	defer func() {
 		if selector != nil {
@@ -273,6 +341,12 @@ func testIOSelectorSync(t *testing.T, ioType uint8) {
 		if ioType == 1 {
 			selector, err = NewMMapSelector(absPath, fsize)
 		}
+		if ioType == 2 {
+			selector, err = NewMemSelector(fsize)
+		}
+		if ioType == 3 {
+			selector, err = NewDirectIOSelector(absPath, fsize)
+		}
 		assert.Nil(t, err)
 		defer func() {
 			if selector != nil {
@@ -303,6 +377,12 @@ func testIOSelectorClose(t *testing.T, ioType uint8) {
 		if ioType == 1 {
 			selector, err = NewMMapSelector(absPath, fsize)
 		}
+		if ioType == 2 {
+			selector, err = NewMemSelector(fsize)
+		}
+		if ioType == 3 {
+			selector, err = NewDirectIOSelector(absPath, fsize)
+		}
 		assert.Nil(t, err)
 		defer func() {
 			if selector != nil {
@@ -340,6 +420,12 @@ func testIOSelectorDelete(t *testing.T, ioType uint8) {
 			if ioType == 1 {
 				selector, err = NewFileIOSelector(absPath, int64((i+1)*100))
 			}
+			if ioType == 2 {
+				selector, err = NewMemSelector(int64((i + 1) * 100))
+			}
+			if ioType == 3 {
+				selector, err = NewDirectIOSelector(absPath, int64((i+1)*100))
+			}
 			assert.Nil(t, err)
 
 			if err := selector.Delete(); (err != nil) != tt.wantErr {
@@ -348,3 +434,154 @@ func testIOSelectorDelete(t *testing.T, ioType uint8) {
 		})
 	}
 }
+
+func TestDirectIOSelector_Unaligned(t *testing.T) {
+	absPath, err := filepath.Abs(filepath.Join("/tmp", "00000001.dio"))
+	assert.Nil(t, err)
+	selector, err := NewDirectIOSelector(absPath, 3*BlockSize)
+	assert.Nil(t, err)
+	defer func() {
+		_ = selector.Delete()
+	}()
+
+	// write across the block boundaries.
+	data := []byte(fmt.Sprintf("%05000d", 123))
+	offsets := []int64{0, 17, BlockSize - 3, 2*BlockSize - 1}
+	for _, offset := range offsets {
+		n, err := selector.Write(data[:100], offset)
+		assert.Nil(t, err)
+		assert.Equal(t, 100, n)
+
+		buf := make([]byte, 100)
+		n, err = selector.Read(buf, offset)
+		assert.Nil(t, err)
+		assert.Equal(t, 100, n)
+		assert.Equal(t, data[:100], buf)
+	}
+	n, err := selector.Write(data, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+
+	// the data around the written one should not be changed.
+	buf := make([]byte, len(data)+20)
+	_, err = selector.Read(buf, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, data[:10], buf[:10])
+	assert.Equal(t, data, buf[10:len(data)+10])
+	assert.Equal(t, make([]byte, 10), buf[len(data)+10:])
+}
+
+func TestMMapSelector_Grow(t *testing.T) {
+	absPath, err := filepath.Abs(filepath.Join("/tmp", "00000001.mmap"))
+	assert.Nil(t, err)
+	var fsize int64 = 64 << 20
+	selector, err := NewMMapSelector(absPath, fsize)
+	assert.Nil(t, err)
+
+	// the file is not preallocated.
+	stat, err := os.Stat(absPath)
+	assert.Nil(t, err)
+	assert.True(t, stat.Size() < fsize)
+
+	data := []byte(fmt.Sprintf("%01048576d", 123))
+	var offset int64
+	for i := 0; i < 5; i++ {
+		n, err := selector.Write(data, offset)
+		assert.Nil(t, err)
+		offset += int64(n)
+	}
+	// read the data beyond the mapped region.
+	buf := make([]byte, 100)
+	_, err = selector.Read(buf, fsize-200)
+	assert.Nil(t, err)
+	assert.Equal(t, make([]byte, 100), buf)
+
+	// truncated to the end of written data.
+	err = selector.Close()
+	assert.Nil(t, err)
+	stat, err = os.Stat(absPath)
+	assert.Nil(t, err)
+	assert.Equal(t, offset, stat.Size())
+
+	selector, err = NewMMapSelector(absPath, fsize)
+	assert.Nil(t, err)
+	defer func() {
+		_ = selector.Delete()
+	}()
+	buf = make([]byte, len(data))
+	_, err = selector.Read(buf, offset-int64(len(data)))
+	assert.Nil(t, err)
+	assert.Equal(t, data, buf)
+	_, err = selector.Read(buf, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, make([]byte, len(data)), buf)
+}
+
+func TestNewReadOnlyMMapSelector(t *testing.T) {
+	absPath, err := filepath.Abs(filepath.Join("/tmp", "00000002.mmap"))
+	assert.Nil(t, err)
+	_, err = NewReadOnlyMMapSelector(absPath, 100)
+	assert.True(t, os.IsNotExist(err))
+
+	selector, err := NewFileIOSelector(absPath, 100)
+	assert.Nil(t, err)
+	writeSomeData(selector, t)
+	err = selector.Close()
+	assert.Nil(t, err)
+
+	selector, err = NewReadOnlyMMapSelector(absPath, 100)
+	assert.Nil(t, err)
+	defer func() {
+		err := selector.Delete()
+		assert.Nil(t, err)
+	}()
+	buf := make([]byte, 7)
+	_, err = selector.Read(buf, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("lotusdb"), buf)
+	_, err = selector.Write([]byte("lotusdb"), 0)
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Nil(t, selector.Sync())
+}
+
+func TestMMapSelector_View(t *testing.T) {
+	absPath, err := filepath.Abs(filepath.Join("/tmp", "00000003.mmap"))
+	assert.Nil(t, err)
+	selector, err := NewMMapSelector(absPath, 64<<20)
+	assert.Nil(t, err)
+	defer func() {
+		_ = selector.Delete()
+	}()
+	_, err = selector.Write([]byte("lotusdb"), 10)
+	assert.Nil(t, err)
+
+	viewer, ok := selector.(Viewer)
+	assert.True(t, ok)
+	viewer.Pin()
+	buf, err := viewer.View(10, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("lotusdb"), buf)
+	_, err = viewer.View(-1, 7)
+	assert.Equal(t, io.EOF, err)
+
+	// growing the mapped region waits until the selector is unpinned.
+	grown := make(chan struct{})
+	go func() {
+		_, err := selector.Write([]byte("grow"), initialMmapSize*2)
+		assert.Nil(t, err)
+		close(grown)
+	}()
+	select {
+	case <-grown:
+		t.Fatal("mapped region is remapped while pinned")
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.Equal(t, []byte("lotusdb"), buf)
+	viewer.Unpin()
+	<-grown
+
+	buf, err = viewer.View(initialMmapSize*2, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(buf))
+	assert.Equal(t, []byte("grow"), buf[:4])
+}
@@ -0,0 +1,99 @@
+package ioselector
+
+import (
+	"io"
+	"sync"
+)
+
+// MemSelector represents keeping the file content in memory, there is no disk file at all.
+// The buffer grows on demand, so a big fsize won`t allocate memory up front.
+type MemSelector struct {
+	mu    sync.RWMutex
+	buf   []byte
+	fsize int64
+}
+
+// NewMemSelector create a new memory selector.
+func NewMemSelector(fsize int64) (IOSelector, error) {
+	if fsize <= 0 {
+		return nil, ErrInvalidFsize
+	}
+	return &MemSelector{fsize: fsize}, nil
+}
+
+// Write copy slice b into buffer at offset, the buffer will grow if necessary.
+func (ms *MemSelector) Write(b []byte, offset int64) (int, error) {
+	length := int64(len(b))
+	if length <= 0 {
+		return 0, nil
+	}
+	if offset < 0 || length+offset > ms.fsize {
+		return 0, io.EOF
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if end := offset + length; end > int64(len(ms.buf)) {
+		ms.grow(end)
+	}
+	return copy(ms.buf[offset:], b), nil
+}
+
+// Read copy data from buffer into slice b at offset.
+// The part which has never been written is filled with zero, just like a truncated file.
+func (ms *MemSelector) Read(b []byte, offset int64) (int, error) {
+	if offset < 0 || offset >= ms.fsize {
+		return 0, io.EOF
+	}
+	if offset+int64(len(b)) > ms.fsize {
+		return 0, io.EOF
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	var n int
+	if offset < int64(len(ms.buf)) {
+		n = copy(b, ms.buf[offset:])
+	}
+	for i := n; i < len(b); i++ {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+// Sync is a no-op, there is nothing to persist.
+func (ms *MemSelector) Sync() error {
+	return nil
+}
+
+// Close release the buffer.
+func (ms *MemSelector) Close() error {
+	ms.mu.Lock()
+	ms.buf = nil
+	ms.mu.Unlock()
+	return nil
+}
+
+// Delete release the buffer, same as Close.
+func (ms *MemSelector) Delete() error {
+	return ms.Close()
+}
+
+// grow the buffer to hold at least size bytes, but never exceed fsize.
+// must hold the lock before invoking.
+func (ms *MemSelector) grow(size int64) {
+	if size <= int64(cap(ms.buf)) {
+		ms.buf = ms.buf[:size]
+		return
+	}
+	newCap := int64(cap(ms.buf)) * 2
+	if newCap < size {
+		newCap = size
+	}
+	if newCap > ms.fsize {
+		newCap = ms.fsize
+	}
+	buf := make([]byte, size, newCap)
+	copy(buf, ms.buf)
+	ms.buf = buf
+}
@@ -1,16 +1,28 @@
 package ioselector
 
 import (
-	"github.com/herott-ai/godb/mmap"
 	"io"
 	"os"
+	"sync"
+
+	"github.com/herott-ai/godb/mmap"
 )
 
+// initialMmapSize the size a new file is mapped with at first, the mapped region grows on demand.
+const initialMmapSize = 1 << 20
+
 // MMapSelector represents using memory-mapped file I/O.
+// The file is not mapped with fsize up front, it starts small and grows by remapping as writes approach the end.
+// And the file will be truncated to the end of written data when closed.
 type MMapSelector struct {
-	fd     *os.File
-	buf    []byte // a buffer of mmap
-	bufLen int64
+	mu       sync.RWMutex
+	pins     sync.RWMutex // read-locked by Pin, remapping and unmapping wait until all pins are released.
+	fd       *os.File
+	buf      []byte // a buffer of mmap
+	bufLen   int64
+	fsize    int64 // the max size of file.
+	written  int64 // the end of written data.
+	readOnly bool
 }
 
 // NewMMapSelector create a new mmap selector.
@@ -18,52 +30,180 @@ func NewMMapSelector(fName string, fsize int64) (IOSelector, error) {
 	if fsize <= 0 {
 		return nil, ErrInvalidFsize
 	}
-	file, err := openFile(fName, fsize)
+	file, err := os.OpenFile(fName, os.O_CREATE|os.O_RDWR, FilePerm)
 	if err != nil {
 		return nil, err
 	}
-	buf, err := mmap.Mmap(file, true, fsize)
+	stat, err := file.Stat()
 	if err != nil {
 		return nil, err
 	}
 
-	return &MMapSelector{fd: file, buf: buf, bufLen: int64(len(buf))}, nil
+	// the data already in file must be mapped.
+	written := stat.Size()
+	if written > fsize {
+		written = fsize
+	}
+	size := int64(initialMmapSize)
+	if written > size {
+		size = written
+	}
+	if size > fsize {
+		size = fsize
+	}
+	if written < size {
+		if err := file.Truncate(size); err != nil {
+			return nil, err
+		}
+	}
+	buf, err := mmap.Mmap(file, true, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MMapSelector{fd: file, buf: buf, bufLen: int64(len(buf)), fsize: fsize, written: written}, nil
 }
 
-// Write copy slice b into mapped region(buf) at offset.
+// NewReadOnlyMMapSelector create a mmap selector which maps the existing content of file read-only.
+// The file won`t be created, truncated or grown, and Write always returns ErrReadOnly.
+func NewReadOnlyMMapSelector(fName string, fsize int64) (IOSelector, error) {
+	if fsize <= 0 {
+		return nil, ErrInvalidFsize
+	}
+	file, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// only the existing content can be mapped, accessing beyond the end of file will cause SIGBUS.
+	size := stat.Size()
+	if size > fsize {
+		size = fsize
+	}
+	var buf []byte
+	if size > 0 {
+		if buf, err = mmap.Mmap(file, false, size); err != nil {
+			return nil, err
+		}
+	}
+	return &MMapSelector{fd: file, buf: buf, bufLen: int64(len(buf)), fsize: fsize, written: size, readOnly: true}, nil
+}
+
+// Write copy slice b into mapped region(buf) at offset, the mapped region will grow if necessary.
 func (lm *MMapSelector) Write(b []byte, offset int64) (int, error) {
+	if lm.readOnly {
+		return 0, ErrReadOnly
+	}
 	length := int64(len(b))
 	if length <= 0 {
 		return 0, nil
 	}
-	if offset < 0 || length+offset > lm.bufLen {
+	if offset < 0 || length+offset > lm.fsize {
 		return 0, io.EOF
 	}
+
+	end := offset + length
+	lm.mu.Lock()
+	if end > lm.bufLen {
+		// the mapped region can`t be remapped while it is pinned.
+		lm.mu.Unlock()
+		lm.pins.Lock()
+		defer lm.pins.Unlock()
+		lm.mu.Lock()
+		if end > lm.bufLen {
+			if err := lm.grow(end); err != nil {
+				lm.mu.Unlock()
+				return 0, err
+			}
+		}
+	}
+	defer lm.mu.Unlock()
+	if end > lm.written {
+		lm.written = end
+	}
 	return copy(lm.buf[offset:], b), nil
 }
 
 // Read copy data from mapped region(buf) into slice b at offset.
+// The part beyond the mapped region is filled with zero, just like a file truncated to fsize.
 func (lm *MMapSelector) Read(b []byte, offset int64) (int, error) {
-	if offset < 0 || offset >= lm.bufLen {
+	if offset < 0 || offset >= lm.fsize {
 		return 0, io.EOF
 	}
-	if offset+int64(len(b)) >= lm.bufLen {
+	if offset+int64(len(b)) >= lm.fsize {
 		return 0, io.EOF
 	}
-	return copy(b, lm.buf[offset:]), nil
+
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	var n int
+	if offset < lm.bufLen {
+		n = copy(b, lm.buf[offset:])
+	}
+	for i := n; i < len(b); i++ {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+// Pin holds off remapping and unmapping of the mapped region until Unpin is called.
+func (lm *MMapSelector) Pin() {
+	lm.pins.RLock()
+}
+
+// Unpin release the pin acquired by Pin.
+func (lm *MMapSelector) Unpin() {
+	lm.pins.RUnlock()
+}
+
+// View returns at most n bytes of the mapped region at offset without copying.
+// The slice aliases the mapped region, so the selector must be pinned until the slice is no longer used.
+func (lm *MMapSelector) View(offset int64, n int) ([]byte, error) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	if offset < 0 || offset >= lm.bufLen {
+		return nil, io.EOF
+	}
+	end := offset + int64(n)
+	if end > lm.bufLen {
+		end = lm.bufLen
+	}
+	return lm.buf[offset:end:end], nil
 }
 
 // Sync synchronize the mapped buffer to the file's contents on disk.
 func (lm *MMapSelector) Sync() error {
+	if lm.readOnly {
+		return nil
+	}
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
 	return mmap.Msync(lm.buf)
 }
 
-// Close sync/unmap mapped buffer and close fd.
+// Close sync/unmap mapped buffer, truncate the file to the end of written data and close fd.
 func (lm *MMapSelector) Close() error {
+	lm.pins.Lock()
+	defer lm.pins.Unlock()
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if lm.readOnly {
+		if err := lm.unmap(); err != nil {
+			return err
+		}
+		return lm.fd.Close()
+	}
 	if err := mmap.Msync(lm.buf); err != nil {
 		return err
 	}
-	if err := mmap.Munmap(lm.buf); err != nil {
+	if err := lm.unmap(); err != nil {
+		return err
+	}
+	if err := lm.fd.Truncate(lm.written); err != nil {
 		return err
 	}
 	return lm.fd.Close()
@@ -71,11 +211,20 @@ func (lm *MMapSelector) Close() error {
 
 // Delete delete mapped buffer and remove file on disk.
 func (lm *MMapSelector) Delete() error {
-	if err := mmap.Munmap(lm.buf); err != nil {
+	lm.pins.Lock()
+	defer lm.pins.Unlock()
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if err := lm.unmap(); err != nil {
 		return err
 	}
-	lm.buf = nil
 
+	if lm.readOnly {
+		if err := lm.fd.Close(); err != nil {
+			return err
+		}
+		return os.Remove(lm.fd.Name())
+	}
 	if err := lm.fd.Truncate(0); err != nil {
 		return err
 	}
@@ -84,3 +233,35 @@ func (lm *MMapSelector) Delete() error {
 	}
 	return os.Remove(lm.fd.Name())
 }
+
+// must hold the lock before invoking.
+func (lm *MMapSelector) unmap() error {
+	if lm.buf == nil {
+		return nil
+	}
+	if err := mmap.Munmap(lm.buf); err != nil {
+		return err
+	}
+	lm.buf = nil
+	return nil
+}
+
+// grow the mapped region to hold at least size bytes, doubling every time but never exceed fsize.
+// must hold the lock before invoking.
+func (lm *MMapSelector) grow(size int64) error {
+	newLen := lm.bufLen * 2
+	if newLen < size {
+		pageSize := int64(os.Getpagesize())
+		newLen = (size + pageSize - 1) / pageSize * pageSize
+	}
+	if newLen > lm.fsize {
+		newLen = lm.fsize
+	}
+	buf, err := mmap.Mremap(lm.fd, lm.buf, newLen)
+	if err != nil {
+		return err
+	}
+	lm.buf = buf
+	lm.bufLen = int64(len(buf))
+	return nil
+}
@@ -0,0 +1,258 @@
+package godb
+
+import (
+	"time"
+
+	"github.com/herott-ai/godb/ds/bptree"
+)
+
+// All data types share one keyspace like Redis, a key holds a value of only one data type at a time.
+// Operations on a key holding a value of another data type return ErrWrongType,
+// except Set and its variants, which overwrite the key whatever it holds.
+// Keys of all data types can have expiration time, see Expire, and fields of Hash can expire by themselves, see HExpire.
+
+// Type returns the data type of the value stored at key.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) Type(key []byte) (DataType, error) {
+	db.strIndex.locks.rLock(key)
+	defer db.strIndex.locks.rUnlock(key)
+	return db.typeOf(key)
+}
+
+// Exists returns the number of the given keys that exist, a key is counted as many times as it is given.
+func (db *GoDb) Exists(keys ...[]byte) int {
+	var count int
+	for _, key := range keys {
+		if _, err := db.Type(key); err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Del removes the given keys whatever data types they hold, and returns the number of keys that were removed.
+func (db *GoDb) Del(keys ...[]byte) (int, error) {
+	unlock := db.strIndex.locks.lockKeys(keys, true)
+	defer unlock()
+
+	var count int
+	for _, key := range keys {
+		var deleted bool
+		for dataType := String; dataType < logFileTypeNum; dataType++ {
+			if !db.exists(dataType, key) {
+				continue
+			}
+			if err := db.deleteType(dataType, key); err != nil {
+				return count, err
+			}
+			deleted = true
+		}
+		if deleted {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Expire set the expiration time for the given key, whatever data type it holds.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) Expire(key []byte, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
+	}
+	return db.ExpireAt(key, time.Now().Add(duration))
+}
+
+// PExpire is the same as Expire, but the duration is given in milliseconds.
+func (db *GoDb) PExpire(key []byte, milliseconds int64) error {
+	return db.Expire(key, time.Duration(milliseconds)*time.Millisecond)
+}
+
+// ExpireAt set the key to expire at the given time, a time in the past expires the key immediately.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) ExpireAt(key []byte, t time.Time) error {
+	expiredAt := t.UnixMilli()
+	if expiredAt <= 0 {
+		// 0 means never expires, keep the key expired.
+		expiredAt = 1
+	}
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
+	return db.expireAt(key, expiredAt)
+}
+
+// ExpireTime get the time at which the given key will expire, it is the zero time if the key never expires.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) ExpireTime(key []byte) (time.Time, error) {
+	expiredAt, err := db.expireTimeOf(key)
+	if err != nil || expiredAt == 0 {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(expiredAt), nil
+}
+
+// TTL get ttl(time to live) in seconds for the given key, it is 0 if the key never expires.
+// The ttl is rounded to the nearest second, use PTTL for a more precise one.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) TTL(key []byte) (int64, error) {
+	ttl, err := db.PTTL(key)
+	if err != nil || ttl == 0 {
+		return 0, err
+	}
+	return (ttl + 500) / 1000, nil
+}
+
+// PTTL get ttl(time to live) in milliseconds for the given key, it is 0 if the key never expires.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) PTTL(key []byte) (int64, error) {
+	expiredAt, err := db.expireTimeOf(key)
+	if err != nil || expiredAt == 0 {
+		return 0, err
+	}
+	ttl := expiredAt - time.Now().UnixMilli()
+	if ttl <= 0 {
+		// expired just now, but still not reported as never expiring.
+		ttl = 1
+	}
+	return ttl, nil
+}
+
+// Persist remove the expiration time for the given key.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *GoDb) Persist(key []byte) error {
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
+	return db.expireAt(key, 0)
+}
+
+// typeOf is the same as Type, but the key lock must be held.
+func (db *GoDb) typeOf(key []byte) (DataType, error) {
+	for dataType := String; dataType < logFileTypeNum; dataType++ {
+		if db.exists(dataType, key) {
+			return dataType, nil
+		}
+	}
+	return 0, ErrKeyNotFound
+}
+
+// expireTimeOf returns the expiration time of key in unix milliseconds, 0 if it never expires.
+func (db *GoDb) expireTimeOf(key []byte) (int64, error) {
+	db.strIndex.locks.rLock(key)
+	defer db.strIndex.locks.rUnlock(key)
+
+	dataType, err := db.typeOf(key)
+	if err != nil {
+		return 0, err
+	}
+	if dataType != String {
+		return db.collectionIndexOf(dataType).expiredAt(key), nil
+	}
+	var expiredAt int64
+	if node, _ := db.strIndex.Get(key).(*indexNode); node != nil {
+		expiredAt = node.expiredAt
+	}
+	return expiredAt, db.indexErr(db.strIndex)
+}
+
+// expireAt set the expiration time of key, 0 means it never expires. The key lock must be held.
+func (db *GoDb) expireAt(key []byte, expiredAt int64) error {
+	dataType, err := db.typeOf(key)
+	if err != nil {
+		return err
+	}
+	if dataType != String {
+		if db.collectionIndexOf(dataType).expiredAt(key) == expiredAt {
+			return nil
+		}
+		return db.expireInternal(dataType, key, expiredAt)
+	}
+	val, err := db.getVal(db.strIndex, key, String)
+	if err != nil {
+		return err
+	}
+	return db.setInternal(key, val, expiredAt)
+}
+
+// exists returns whether key holds a value of the data type, the key lock must be held.
+func (db *GoDb) exists(dataType DataType, key []byte) bool {
+	if dataType == String {
+		node, _ := db.strIndex.Get(key).(*indexNode)
+		return node != nil && (node.expiredAt == 0 || node.expiredAt > time.Now().UnixMilli())
+	}
+	tree := db.collectionIndexOf(dataType).tree(key)
+	if tree == nil {
+		return false
+	}
+	switch dataType {
+	case List:
+		// the meta of an empty list may be left in its tree.
+		return tree.Size() > 1
+	case Hash:
+		// all fields may have expired.
+		return hashLen(tree, 1) > 0
+	}
+	return tree.Size() > 0
+}
+
+// checkType returns ErrWrongType if key holds a value of a data type other than dataType, the key lock must be held.
+func (db *GoDb) checkType(key []byte, dataType DataType) error {
+	if db.exists(dataType, key) {
+		return nil
+	}
+	for typ := String; typ < logFileTypeNum; typ++ {
+		if typ != dataType && db.exists(typ, key) {
+			return ErrWrongType
+		}
+	}
+	return nil
+}
+
+// checkWrite prepares key to be written as a collection of the data type, the key lock must be held.
+// It returns ErrWrongType if key holds a value of another data type.
+// A collection that is expired, or is empty but has expiration time, is dropped, so a new one never inherits its expiration time.
+func (db *GoDb) checkWrite(key []byte, dataType DataType) error {
+	if err := db.checkType(key, dataType); err != nil {
+		return err
+	}
+	if !db.exists(dataType, key) && db.collectionIndexOf(dataType).expiredAt(key) != 0 {
+		return db.dropInternal(dataType, key)
+	}
+	return nil
+}
+
+// keyNotFound returns the error for a key which does not hold a value of the data type,
+// it is ErrWrongType if the key holds a value of another data type, otherwise ErrKeyNotFound.
+// The key lock must be held.
+func (db *GoDb) keyNotFound(key []byte, dataType DataType) error {
+	if err := db.checkType(key, dataType); err != nil {
+		return err
+	}
+	return ErrKeyNotFound
+}
+
+// deleteType removes the value of the data type stored at key, the key lock must be held.
+func (db *GoDb) deleteType(dataType DataType, key []byte) error {
+	if dataType == String {
+		return db.deleteInternal(key)
+	}
+	return db.dropInternal(dataType, key)
+}
+
+// dropOthers removes the collections stored at key, so that it can be overwritten by a String value.
+// It is called before the String is written, so the key never holds both of them, even if db crashes in between.
+// The key lock must be held.
+func (db *GoDb) dropOthers(key []byte) error {
+	// the String can't be written, keep the collections.
+	if len(key) > bptree.MaxKeySize && db.strIndexOnDisk() {
+		return ErrKeyTooLarge
+	}
+	for dataType := List; dataType < logFileTypeNum; dataType++ {
+		if !db.exists(dataType, key) {
+			continue
+		}
+		if err := db.dropInternal(dataType, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
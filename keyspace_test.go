@@ -0,0 +1,425 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/herott-ai/godb/logfile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoDb_Type(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("list"), []byte("v")))
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f"), []byte("v")))
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("m")))
+	assert.Nil(t, db.ZAdd([]byte("zset"), 1, []byte("m")))
+
+	tests := []struct {
+		key      string
+		dataType DataType
+		wantErr  error
+	}{
+		{"str", String, nil},
+		{"list", List, nil},
+		{"hash", Hash, nil},
+		{"set", Set, nil},
+		{"zset", ZSet, nil},
+		{"not-exist", 0, ErrKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			dataType, err := db.Type([]byte(tt.key))
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.dataType, dataType)
+		})
+	}
+
+	// empty collections do not exist.
+	_, err = db.LPop([]byte("list"))
+	assert.Nil(t, err)
+	_, err = db.HDel([]byte("hash"), []byte("f"))
+	assert.Nil(t, err)
+	for _, key := range []string{"list", "hash"} {
+		_, err = db.Type([]byte(key))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+}
+
+func TestGoDb_Exists(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Set([]byte("a"), []byte("v")))
+	assert.Nil(t, db.SAdd([]byte("b"), []byte("m")))
+	assert.Nil(t, db.SetEX([]byte("c"), []byte("v"), -1))
+
+	assert.Equal(t, 0, db.Exists())
+	assert.Equal(t, 2, db.Exists([]byte("a"), []byte("b"), []byte("c"), []byte("d")))
+	assert.Equal(t, 2, db.Exists([]byte("a"), []byte("a")))
+}
+
+func TestGoDb_Del(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	for name, ops := range testCollectionOps {
+		assert.Nil(t, ops.add(db, []byte(name), 0))
+	}
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+
+	n, err := db.Del([]byte("str"), []byte("hash"), []byte("list"), []byte("not-exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 2, db.Exists([]byte("set"), []byte("zset")))
+	n, err = db.Del([]byte("set"), []byte("zset"), []byte("set"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	// deleted keys stay deleted after reopening.
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for _, key := range []string{"str", "hash", "list", "set", "zset"} {
+		assert.Equal(t, 0, db.Exists([]byte(key)))
+	}
+}
+
+func TestGoDb_WrongType(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	str, hash := []byte("str"), []byte("hash")
+	assert.Nil(t, db.Set(str, []byte("10")))
+	assert.Nil(t, db.HSet(hash, []byte("f"), []byte("v")))
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"Get", func() error { _, err := db.Get(hash); return err }},
+		{"Append", func() error { return db.Append(hash, []byte("v")) }},
+		{"Incr", func() error { _, err := db.Incr(hash); return err }},
+		{"GetDel", func() error { _, err := db.GetDel(hash); return err }},
+		{"HSet", func() error { return db.HSet(str, []byte("f"), []byte("v")) }},
+		{"HGet", func() error { _, err := db.HGet(str, []byte("f")); return err }},
+		{"HGetAll", func() error { _, err := db.HGetAll(str); return err }},
+		{"HIncrBy", func() error { _, err := db.HIncrBy(str, []byte("f"), 1); return err }},
+		{"LPush", func() error { return db.LPush(str, []byte("v")) }},
+		{"RPushX", func() error { return db.RPushX(str, []byte("v")) }},
+		{"LPop", func() error { _, err := db.LPop(hash); return err }},
+		{"LRange", func() error { _, err := db.LRange(hash, 0, -1); return err }},
+		{"LMove", func() error { _, err := db.LMove(hash, str, true, true); return err }},
+		{"SAdd", func() error { return db.SAdd(str, []byte("m")) }},
+		{"SMembers", func() error { _, err := db.SMembers(hash); return err }},
+		{"SUnion", func() error { _, err := db.SUnion(str, hash); return err }},
+		{"ZAdd", func() error { return db.ZAdd(hash, 1, []byte("m")) }},
+		{"ZRange", func() error { _, err := db.ZRange(str, 0, -1); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, ErrWrongType, tt.call())
+		})
+	}
+
+	// nothing is changed by the failed operations.
+	dataType, err := db.Type(str)
+	assert.Nil(t, err)
+	assert.Equal(t, String, dataType)
+	v, err := db.Get(str)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("10"), v)
+	assert.Equal(t, 1, db.HLen(hash))
+	// keys that do not exist are not affected.
+	_, err = db.Get([]byte("not-exist"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.HSet([]byte("new"), []byte("f"), []byte("v")))
+}
+
+func TestGoDb_SetOverwritesType(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := []byte("key")
+	assert.Nil(t, db.HSet(key, []byte("f"), []byte("v")))
+
+	// SetNX and MSetNX do nothing if the key holds any data type.
+	assert.Nil(t, db.SetNX(key, []byte("v")))
+	assert.Nil(t, db.MSetNX([]byte("other"), []byte("v"), key, []byte("v")))
+	assert.Equal(t, 0, db.Exists([]byte("other")))
+	dataType, err := db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, Hash, dataType)
+
+	// Set overwrites the hash.
+	assert.Nil(t, db.Set(key, []byte("v")))
+	dataType, err = db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, String, dataType)
+	assert.Equal(t, 0, db.HLen(key))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	dataType, err = db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, String, dataType)
+	assert.Equal(t, 0, db.HLen(key))
+
+	// the hash is kept if the value is too large, and dropped before the String is written otherwise,
+	// so the key never holds both of them even if writing the String fails.
+	other := []byte("other")
+	assert.Nil(t, db.HSet(other, []byte("f"), []byte("v")))
+	err = db.SetReader(other, strings.NewReader(""), opts.LogFileSizeThreshold)
+	assert.Equal(t, ErrValueTooLarge, err)
+	assert.Equal(t, 1, db.HLen(other))
+	err = db.SetReader(other, strings.NewReader("short"), 100)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, db.Exists(other))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.Exists(other))
+}
+
+func TestGoDb_ExpireCollections(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	reopen := func() {
+		assert.Nil(t, db.Close())
+		db, err = Open(opts)
+		assert.Nil(t, err)
+	}
+	for name, ops := range testCollectionOps {
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, ops.add(db, []byte(name), i))
+		}
+		assert.Nil(t, db.Expire([]byte(name), time.Second*100))
+		assert.Nil(t, ops.add(db, []byte("tmp-"+name), 0))
+	}
+	assert.Equal(t, ErrKeyNotFound, db.Expire([]byte("not-exist"), time.Second))
+
+	// the expiration time is kept after reopening, and is not changed by writes.
+	reopen()
+	for name, ops := range testCollectionOps {
+		assert.Nil(t, ops.add(db, []byte(name), 10))
+		ttl, err := db.TTL([]byte(name))
+		assert.Nil(t, err)
+		assert.True(t, ttl > 90 && ttl <= 100, name)
+		assert.Nil(t, db.Persist([]byte(name)))
+		ttl, err = db.TTL([]byte(name))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), ttl, name)
+		assert.Nil(t, db.Expire([]byte(name), time.Second))
+	}
+
+	time.Sleep(time.Second)
+	for name, ops := range testCollectionOps {
+		assert.Equal(t, 0, ops.size(db, []byte(name)), name)
+		assert.Equal(t, 0, db.Exists([]byte(name)), name)
+		_, err = db.TTL([]byte(name))
+		assert.Equal(t, ErrKeyNotFound, err, name)
+		// other keys are not affected.
+		assert.Equal(t, 1, ops.size(db, []byte("tmp-"+name)), name)
+	}
+	_, err = db.HGet([]byte("hash"), GetKey(0))
+	assert.Nil(t, err)
+	_, err = db.LRange([]byte("list"), 0, -1)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// expired collections stay expired after reopening.
+	reopen()
+	for name, ops := range testCollectionOps {
+		assert.Equal(t, 0, ops.size(db, []byte(name)), name)
+		// a new collection starts from empty, and never expires.
+		assert.Nil(t, ops.add(db, []byte(name), 0))
+		assert.Equal(t, 1, ops.size(db, []byte(name)), name)
+		ttl, err := db.TTL([]byte(name))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), ttl, name)
+	}
+	reopen()
+	for name, ops := range testCollectionOps {
+		assert.Equal(t, 1, ops.size(db, []byte(name)), name)
+	}
+}
+
+func TestGoDb_ExpireEmptyCollection(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := []byte("list")
+	assert.Nil(t, db.RPush(key, []byte("a")))
+	assert.Nil(t, db.Expire(key, time.Second*100))
+	_, err = db.LPop(key)
+	assert.Nil(t, err)
+
+	// a list pushed again after it was emptied does not inherit the expiration time.
+	assert.Nil(t, db.RPush(key, []byte("b")))
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), ttl)
+}
+
+func TestGoDb_PTTL(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// expiration time shorter than a second is not rounded.
+	key := []byte("str")
+	assert.Nil(t, db.SetEX(key, []byte("v"), time.Millisecond*1200))
+	ttl, err := db.PTTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 1000 && ttl <= 1200, ttl)
+	ttl, err = db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ttl)
+
+	assert.Nil(t, db.RPush([]byte("list"), []byte("v")))
+	assert.Nil(t, db.PExpire([]byte("list"), 300))
+	ttl, err = db.PTTL([]byte("list"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= 300, ttl)
+
+	assert.Nil(t, db.Set([]byte("persist"), []byte("v")))
+	ttl, err = db.PTTL([]byte("persist"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), ttl)
+	_, err = db.PTTL([]byte("not-exist"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	time.Sleep(time.Millisecond * 400)
+	assert.Equal(t, 1, db.Exists(key))
+	assert.Equal(t, 0, db.Exists([]byte("list")))
+	time.Sleep(time.Millisecond * 800)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestGoDb_ExpireAt(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	for name, ops := range testCollectionOps {
+		assert.Nil(t, ops.add(db, []byte(name), 0))
+		assert.Nil(t, db.ExpireAt([]byte(name), at))
+	}
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	assert.Nil(t, db.ExpireAt([]byte("str"), at))
+	assert.Equal(t, ErrKeyNotFound, db.ExpireAt([]byte("not-exist"), at))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for _, key := range []string{"str", "hash", "list", "set", "zset"} {
+		expireTime, err := db.ExpireTime([]byte(key))
+		assert.Nil(t, err)
+		assert.True(t, at.Equal(expireTime), key)
+	}
+
+	// keys expire at once with a time in the past.
+	for _, key := range []string{"str", "hash"} {
+		assert.Nil(t, db.ExpireAt([]byte(key), time.Unix(0, 0)))
+		assert.Equal(t, 0, db.Exists([]byte(key)), key)
+	}
+	assert.Nil(t, db.Persist([]byte("list")))
+	expireTime, err := db.ExpireTime([]byte("list"))
+	assert.Nil(t, err)
+	assert.True(t, expireTime.IsZero())
+}
+
+func TestOpen_LegacyExpiration(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-legacy")
+	assert.Nil(t, os.MkdirAll(path, os.ModePerm))
+	defer os.RemoveAll(path)
+
+	// a log file written when expiration time was in seconds, which has no record in manifest.
+	lf, err := logfile.OpenLogFile(path, 0, 1<<20, logfile.Strs, logfile.FileIO)
+	assert.Nil(t, err)
+	now := time.Now().Unix()
+	entries := []*logfile.LogEntry{
+		{Key: []byte("a"), Value: []byte("v"), ExpiredAt: now + 100},
+		{Key: []byte("b"), Value: []byte("v"), ExpiredAt: now - 10},
+		{Key: []byte("c"), Value: []byte("v")},
+	}
+	for _, e := range entries {
+		buf, _ := logfile.EncodeEntry(e)
+		assert.Nil(t, lf.Write(buf))
+	}
+	assert.Nil(t, lf.Close())
+
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	check := func() {
+		ttl, err := db.TTL([]byte("a"))
+		assert.Nil(t, err)
+		assert.True(t, ttl > 90 && ttl <= 100, ttl)
+		_, err = db.Get([]byte("b"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		ttl, err = db.TTL([]byte("c"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), ttl)
+	}
+	check()
+	// new entries are in milliseconds, and old ones are still read in seconds.
+	assert.Nil(t, db.SetEX([]byte("d"), []byte("v"), time.Second*100))
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check()
+	ttl, err := db.TTL([]byte("d"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 90 && ttl <= 100, ttl)
+	v, err := db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), v)
+}
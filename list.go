@@ -3,7 +3,7 @@ package godb
 import (
 	"bytes"
 	"encoding/binary"
-	"github.com/herott-ai/godb/ds/art"
+	"github.com/herott-ai/godb/ds/index"
 	"github.com/herott-ai/godb/logfile"
 	"github.com/herott-ai/godb/logger"
 	"math"
@@ -12,11 +12,11 @@ import (
 // LPush insert all the specified values at the head of the list stored at key.
 // If key does not exist, it is created as empty list before performing the push operations.
 func (db *GoDb) LPush(key []byte, values ...[]byte) error {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	db.listIndex.locks.lock(key)
+	defer db.listIndex.locks.unlock(key)
 
-	if db.listIndex.trees[string(key)] == nil {
-		db.listIndex.trees[string(key)] = art.NewART()
+	if err := db.checkWrite(key, List); err != nil {
+		return err
 	}
 	for _, val := range values {
 		if err := db.pushInternal(key, val, true); err != nil {
@@ -30,11 +30,11 @@ func (db *GoDb) LPush(key []byte, values ...[]byte) error {
 // only if key already exists and holds a list.
 // In contrary to LPUSH, no operation will be performed when key does not yet exist.
 func (db *GoDb) LPushX(key []byte, values ...[]byte) error {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	db.listIndex.locks.lock(key)
+	defer db.listIndex.locks.unlock(key)
 
-	if db.listIndex.trees[string(key)] == nil {
-		return ErrKeyNotFound
+	if db.listIndex.tree(key) == nil {
+		return db.keyNotFound(key, List)
 	}
 
 	for _, val := range values {
@@ -48,11 +48,11 @@ func (db *GoDb) LPushX(key []byte, values ...[]byte) error {
 // RPush insert all the specified values at the tail of the list stored at key.
 // If key does not exist, it is created as empty list before performing the push operation.
 func (db *GoDb) RPush(key []byte, values ...[]byte) error {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	db.listIndex.locks.lock(key)
+	defer db.listIndex.locks.unlock(key)
 
-	if db.listIndex.trees[string(key)] == nil {
-		db.listIndex.trees[string(key)] = art.NewART()
+	if err := db.checkWrite(key, List); err != nil {
+		return err
 	}
 	for _, val := range values {
 		if err := db.pushInternal(key, val, false); err != nil {
@@ -66,11 +66,11 @@ func (db *GoDb) RPush(key []byte, values ...[]byte) error {
 // only if key already exists and holds a list.
 // In contrary to RPUSH, no operation will be performed when key does not yet exist.
 func (db *GoDb) RPushX(key []byte, values ...[]byte) error {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	db.listIndex.locks.lock(key)
+	defer db.listIndex.locks.unlock(key)
 
-	if db.listIndex.trees[string(key)] == nil {
-		return ErrKeyNotFound
+	if db.listIndex.tree(key) == nil {
+		return db.keyNotFound(key, List)
 	}
 	for _, val := range values {
 		if err := db.pushInternal(key, val, false); err != nil {
@@ -82,24 +82,27 @@ func (db *GoDb) RPushX(key []byte, values ...[]byte) error {
 
 // LPop removes and returns the first elements of the list stored at key.
 func (db *GoDb) LPop(key []byte) ([]byte, error) {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	db.listIndex.locks.lock(key)
+	defer db.listIndex.locks.unlock(key)
 	return db.popInternal(key, true)
 }
 
 // RPop Removes and returns the last elements of the list stored at key.
 func (db *GoDb) RPop(key []byte) ([]byte, error) {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	db.listIndex.locks.lock(key)
+	defer db.listIndex.locks.unlock(key)
 	return db.popInternal(key, false)
 }
 
 // LMove atomically returns and removes the first/last element of the list stored at source,
 // and pushes the element at the first/last element of the list stored at destination.
 func (db *GoDb) LMove(srcKey, dstKey []byte, srcIsLeft, dstIsLeft bool) ([]byte, error) {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	unlock := db.listIndex.locks.lockKeys([][]byte{srcKey, dstKey}, true)
+	defer unlock()
 
+	if err := db.checkWrite(dstKey, List); err != nil {
+		return nil, err
+	}
 	popValue, err := db.popInternal(srcKey, srcIsLeft)
 	if err != nil {
 		return nil, err
@@ -108,9 +111,6 @@ func (db *GoDb) LMove(srcKey, dstKey []byte, srcIsLeft, dstIsLeft bool) ([]byte,
 		return nil, nil
 	}
 
-	if db.listIndex.trees[string(dstKey)] == nil {
-		db.listIndex.trees[string(dstKey)] = art.NewART()
-	}
 	if err = db.pushInternal(dstKey, popValue, dstIsLeft); err != nil {
 		return nil, err
 	}
@@ -118,16 +118,22 @@ func (db *GoDb) LMove(srcKey, dstKey []byte, srcIsLeft, dstIsLeft bool) ([]byte,
 	return popValue, nil
 }
 
+// LClear deletes the list stored at key with all its elements.
+// It writes only one record no matter how many elements the list has, the elements are reclaimed by log file gc later.
+func (db *GoDb) LClear(key []byte) error {
+	return db.dropCollection(List, key)
+}
+
 // LLen returns the length of the list stored at key.
 // If key does not exist, it is interpreted as an empty list and 0 is returned.
 func (db *GoDb) LLen(key []byte) int {
-	db.listIndex.mu.RLock()
-	defer db.listIndex.mu.RUnlock()
+	db.listIndex.locks.rLock(key)
+	defer db.listIndex.locks.rUnlock(key)
 
-	if db.listIndex.trees[string(key)] == nil {
+	idxTree := db.listIndex.tree(key)
+	if idxTree == nil {
 		return 0
 	}
-	idxTree := db.listIndex.trees[string(key)]
 	headSeq, tailSeq, err := db.listMeta(idxTree, key)
 	if err != nil {
 		return 0
@@ -138,13 +144,13 @@ func (db *GoDb) LLen(key []byte) int {
 // LIndex returns the element at index in the list stored at key.
 // If index is out of range, it returns nil.
 func (db *GoDb) LIndex(key []byte, index int) ([]byte, error) {
-	db.listIndex.mu.RLock()
-	defer db.listIndex.mu.RUnlock()
+	db.listIndex.locks.rLock(key)
+	defer db.listIndex.locks.rUnlock(key)
 
-	if db.listIndex.trees[string(key)] == nil {
-		return nil, nil
+	idxTree := db.listIndex.tree(key)
+	if idxTree == nil {
+		return nil, db.checkType(key, List)
 	}
-	idxTree := db.listIndex.trees[string(key)]
 	headSeq, tailSeq, err := db.listMeta(idxTree, key)
 	if err != nil {
 		return nil, err
@@ -169,13 +175,13 @@ func (db *GoDb) LIndex(key []byte, index int) ([]byte, error) {
 
 // LSet Sets the list element at index to element.
 func (db *GoDb) LSet(key []byte, index int, value []byte) error {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	db.listIndex.locks.lock(key)
+	defer db.listIndex.locks.unlock(key)
 
-	if db.listIndex.trees[string(key)] == nil {
-		return ErrKeyNotFound
+	idxTree := db.listIndex.tree(key)
+	if idxTree == nil {
+		return db.keyNotFound(key, List)
 	}
-	idxTree := db.listIndex.trees[string(key)]
 	headSeq, tailSeq, err := db.listMeta(idxTree, key)
 	if err != nil {
 		return err
@@ -192,7 +198,7 @@ func (db *GoDb) LSet(key []byte, index int, value []byte) error {
 
 	encKey := db.encodeListKey(key, seq)
 	ent := &logfile.LogEntry{Key: encKey, Value: value}
-	valuePos, err := db.writeLogEntry(ent, List)
+	valuePos, err := db.writeMember(List, key, ent)
 	if err != nil {
 		return err
 	}
@@ -210,14 +216,14 @@ func (db *GoDb) LSet(key []byte, index int, value []byte) error {
 // If start is larger than the end of the list, an empty list is returned.
 // If stop is larger than the actual end of the list, Redis will treat it like the last element of the list.
 func (db *GoDb) LRange(key []byte, start, end int) (values [][]byte, err error) {
-	db.listIndex.mu.RLock()
-	defer db.listIndex.mu.RUnlock()
+	db.listIndex.locks.rLock(key)
+	defer db.listIndex.locks.rUnlock(key)
 
-	if db.listIndex.trees[string(key)] == nil {
-		return nil, ErrKeyNotFound
+	idxTree := db.listIndex.tree(key)
+	if idxTree == nil {
+		return nil, db.keyNotFound(key, List)
 	}
 
-	idxTree := db.listIndex.trees[string(key)]
 	// get List DataType meta info
 	headSeq, tailSeq, err := db.listMeta(idxTree, key)
 	if err != nil {
@@ -276,7 +282,7 @@ func (db *GoDb) decodeListKey(buf []byte) ([]byte, uint32) {
 	return key, seq
 }
 
-func (db *GoDb) listMeta(idxTree *art.AdaptiveRadixTree, key []byte) (uint32, uint32, error) {
+func (db *GoDb) listMeta(idxTree *index.Tree, key []byte) (uint32, uint32, error) {
 	val, err := db.getVal(idxTree, key, List) //get value from file of corresponding List(type) tt  
 	if err != nil && err != ErrKeyNotFound {
 		return 0, 0, err
@@ -291,12 +297,12 @@ func (db *GoDb) listMeta(idxTree *art.AdaptiveRadixTree, key []byte) (uint32, ui
 	return headSeq, tailSeq, nil
 }
 
-func (db *GoDb) saveListMeta(idxTree *art.AdaptiveRadixTree, key []byte, headSeq, tailSeq uint32) error {
+func (db *GoDb) saveListMeta(idxTree *index.Tree, key []byte, headSeq, tailSeq uint32) error {
 	buf := make([]byte, 8)
 	binary.LittleEndian.PutUint32(buf[:4], headSeq)
 	binary.LittleEndian.PutUint32(buf[4:8], tailSeq)
 	ent := &logfile.LogEntry{Key: key, Value: buf, Type: logfile.TypeListMeta}
-	pos, err := db.writeLogEntry(ent, List)
+	pos, err := db.writeMember(List, key, ent)
 	if err != nil {
 		return err
 	}
@@ -305,7 +311,7 @@ func (db *GoDb) saveListMeta(idxTree *art.AdaptiveRadixTree, key []byte, headSeq
 }
 
 func (db *GoDb) pushInternal(key []byte, val []byte, isLeft bool) error {
-	idxTree := db.listIndex.trees[string(key)]  // *art.AdaptiveRadixTree tt
+	idxTree := db.listIndex.treeOrCreate(key)
 	headSeq, tailSeq, err := db.listMeta(idxTree, key)
 	if err != nil {
 		return err
@@ -316,7 +322,7 @@ func (db *GoDb) pushInternal(key []byte, val []byte, isLeft bool) error {
 	}
 	encKey := db.encodeListKey(key, seq)
 	ent := &logfile.LogEntry{Key: encKey, Value: val}
-	valuePos, err := db.writeLogEntry(ent, List)
+	valuePos, err := db.writeMember(List, key, ent)
 	if err != nil {
 		return err
 	}
@@ -335,10 +341,10 @@ func (db *GoDb) pushInternal(key []byte, val []byte, isLeft bool) error {
 }
 
 func (db *GoDb) popInternal(key []byte, isLeft bool) ([]byte, error) {
-	if db.listIndex.trees[string(key)] == nil {
-		return nil, nil
+	idxTree := db.listIndex.tree(key)
+	if idxTree == nil {
+		return nil, db.checkType(key, List)
 	}
-	idxTree := db.listIndex.trees[string(key)]
 	headSeq, tailSeq, err := db.listMeta(idxTree, key)
 	if err != nil {
 		return nil, err
@@ -358,7 +364,7 @@ func (db *GoDb) popInternal(key []byte, isLeft bool) ([]byte, error) {
 	}
 
 	ent := &logfile.LogEntry{Key: encKey, Type: logfile.TypeDelete}
-	pos, err := db.writeLogEntry(ent, List)
+	pos, err := db.writeMember(List, key, ent)
 	if err != nil {
 		return nil, err
 	}
@@ -373,8 +379,7 @@ func (db *GoDb) popInternal(key []byte, isLeft bool) ([]byte, error) {
 	}
 	// send discard
 	db.sendDiscard(oldVal, updated, List)
-	_, entrySize := logfile.EncodeEntry(ent)
-	node := &indexNode{fid: pos.fid, entrySize: entrySize}
+	node := &indexNode{fid: pos.fid, entrySize: pos.entrySize}
 	select {
 	case db.discards[List].valChan <- node:
 	default:
@@ -387,7 +392,7 @@ func (db *GoDb) popInternal(key []byte, isLeft bool) ([]byte, error) {
 			tailSeq = initialListSeq + 1
 			_ = db.saveListMeta(idxTree, key, headSeq, tailSeq)
 		}
-		delete(db.listIndex.trees, string(key))
+		db.listIndex.removeTree(key)
 	}
 	return val, nil
 }
@@ -412,16 +417,16 @@ func (db *GoDb) listSequence(headSeq, tailSeq uint32, index int) (uint32, error)
 // count = 0: Remove all elements equal to element.
 // Note that this method will rewrite the values, so it maybe very slow.
 func (db *GoDb) LRem(key []byte, count int, value []byte) (int, error) {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	db.listIndex.locks.lock(key)
+	defer db.listIndex.locks.unlock(key)
 
 	if count == 0 {
 		count = math.MaxUint32
 	}
 	var discardCount int
-	idxTree := db.listIndex.trees[string(key)]
+	idxTree := db.listIndex.tree(key)
 	if idxTree == nil {
-		return discardCount, nil
+		return discardCount, db.checkType(key, List)
 	}
 	// get List DataType meta info
 	headSeq, tailSeq, err := db.listMeta(idxTree, key)
@@ -449,9 +454,6 @@ func (db *GoDb) LRem(key []byte, count int, value []byte) (int, error) {
 	}
 
 	addReserveData := func(key []byte, value []byte, isLeft bool) error {
-		if db.listIndex.trees[string(key)] == nil {
-			db.listIndex.trees[string(key)] = art.NewART()
-		}
 		if err := db.pushInternal(key, value, isLeft); err != nil {
 			return err
 		}
@@ -0,0 +1,327 @@
+package godb
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/herott-ai/godb/ds/index"
+	"github.com/herott-ai/godb/util"
+)
+
+// lockShards number of key locks, it must be a power of 2.
+const lockShards = 256
+
+// keyLocks rw locks sharded by the hash of key, operations on the same key always use the same lock.
+// Keys in different shards can be written concurrently. All data types share the same key locks.
+type keyLocks struct {
+	shards [lockShards]sync.RWMutex
+}
+
+func (l *keyLocks) shard(key []byte) int {
+	return int(util.MemHash(key) & (lockShards - 1))
+}
+
+func (l *keyLocks) lock(key []byte) {
+	l.shards[l.shard(key)].Lock()
+}
+
+func (l *keyLocks) unlock(key []byte) {
+	l.shards[l.shard(key)].Unlock()
+}
+
+func (l *keyLocks) rLock(key []byte) {
+	l.shards[l.shard(key)].RLock()
+}
+
+func (l *keyLocks) rUnlock(key []byte) {
+	l.shards[l.shard(key)].RUnlock()
+}
+
+// tryLock lock key if it is not locked, it returns whether it succeeds.
+func (l *keyLocks) tryLock(key []byte) bool {
+	return l.shards[l.shard(key)].TryLock()
+}
+
+// tryRLock is the same as tryLock, but takes a read lock.
+func (l *keyLocks) tryRLock(key []byte) bool {
+	return l.shards[l.shard(key)].TryRLock()
+}
+
+// lockKeys lock all the keys in the order of shards, so it never deadlocks with other operations on multiple keys.
+// It returns the function to unlock them.
+func (l *keyLocks) lockKeys(keys [][]byte, write bool) (unlock func()) {
+	shards := make([]int, 0, len(keys))
+	for _, key := range keys {
+		shards = append(shards, l.shard(key))
+	}
+	sort.Ints(shards)
+	n := 0
+	for i, shard := range shards {
+		if i == 0 || shard != shards[n-1] {
+			shards[n] = shard
+			n++
+		}
+	}
+	shards = shards[:n]
+
+	for _, shard := range shards {
+		if write {
+			l.shards[shard].Lock()
+		} else {
+			l.shards[shard].RLock()
+		}
+	}
+	return func() {
+		for i := len(shards) - 1; i >= 0; i-- {
+			if write {
+				l.shards[shards[i]].Unlock()
+			} else {
+				l.shards[shards[i]].RUnlock()
+			}
+		}
+	}
+}
+
+// lockAll lock all the shards, which excludes every other operation holding a key lock.
+// It returns the function to unlock them.
+func (l *keyLocks) lockAll() (unlock func()) {
+	for i := range l.shards {
+		l.shards[i].Lock()
+	}
+	return func() {
+		for i := len(l.shards) - 1; i >= 0; i-- {
+			l.shards[i].Unlock()
+		}
+	}
+}
+
+// Put key and index node into String index.
+func (si *strIndex) Put(key []byte, value interface{}) (oldVal interface{}, updated bool) {
+	si.mu.Lock()
+	oldVal, updated = si.idxTree.Put(key, value)
+	si.mu.Unlock()
+	si.updateExpiry(key, oldVal, value)
+	return
+}
+
+// Get the index node of key.
+func (si *strIndex) Get(key []byte) interface{} {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return si.idxTree.Get(key)
+}
+
+// Delete key from String index.
+func (si *strIndex) Delete(key []byte) (val interface{}, updated bool) {
+	si.mu.Lock()
+	val, updated = si.idxTree.Delete(key)
+	si.mu.Unlock()
+	si.updateExpiry(key, val, nil)
+	return
+}
+
+// Err returns the io error of the String index on disk, the index is out of date after it.
+func (si *strIndex) Err() error {
+	if idx, ok := si.idxTree.(*diskIndex); ok {
+		return idx.Err()
+	}
+	return nil
+}
+
+// updateExpiry update the expiry index after the index node of key is changed from oldVal to val, val is nil if key is deleted.
+// Keys that never expire are not in the expiry index, so it is skipped unless the old or new node has expiration time.
+func (si *strIndex) updateExpiry(key []byte, oldVal, val interface{}) {
+	var oldExpiredAt, expiredAt int64
+	if node, _ := oldVal.(*indexNode); node != nil {
+		oldExpiredAt = node.expiredAt
+	}
+	if node, _ := val.(*indexNode); node != nil {
+		expiredAt = node.expiredAt
+	}
+	if oldExpiredAt != 0 || expiredAt != 0 {
+		si.expires.set(String, key, expiredAt)
+	}
+}
+
+// Iterator returns an iterator of String index, mu must be read-locked until the iteration is done.
+func (si *strIndex) Iterator() index.Iterator {
+	return si.idxTree.Iterator()
+}
+
+// Seek returns an iterator of String index at key, mu must be read-locked until the iteration is done.
+func (si *strIndex) Seek(key []byte) index.Iterator {
+	return si.idxTree.Seek(key)
+}
+
+// PrefixScan returns at most count keys with the prefix.
+func (si *strIndex) PrefixScan(prefix []byte, count int) [][]byte {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return si.idxTree.PrefixScan(prefix, count)
+}
+
+// Size returns the number of String keys.
+func (si *strIndex) Size() int {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return si.idxTree.Size()
+}
+
+// tree returns the index tree of key, nil if key does not exist or is expired.
+func (c *collectionIndex) tree(key []byte) *index.Tree {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if kg := c.gens[string(key)]; kg != nil && kg.expired(time.Now().UnixMilli()) {
+		return nil
+	}
+	return c.trees[string(key)]
+}
+
+// rawTree returns the index tree of key, including an expired one.
+func (c *collectionIndex) rawTree(key []byte) *index.Tree {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.trees[string(key)]
+}
+
+// treeOrCreate returns the index tree of key, an empty tree is created if key does not exist.
+// An expired tree is returned as it is, it must be dropped before being written, see checkWrite.
+func (c *collectionIndex) treeOrCreate(key []byte) *index.Tree {
+	if tree := c.rawTree(key); tree != nil {
+		return tree
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tree := c.trees[string(key)]
+	if tree == nil {
+		tree = index.NewPackedTree(c.typ, c.counter, c.maxPacked)
+		c.trees[string(key)] = tree
+	}
+	return tree
+}
+
+// removeTree drop the index tree of key.
+func (c *collectionIndex) removeTree(key []byte) {
+	c.mu.Lock()
+	tree := c.trees[string(key)]
+	delete(c.trees, string(key))
+	c.mu.Unlock()
+	if tree != nil {
+		tree.Clear()
+	}
+}
+
+// detachTree remove the index tree of key and returns it, the tree is not cleared.
+func (c *collectionIndex) detachTree(key []byte) *index.Tree {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tree := c.trees[string(key)]
+	delete(c.trees, string(key))
+	return tree
+}
+
+// gen returns the current generation of key, it is 0 if key has never been dropped.
+func (c *collectionIndex) gen(key []byte) uint32 {
+	gen, _ := c.genNode(key)
+	return gen
+}
+
+// genNode returns the current generation of key, and the index node of the record that started it.
+func (c *collectionIndex) genNode(key []byte) (uint32, *indexNode) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if kg := c.gens[string(key)]; kg != nil {
+		return kg.gen, kg.node
+	}
+	return 0, nil
+}
+
+// expiredAt returns the expiration time of key, it is 0 if key never expires.
+func (c *collectionIndex) expiredAt(key []byte) int64 {
+	_, node := c.genNode(key)
+	if node == nil {
+		return 0
+	}
+	return node.expiredAt
+}
+
+// setGen set the generation of key, and returns the index node of the record that started the older one.
+func (c *collectionIndex) setGen(key []byte, gen uint32, node *indexNode) *indexNode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var old *indexNode
+	var members bool
+	if kg := c.gens[string(key)]; kg != nil {
+		old = kg.node
+		members = kg.gen == gen && kg.members
+	}
+	c.gens[string(key)] = &keyGen{gen: gen, node: node, members: members}
+
+	var expiredAt int64
+	if node != nil {
+		expiredAt = node.expiredAt
+	}
+	if expiredAt != 0 || (old != nil && old.expiredAt != 0) {
+		c.expires.set(c.dataType, key, expiredAt)
+	}
+	return old
+}
+
+// genMembers returns the current generation of key, and whether it needs to be marked by markMembers.
+func (c *collectionIndex) genMembers(key []byte) (uint32, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if kg := c.gens[string(key)]; kg != nil {
+		return kg.gen, !kg.members
+	}
+	return 0, false
+}
+
+// markMembers mark that entries of members have been written in gen of key.
+func (c *collectionIndex) markMembers(key []byte, gen uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if kg := c.gens[string(key)]; kg != nil && kg.gen == gen {
+		kg.members = true
+	}
+}
+
+// genDroppable returns whether the generation of key started by the record of node is not needed by anything but older entries,
+// that is, the collection is empty, never expires, and no member has been written in the generation.
+func (c *collectionIndex) genDroppable(key []byte, node *indexNode) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	kg := c.gens[string(key)]
+	return kg != nil && kg.node == node && node.expiredAt == 0 && !kg.members && c.trees[string(key)] == nil
+}
+
+// dropGen remove the generation of key after the log file of the record of node is deleted.
+// Members written in the generation since then keep it without the record.
+func (c *collectionIndex) dropGen(key []byte, node *indexNode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kg := c.gens[string(key)]
+	if kg == nil || kg.node != node {
+		return
+	}
+	if kg.members || c.trees[string(key)] != nil {
+		kg.node = nil
+		return
+	}
+	delete(c.gens, string(key))
+}
+
+// sample returns at most n keys including the expired ones, they are picked randomly by the iteration of map.
+func (c *collectionIndex) sample(n int) [][]byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make([][]byte, 0, n)
+	for key := range c.trees {
+		if len(keys) >= n {
+			break
+		}
+		keys = append(keys, []byte(key))
+	}
+	return keys
+}
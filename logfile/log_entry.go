@@ -3,6 +3,7 @@ package logfile
 import (
 	"encoding/binary"
 	"hash/crc32"
+	"io"
 )
 
 // MaxHeaderSize max entry header size.
@@ -10,6 +11,14 @@ import (
 //  4    +   1   +   5   +   5    +    10      = 25 (refer to binary.MaxVarintLen32 and binary.MaxVarintLen64)
 const MaxHeaderSize = 25
 
+// FormatVersion version of the log entry format, it is recorded in MANIFEST for every log file.
+// Since version 2, keys of List, Hash, Set and ZSet entries end with the 4 bytes generation of their collection.
+// Since version 3, ExpiredAt of entries is in milliseconds instead of seconds.
+const FormatVersion uint32 = 3
+
+// milliExpiryVersion the first format version whose ExpiredAt is in milliseconds.
+const milliExpiryVersion uint32 = 3
+
 // EntryType type of Entry.
 type EntryType byte
 
@@ -18,13 +27,15 @@ const (
 	TypeDelete EntryType = iota + 1
 	// TypeListMeta represents entry is list meta.
 	TypeListMeta
+	// TypeGenMeta represents entry starts a new generation of a collection, the older ones are dropped.
+	TypeGenMeta
 )
 
 // LogEntry is the data will be appended in log file.
 type LogEntry struct {
 	Key       []byte
 	Value     []byte
-	ExpiredAt int64 // time.Unix
+	ExpiredAt int64 // time.UnixMilli
 	Type      EntryType
 }
 
@@ -33,7 +44,7 @@ type entryHeader struct {
 	typ       EntryType
 	kSize     uint32
 	vSize     uint32
-	expiredAt int64 // time.Unix
+	expiredAt int64 // time.UnixMilli, or time.Unix before milliExpiryVersion
 }
 
 // EncodeEntry will encode entry into a byte slice.
@@ -47,47 +58,149 @@ func EncodeEntry(e *LogEntry) ([]byte, int) {
 	if e == nil {
 		return nil, 0
 	}
-	header := make([]byte, MaxHeaderSize)
-	// encode header.
-	header[4] = byte(e.Type)
-	var index = 5
-	index += binary.PutVarint(header[index:], int64(len(e.Key)))
-	index += binary.PutVarint(header[index:], int64(len(e.Value)))
-	index += binary.PutVarint(header[index:], e.ExpiredAt)
+	buf := AppendEntry(nil, e)
+	return buf, len(buf)
+}
 
-	var size = index + len(e.Key) + len(e.Value)
-	buf := make([]byte, size)
-	copy(buf[:index], header[:])
+// AppendEntry appends the encoded entry to buf and returns the extended buffer.
+// The entry is encoded in place, nothing is allocated if buf has enough capacity.
+func AppendEntry(buf []byte, e *LogEntry) []byte {
+	if e == nil {
+		return buf
+	}
+	size, start := EncodedSize(e), len(buf)
+	if cap(buf)-start < size {
+		newBuf := make([]byte, start, start+size)
+		copy(newBuf, buf)
+		buf = newBuf
+	}
+	buf = buf[:start+size]
+	b := buf[start:]
+
+	index := encodeHeader(b, e.Type, int64(len(e.Key)), int64(len(e.Value)), e.ExpiredAt)
 	// key and value.
-	copy(buf[index:], e.Key)
-	copy(buf[index+len(e.Key):], e.Value)
+	index += copy(b[index:], e.Key)
+	copy(b[index:], e.Value)
 
 	// crc32.
-	crc := crc32.ChecksumIEEE(buf[4:])
-	binary.LittleEndian.PutUint32(buf[:4], crc)
-	return buf, size
+	crc := crc32.ChecksumIEEE(b[4:])
+	binary.LittleEndian.PutUint32(b[:4], crc)
+	return buf
+}
+
+// encodeHeader encode the header except crc into buf, which must have at least MaxHeaderSize bytes.
+// It returns the size of header.
+func encodeHeader(buf []byte, typ EntryType, kSize, vSize, expiredAt int64) int {
+	buf[4] = byte(typ)
+	var index = 5
+	index += binary.PutVarint(buf[index:], kSize)
+	index += binary.PutVarint(buf[index:], vSize)
+	index += binary.PutVarint(buf[index:], expiredAt)
+	return index
+}
+
+// EncodedSize returns the size of the encoded entry, without encoding it.
+func EncodedSize(e *LogEntry) int {
+	if e == nil {
+		return 0
+	}
+	headerSize := 5 + varintLen(int64(len(e.Key))) + varintLen(int64(len(e.Value))) + varintLen(e.ExpiredAt)
+	return headerSize + len(e.Key) + len(e.Value)
+}
+
+// varintLen returns the number of bytes binary.PutVarint uses to encode x.
+func varintLen(x int64) int {
+	ux := uint64(x) << 1
+	if x < 0 {
+		ux = ^ux
+	}
+	n := 1
+	for ux >= 0x80 {
+		ux >>= 7
+		n++
+	}
+	return n
 }
 
 func decodeHeader(buf []byte) (*entryHeader, int64) {
 	if len(buf) <= 4 {
 		return nil, 0
 	}
-	h := &entryHeader{
-		crc32: binary.LittleEndian.Uint32(buf[:4]),
-		typ:   EntryType(buf[4]),
-	}
+	h := &entryHeader{}
+	size := parseHeader(buf, h)
+	return h, size
+}
+
+// parseHeader decode the header in buf into h, buf must be longer than 4 bytes.
+// It returns the size of header, or 0 if buf does not hold the whole header.
+func parseHeader(buf []byte, h *entryHeader) int64 {
+	h.crc32 = binary.LittleEndian.Uint32(buf[:4])
+	h.typ = EntryType(buf[4])
 	var index = 5
 	ksize, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return 0
+	}
 	h.kSize = uint32(ksize)
 	index += n
 
 	vsize, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return 0
+	}
 	h.vSize = uint32(vsize)
 	index += n
 
 	expiredAt, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return 0
+	}
 	h.expiredAt = expiredAt
-	return h, int64(index + n)
+	return int64(index + n)
+}
+
+// DecodeEntry decode the entry at the beginning of buf, key and value are copied, so buf can be reused.
+// It returns the entry and its size, io.ErrUnexpectedEOF if buf does not hold the whole entry.
+func DecodeEntry(buf []byte) (*LogEntry, int64, error) {
+	if len(buf) <= 4 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	var header entryHeader
+	size := parseHeader(buf, &header)
+	if size == 0 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	if header.crc32 == 0 && header.kSize == 0 && header.vSize == 0 {
+		return nil, 0, ErrEndOfEntry
+	}
+	kSize, vSize := int64(header.kSize), int64(header.vSize)
+	entrySize := size + kSize + vSize
+	if int64(len(buf)) < entrySize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	e := &LogEntry{
+		ExpiredAt: header.expiredAt,
+		Type:      header.typ,
+	}
+	if kSize > 0 || vSize > 0 {
+		kvBuf := make([]byte, kSize+vSize)
+		copy(kvBuf, buf[size:entrySize])
+		e.Key = kvBuf[:kSize]
+		e.Value = kvBuf[kSize:]
+	}
+	if crc := getEntryCrc(e, buf[crc32.Size:size]); crc != header.crc32 {
+		return nil, 0, ErrInvalidCrc
+	}
+	return e, entrySize, nil
+}
+
+// ExpiredAtMilli returns ExpiredAt of an entry in a log file of the format version in milliseconds.
+func ExpiredAtMilli(version uint32, expiredAt int64) int64 {
+	if version < milliExpiryVersion {
+		return expiredAt * 1000
+	}
+	return expiredAt
 }
 
 func getEntryCrc(e *LogEntry, h []byte) uint32 {
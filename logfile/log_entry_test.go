@@ -3,6 +3,8 @@ package logfile
 import (
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestEncodeEntry(t *testing.T) {
@@ -44,6 +46,32 @@ func TestEncodeEntry(t *testing.T) {
 	}
 }
 
+func TestAppendEntry(t *testing.T) {
+	entries := []*LogEntry{
+		{},
+		{ExpiredAt: -1, Type: TypeDelete},
+		{Key: []byte("kv"), Value: []byte("lotusdb"), ExpiredAt: 443434211},
+		{Key: []byte("k"), Value: make([]byte, 1<<10)},
+	}
+	prefix := []byte("prefix")
+	for _, e := range entries {
+		want, size := EncodeEntry(e)
+		assert.Equal(t, size, EncodedSize(e))
+
+		buf := make([]byte, len(prefix), 64)
+		copy(buf, prefix)
+		got := AppendEntry(buf, e)
+		assert.Equal(t, prefix, got[:len(prefix)])
+		assert.Equal(t, want, got[len(prefix):])
+		// buffer with enough capacity is reused.
+		if len(prefix)+size <= 64 {
+			assert.Equal(t, &buf[0], &got[0])
+		}
+	}
+	assert.Equal(t, 0, EncodedSize(nil))
+	assert.Nil(t, AppendEntry(nil, nil))
+}
+
 func Test_decodeHeader(t *testing.T) {
 	type args struct {
 		buf []byte
@@ -108,3 +136,39 @@ func Test_getEntryCrc(t *testing.T) {
 		})
 	}
 }
+
+func TestExpiredAtMilli(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   uint32
+		expiredAt int64
+		want      int64
+	}{
+		{"legacy", 1, 1650000000, 1650000000000},
+		{"seconds", 2, 1650000000, 1650000000000},
+		{"never-expires", 2, 0, 0},
+		{"milliseconds", FormatVersion, 1650000000123, 1650000000123},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExpiredAtMilli(tt.version, tt.expiredAt))
+		})
+	}
+}
+
+func BenchmarkEncodeEntry(b *testing.B) {
+	e := &LogEntry{Key: []byte("kvstore-bench-key"), Value: make([]byte, 128)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		EncodeEntry(e)
+	}
+}
+
+func BenchmarkAppendEntry(b *testing.B) {
+	e := &LogEntry{Key: []byte("kvstore-bench-key"), Value: make([]byte, 128)}
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = AppendEntry(buf[:0], e)
+	}
+}
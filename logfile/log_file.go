@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
@@ -21,6 +22,9 @@ var (
 	// ErrEndOfEntry end of entry in log file.
 	ErrEndOfEntry = errors.New("logfile: end of entry in log file")
 
+	// ErrEntryTooLarge entry can`t be written to the log file since it exceeds the size of log file.
+	ErrEntryTooLarge = errors.New("logfile: entry is too large for the log file")
+
 	// ErrUnsupportedIoType unsupported io type, only mmap and fileIO now.
 	ErrUnsupportedIoType = errors.New("unsupported io type")
 
@@ -32,10 +36,19 @@ const (
 	// InitialLogFileId initial log file id: 0.
 	InitialLogFileId = 0
 
+	// readAheadSize number of bytes read with the entry header.
+	readAheadSize = 512
+
 	// FilePrefix log file prefix.
 	FilePrefix = "log."
 )
 
+// readBufPool buffers for reading entry headers.
+var readBufPool = sync.Pool{New: func() interface{} {
+	buf := make([]byte, readAheadSize)
+	return &buf
+}}
+
 // FileType represents different types of log file: wal and value log.
 type FileType int8
 
@@ -66,7 +79,7 @@ var (
 	}
 )
 
-// IOType represents different types of file io: FileIO(standard file io) and MMap(Memory Map).
+// IOType represents different types of file io: FileIO(standard file io), MMap(Memory Map), Memory, DirectIO and MMapReadOnly.
 type IOType int8
 
 const (
@@ -74,21 +87,31 @@ const (
 	FileIO IOType = iota
 	// MMap Memory Map.
 	MMap
+	// Memory keep the log file in memory only, nothing will be written to disk.
+	Memory
+	// DirectIO file io bypassing the OS page cache.
+	DirectIO
+	// MMapReadOnly map the existing content of log file read-only, used for sealed log files.
+	MMapReadOnly
 )
 
 // LogFile is an abstraction of a disk file, entry`s read and write will go through it.
 type LogFile struct {
 	sync.RWMutex
-	Fid        uint32 //for record the entry belong to which file tt
-	WriteAt    int64 // for new a logfile when the last file is full tt
+	Fid        uint32                //for record the entry belong to which file tt
+	WriteAt    int64                 // for new a logfile when the last file is full tt
+	Size       int64                 // size of the log file, entries can`t be written beyond it.
 	IoSelector ioselector.IOSelector // for LogFile^'^s read and write from file tt
+	// Version format version of entries in the log file, it is FormatVersion unless the log file is written by older versions.
+	// ExpiredAt of entries read is always in milliseconds.
+	Version uint32
 }
 
 // OpenLogFile open an existing or create a new log file.
 // fsize must be a postitive number.And we will create io selector according to ioType.
 func OpenLogFile(path string, fid uint32, fsize int64, ftype FileType, ioType IOType) (lf *LogFile, err error) {
-	lf = &LogFile{Fid: fid} // to record the file id first
-	 
+	lf = &LogFile{Fid: fid, Size: fsize, Version: FormatVersion} // to record the file id first
+
 	fileName, err := lf.getLogFileName(path, fid, ftype)
 	if err != nil {
 		return nil, err
@@ -97,7 +120,7 @@ func OpenLogFile(path string, fid uint32, fsize int64, ftype FileType, ioType IO
 	var selector ioselector.IOSelector
 	switch ioType {
 	case FileIO:
-		                   // this just is a fuction located in package ioselector
+		// this just is a fuction located in package ioselector
 		if selector, err = ioselector.NewFileIOSelector(fileName, fsize); err != nil {
 			return
 		}
@@ -105,6 +128,18 @@ func OpenLogFile(path string, fid uint32, fsize int64, ftype FileType, ioType IO
 		if selector, err = ioselector.NewMMapSelector(fileName, fsize); err != nil {
 			return
 		}
+	case Memory:
+		if selector, err = ioselector.NewMemSelector(fsize); err != nil {
+			return
+		}
+	case DirectIO:
+		if selector, err = ioselector.NewDirectIOSelector(fileName, fsize); err != nil {
+			return
+		}
+	case MMapReadOnly:
+		if selector, err = ioselector.NewReadOnlyMMapSelector(fileName, fsize); err != nil {
+			return
+		}
 	default:
 		return nil, ErrUnsupportedIoType
 	}
@@ -116,13 +151,20 @@ func OpenLogFile(path string, fid uint32, fsize int64, ftype FileType, ioType IO
 // ReadLogEntry read a LogEntry from log file at offset.
 // It returns a LogEntry, entry size and an error, if any.
 // If offset is invalid, the err is io.EOF.
+// The header is read together with the first readAheadSize bytes of the entry, so small entries are read at once.
 func (lf *LogFile) ReadLogEntry(offset int64) (*LogEntry, int64, error) {
-	// read entry header.
-	headerBuf, err := lf.readBytes(offset, MaxHeaderSize)
+	bufp := readBufPool.Get().(*[]byte)
+	defer readBufPool.Put(bufp)
+	buf, err := lf.readAhead(*bufp, offset)
 	if err != nil {
 		return nil, 0, err
 	}
-	header, size := decodeHeader(headerBuf)
+
+	var header entryHeader
+	size := parseHeader(buf, &header)
+	if size == 0 {
+		return nil, 0, ErrInvalidCrc
+	}
 	// the end of entries.
 	if header.crc32 == 0 && header.kSize == 0 && header.vSize == 0 {
 		return nil, 0, ErrEndOfEntry
@@ -135,23 +177,123 @@ func (lf *LogFile) ReadLogEntry(offset int64) (*LogEntry, int64, error) {
 	kSize, vSize := int64(header.kSize), int64(header.vSize)
 	var entrySize = size + kSize + vSize
 
-	// read entry key and value.
+	// key and value, only the part not read ahead is read from file.
 	if kSize > 0 || vSize > 0 {
-		kvBuf, err := lf.readBytes(offset+size, kSize+vSize)
-		if err != nil {
-			return nil, 0, err
+		kvBuf := make([]byte, kSize+vSize)
+		n := int64(copy(kvBuf, buf[size:]))
+		if n < kSize+vSize {
+			if _, err := lf.IoSelector.Read(kvBuf[n:], offset+size+n); err != nil {
+				return nil, 0, err
+			}
 		}
 		e.Key = kvBuf[:kSize]
 		e.Value = kvBuf[kSize:]
 	}
 
 	// crc32 check.
-	if crc := getEntryCrc(e, headerBuf[crc32.Size:size]); crc != header.crc32 {
+	if crc := getEntryCrc(e, buf[crc32.Size:size]); crc != header.crc32 {
 		return nil, 0, ErrInvalidCrc
 	}
+	e.ExpiredAt = ExpiredAtMilli(lf.Version, e.ExpiredAt)
 	return e, entrySize, nil
 }
 
+// DecodeEntry decode the entry at the beginning of buf which is read from the log file, see DecodeEntry.
+func (lf *LogFile) DecodeEntry(buf []byte) (*LogEntry, int64, error) {
+	e, size, err := DecodeEntry(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	e.ExpiredAt = ExpiredAtMilli(lf.Version, e.ExpiredAt)
+	return e, size, nil
+}
+
+// Pin holds off remapping and unmapping of the log file until Unpin is called.
+// It returns false if entries of the log file can`t be viewed without copying, and Unpin mustn`t be called then.
+func (lf *LogFile) Pin() bool {
+	viewer, ok := lf.IoSelector.(ioselector.Viewer)
+	if ok {
+		viewer.Pin()
+	}
+	return ok
+}
+
+// Unpin release the pin acquired by Pin.
+func (lf *LogFile) Unpin() {
+	if viewer, ok := lf.IoSelector.(ioselector.Viewer); ok {
+		viewer.Unpin()
+	}
+}
+
+// ViewLogEntry is like ReadLogEntry, but key and value of the entry alias the content of log file instead of being copied.
+// The log file must be pinned until they are no longer used.
+func (lf *LogFile) ViewLogEntry(offset int64) (*LogEntry, int64, error) {
+	viewer, ok := lf.IoSelector.(ioselector.Viewer)
+	if !ok {
+		return lf.ReadLogEntry(offset)
+	}
+	buf, err := viewer.View(offset, MaxHeaderSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(buf) <= 4 {
+		return nil, 0, io.EOF
+	}
+	var header entryHeader
+	size := parseHeader(buf, &header)
+	if size == 0 {
+		return nil, 0, io.EOF
+	}
+	// the end of entries.
+	if header.crc32 == 0 && header.kSize == 0 && header.vSize == 0 {
+		return nil, 0, ErrEndOfEntry
+	}
+
+	e := &LogEntry{
+		ExpiredAt: header.expiredAt,
+		Type:      header.typ,
+	}
+	kSize, vSize := int64(header.kSize), int64(header.vSize)
+	if kSize > 0 || vSize > 0 {
+		kvBuf, err := viewer.View(offset+size, int(kSize+vSize))
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(kvBuf)) < kSize+vSize {
+			return nil, 0, io.EOF
+		}
+		e.Key = kvBuf[:kSize:kSize]
+		e.Value = kvBuf[kSize:]
+	}
+
+	// crc32 check.
+	if crc := getEntryCrc(e, buf[crc32.Size:size]); crc != header.crc32 {
+		return nil, 0, ErrInvalidCrc
+	}
+	e.ExpiredAt = ExpiredAtMilli(lf.Version, e.ExpiredAt)
+	return e, size + kSize + vSize, nil
+}
+
+// readAhead read at most len(buf) bytes at offset into buf, and at least MaxHeaderSize bytes.
+func (lf *LogFile) readAhead(buf []byte, offset int64) ([]byte, error) {
+	n := int64(len(buf))
+	if lf.Size > 0 && lf.Size-offset < n {
+		n = lf.Size - offset
+	}
+	if n > MaxHeaderSize {
+		if _, err := lf.IoSelector.Read(buf[:n], offset); err == nil {
+			return buf[:n], nil
+		} else if err != io.EOF {
+			return nil, err
+		}
+	}
+	// near the end of file, only the header is read.
+	if _, err := lf.IoSelector.Read(buf[:MaxHeaderSize], offset); err != nil {
+		return nil, err
+	}
+	return buf[:MaxHeaderSize], nil
+}
+
 // Read a byte slice in the log file at offset, slice length is the given size.
 // It returns the byte slice and error, if any.
 func (lf *LogFile) Read(offset int64, size uint32) ([]byte, error) {
@@ -200,13 +342,6 @@ func (lf *LogFile) Delete() error {
 	return lf.IoSelector.Delete()
 }
 
-//important tt
-func (lf *LogFile) readBytes(offset, n int64) (buf []byte, err error) {
-	buf = make([]byte, n)
-	_, err = lf.IoSelector.Read(buf, offset)
-	return
-}
-
 func (lf *LogFile) getLogFileName(path string, fid uint32, ftype FileType) (name string, err error) {
 	if _, ok := FileNamesMap[ftype]; !ok {
 		return "", ErrUnsupportedLogFileType
@@ -1,6 +1,7 @@
 package logfile
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 	"sync/atomic"
@@ -17,6 +18,14 @@ func TestOpenLogFile(t *testing.T) {
 	t.Run("mmap", func(t *testing.T) {
 		testOpenLogFile(t, MMap)
 	})
+
+	t.Run("memory", func(t *testing.T) {
+		testOpenLogFile(t, Memory)
+	})
+
+	t.Run("directio", func(t *testing.T) {
+		testOpenLogFile(t, DirectIO)
+	})
 }
 
 func testOpenLogFile(t *testing.T, ioType IOType) {
@@ -70,6 +79,14 @@ func TestLogFile_Write(t *testing.T) {
 	t.Run("mmap", func(t *testing.T) {
 		testLogFileWrite(t, MMap)
 	})
+
+	t.Run("memory", func(t *testing.T) {
+		testLogFileWrite(t, Memory)
+	})
+
+	t.Run("directio", func(t *testing.T) {
+		testLogFileWrite(t, DirectIO)
+	})
 }
 
 func testLogFileWrite(t *testing.T, ioType IOType) {
@@ -123,6 +140,14 @@ func TestLogFile_Read(t *testing.T) {
 	t.Run("mmap", func(t *testing.T) {
 		testLogFileRead(t, MMap)
 	})
+
+	t.Run("memory", func(t *testing.T) {
+		testLogFileRead(t, Memory)
+	})
+
+	t.Run("directio", func(t *testing.T) {
+		testLogFileRead(t, DirectIO)
+	})
 }
 
 func testLogFileRead(t *testing.T, ioType IOType) {
@@ -212,6 +237,14 @@ func TestLogFile_ReadLogEntry(t *testing.T) {
 	t.Run("mmap", func(t *testing.T) {
 		testLogFileReadLogEntry(t, MMap)
 	})
+
+	t.Run("memory", func(t *testing.T) {
+		testLogFileReadLogEntry(t, Memory)
+	})
+
+	t.Run("directio", func(t *testing.T) {
+		testLogFileReadLogEntry(t, DirectIO)
+	})
 }
 
 func testLogFileReadLogEntry(t *testing.T, ioType IOType) {
@@ -232,6 +265,8 @@ func testLogFileReadLogEntry(t *testing.T, ioType IOType) {
 		{Key: nil, Value: []byte("lotusdb"), ExpiredAt: 99400542343},
 		{Key: []byte("k2"), Value: []byte("lotusdb"), ExpiredAt: 8847333912},
 		{Key: []byte("k3"), Value: []byte("some data"), ExpiredAt: 8847333912, Type: TypeDelete},
+		// larger than readAheadSize, read in two parts.
+		{Key: []byte("k4"), Value: bytes.Repeat([]byte("lotusdb"), 200), ExpiredAt: 8847333912},
 	}
 	var vals [][]byte
 	for _, e := range entries {
@@ -275,6 +310,9 @@ func testLogFileReadLogEntry(t *testing.T, ioType IOType) {
 		{
 			"read-entry-6", fields{lf: lf}, args{offset: offsets[6]}, entries[6], int64(len(vals[6])), false,
 		},
+		{
+			"read-entry-7", fields{lf: lf}, args{offset: offsets[7]}, entries[7], int64(len(vals[7])), false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -313,6 +351,14 @@ func TestLogFile_Sync(t *testing.T) {
 	t.Run("mmap", func(t *testing.T) {
 		sync(MMap)
 	})
+
+	t.Run("memory", func(t *testing.T) {
+		sync(Memory)
+	})
+
+	t.Run("directio", func(t *testing.T) {
+		sync(DirectIO)
+	})
 }
 
 func TestLogFile_Close(t *testing.T) {
@@ -333,6 +379,14 @@ func TestLogFile_Close(t *testing.T) {
 	t.Run("mmap", func(t *testing.T) {
 		closeLf(MMap)
 	})
+
+	t.Run("memory", func(t *testing.T) {
+		closeLf(Memory)
+	})
+
+	t.Run("directio", func(t *testing.T) {
+		closeLf(DirectIO)
+	})
 }
 
 func TestLogFile_Delete(t *testing.T) {
@@ -350,4 +404,79 @@ func TestLogFile_Delete(t *testing.T) {
 	t.Run("mmap", func(t *testing.T) {
 		deleteLf(MMap)
 	})
+
+	t.Run("memory", func(t *testing.T) {
+		deleteLf(Memory)
+	})
+
+	t.Run("directio", func(t *testing.T) {
+		deleteLf(DirectIO)
+	})
+}
+
+func TestLogFile_MMapReadOnly(t *testing.T) {
+	lf, err := OpenLogFile("/tmp", 1, 1<<20, Strs, FileIO)
+	assert.Nil(t, err)
+	entries := []*LogEntry{
+		{Key: []byte("k1"), Value: []byte("lotusdb"), ExpiredAt: 8847333912},
+		{Key: []byte("k2"), Value: []byte("some data"), Type: TypeDelete},
+	}
+	var vals [][]byte
+	for _, e := range entries {
+		v, _ := EncodeEntry(e)
+		vals = append(vals, v)
+	}
+	offsets := writeSomeData(lf, vals)
+	err = lf.Close()
+	assert.Nil(t, err)
+
+	// reopen the sealed log file.
+	lf, err = OpenLogFile("/tmp", 1, 1<<20, Strs, MMapReadOnly)
+	assert.Nil(t, err)
+	defer func() {
+		_ = lf.Delete()
+	}()
+	for i, offset := range offsets {
+		got, size, err := lf.ReadLogEntry(offset)
+		assert.Nil(t, err)
+		assert.Equal(t, entries[i], got)
+		assert.Equal(t, int64(len(vals[i])), size)
+	}
+	_, _, err = lf.ReadLogEntry(offsets[1] + int64(len(vals[1])))
+	assert.Equal(t, ErrEndOfEntry, err)
+
+	err = lf.Write([]byte("lotusdb"))
+	assert.NotNil(t, err)
+}
+
+func TestLogFile_ViewLogEntry(t *testing.T) {
+	for _, ioType := range []IOType{FileIO, MMap} {
+		lf, err := OpenLogFile("/tmp", 1, 1<<20, Strs, ioType)
+		assert.Nil(t, err)
+		entries := []*LogEntry{
+			{Key: []byte("k1"), Value: []byte("lotusdb"), ExpiredAt: 8847333912},
+			{Key: []byte("k2"), Value: bytes.Repeat([]byte("lotusdb"), 200), Type: TypeDelete},
+		}
+		var vals [][]byte
+		for _, e := range entries {
+			v, _ := EncodeEntry(e)
+			vals = append(vals, v)
+		}
+		offsets := writeSomeData(lf, vals)
+
+		pinned := lf.Pin()
+		assert.Equal(t, ioType == MMap, pinned)
+		for i, offset := range offsets {
+			got, size, err := lf.ViewLogEntry(offset)
+			assert.Nil(t, err)
+			assert.Equal(t, entries[i], got)
+			assert.Equal(t, int64(len(vals[i])), size)
+		}
+		_, _, err = lf.ViewLogEntry(offsets[1] + int64(len(vals[1])))
+		assert.Equal(t, ErrEndOfEntry, err)
+		if pinned {
+			lf.Unpin()
+		}
+		_ = lf.Delete()
+	}
 }
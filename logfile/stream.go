@@ -0,0 +1,180 @@
+package logfile
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// streamChunkSize size of the chunks a streamed value is copied in.
+const streamChunkSize = 64 << 10
+
+var chunkPool = sync.Pool{New: func() interface{} {
+	buf := make([]byte, streamChunkSize)
+	return &buf
+}}
+
+// WriteFrom write an entry at the end of log file, whose value is read from r and must be vSize bytes, e.Value is ignored.
+// The value is copied in chunks, and the header is written at last, so a partially written entry looks like the end of entries.
+// The bytes written are zeroed if it fails, so the next entry written there is not mixed up with them.
+// It returns the size of the entry.
+func (lf *LogFile) WriteFrom(e *LogEntry, r io.Reader, vSize int64) (size int64, err error) {
+	var header [MaxHeaderSize]byte
+	hSize := int64(encodeHeader(header[:], e.Type, int64(len(e.Key)), vSize, e.ExpiredAt))
+	kSize := int64(len(e.Key))
+	offset := atomic.LoadInt64(&lf.WriteAt)
+	if offset+hSize+kSize+vSize > lf.Size {
+		return 0, ErrEntryTooLarge
+	}
+
+	bufp := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(bufp)
+	pos, end := offset+hSize, offset+hSize+kSize+vSize
+	defer func() {
+		if err != nil {
+			lf.zero(*bufp, offset, pos)
+		}
+	}()
+
+	crc := crc32.ChecksumIEEE(header[4:hSize])
+	crc = crc32.Update(crc, crc32.IEEETable, e.Key)
+	// pos is moved before writing, since a write may fail after writing a part.
+	pos += kSize
+	if err := lf.writeAt(e.Key, pos-kSize); err != nil {
+		return 0, err
+	}
+	for pos < end {
+		chunk := *bufp
+		if end-pos < int64(len(chunk)) {
+			chunk = chunk[:end-pos]
+		}
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, chunk)
+		pos += int64(len(chunk))
+		if err := lf.writeAt(chunk, pos-int64(len(chunk))); err != nil {
+			return 0, err
+		}
+	}
+
+	binary.LittleEndian.PutUint32(header[:4], crc)
+	if err := lf.writeAt(header[:hSize], offset); err != nil {
+		return 0, err
+	}
+	atomic.AddInt64(&lf.WriteAt, end-offset)
+	return end - offset, nil
+}
+
+// zero write zeros in [start, end) of log file with buf, errors are ignored since it is called on failure.
+func (lf *LogFile) zero(buf []byte, start, end int64) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	for start < end {
+		n := int64(len(buf))
+		if end-start < n {
+			n = end - start
+		}
+		if _, err := lf.IoSelector.Write(buf[:n], start); err != nil {
+			return
+		}
+		start += n
+	}
+}
+
+func (lf *LogFile) writeAt(b []byte, offset int64) error {
+	if len(b) == 0 {
+		return nil
+	}
+	n, err := lf.IoSelector.Write(b, offset)
+	if err != nil {
+		return err
+	}
+	if n != len(b) {
+		return ErrWriteSizeNotEqual
+	}
+	return nil
+}
+
+// ReadAt read len(b) bytes of log file at offset into b, it implements io.ReaderAt.
+func (lf *LogFile) ReadAt(b []byte, offset int64) (int, error) {
+	return lf.IoSelector.Read(b, offset)
+}
+
+// ValueReader reads the value of an entry on demand, the crc of entry is checked when all the value is read.
+type ValueReader struct {
+	// Entry the entry without value.
+	Entry *LogEntry
+	ra    io.ReaderAt
+	pos   int64
+	end   int64
+	crc   uint32
+	want  uint32
+}
+
+// NewValueReader read the header and key of the entry at offset from ra, and returns a reader of its value.
+// The header is read with MaxHeaderSize bytes, so the entry mustn`t be at the very end of ra.
+func NewValueReader(ra io.ReaderAt, offset int64) (*ValueReader, error) {
+	var buf [MaxHeaderSize]byte
+	if _, err := ra.ReadAt(buf[:], offset); err != nil {
+		return nil, err
+	}
+	var header entryHeader
+	hSize := parseHeader(buf[:], &header)
+	if hSize == 0 {
+		return nil, ErrInvalidCrc
+	}
+	if header.crc32 == 0 && header.kSize == 0 && header.vSize == 0 {
+		return nil, ErrEndOfEntry
+	}
+
+	e := &LogEntry{ExpiredAt: header.expiredAt, Type: header.typ}
+	if header.kSize > 0 {
+		e.Key = make([]byte, header.kSize)
+		if _, err := ra.ReadAt(e.Key, offset+hSize); err != nil {
+			return nil, err
+		}
+	}
+	crc := crc32.ChecksumIEEE(buf[4:hSize])
+	crc = crc32.Update(crc, crc32.IEEETable, e.Key)
+	pos := offset + hSize + int64(header.kSize)
+	return &ValueReader{
+		Entry: e,
+		ra:    ra,
+		pos:   pos,
+		end:   pos + int64(header.vSize),
+		crc:   crc,
+		want:  header.crc32,
+	}, nil
+}
+
+// Size returns the number of bytes of the value not read yet.
+func (r *ValueReader) Size() int64 {
+	return r.end - r.pos
+}
+
+// Read implements io.Reader, it returns ErrInvalidCrc instead of io.EOF if the entry is corrupted.
+func (r *ValueReader) Read(p []byte) (int, error) {
+	if r.pos >= r.end {
+		if r.crc != r.want {
+			return 0, ErrInvalidCrc
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.end-r.pos {
+		p = p[:r.end-r.pos]
+	}
+	n, err := r.ra.ReadAt(p, r.pos)
+	if err != nil && !(err == io.EOF && n == len(p)) {
+		return n, err
+	}
+	r.crc = crc32.Update(r.crc, crc32.IEEETable, p[:n])
+	r.pos += int64(n)
+	return n, nil
+}
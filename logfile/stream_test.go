@@ -0,0 +1,71 @@
+package logfile
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogFile_WriteFrom(t *testing.T) {
+	for _, ioType := range []IOType{FileIO, MMap} {
+		lf, err := OpenLogFile("/tmp", 1, 1<<20, Strs, ioType)
+		assert.Nil(t, err)
+
+		value := bytes.Repeat([]byte("lotusdb"), streamChunkSize/7*3)
+		e := &LogEntry{Key: []byte("k1"), ExpiredAt: 8847333912}
+		size, err := lf.WriteFrom(e, bytes.NewReader(value), int64(len(value)))
+		assert.Nil(t, err)
+		e.Value = value
+		assert.Equal(t, int64(EncodedSize(e)), size)
+		assert.Equal(t, size, lf.WriteAt)
+
+		// the same as an entry written at once.
+		got, gotSize, err := lf.ReadLogEntry(0)
+		assert.Nil(t, err)
+		assert.Equal(t, e, got)
+		assert.Equal(t, size, gotSize)
+
+		// the reader is shorter than vSize, nothing is written.
+		_, err = lf.WriteFrom(&LogEntry{Key: []byte("k2")}, bytes.NewReader(value[:10]), 100)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, size, lf.WriteAt)
+		_, _, err = lf.ReadLogEntry(size)
+		assert.Equal(t, ErrEndOfEntry, err)
+
+		_, err = lf.WriteFrom(&LogEntry{Key: []byte("k3")}, bytes.NewReader(nil), 1<<20)
+		assert.Equal(t, ErrEntryTooLarge, err)
+
+		// read the value by ValueReader.
+		r, err := NewValueReader(lf, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("k1"), r.Entry.Key)
+		assert.Equal(t, int64(len(value)), r.Size())
+		buf, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, value, buf)
+		_ = lf.Delete()
+	}
+}
+
+func TestValueReader_InvalidCrc(t *testing.T) {
+	lf, err := OpenLogFile("/tmp", 1, 1<<20, Strs, FileIO)
+	assert.Nil(t, err)
+	defer func() {
+		_ = lf.Delete()
+	}()
+	buf, _ := EncodeEntry(&LogEntry{Key: []byte("k1"), Value: []byte("lotusdb")})
+	buf[len(buf)-1]++
+	err = lf.Write(buf)
+	assert.Nil(t, err)
+
+	r, err := NewValueReader(lf, 0)
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, ErrInvalidCrc, err)
+
+	_, err = NewValueReader(lf, int64(len(buf)))
+	assert.Equal(t, ErrEndOfEntry, err)
+}
@@ -0,0 +1,255 @@
+package godb
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/herott-ai/godb/logfile"
+	"github.com/herott-ai/godb/util"
+)
+
+const (
+	manifestFileName = "MANIFEST"
+	// manifestVersion the version of manifest file format.
+	manifestVersion uint32 = 1
+	// legacyFormatVersion format version of log files created before MANIFEST existed.
+	legacyFormatVersion uint32 = 1
+)
+
+// ErrManifestVersion the manifest is written by a newer version of godb.
+var ErrManifestVersion = errors.New("unsupported manifest version")
+
+// manifest records every log file`s actual size, format version and the options the db was created with.
+// So that a log file will always be opened with the size it was created,
+// even though Options.LogFileSizeThreshold is changed between restarts.
+//
+// It is a small json file, and will be rewritten atomically(write a temp file and rename) when log files changed.
+// Log files only change when rotating or log file gc, so the cost is negligible.
+type manifest struct {
+	mu       sync.RWMutex
+	path     string
+	version  uint32
+	created  creationOptions
+	segments map[DataType]map[uint32]segmentMeta
+}
+
+// creationOptions options used when the db was created for the first time.
+type creationOptions struct {
+	IndexMode            DataIndexMode `json:"index_mode"`
+	IoType               IOType        `json:"io_type"`
+	LogFileSizeThreshold int64         `json:"log_file_size_threshold"`
+}
+
+// segmentMeta meta info of a log file.
+type segmentMeta struct {
+	Type    DataType `json:"type"`
+	Fid     uint32   `json:"fid"`
+	Size    int64    `json:"size"`
+	Version uint32   `json:"version"`
+}
+
+type manifestFile struct {
+	Version  uint32          `json:"version"`
+	Created  creationOptions `json:"created"`
+	Segments []segmentMeta   `json:"segments"`
+}
+
+// openManifest load the manifest in db path, a new one will be created if not exist.
+func openManifest(path string, opts Options) (*manifest, error) {
+	m := &manifest{
+		path:     filepath.Join(path, manifestFileName),
+		version:  manifestVersion,
+		segments: make(map[DataType]map[uint32]segmentMeta),
+	}
+
+	buf, err := ioutil.ReadFile(m.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// first startup, save the options it was created with.
+	if os.IsNotExist(err) {
+		m.created = creationOptions{
+			IndexMode:            opts.IndexMode,
+			IoType:               opts.IoType,
+			LogFileSizeThreshold: opts.LogFileSizeThreshold,
+		}
+		// the manifest is never written in read-only mode.
+		if opts.ReadOnly {
+			m.path = ""
+			return m, nil
+		}
+		return m, m.persist()
+	}
+
+	var mf manifestFile
+	if err := json.Unmarshal(buf, &mf); err != nil {
+		return nil, err
+	}
+	if mf.Version > manifestVersion {
+		return nil, ErrManifestVersion
+	}
+	m.version = mf.Version
+	m.created = mf.Created
+	for _, seg := range mf.Segments {
+		if m.segments[seg.Type] == nil {
+			m.segments[seg.Type] = make(map[uint32]segmentMeta)
+		}
+		m.segments[seg.Type][seg.Fid] = seg
+	}
+	if opts.ReadOnly {
+		m.path = ""
+	}
+	return m, nil
+}
+
+// newMemManifest create a manifest which is never persisted, used in InMemory mode.
+func newMemManifest() *manifest {
+	return &manifest{version: manifestVersion, segments: make(map[DataType]map[uint32]segmentMeta)}
+}
+
+// segmentSize returns the recorded size of a log file.
+func (m *manifest) segmentSize(dataType DataType, fid uint32) (int64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seg, ok := m.segments[dataType][fid]
+	return seg.Size, ok
+}
+
+// segmentVersion returns the format version of a log file.
+func (m *manifest) segmentVersion(dataType DataType, fid uint32) uint32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if seg, ok := m.segments[dataType][fid]; ok && seg.Version > 0 {
+		return seg.Version
+	}
+	return legacyFormatVersion
+}
+
+// addSegment record a new log file and persist the manifest.
+func (m *manifest) addSegment(dataType DataType, fid uint32, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.segments[dataType] == nil {
+		m.segments[dataType] = make(map[uint32]segmentMeta)
+	}
+	m.segments[dataType][fid] = segmentMeta{Type: dataType, Fid: fid, Size: size, Version: logfile.FormatVersion}
+	return m.persist()
+}
+
+// addSegments record log files and persist the manifest once, so either all or none of them are recorded.
+// Log files without a version are in the current format.
+func (m *manifest) addSegments(segs []segmentMeta) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	olds := make([]segmentMeta, len(segs))
+	existed := make([]bool, len(segs))
+	for i, seg := range segs {
+		if m.segments[seg.Type] == nil {
+			m.segments[seg.Type] = make(map[uint32]segmentMeta)
+		}
+		if seg.Version == 0 {
+			seg.Version = logfile.FormatVersion
+		}
+		olds[i], existed[i] = m.segments[seg.Type][seg.Fid]
+		m.segments[seg.Type][seg.Fid] = seg
+	}
+	if err := m.persist(); err != nil {
+		// none of them is recorded, in the reverse order in case a log file is added twice.
+		for i := len(segs) - 1; i >= 0; i-- {
+			if existed[i] {
+				m.segments[segs[i].Type][segs[i].Fid] = olds[i]
+			} else {
+				delete(m.segments[segs[i].Type], segs[i].Fid)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// removeSegment remove a log file from the manifest and persist it.
+func (m *manifest) removeSegment(dataType DataType, fid uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.segments[dataType][fid]; !ok {
+		return nil
+	}
+	delete(m.segments[dataType], fid)
+	return m.persist()
+}
+
+// retainSegments drop the records of log files that no longer exist.
+// A log file may be deleted by gc right before the process crashed, so its record is left in manifest.
+func (m *manifest) retainSegments(fidMap map[DataType][]uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var changed bool
+	for dataType, segs := range m.segments {
+		exists := make(map[uint32]struct{}, len(fidMap[dataType]))
+		for _, fid := range fidMap[dataType] {
+			exists[fid] = struct{}{}
+		}
+		for fid := range segs {
+			if _, ok := exists[fid]; !ok {
+				delete(segs, fid)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return m.persist()
+}
+
+// must hold the lock before invoking.
+func (m *manifest) persist() error {
+	// in memory or read-only manifest.
+	if m.path == "" {
+		return nil
+	}
+	mf := manifestFile{Version: m.version, Created: m.created}
+	for _, segs := range m.segments {
+		for _, seg := range segs {
+			mf.Segments = append(mf.Segments, seg)
+		}
+	}
+	// keep the file content stable, make it easy to diff.
+	sort.Slice(mf.Segments, func(i, j int) bool {
+		if mf.Segments[i].Type != mf.Segments[j].Type {
+			return mf.Segments[i].Type < mf.Segments[j].Type
+		}
+		return mf.Segments[i].Fid < mf.Segments[j].Fid
+	})
+	buf, err := json.MarshalIndent(mf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := m.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buf); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, m.path); err != nil {
+		return err
+	}
+	// the rename is the commit point, it must be persisted too.
+	return util.SyncDir(filepath.Dir(m.path))
+}
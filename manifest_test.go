@@ -0,0 +1,96 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/herott-ai/godb/logfile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenManifest(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-manifest")
+	_ = os.MkdirAll(path, os.ModePerm)
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	opts := DefaultOptions(path)
+	m, err := openManifest(path, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, opts.LogFileSizeThreshold, m.created.LogFileSizeThreshold)
+
+	err = m.addSegment(String, 0, 1024)
+	assert.Nil(t, err)
+	err = m.addSegment(String, 1, 2048)
+	assert.Nil(t, err)
+	err = m.addSegment(Hash, 0, 4096)
+	assert.Nil(t, err)
+	err = m.removeSegment(String, 0)
+	assert.Nil(t, err)
+
+	// reopen with another threshold, the created options should not change.
+	opts.LogFileSizeThreshold = 64 << 20
+	m2, err := openManifest(path, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(512<<20), m2.created.LogFileSizeThreshold)
+
+	_, ok := m2.segmentSize(String, 0)
+	assert.False(t, ok)
+	size, ok := m2.segmentSize(String, 1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2048), size)
+	size, ok = m2.segmentSize(Hash, 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(4096), size)
+	assert.Equal(t, logfile.FormatVersion, m2.segments[Hash][0].Version)
+
+	err = m2.retainSegments(map[DataType][]uint32{Hash: {0}})
+	assert.Nil(t, err)
+	_, ok = m2.segmentSize(String, 1)
+	assert.False(t, ok)
+}
+
+func TestGoDb_ChangeLogFileSizeThreshold(t *testing.T) {
+	path := filepath.Join("/tmp", "godb")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	writeCount := 10000
+	for i := 0; i < writeCount; i++ {
+		err := db.Set(GetKey(i), GetValue128B())
+		assert.Nil(t, err)
+	}
+	_ = db.Close()
+
+	// reopen with a bigger threshold.
+	opts.LogFileSizeThreshold = 4 << 20
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// the existing log files keep the size they were created with.
+	active := db.getActiveLogFile(String)
+	assert.Equal(t, int64(1<<20), active.Size)
+	for fid := range db.archivedLogFiles[String] {
+		size, ok := db.manifest.segmentSize(String, fid)
+		assert.True(t, ok)
+		assert.Equal(t, int64(1<<20), size)
+	}
+
+	for i := writeCount; i < writeCount*2; i++ {
+		err := db.Set(GetKey(i), GetValue128B())
+		assert.Nil(t, err)
+	}
+	// new log files use the new threshold.
+	active = db.getActiveLogFile(String)
+	assert.Equal(t, int64(4<<20), active.Size)
+
+	for i := 0; i < writeCount*2; i++ {
+		_, err := db.Get(GetKey(i))
+		assert.Nil(t, err)
+	}
+}
@@ -10,6 +10,13 @@ func Mmap(fd *os.File, writable bool, size int64) ([]byte, error) {
 	return mmap(fd, writable, size)
 }
 
+// Mremap remaps a previously mapped slice with a new size.
+// The file will be truncated to the new size if it is smaller, so the whole mapped region is backed by the file.
+// The returned slice may have a different address, b must not be used after remapping.
+func Mremap(fd *os.File, b []byte, size int64) ([]byte, error) {
+	return mremap(fd, b, size)
+}
+
 // Munmap unmaps a previously mapped slice.
 func Munmap(b []byte) error {
 	return munmap(b)
@@ -26,3 +33,15 @@ func Madvise(b []byte, readahead bool) error {
 func Msync(b []byte) error {
 	return msync(b)
 }
+
+// extend the file to size if it is smaller.
+func extendFile(fd *os.File, size int64) error {
+	stat, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() < size {
+		return fd.Truncate(size)
+	}
+	return nil
+}
@@ -18,8 +18,16 @@ func mmap(fd *os.File, writable bool, size int64) ([]byte, error) {
 	return unix.Mmap(int(fd.Fd()), 0, int(size), mtype, unix.MAP_SHARED)
 }
 
-// mremap is a Linux-specific system call to remap pages in memory. This can be used in place of munmap + mmap.
-func mremap(data []byte, size int) ([]byte, error) {
+// mremap extend the file and remap the mapped region by mremap system call.
+func mremap(fd *os.File, data []byte, size int64) ([]byte, error) {
+	if err := extendFile(fd, size); err != nil {
+		return nil, err
+	}
+	return mremapSys(data, int(size))
+}
+
+// mremapSys is a Linux-specific system call to remap pages in memory. This can be used in place of munmap + mmap.
+func mremapSys(data []byte, size int) ([]byte, error) {
 	// taken from <https://github.com/torvalds/linux/blob/f8394f232b1eab649ce2df5c5f15b0e528c92091/include/uapi/linux/mman.h#L8>
 	const MREMAP_MAYMOVE = 0x1
 
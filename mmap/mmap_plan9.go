@@ -11,6 +11,11 @@ func mmap(fd *os.File, writable bool, size int64) ([]byte, error) {
 	return nil, syscall.EPLAN9
 }
 
+// mremap remaps a previously mapped slice with a new size.
+func mremap(fd *os.File, b []byte, size int64) ([]byte, error) {
+	return nil, syscall.EPLAN9
+}
+
 // Munmap unmaps a previously mapped slice.
 func munmap(b []byte) error {
 	return syscall.EPLAN9
@@ -73,6 +73,40 @@ func TestMunmap(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestMremap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godb-mmap-test")
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "mmap.txt")
+
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	assert.Nil(t, err)
+	defer func() {
+		if fd != nil {
+			_ = fd.Close()
+			destroyDir(path)
+		}
+	}()
+
+	err = fd.Truncate(4096)
+	assert.Nil(t, err)
+	buf, err := Mmap(fd, true, 4096)
+	assert.Nil(t, err)
+	copy(buf, "lotusdb")
+
+	buf, err = Mremap(fd, buf, 8192)
+	assert.Nil(t, err)
+	assert.Equal(t, 8192, len(buf))
+	assert.Equal(t, []byte("lotusdb"), buf[:7])
+	// the file is extended, so the new region is writable.
+	copy(buf[8000:], "lotusdb")
+	stat, err := fd.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8192), stat.Size())
+
+	err = Munmap(buf)
+	assert.Nil(t, err)
+}
+
 func TestMsync(t *testing.T) {
 	dir, err := ioutil.TempDir("", "godb-mmap-test")
 	assert.Nil(t, err)
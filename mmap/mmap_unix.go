@@ -18,6 +18,17 @@ func mmap(fd *os.File, writable bool, size int64) ([]byte, error) {
 	return unix.Mmap(int(fd.Fd()), 0, int(size), mtype, unix.MAP_SHARED)
 }
 
+// mremap unmap the mapped region, extend the file and map it again, there is no mremap system call.
+func mremap(fd *os.File, b []byte, size int64) ([]byte, error) {
+	if err := munmap(b); err != nil {
+		return nil, err
+	}
+	if err := extendFile(fd, size); err != nil {
+		return nil, err
+	}
+	return mmap(fd, true, size)
+}
+
 // Munmap unmaps a previously mapped slice.
 func munmap(b []byte) error {
 	return unix.Munmap(b)
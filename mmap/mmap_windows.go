@@ -65,6 +65,17 @@ func mmap(fd *os.File, write bool, size int64) ([]byte, error) {
 	return data, nil
 }
 
+// mremap unmap the mapped region, extend the file and map it again, there is no mremap system call.
+func mremap(fd *os.File, b []byte, size int64) ([]byte, error) {
+	if err := munmap(b); err != nil {
+		return nil, err
+	}
+	if err := extendFile(fd, size); err != nil {
+		return nil, err
+	}
+	return mmap(fd, true, size)
+}
+
 func munmap(b []byte) error {
 	return syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(&b[0])))
 }
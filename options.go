@@ -14,9 +14,17 @@ const (
 	// KeyOnlyMemMode only key in memory, there is a disk seek while getting a value.
 	// Because values are in log file on disk.
 	KeyOnlyMemMode
+
+	// DiskIndexMode keys are indexed in a B+tree file on disk, only hot pages of it are cached in memory.
+	// So the number of keys is not limited by memory, but reading a cold key may need more disk seeks.
+	// The index file is reused if db was closed properly, otherwise it is rebuilt from log files when opening.
+	// Only String keys are indexed on disk, keys of List, Hash, Set and ZSet and the ZSet skip list are in memory like KeyOnlyMemMode,
+	// so the number of collection members is still limited by memory. Store large datasets as String keys in this mode.
+	// The size of String keys is limited to 1KB in this mode, and it is ignored in InMemory mode.
+	DiskIndexMode
 )
 
-// IOType represents different types of file io: FileIO(standard file io) and MMap(Memory Map).
+// IOType represents different types of file io: FileIO(standard file io), MMap(Memory Map), DirectIO and Hybrid.
 type IOType int8
 
 const (
@@ -24,6 +32,45 @@ const (
 	FileIO IOType = iota
 	// MMap Memory Map.
 	MMap
+	// DirectIO file io bypassing the OS page cache(O_DIRECT on linux, F_NOCACHE on darwin).
+	// Reads always go to disk, so it is recommended to use it with KeyValueMemMode.
+	DirectIO
+	// Hybrid the active log file is written by standard file io, and archived log files are mapped read-only.
+	// Writes avoid the page fault overhead of mmap, while random reads on cold data stay cheap.
+	Hybrid
+)
+
+// IndexType the in-memory data structure of index.
+type IndexType int8
+
+const (
+	// ARTIndex adaptive radix tree, keys are ordered and common prefixes are shared.
+	ARTIndex IndexType = iota
+	// BTreeIndex in-memory B-tree, keys are ordered and seeking a key is cheap.
+	BTreeIndex
+	// HashMapIndex keys are unordered, reads and writes are the cheapest.
+	// But scanning keys(Scan, HScan) has to sort all keys, so it is suitable for workloads that never scan.
+	HashMapIndex
+)
+
+// EvictionPolicy decides which keys will be evicted when the memory usage reaches Options.MaxMemory.
+type EvictionPolicy int8
+
+const (
+	// AllKeysLRU evict the least recently used keys.
+	AllKeysLRU EvictionPolicy = iota
+	// AllKeysLFU evict the least frequently used keys.
+	AllKeysLFU
+	// AllKeysRandom evict random keys.
+	AllKeysRandom
+	// VolatileLRU evict the least recently used keys among the keys with an expiration time.
+	VolatileLRU
+	// VolatileLFU evict the least frequently used keys among the keys with an expiration time.
+	VolatileLFU
+	// VolatileRandom evict random keys among the keys with an expiration time.
+	VolatileRandom
+	// VolatileTTL evict the keys with the nearest expiration time.
+	VolatileTTL
 )
 
 // Options for opening a db.
@@ -31,12 +78,12 @@ type Options struct {
 	// DBPath db path, will be created automatically if not exist.
 	DBPath string
 
-	// IndexMode mode of index, support KeyValueMemMode and KeyOnlyMemMode now.
+	// IndexMode mode of index, support KeyValueMemMode, KeyOnlyMemMode and DiskIndexMode now.
 	// Note that this mode is only for kv pairs, not List, Hash, Set, and ZSet.
 	// Default value is KeyOnlyMemMode.
 	IndexMode DataIndexMode
 
-	// IoType file r/w io type, support FileIO and MMap now.
+	// IoType file r/w io type, support FileIO, MMap, DirectIO and Hybrid now.
 	// Default value is FileIO.
 	IoType IOType
 
@@ -58,15 +105,79 @@ type Options struct {
 	LogFileGCRatio float64
 
 	// LogFileSizeThreshold threshold size of each log file, active log file will be closed if reach the threshold.
-	// Important!!! This option must be set to the same value as the first startup.
+	// The actual size of every log file is recorded in MANIFEST, so this option can be changed between restarts.
+	// Existing log files keep their recorded size, and only new log files will use the new threshold.
 	// Default value is 512MB.
 	LogFileSizeThreshold int64
 
+	// InMemory all log files are kept in memory, there are no disk files, file locks or discard files at all.
+	// DBPath and IoType are ignored in this mode, and all data will be lost after the db is closed.
+	// It is suitable for unit tests, or using godb as an embedded cache.
+	// Default value is false.
+	InMemory bool
+
+	// ReadOnly open the db in read-only mode, all mutating methods will return ErrReadOnly.
+	// A shared file lock is taken, so multiple read-only instances(even in different processes) can open the same db at the same time,
+	// but not together with a writable one. Log files are mapped read-only whatever IoType is, and log file gc will never run.
+	// Default value is false.
+	ReadOnly bool
+
 	// DiscardBufferSize a channel will be created to send the older entry size when a key updated or deleted.
 	// Entry size will be saved in the discard file, recording the invalid size in a log file, and be used when log file gc is running.
 	// This option represents the size of that channel.
 	// If you got errors like `send discard chan fail`, you can increase this option to avoid it.
 	DiscardBufferSize int
+
+	// IndexTypes the in-memory index of each data type, for String it is the index of keys,
+	// and for List, Hash, Set and ZSet it is the index of members in every collection.
+	// It doesn`t work for String keys in DiskIndexMode. ZSet scores are always indexed by the skip list.
+	// Default value is ARTIndex for all data types.
+	IndexTypes map[DataType]IndexType
+
+	// IndexCacheSize max bytes of index pages cached in memory in DiskIndexMode.
+	// Default value is 64MB.
+	IndexCacheSize int64
+
+	// ValueCacheSize max bytes of the value cache, values read from log files are cached in a sharded LRU cache.
+	// It only works in KeyOnlyMemMode and DiskIndexMode, hot values can be read without accessing log files.
+	// Default value is 0, means the value cache is disabled.
+	ValueCacheSize int64
+
+	// MaxMemory max bytes of in-memory index and values(in KeyValueMemMode), it is an estimate, not an exact number.
+	// Keys of all data types will be evicted by writing delete entries according to EvictionPolicy when it is exceeded,
+	// before the next write like redis, so writes wait for the eviction instead of outpacing it.
+	// String keys are not counted or evicted in DiskIndexMode, since they are not in memory.
+	// It is useful when godb is used as a persistent cache.
+	// Default value is 0, means no limit.
+	MaxMemory int64
+
+	// EvictionPolicy which keys will be evicted when MaxMemory is reached.
+	// A List, Hash, Set or Sorted Set is evicted as a whole.
+	// Default value is AllKeysLRU.
+	EvictionPolicy EvictionPolicy
+
+	// HashMaxPacked a Hash with no more fields than it is indexed in a compact packed encoding,
+	// which is a slice sorted by field instead of the index in IndexTypes.
+	// It is converted to the full index when it grows larger, and never converted back.
+	// Millions of small hashes take much less memory in this encoding.
+	// Default value is 128, 0 means hashes are never packed.
+	HashMaxPacked int
+
+	// SetMaxPacked a Set with no more members than it is indexed in a compact packed encoding, see HashMaxPacked.
+	// Default value is 128, 0 means sets are never packed.
+	SetMaxPacked int
+
+	// ZSetMaxPacked a Sorted Set with no more members than it is indexed in a compact packed encoding,
+	// and its scores are kept in a slice ordered by score instead of the skip list, see HashMaxPacked.
+	// Default value is 128, 0 means sorted sets are never packed.
+	ZSetMaxPacked int
+
+	// ActiveExpireInterval a background goroutine deletes expired keys periodically according to the interval,
+	// by writing delete entries like Del, so keys that are never read again don`t stay in index and log files forever.
+	// Keys are deleted in the order of expiration time, and a round takes at most a quarter of the interval.
+	// String keys are not deleted in DiskIndexMode, since they are not in memory, but they are still invisible once expired.
+	// Default value is 100ms, 0 means expired keys are only deleted when they are written again.
+	ActiveExpireInterval time.Duration
 }
 
 // DefaultOptions default options for opening a GoDb.
@@ -80,5 +191,10 @@ func DefaultOptions(path string) Options {
 		LogFileGCRatio:       0.5,
 		LogFileSizeThreshold: 512 << 20,
 		DiscardBufferSize:    8 << 20,
+		IndexCacheSize:       64 << 20,
+		HashMaxPacked:        128,
+		SetMaxPacked:         128,
+		ZSetMaxPacked:        128,
+		ActiveExpireInterval: time.Millisecond * 100,
 	}
 }
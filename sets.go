@@ -1,7 +1,6 @@
 package godb
 
 import (
-	"github.com/herott-ai/godb/ds/art"
 	"github.com/herott-ai/godb/logfile"
 	"github.com/herott-ai/godb/logger"
 	"github.com/herott-ai/godb/util"
@@ -11,31 +10,25 @@ import (
 // Specified members that are already a member of this set are ignored.
 // If key does not exist, a new set is created before adding the specified members.
 func (db *GoDb) SAdd(key []byte, members ...[]byte) error {
-	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
+	db.setIndex.locks.lock(key)
+	defer db.setIndex.locks.unlock(key)
 
-	if db.setIndex.trees[string(key)] == nil {
-		db.setIndex.trees[string(key)] = art.NewART()
+	if err := db.checkWrite(key, Set); err != nil {
+		return err
 	}
-	idxTree := db.setIndex.trees[string(key)]
+	idxTree := db.setIndex.treeOrCreate(key)
 	for _, mem := range members {
 		if len(mem) == 0 {
 			continue
 		}
-		if err := db.setIndex.murhash.Write(mem); err != nil {
-			return err
-		}
-		sum := db.setIndex.murhash.EncodeSum128()
-		db.setIndex.murhash.Reset()
+		sum := util.Sum128(mem)
 
 		ent := &logfile.LogEntry{Key: key, Value: mem}
-		valuePos, err := db.writeLogEntry(ent, Set)
+		valuePos, err := db.writeMember(Set, key, ent)
 		if err != nil {
 			return err
 		}
 		entry := &logfile.LogEntry{Key: sum, Value: mem}
-		_, size := logfile.EncodeEntry(ent)
-		valuePos.entrySize = size
 		if err := db.updateIndexTree(idxTree, entry, valuePos, true, Set); err != nil {
 			return err
 		}
@@ -45,22 +38,19 @@ func (db *GoDb) SAdd(key []byte, members ...[]byte) error {
 
 // SPop removes and returns one or more random members from the set value store at key.
 func (db *GoDb) SPop(key []byte, count uint) ([][]byte, error) {
-	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
-	if db.setIndex.trees[string(key)] == nil {
-		return nil, nil
+	db.setIndex.locks.lock(key)
+	defer db.setIndex.locks.unlock(key)
+	idxTree := db.setIndex.tree(key)
+	if idxTree == nil {
+		return nil, db.checkType(key, Set)
 	}
-	idxTree := db.setIndex.trees[string(key)]
 
 	var values [][]byte
 	iter := idxTree.Iterator()
 	for iter.HasNext() && count > 0 {
 		count--
-		node, _ := iter.Next()
-		if node == nil {
-			continue
-		}
-		val, err := db.getVal(idxTree, node.Key(), Set)
+		sum, _ := iter.Next()
+		val, err := db.getVal(idxTree, sum, Set)
 		if err != nil {
 			return nil, err
 		}
@@ -78,11 +68,11 @@ func (db *GoDb) SPop(key []byte, count uint) ([][]byte, error) {
 // Specified members that are not a member of this set are ignored.
 // If key does not exist, it is treated as an empty set and this command returns 0.
 func (db *GoDb) SRem(key []byte, members ...[]byte) error {
-	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
+	db.setIndex.locks.lock(key)
+	defer db.setIndex.locks.unlock(key)
 
-	if db.setIndex.trees[string(key)] == nil {
-		return nil
+	if db.setIndex.tree(key) == nil {
+		return db.checkType(key, Set)
 	}
 	for _, mem := range members {
 		if err := db.sremInternal(key, mem); err != nil {
@@ -92,49 +82,52 @@ func (db *GoDb) SRem(key []byte, members ...[]byte) error {
 	return nil
 }
 
+// SClear deletes the set stored at key with all its members.
+// It writes only one record no matter how many members the set has, the members are reclaimed by log file gc later.
+func (db *GoDb) SClear(key []byte) error {
+	return db.dropCollection(Set, key)
+}
+
 // SIsMember returns if member is a member of the set stored at key.
 func (db *GoDb) SIsMember(key, member []byte) bool {
-	db.setIndex.mu.RLock()
-	defer db.setIndex.mu.RUnlock()
+	db.setIndex.locks.rLock(key)
+	defer db.setIndex.locks.rUnlock(key)
 
-	if db.setIndex.trees[string(key)] == nil {
+	idxTree := db.setIndex.tree(key)
+	if idxTree == nil {
 		return false
 	}
-	idxTree := db.setIndex.trees[string(key)]
-	if err := db.setIndex.murhash.Write(member); err != nil {
-		return false
-	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
+	sum := util.Sum128(member)
 	node := idxTree.Get(sum)
 	return node != nil
 }
 
 // SMembers returns all the members of the set value stored at key.
 func (db *GoDb) SMembers(key []byte) ([][]byte, error) {
-	db.setIndex.mu.RLock()
-	defer db.setIndex.mu.RUnlock()
+	db.setIndex.locks.rLock(key)
+	defer db.setIndex.locks.rUnlock(key)
 	return db.sMembers(key)
 }
 
 // SCard returns the set cardinality (number of elements) of the set stored at key.
 func (db *GoDb) SCard(key []byte) int {
-	db.setIndex.mu.RLock()
-	defer db.setIndex.mu.RUnlock()
-	if db.setIndex.trees[string(key)] == nil {
+	db.setIndex.locks.rLock(key)
+	defer db.setIndex.locks.rUnlock(key)
+	idxTree := db.setIndex.tree(key)
+	if idxTree == nil {
 		return 0
 	}
-	return db.setIndex.trees[string(key)].Size()
+	return idxTree.Size()
 }
 
 // SDiff returns the members of the set difference between the first set and
 // all the successive sets. Returns error if no key is passed as a parameter.
 func (db *GoDb) SDiff(keys ...[]byte) ([][]byte, error) {
-	db.setIndex.mu.RLock()
-	defer db.setIndex.mu.RUnlock()
 	if len(keys) == 0 {
 		return nil, ErrWrongNumberOfArgs
 	}
+	unlock := db.setIndex.locks.lockKeys(keys, false)
+	defer unlock()
 	if len(keys) == 1 {
 		return db.sMembers(keys[0])
 	}
@@ -184,12 +177,11 @@ func (db *GoDb) SDiffStore(keys ...[]byte) (int, error) {
 
 // SUnion returns the members of the set resulting from the union of all the given sets.
 func (db *GoDb) SUnion(keys ...[]byte) ([][]byte, error) {
-	db.setIndex.mu.RLock()
-	defer db.setIndex.mu.RUnlock()
-
 	if len(keys) == 0 {
 		return nil, ErrWrongNumberOfArgs
 	}
+	unlock := db.setIndex.locks.lockKeys(keys, false)
+	defer unlock()
 	if len(keys) == 1 {
 		return db.sMembers(keys[0])
 	}
@@ -226,27 +218,22 @@ func (db *GoDb) SUnionStore(keys ...[]byte) (int, error) {
 }
 
 func (db *GoDb) sremInternal(key []byte, member []byte) error {
-	idxTree := db.setIndex.trees[string(key)]
-	if err := db.setIndex.murhash.Write(member); err != nil {
-		return err
-	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
+	idxTree := db.setIndex.tree(key)
+	sum := util.Sum128(member)
 
-	val, updated := idxTree.Delete(sum)
-	if !updated {
+	if idxTree.Get(sum) == nil {
 		return nil
 	}
 	entry := &logfile.LogEntry{Key: key, Value: sum, Type: logfile.TypeDelete}
-	pos, err := db.writeLogEntry(entry, Set)
+	pos, err := db.writeMember(Set, key, entry)
 	if err != nil {
 		return err
 	}
 
+	val, updated := idxTree.Delete(sum)
 	db.sendDiscard(val, updated, Set)
 	// The deleted entry itself is also invalid.
-	_, size := logfile.EncodeEntry(entry)
-	node := &indexNode{fid: pos.fid, entrySize: size}
+	node := &indexNode{fid: pos.fid, entrySize: pos.entrySize}
 	select {
 	case db.discards[Set].valChan <- node:
 	default:
@@ -257,35 +244,38 @@ func (db *GoDb) sremInternal(key []byte, member []byte) error {
 
 // sMembers is a helper method to get all members of the given set key.
 func (db *GoDb) sMembers(key []byte) ([][]byte, error) {
-	if db.setIndex.trees[string(key)] == nil {
-		return nil, nil
+	idxTree := db.setIndex.tree(key)
+	if idxTree == nil {
+		return nil, db.checkType(key, Set)
 	}
 
-	var values [][]byte
-	idxTree := db.setIndex.trees[string(key)]
+	sums := make([][]byte, 0, idxTree.Size())
 	iterator := idxTree.Iterator()
 	for iterator.HasNext() {
-		node, _ := iterator.Next()
-		if node == nil {
-			continue
-		}
-		val, err := db.getVal(idxTree, node.Key(), Set)
-		if err != nil {
-			return nil, err
+		sum, _ := iterator.Next()
+		sums = append(sums, sum)
+	}
+	vals, err := db.getVals(idxTree, sums, Set)
+	if err != nil {
+		return nil, err
+	}
+
+	var values [][]byte
+	for _, val := range vals {
+		if val != nil {
+			values = append(values, val)
 		}
-		values = append(values, val)
 	}
 	return values, nil
 }
 
 // SInter returns the members of the set resulting from the inter of all the given sets.
 func (db *GoDb) SInter(keys ...[]byte) ([][]byte, error) {
-	db.setIndex.mu.RLock()
-	defer db.setIndex.mu.RUnlock()
-
 	if len(keys) == 0 {
 		return nil, ErrWrongNumberOfArgs
 	}
+	unlock := db.setIndex.locks.lockKeys(keys, false)
+	defer unlock()
 	if len(keys) == 1 {
 		return db.sMembers(keys[0])
 	}
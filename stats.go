@@ -0,0 +1,45 @@
+package godb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats statistics of a godb instance.
+type Stats struct {
+	// ValueCacheHits number of reads served by value cache.
+	ValueCacheHits uint64
+	// ValueCacheMisses number of reads that missed value cache and went to log files.
+	ValueCacheMisses uint64
+	// ValueCacheCount number of values in value cache.
+	ValueCacheCount int
+	// ValueCacheBytes bytes used by value cache.
+	ValueCacheBytes int64
+	// MemoryUsage approximate memory used by indexes of all data types.
+	MemoryUsage int64
+	// EvictedKeys number of keys evicted since db opened because of MaxMemory.
+	EvictedKeys uint64
+	// ExpiredKeys number of expired keys and hash fields deleted in background since db opened, see Options.ActiveExpireInterval.
+	ExpiredKeys uint64
+	// VolatileKeys number of keys and hash fields that have expiration time and will be deleted in background when expired.
+	VolatileKeys int
+	// IndexLoadTime time spent on loading index from log files when db opened.
+	IndexLoadTime time.Duration
+}
+
+// Stats returns the statistics of db.
+func (db *GoDb) Stats() Stats {
+	stats := Stats{
+		MemoryUsage:   atomic.LoadInt64(&db.memUsage),
+		EvictedKeys:   atomic.LoadUint64(&db.evictedKeys),
+		ExpiredKeys:   atomic.LoadUint64(&db.expiredKeys),
+		VolatileKeys:  db.expires.len(),
+		IndexLoadTime: db.indexLoadTime,
+	}
+	if db.valueCache != nil {
+		stats.ValueCacheHits = atomic.LoadUint64(&db.valueCache.hits)
+		stats.ValueCacheMisses = atomic.LoadUint64(&db.valueCache.misses)
+		stats.ValueCacheCount, stats.ValueCacheBytes = db.valueCache.stats()
+	}
+	return stats
+}
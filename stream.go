@@ -0,0 +1,110 @@
+package godb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/herott-ai/godb/logfile"
+)
+
+// streamThreshold values of entries smaller than it are read at once by GetReader.
+const streamThreshold = 1 << 20
+
+// SetReader set key to hold the value read from r, which must be size bytes.
+// The value is streamed into log file in chunks instead of being held in memory, and other writes of String wait until it is done.
+// The value must fit in a log file, or ErrValueTooLarge is returned. In KeyValueMemMode, it is not kept in memory until db is reopened.
+func (db *GoDb) SetReader(key []byte, r io.Reader, size int64) error {
+	if size < 0 {
+		return ErrInvalidValueSize
+	}
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
+
+	// the collections are dropped first, so check the size before that.
+	entry := &logfile.LogEntry{Key: key}
+	if int64(logfile.EncodedSize(entry))+size > db.opts.LogFileSizeThreshold {
+		return ErrValueTooLarge
+	}
+	if err := db.dropOthers(key); err != nil {
+		return err
+	}
+	valuePos, err := db.writeLogEntryFrom(entry, r, size, String)
+	if err == logfile.ErrEntryTooLarge {
+		return ErrValueTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	return db.updateIndexTree(db.strIndex, entry, valuePos, true, String)
+}
+
+// GetReader returns a reader of the value of key, large values are read from log file on demand instead of at once.
+// If the key does not exist the error ErrKeyNotFound is returned.
+// The reader fails with ErrLogFileNotFound if the log file is garbage collected before the value is read,
+// and with logfile.ErrInvalidCrc at the end if the value is corrupted.
+func (db *GoDb) GetReader(key []byte) (io.ReadCloser, error) {
+	idxNode, val, err := db.getMemVal(db.strIndex, key, String)
+	if err != nil {
+		return nil, err
+	}
+	if idxNode == nil {
+		return ioutil.NopCloser(bytes.NewReader(val)), nil
+	}
+
+	var ent *logfile.LogEntry
+	var reader io.Reader
+	if idxNode.entrySize < streamThreshold {
+		if ent, err = db.readLogEntry(String, idxNode.fid, idxNode.offset); err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(ent.Value)
+	} else {
+		ra := &logFileReader{db: db, dataType: String, fid: idxNode.fid}
+		vr, err := logfile.NewValueReader(ra, idxNode.offset)
+		if err != nil {
+			return nil, err
+		}
+		version, err := ra.version()
+		if err != nil {
+			return nil, err
+		}
+		vr.Entry.ExpiredAt = logfile.ExpiredAtMilli(version, vr.Entry.ExpiredAt)
+		ent, reader = vr.Entry, vr
+	}
+	// key exists, but is invalid(deleted or expired)
+	if ent.Type == logfile.TypeDelete || (ent.ExpiredAt != 0 && ent.ExpiredAt < time.Now().UnixMilli()) {
+		return nil, ErrKeyNotFound
+	}
+	return ioutil.NopCloser(reader), nil
+}
+
+// logFileReader reads the log file fid, which is looked up on every read, so a closed log file is never read.
+type logFileReader struct {
+	db       *GoDb
+	dataType DataType
+	fid      uint32
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *logFileReader) ReadAt(b []byte, offset int64) (int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	logFile := r.db.logFile(r.dataType, r.fid)
+	if logFile == nil {
+		return 0, ErrLogFileNotFound
+	}
+	return logFile.ReadAt(b, offset)
+}
+
+// version returns the format version of the log file.
+func (r *logFileReader) version() (uint32, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	logFile := r.db.logFile(r.dataType, r.fid)
+	if logFile == nil {
+		return 0, ErrLogFileNotFound
+	}
+	return logFile.Version, nil
+}
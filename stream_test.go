@@ -0,0 +1,117 @@
+package godb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoDb_SetReader(t *testing.T) {
+	t.Run("fileio", func(t *testing.T) {
+		testGoDbSetReader(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testGoDbSetReader(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-value", func(t *testing.T) {
+		testGoDbSetReader(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func testGoDbSetReader(t *testing.T, ioType IOType, mode DataIndexMode) {
+	path := filepath.Join("/tmp", "godb-stream")
+	opts := DefaultOptions(path)
+	opts.IoType = ioType
+	opts.IndexMode = mode
+	opts.LogFileSizeThreshold = 8 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	bigValue := GetValue(3 << 20)
+	err = db.SetReader(GetKey(1), bytes.NewReader(bigValue), int64(len(bigValue)))
+	assert.Nil(t, err)
+	// the second one is written to a new log file.
+	err = db.SetReader(GetKey(2), bytes.NewReader(bigValue), int64(len(bigValue)))
+	assert.Nil(t, err)
+	err = db.SetReader(GetKey(2), bytes.NewReader(bigValue), int64(len(bigValue)))
+	assert.Nil(t, err)
+	err = db.SetReader(GetKey(3), bytes.NewReader([]byte("small")), 5)
+	assert.Nil(t, err)
+	err = db.SetReader(GetKey(4), bytes.NewReader(nil), 0)
+	assert.Nil(t, err)
+
+	// the reader is shorter than size.
+	err = db.SetReader(GetKey(5), bytes.NewReader(bigValue[:100]), int64(len(bigValue)))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	err = db.SetReader(GetKey(5), bytes.NewReader(nil), 8<<20)
+	assert.Equal(t, ErrValueTooLarge, err)
+	err = db.SetReader(GetKey(5), bytes.NewReader(nil), -1)
+	assert.Equal(t, ErrInvalidValueSize, err)
+	err = db.Set(GetKey(6), []byte("after"))
+	assert.Nil(t, err)
+
+	check := func(db *GoDb) {
+		for key, want := range map[int][]byte{1: bigValue, 2: bigValue, 3: []byte("small"), 4: {}, 6: []byte("after")} {
+			r, err := db.GetReader(GetKey(key))
+			assert.Nil(t, err)
+			val, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+			assert.Nil(t, r.Close())
+			assert.Equal(t, len(want), len(val))
+			assert.True(t, bytes.Equal(want, val))
+
+			val, err = db.Get(GetKey(key))
+			assert.Nil(t, err)
+			assert.True(t, bytes.Equal(want, val))
+		}
+		_, err := db.GetReader(GetKey(5))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	check(db)
+
+	err = db.Delete(GetKey(1))
+	assert.Nil(t, err)
+	_, err = db.GetReader(GetKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	err = db.SetReader(GetKey(1), bytes.NewReader(bigValue), int64(len(bigValue)))
+	assert.Nil(t, err)
+	_ = db.Close()
+
+	// streamed entries are loaded like others.
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	check(db)
+}
+
+func TestGoDb_SetReaderFailed(t *testing.T) {
+	path := filepath.Join("/tmp", "godb-stream")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// the reader fails after a part of the value is written, the part must not be mixed up with the next entry.
+	value := GetValue(1 << 20)
+	r := io.MultiReader(bytes.NewReader(value[:len(value)/2]), iotest.ErrReader(errors.New("boom")))
+	err = db.SetReader(GetKey(1), r, int64(len(value)))
+	assert.NotNil(t, err)
+	assert.Nil(t, db.Set(GetKey(2), []byte("after")))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	_, err = db.Get(GetKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db.Get(GetKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("after"), val)
+}
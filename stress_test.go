@@ -0,0 +1,207 @@
+package godb
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The stress tests run readers and writers of a data type at the same time, they are meant to be run with -race:
+//   go test -race -run TestStress .
+// Readers only check the stable keys or members written before the test, writers keep changing the others.
+
+const (
+	stressWorkers = 4
+	stressRounds  = 300
+	stressStable  = 100
+)
+
+// runStress runs write and read by stressWorkers goroutines each, for stressRounds times.
+func runStress(t *testing.T, name string, prepare, write, read func(db *GoDb, worker, round int)) {
+	path := filepath.Join("/tmp", "godb-stress-"+name)
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 1 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 0; i < stressStable; i++ {
+		prepare(db, 0, i)
+	}
+	wg := new(sync.WaitGroup)
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < stressRounds; i++ {
+				write(db, w, i)
+			}
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < stressRounds; i++ {
+				read(db, w, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func stableMember(i int) []byte {
+	return []byte(fmt.Sprintf("stable-%d", i%stressStable))
+}
+
+func volatileMember(worker, round int) []byte {
+	return []byte(fmt.Sprintf("volatile-%d-%d", worker, round))
+}
+
+func TestStress_String(t *testing.T) {
+	runStress(t, "strs",
+		func(db *GoDb, _, i int) {
+			assert.Nil(t, db.Set(stableMember(i), stableMember(i)))
+		},
+		func(db *GoDb, w, i int) {
+			key := volatileMember(w, i)
+			assert.Nil(t, db.Set(key, key))
+			assert.Nil(t, db.MSet(key, key, volatileMember(w, i+1), key))
+			_, err := db.Incr([]byte("counter"))
+			assert.Nil(t, err)
+			if i%2 == 0 {
+				assert.Nil(t, db.Delete(key))
+			}
+		},
+		func(db *GoDb, _, i int) {
+			val, err := db.Get(stableMember(i))
+			assert.Nil(t, err)
+			assert.Equal(t, stableMember(i), val)
+			vals, err := db.MGet([][]byte{stableMember(i), stableMember(i + 1)})
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{stableMember(i), stableMember(i + 1)}, vals)
+			_, err = db.Scan([]byte("stable-"), "", 10)
+			assert.Nil(t, err)
+			assert.GreaterOrEqual(t, db.Count(), stressStable)
+		},
+	)
+}
+
+func TestStress_List(t *testing.T) {
+	stableKey, key := []byte("stable-list"), []byte("my_list")
+	runStress(t, "list",
+		func(db *GoDb, _, i int) {
+			assert.Nil(t, db.RPush(stableKey, stableMember(i)))
+			assert.Nil(t, db.RPush(key, stableMember(i)))
+		},
+		func(db *GoDb, w, i int) {
+			assert.Nil(t, db.LPush(key, volatileMember(w, i)))
+			assert.Nil(t, db.RPush(key, volatileMember(w, i)))
+			if i%2 == 0 {
+				_, err := db.LPop(key)
+				assert.Nil(t, err)
+			}
+		},
+		func(db *GoDb, _, i int) {
+			idx := i % stressStable
+			val, err := db.LIndex(stableKey, idx)
+			assert.Nil(t, err)
+			assert.Equal(t, stableMember(i), val)
+			vals, err := db.LRange(stableKey, idx, idx)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{stableMember(i)}, vals)
+			assert.Equal(t, stressStable, db.LLen(stableKey))
+			_, err = db.LRange(key, 0, 10)
+			assert.Nil(t, err)
+		},
+	)
+}
+
+func TestStress_Hash(t *testing.T) {
+	key := []byte("my_hash")
+	runStress(t, "hash",
+		func(db *GoDb, _, i int) {
+			assert.Nil(t, db.HSet(key, stableMember(i), stableMember(i)))
+		},
+		func(db *GoDb, w, i int) {
+			field := volatileMember(w, i)
+			assert.Nil(t, db.HSet(key, field, field))
+			_, err := db.HIncrBy(key, []byte("counter"), 1)
+			assert.Nil(t, err)
+			if i%2 == 0 {
+				_, err := db.HDel(key, field)
+				assert.Nil(t, err)
+			}
+		},
+		func(db *GoDb, _, i int) {
+			val, err := db.HGet(key, stableMember(i))
+			assert.Nil(t, err)
+			assert.Equal(t, stableMember(i), val)
+			vals, err := db.HMGet(key, stableMember(i), stableMember(i+1))
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{stableMember(i), stableMember(i + 1)}, vals)
+			ok, err := db.HExists(key, stableMember(i))
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.GreaterOrEqual(t, db.HLen(key), stressStable)
+		},
+	)
+}
+
+func TestStress_Set(t *testing.T) {
+	stableKey, key := []byte("stable-set"), []byte("my_set")
+	runStress(t, "sets",
+		func(db *GoDb, _, i int) {
+			assert.Nil(t, db.SAdd(stableKey, stableMember(i)))
+		},
+		func(db *GoDb, w, i int) {
+			member := volatileMember(w, i)
+			assert.Nil(t, db.SAdd(key, member, stableMember(i)))
+			if i%2 == 0 {
+				assert.Nil(t, db.SRem(key, member))
+			}
+		},
+		func(db *GoDb, _, i int) {
+			assert.True(t, db.SIsMember(stableKey, stableMember(i)))
+			assert.False(t, db.SIsMember(stableKey, volatileMember(0, i)))
+			assert.Equal(t, stressStable, db.SCard(stableKey))
+			if i%10 == 0 {
+				members, err := db.SMembers(stableKey)
+				assert.Nil(t, err)
+				assert.Equal(t, stressStable, len(members))
+				_, err = db.SUnion(stableKey, key)
+				assert.Nil(t, err)
+			}
+		},
+	)
+}
+
+func TestStress_ZSet(t *testing.T) {
+	stableKey, key := []byte("stable-zset"), []byte("my_zset")
+	runStress(t, "zset",
+		func(db *GoDb, _, i int) {
+			assert.Nil(t, db.ZAdd(stableKey, float64(i), stableMember(i)))
+		},
+		func(db *GoDb, w, i int) {
+			member := volatileMember(w, i)
+			assert.Nil(t, db.ZAdd(key, float64(i), member))
+			if i%2 == 0 {
+				assert.Nil(t, db.ZRem(key, member))
+			}
+		},
+		func(db *GoDb, _, i int) {
+			ok, score := db.ZScore(stableKey, stableMember(i))
+			assert.True(t, ok)
+			assert.Equal(t, float64(i%stressStable), score)
+			ok, rank := db.ZRank(stableKey, stableMember(i))
+			assert.True(t, ok)
+			assert.Equal(t, i%stressStable, rank)
+			vals, err := db.ZRange(stableKey, i%stressStable, i%stressStable)
+			assert.Nil(t, err)
+			assert.Equal(t, [][]byte{stableMember(i)}, vals)
+			assert.Equal(t, stressStable, db.ZCard(stableKey))
+			_, err = db.ZRevRange(key, 0, 10)
+			assert.Nil(t, err)
+		},
+	)
+}
@@ -12,58 +12,33 @@ import (
 	"time"
 )
 
-// Set set key to hold the string value. If key already holds a value, it is overwritten.
+// Set set key to hold the string value. If key already holds a value, it is overwritten, regardless of its data type.
 // Any previous time to live associated with the key is discarded on successful Set operation.
 func (db *GoDb) Set(key, value []byte) error {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
-
-	// write entry to log file.
-	entry := &logfile.LogEntry{Key: key, Value: value}
-	valuePos, err := db.writeLogEntry(entry, String)
-	if err != nil {
-		return err
-	}
-	// set String index info, stored at adaptive radix tree.
-	err = db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
-	return err
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
+	return db.setInternal(key, value, 0)
 }
 
 // Get get the value of key.
 // If the key does not exist the error ErrKeyNotFound is returned.
 func (db *GoDb) Get(key []byte) ([]byte, error) {
-	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-	return db.getVal(db.strIndex.idxTree, key, String)
+	return db.getStr(key)
 }
 
 // MGet get the values of all specified keys.
 // If the key that does not hold a string value or does not exist, nil is returned.
 func (db *GoDb) MGet(keys [][]byte) ([][]byte, error) {
-	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-
 	if len(keys) == 0 {
 		return nil, ErrWrongNumberOfArgs
 	}
-	values := make([][]byte, len(keys))
-	for i, key := range keys {
-		val, err := db.getVal(db.strIndex.idxTree, key, String)
-		if err != nil && !errors.Is(ErrKeyNotFound, err) {
-			return nil, err
-		}
-		values[i] = val
-	}
-	return values, nil
+	return db.getVals(db.strIndex, keys, String)
 }
 
 // GetRange returns the substring of the string value stored at key,
 // determined by the offsets start and end.
 func (db *GoDb) GetRange(key []byte, start, end int) ([]byte, error) {
-	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-
-	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	val, err := db.getStr(key)
 	if err != nil {
 		return nil, err
 	}
@@ -98,10 +73,13 @@ func (db *GoDb) GetRange(key []byte, start, end int) ([]byte, error) {
 // GetDel gets the value of the key and deletes the key. This method is similar
 // to Get method. It also deletes the key if it exists.
 func (db *GoDb) GetDel(key []byte) ([]byte, error) {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
 
-	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err := db.checkType(key, String); err != nil {
+		return nil, err
+	}
+	val, err := db.getVal(db.strIndex, key, String)
 	if err != nil && err != ErrKeyNotFound {
 		return nil, err
 	}
@@ -115,9 +93,12 @@ func (db *GoDb) GetDel(key []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	oldVal, updated := db.strIndex.idxTree.Delete(key)
+	oldVal, updated := db.strIndex.Delete(key)
+	if err := db.indexErr(db.strIndex); err != nil {
+		return nil, err
+	}
 	db.sendDiscard(oldVal, updated, String)
-	_, size := logfile.EncodeEntry(entry)
+	size := logfile.EncodedSize(entry)
 	node := &indexNode{fid: pos.fid, entrySize: size}
 	select {
 	case db.discards[String].valChan <- node:
@@ -129,18 +110,25 @@ func (db *GoDb) GetDel(key []byte) ([]byte, error) {
 
 // Delete value at the given key.
 func (db *GoDb) Delete(key []byte) error {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
+	return db.deleteInternal(key)
+}
 
+// deleteInternal is the same as Delete, but the key lock must be held.
+func (db *GoDb) deleteInternal(key []byte) error {
 	entry := &logfile.LogEntry{Key: key, Type: logfile.TypeDelete}
 	pos, err := db.writeLogEntry(entry, String)
 	if err != nil {
 		return err
 	}
-	val, updated := db.strIndex.idxTree.Delete(key)
+	val, updated := db.strIndex.Delete(key)
+	if err := db.indexErr(db.strIndex); err != nil {
+		return err
+	}
 	db.sendDiscard(val, updated, String)
 	// The deleted entry itself is also invalid.
-	_, size := logfile.EncodeEntry(entry)
+	size := logfile.EncodedSize(entry)
 	node := &indexNode{fid: pos.fid, entrySize: size}
 	select {
 	case db.discards[String].valChan <- node:
@@ -152,30 +140,38 @@ func (db *GoDb) Delete(key []byte) error {
 
 // SetEX set key to hold the string value and set key to timeout after the given duration.
 func (db *GoDb) SetEX(key, value []byte, duration time.Duration) error {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
+	return db.setInternal(key, value, time.Now().Add(duration).UnixMilli())
+}
 
-	expiredAt := time.Now().Add(duration).Unix()
+// setInternal set key to hold the string value which expires at expiredAt, 0 means it never expires.
+// The collections stored at key are dropped, the key lock must be held.
+func (db *GoDb) setInternal(key, value []byte, expiredAt int64) error {
+	if err := db.dropOthers(key); err != nil {
+		return err
+	}
+	// write entry to log file.
 	entry := &logfile.LogEntry{Key: key, Value: value, ExpiredAt: expiredAt}
 	valuePos, err := db.writeLogEntry(entry, String)
 	if err != nil {
 		return err
 	}
-
-	return db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
+	// set String index info, stored at adaptive radix tree.
+	return db.updateIndexTree(db.strIndex, entry, valuePos, true, String)
 }
 
-// SetNX sets the key-value pair if it is not exist. It returns nil if the key already exists.
+// SetNX sets the key-value pair if it is not exist. It returns nil if the key already exists, regardless of its data type.
 func (db *GoDb) SetNX(key, value []byte) error {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
 
-	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	val, err := db.getVal(db.strIndex, key, String)
 	if err != nil && !errors.Is(err, ErrKeyNotFound) {
 		return err
 	}
 	// Key exists in db.
-	if val != nil {
+	if val != nil || db.checkType(key, String) != nil {
 		return nil
 	}
 
@@ -185,27 +181,29 @@ func (db *GoDb) SetNX(key, value []byte) error {
 		return err
 	}
 
-	return db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
+	return db.updateIndexTree(db.strIndex, entry, valuePos, true, String)
 }
 
 // MSet is multiple set command. Parameter order should be like "key", "value", "key", "value", ...
 func (db *GoDb) MSet(args ...[]byte) error {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
-
 	if len(args) == 0 || len(args)%2 != 0 {
 		return ErrWrongNumberOfArgs
 	}
+	unlock := db.strIndex.locks.lockKeys(pairKeys(args), true)
+	defer unlock()
 
 	// Add multiple key-value pairs.
 	for i := 0; i < len(args); i += 2 {
 		key, value := args[i], args[i+1]
+		if err := db.dropOthers(key); err != nil {
+			return err
+		}
 		entry := &logfile.LogEntry{Key: key, Value: value}
 		valuePos, err := db.writeLogEntry(entry, String)
 		if err != nil {
 			return err
 		}
-		err = db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
+		err = db.updateIndexTree(db.strIndex, entry, valuePos, true, String)
 		if err != nil {
 			return err
 		}
@@ -216,24 +214,23 @@ func (db *GoDb) MSet(args ...[]byte) error {
 // MSetNX sets given keys to their respective values. MSetNX will not perform
 // any operation at all even if just a single key already exists.
 func (db *GoDb) MSetNX(args ...[]byte) error {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
-
 	if len(args) == 0 || len(args)%2 != 0 {
 		return ErrWrongNumberOfArgs
 	}
+	unlock := db.strIndex.locks.lockKeys(pairKeys(args), true)
+	defer unlock()
 
 	// Firstly, check each keys whether they are exists.
 	for i := 0; i < len(args); i += 2 {
 		key := args[i]
-		val, err := db.getVal(db.strIndex.idxTree, key, String)
+		val, err := db.getVal(db.strIndex, key, String)
 		if err != nil && !errors.Is(err, ErrKeyNotFound) {
 			return err
 		}
 
 		// Key exists in db. We discard the rest of the key-value pairs. It
 		// provides the atomicity of the method.
-		if val != nil {
+		if val != nil || db.checkType(key, String) != nil {
 			return nil
 		}
 	}
@@ -251,7 +248,7 @@ func (db *GoDb) MSetNX(args ...[]byte) error {
 		if err != nil {
 			return err
 		}
-		err = db.updateIndexTree(db.strIndex.idxTree, entry, valPos, true, String)
+		err = db.updateIndexTree(db.strIndex, entry, valPos, true, String)
 		if err != nil {
 			return err
 		}
@@ -263,10 +260,13 @@ func (db *GoDb) MSetNX(args ...[]byte) error {
 // Append appends the value at the end of the old value if key already exists.
 // It will be similar to Set if key does not exist.
 func (db *GoDb) Append(key, value []byte) error {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
 
-	oldVal, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err := db.checkType(key, String); err != nil {
+		return err
+	}
+	oldVal, err := db.getVal(db.strIndex, key, String)
 	if err != nil && !errors.Is(err, ErrKeyNotFound) {
 		return err
 	}
@@ -281,7 +281,7 @@ func (db *GoDb) Append(key, value []byte) error {
 	if err != nil {
 		return err
 	}
-	err = db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
+	err = db.updateIndexTree(db.strIndex, entry, valuePos, true, String)
 	return err
 }
 
@@ -290,8 +290,8 @@ func (db *GoDb) Append(key, value []byte) error {
 // error if the value is not integer type. Also, it returns ErrIntegerOverflow
 // error if the value exceeds after decrementing the value.
 func (db *GoDb) Decr(key []byte) (int64, error) {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
 	return db.incrDecrBy(key, -1)
 }
 
@@ -300,8 +300,8 @@ func (db *GoDb) Decr(key []byte) (int64, error) {
 // error if the value is not integer type. Also, it returns ErrIntegerOverflow
 // error if the value exceeds after decrementing the value.
 func (db *GoDb) DecrBy(key []byte, decr int64) (int64, error) {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
 	return db.incrDecrBy(key, -decr)
 }
 
@@ -310,8 +310,8 @@ func (db *GoDb) DecrBy(key []byte, decr int64) (int64, error) {
 // error if the value is not integer type. Also, it returns ErrIntegerOverflow
 // error if the value exceeds after incrementing the value.
 func (db *GoDb) Incr(key []byte) (int64, error) {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
 	return db.incrDecrBy(key, 1)
 }
 
@@ -320,14 +320,17 @@ func (db *GoDb) Incr(key []byte) (int64, error) {
 // error if the value is not integer type. Also, it returns ErrIntegerOverflow
 // error if the value exceeds after incrementing the value.
 func (db *GoDb) IncrBy(key []byte, incr int64) (int64, error) {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	db.strIndex.locks.lock(key)
+	defer db.strIndex.locks.unlock(key)
 	return db.incrDecrBy(key, incr)
 }
 
 // incrDecrBy is a helper method for Incr, IncrBy, Decr, and DecrBy methods. It updates the key by incr.
 func (db *GoDb) incrDecrBy(key []byte, incr int64) (int64, error) {
-	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err := db.checkType(key, String); err != nil {
+		return 0, err
+	}
+	val, err := db.getVal(db.strIndex, key, String)
 	if err != nil && !errors.Is(err, ErrKeyNotFound) {
 		return 0, err
 	}
@@ -351,7 +354,7 @@ func (db *GoDb) incrDecrBy(key []byte, incr int64) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	err = db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
+	err = db.updateIndexTree(db.strIndex, entry, valuePos, true, String)
 	if err != nil {
 		return 0, err
 	}
@@ -361,10 +364,7 @@ func (db *GoDb) incrDecrBy(key []byte, incr int64) (int64, error) {
 // StrLen returns the length of the string value stored at key. If the key
 // doesn't exist, it returns 0.
 func (db *GoDb) StrLen(key []byte) int {
-	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-
-	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	val, err := db.getVal(db.strIndex, key, String)
 	if err != nil {
 		return 0
 	}
@@ -373,13 +373,7 @@ func (db *GoDb) StrLen(key []byte) int {
 
 // Count returns the total number of keys of String.
 func (db *GoDb) Count() int {
-	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-
-	if db.strIndex.idxTree == nil {
-		return 0
-	}
-	return db.strIndex.idxTree.Size()
+	return db.strIndex.Size()
 }
 
 // Scan iterates over all keys of type String and finds its value.
@@ -399,74 +393,32 @@ func (db *GoDb) Scan(prefix []byte, pattern string, count int) ([][]byte, error)
 		}
 	}
 
-	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-	if db.strIndex.idxTree == nil {
-		return nil, nil
-	}
-	keys := db.strIndex.idxTree.PrefixScan(prefix, count)
+	keys := db.strIndex.PrefixScan(prefix, count)
 	if len(keys) == 0 {
-		return nil, nil
+		return nil, db.indexErr(db.strIndex)
 	}
 
-	var results [][]byte
-	for _, key := range keys {
-		if reg != nil && !reg.Match(key) {
-			continue
-		}
-		val, err := db.getVal(db.strIndex.idxTree, key, String)
-		if err != nil && err != ErrKeyNotFound {
-			return nil, err
-		}
-		if err != ErrKeyNotFound {
-			results = append(results, key, val)
+	if reg != nil {
+		matched := keys[:0]
+		for _, key := range keys {
+			if reg.Match(key) {
+				matched = append(matched, key)
+			}
 		}
+		keys = matched
 	}
-	return results, nil
-}
-
-// Expire set the expiration time for the given key.
-func (db *GoDb) Expire(key []byte, duration time.Duration) error {
-	if duration <= 0 {
-		return nil
-	}
-	db.strIndex.mu.Lock()
-	val, err := db.getVal(db.strIndex.idxTree, key, String)
-	if err != nil {
-		db.strIndex.mu.Unlock()
-		return err
-	}
-	db.strIndex.mu.Unlock()
-	return db.SetEX(key, val, duration)
-}
-
-// TTL get ttl(time to live) for the given key.
-func (db *GoDb) TTL(key []byte) (int64, error) {
-	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
-
-	node, err := db.getIndexNode(db.strIndex.idxTree, key)
+	vals, err := db.getVals(db.strIndex, keys, String)
 	if err != nil {
-		return 0, err
-	}
-	var ttl int64
-	if node.expiredAt != 0 {
-		ttl = node.expiredAt - time.Now().Unix()
+		return nil, err
 	}
-	return ttl, nil
-}
 
-// Persist remove the expiration time for the given key.
-func (db *GoDb) Persist(key []byte) error {
-	db.strIndex.mu.Lock()
-	val, err := db.getVal(db.strIndex.idxTree, key, String)
-	if err != nil {
-		db.strIndex.mu.Unlock()
-		return err
+	var results [][]byte
+	for i, key := range keys {
+		if vals[i] != nil {
+			results = append(results, key, vals[i])
+		}
 	}
-	db.strIndex.mu.Unlock()
-
-	return db.Set(key, val)
+	return results, nil
 }
 
 // GetStrsKeys get all stored keys of type String.
@@ -474,26 +426,42 @@ func (db *GoDb) GetStrsKeys() ([][]byte, error) {
 	db.strIndex.mu.RLock()
 	defer db.strIndex.mu.RUnlock()
 
-	if db.strIndex.idxTree == nil {
-		return nil, nil
-	}
-
 	var keys [][]byte
-	iter := db.strIndex.idxTree.Iterator()
-	ts := time.Now().Unix()
+	iter := db.strIndex.Iterator()
+	ts := time.Now().UnixMilli()
 	for iter.HasNext() {
-		node, err := iter.Next()
-		if err != nil {
-			return nil, err
-		}
-		indexNode, _ := node.Value().(*indexNode)
+		key, value := iter.Next()
+		indexNode, _ := value.(*indexNode)
 		if indexNode == nil {
 			continue
 		}
 		if indexNode.expiredAt != 0 && indexNode.expiredAt <= ts {
 			continue
 		}
-		keys = append(keys, node.Key())
+		keys = append(keys, key)
+	}
+	if err := db.indexErr(db.strIndex); err != nil {
+		return nil, err
 	}
 	return keys, nil
 }
+
+// getStr get the value of key, ErrWrongType is returned instead of ErrKeyNotFound if the key holds a value of another data type.
+func (db *GoDb) getStr(key []byte) ([]byte, error) {
+	val, err := db.getVal(db.strIndex, key, String)
+	if err == ErrKeyNotFound {
+		db.strIndex.locks.rLock(key)
+		defer db.strIndex.locks.rUnlock(key)
+		err = db.keyNotFound(key, String)
+	}
+	return val, err
+}
+
+// pairKeys returns the keys of key-value pairs like "key", "value", "key", "value", ...
+func pairKeys(args [][]byte) [][]byte {
+	keys := make([][]byte, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"runtime"
 )
 
 // PathExist check if the directory or file exists.
@@ -15,6 +16,23 @@ func PathExist(path string) bool {
 	return true
 }
 
+// SyncDir flush the directory entries to disk, so files created or renamed in it survive a crash.
+// Directories can't be synced on windows, it does nothing there.
+func SyncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 // CopyDir copy directory from src to dst.
 func CopyDir(src string, dst string) error {
 	var (
@@ -104,3 +104,15 @@ func TestCopyFile(t *testing.T) {
 
 	_ = f.Close()
 }
+
+func TestSyncDir(t *testing.T) {
+	path := filepath.Join("/tmp", "path", "sync-dir")
+	err := os.MkdirAll(path, os.ModePerm)
+	assert.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(filepath.Join("/tmp", "path"))
+	}()
+
+	assert.Nil(t, SyncDir(path))
+	assert.NotNil(t, SyncDir(filepath.Join(path, "not-exist")))
+}
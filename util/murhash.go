@@ -23,14 +23,23 @@ func (m *Murmur128) Write(p []byte) error {
 }
 
 func (m *Murmur128) EncodeSum128() []byte {
+	return encodeSum128(m.mur.Sum128())
+}
+
+func (m *Murmur128) Reset() {
+	m.mur.Reset()
+}
+
+// Sum128 returns the encoded murmur3 128-bit hash of p, same as Write p and EncodeSum128.
+// It keeps no state, so it is safe for concurrent use.
+func Sum128(p []byte) []byte {
+	return encodeSum128(murmur3.Sum128(p))
+}
+
+func encodeSum128(s1, s2 uint64) []byte {
 	buf := make([]byte, binary.MaxVarintLen64*2)
-	s1, s2 := m.mur.Sum128()
 	var index int
 	index += binary.PutUvarint(buf[index:], s1)
 	index += binary.PutUvarint(buf[index:], s2)
 	return buf[:index]
 }
-
-func (m *Murmur128) Reset() {
-	m.mur.Reset()
-}
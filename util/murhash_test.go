@@ -0,0 +1,54 @@
+package util
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSum128(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"nil", nil},
+		{"empty", []byte("")},
+		{"short", []byte("godb")},
+		{"long", []byte("the sum must be equal to the one written to Murmur128")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMurmur128()
+			err := m.Write(tt.buf)
+			assert.Nil(t, err)
+			assert.Equal(t, m.EncodeSum128(), Sum128(tt.buf))
+		})
+	}
+}
+
+func TestSum128_Concurrent(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				buf := []byte(strconv.Itoa(j))
+				m := NewMurmur128()
+				_ = m.Write(buf)
+				assert.Equal(t, m.EncodeSum128(), Sum128(buf))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkSum128(b *testing.B) {
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Sum128([]byte(strconv.Itoa(i * 1000)))
+	}
+}
@@ -0,0 +1,105 @@
+package godb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/herott-ai/godb/ds/index"
+	"github.com/herott-ai/godb/logfile"
+)
+
+// Tx a read-only transaction, it is only valid in the function passed to View.
+type Tx struct {
+	db *GoDb
+	mu sync.Mutex
+	// log files accessed by tx, the value is whether the log file is pinned.
+	pinned map[*logfile.LogFile]bool
+}
+
+// View runs fn in a read-only transaction.
+// When IoType is MMap, values returned by tx alias the mapped log files instead of being copied,
+// they must not be modified, and are only valid until fn returns, copy them if they are needed after that.
+// Log files won`t be rotated, garbage collected or unmapped while fn is running, so fn should return quickly,
+// and it must read by tx only, calling other methods of db in fn may cause deadlock.
+func (db *GoDb) View(fn func(tx *Tx) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	tx := &Tx{db: db, pinned: make(map[*logfile.LogFile]bool)}
+	defer tx.unpin()
+	return fn(tx)
+}
+
+// Get the value of key, see GoDb.Get.
+func (tx *Tx) Get(key []byte) ([]byte, error) {
+	return tx.getVal(tx.db.strIndex, key, String)
+}
+
+// HGet returns the value associated with field in the hash stored at key, see GoDb.HGet.
+func (tx *Tx) HGet(key, field []byte) ([]byte, error) {
+	db := tx.db
+	db.hashIndex.locks.rLock(key)
+	defer db.hashIndex.locks.rUnlock(key)
+
+	idxTree := db.hashIndex.tree(key)
+	if idxTree == nil {
+		return nil, nil
+	}
+	val, err := tx.getVal(idxTree, field, Hash)
+	if err == ErrKeyNotFound {
+		return nil, nil
+	}
+	return val, err
+}
+
+func (tx *Tx) getVal(idxTree index.Index, key []byte, dataType DataType) ([]byte, error) {
+	db := tx.db
+	idxNode, val, err := db.getMemVal(idxTree, key, dataType)
+	if err != nil || idxNode == nil {
+		return val, err
+	}
+
+	// db.mu is held by View.
+	logFile := db.logFile(dataType, idxNode.fid)
+	if logFile == nil {
+		return nil, ErrLogFileNotFound
+	}
+	var ent *logfile.LogEntry
+	if tx.pin(logFile) {
+		ent, _, err = logFile.ViewLogEntry(idxNode.offset)
+	} else {
+		ent, _, err = logFile.ReadLogEntry(idxNode.offset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// key exists, but is invalid(deleted or expired)
+	if ent.Type == logfile.TypeDelete || (ent.ExpiredAt != 0 && ent.ExpiredAt < time.Now().UnixMilli()) {
+		return nil, ErrKeyNotFound
+	}
+	// the value may alias the log file, so it is not put into value cache.
+	return ent.Value, nil
+}
+
+// pin the log file until the transaction ends, it returns false if the log file can`t be pinned.
+func (tx *Tx) pin(logFile *logfile.LogFile) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	pinned, ok := tx.pinned[logFile]
+	if !ok {
+		pinned = logFile.Pin()
+		tx.pinned[logFile] = pinned
+	}
+	return pinned
+}
+
+func (tx *Tx) unpin() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for logFile, pinned := range tx.pinned {
+		if pinned {
+			logFile.Unpin()
+		}
+	}
+	tx.pinned = nil
+}
@@ -0,0 +1,111 @@
+package godb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoDb_View(t *testing.T) {
+	t.Run("fileio", func(t *testing.T) {
+		testGoDbView(t, FileIO, false)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testGoDbView(t, MMap, true)
+	})
+}
+
+func testGoDbView(t *testing.T, ioType IOType, zeroCopy bool) {
+	path := filepath.Join("/tmp", "godb-view")
+	opts := DefaultOptions(path)
+	opts.IoType = ioType
+	opts.LogFileSizeThreshold = 16 << 20
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	bigValue := GetValue(1 << 20)
+	err = db.Set(GetKey(1), bigValue)
+	assert.Nil(t, err)
+	err = db.Set(GetKey(2), GetValue16B())
+	assert.Nil(t, err)
+	err = db.Delete(GetKey(2))
+	assert.Nil(t, err)
+	err = db.HSet([]byte("my_hash"), []byte("a"), GetValue128B())
+	assert.Nil(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		v1, err := tx.Get(GetKey(1))
+		assert.Nil(t, err)
+		assert.Equal(t, bigValue, v1)
+		v2, err := tx.Get(GetKey(1))
+		assert.Nil(t, err)
+		// values alias the mapped log file in mmap mode.
+		assert.Equal(t, zeroCopy, &v1[0] == &v2[0])
+
+		_, err = tx.Get(GetKey(2))
+		assert.Equal(t, ErrKeyNotFound, err)
+		_, err = tx.Get(GetKey(3))
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		val, err := tx.HGet([]byte("my_hash"), []byte("a"))
+		assert.Nil(t, err)
+		assert.Equal(t, 128, len(val))
+		val, err = tx.HGet([]byte("my_hash"), []byte("b"))
+		assert.Nil(t, err)
+		assert.Nil(t, val)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// the mapped region grows while values are viewed.
+	done := make(chan struct{})
+	err = db.View(func(tx *Tx) error {
+		val, err := tx.Get(GetKey(1))
+		assert.Nil(t, err)
+		go func() {
+			defer close(done)
+			for i := 0; i < 8; i++ {
+				err := db.Set(GetKey(i+10), bigValue)
+				assert.Nil(t, err)
+			}
+		}()
+		assert.Equal(t, bigValue, val)
+		return ErrKeyNotFound
+	})
+	assert.Equal(t, ErrKeyNotFound, err)
+	<-done
+	val, err := db.Get(GetKey(17))
+	assert.Nil(t, err)
+	assert.Equal(t, bigValue, val)
+}
+
+func BenchmarkGoDb_View(b *testing.B) {
+	path := filepath.Join("/tmp", "godb-view-bench")
+	opts := DefaultOptions(path)
+	opts.IoType = MMap
+	db, err := Open(opts)
+	assert.Nil(b, err)
+	defer destroyDB(db)
+	err = db.Set(GetKey(1), GetValue(64<<10))
+	assert.Nil(b, err)
+
+	b.Run("get", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := db.Get(GetKey(1))
+			assert.Nil(b, err)
+		}
+	})
+	b.Run("view", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			err := db.View(func(tx *Tx) error {
+				_, err := tx.Get(GetKey(1))
+				return err
+			})
+			assert.Nil(b, err)
+		}
+	})
+}
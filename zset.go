@@ -1,7 +1,6 @@
 package godb
 
 import (
-	"github.com/herott-ai/godb/ds/art"
 	"github.com/herott-ai/godb/logfile"
 	"github.com/herott-ai/godb/logger"
 	"github.com/herott-ai/godb/util"
@@ -9,29 +8,23 @@ import (
 
 // ZAdd adds the specified member with the specified score to the sorted set stored at key.
 func (db *GoDb) ZAdd(key []byte, score float64, member []byte) error {
-	db.zsetIndex.mu.Lock()
-	defer db.zsetIndex.mu.Unlock()
+	db.zsetIndex.locks.lock(key)
+	defer db.zsetIndex.locks.unlock(key)
 
-	if err := db.zsetIndex.murhash.Write(member); err != nil {
+	if err := db.checkWrite(key, ZSet); err != nil {
 		return err
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
-	if db.zsetIndex.trees[string(key)] == nil {
-		db.zsetIndex.trees[string(key)] = art.NewART()
-	}
-	idxTree := db.zsetIndex.trees[string(key)]
+	sum := util.Sum128(member)
+	idxTree := db.zsetIndex.treeOrCreate(key)
 
 	scoreBuf := []byte(util.Float64ToStr(score))
 	zsetKey := db.encodeKey(key, scoreBuf)
 	entry := &logfile.LogEntry{Key: zsetKey, Value: member}
-	pos, err := db.writeLogEntry(entry, ZSet)
+	pos, err := db.writeMember(ZSet, key, entry)
 	if err != nil {
 		return err
 	}
 
-	_, size := logfile.EncodeEntry(entry)
-	pos.entrySize = size
 	ent := &logfile.LogEntry{Key: sum, Value: member}
 	if err := db.updateIndexTree(idxTree, ent, pos, true, ZSet); err != nil {
 		return err
@@ -42,50 +35,42 @@ func (db *GoDb) ZAdd(key []byte, score float64, member []byte) error {
 
 // ZScore returns the score of member in the sorted set at key.
 func (db *GoDb) ZScore(key, member []byte) (ok bool, score float64) {
-	db.zsetIndex.mu.RLock()
-	defer db.zsetIndex.mu.RUnlock()
+	db.zsetIndex.locks.rLock(key)
+	defer db.zsetIndex.locks.rUnlock(key)
 
-	if err := db.zsetIndex.murhash.Write(member); err != nil {
+	if db.zsetIndex.tree(key) == nil {
 		return false, 0
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
+	sum := util.Sum128(member)
 	return db.zsetIndex.indexes.ZScore(string(key), string(sum))
 }
 
 // ZRem removes the specified members from the sorted set stored at key. Non existing members are ignored.
 // An error is returned when key exists and does not hold a sorted set.
 func (db *GoDb) ZRem(key, member []byte) error {
-	db.zsetIndex.mu.Lock()
-	defer db.zsetIndex.mu.Unlock()
+	db.zsetIndex.locks.lock(key)
+	defer db.zsetIndex.locks.unlock(key)
 
-	if err := db.zsetIndex.murhash.Write(member); err != nil {
-		return err
+	idxTree := db.zsetIndex.tree(key)
+	if idxTree == nil {
+		return db.checkType(key, ZSet)
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
-
-	ok := db.zsetIndex.indexes.ZRem(string(key), string(sum))
-	if !ok {
+	sum := util.Sum128(member)
+	if ok, _ := db.zsetIndex.indexes.ZScore(string(key), string(sum)); !ok {
 		return nil
 	}
-
-	if db.zsetIndex.trees[string(key)] == nil {
-		db.zsetIndex.trees[string(key)] = art.NewART()
-	}
-	idxTree := db.zsetIndex.trees[string(key)]
-
-	oldVal, deleted := idxTree.Delete(sum)
-	db.sendDiscard(oldVal, deleted, ZSet)
 	entry := &logfile.LogEntry{Key: key, Value: sum, Type: logfile.TypeDelete}
-	pos, err := db.writeLogEntry(entry, ZSet)
+	pos, err := db.writeMember(ZSet, key, entry)
 	if err != nil {
 		return err
 	}
+	db.zsetIndex.indexes.ZRem(string(key), string(sum))
+
+	oldVal, deleted := idxTree.Delete(sum)
+	db.sendDiscard(oldVal, deleted, ZSet)
 
 	// The deleted entry itself is also invalid.
-	_, size := logfile.EncodeEntry(entry)
-	node := &indexNode{fid: pos.fid, entrySize: size}
+	node := &indexNode{fid: pos.fid, entrySize: pos.entrySize}
 	select {
 	case db.discards[ZSet].valChan <- node:
 	default:
@@ -94,10 +79,19 @@ func (db *GoDb) ZRem(key, member []byte) error {
 	return nil
 }
 
+// ZClear deletes the sorted set stored at key with all its members.
+// It writes only one record no matter how many members the sorted set has, the members are reclaimed by log file gc later.
+func (db *GoDb) ZClear(key []byte) error {
+	return db.dropCollection(ZSet, key)
+}
+
 // ZCard returns the sorted set cardinality (number of elements) of the sorted set stored at key.
 func (db *GoDb) ZCard(key []byte) int {
-	db.zsetIndex.mu.RLock()
-	defer db.zsetIndex.mu.RUnlock()
+	db.zsetIndex.locks.rLock(key)
+	defer db.zsetIndex.locks.rUnlock(key)
+	if db.zsetIndex.tree(key) == nil {
+		return 0
+	}
 	return db.zsetIndex.indexes.ZCard(string(key))
 }
 
@@ -125,12 +119,12 @@ func (db *GoDb) ZRevRank(key []byte, member []byte) (ok bool, rank int) {
 }
 
 func (db *GoDb) zRangeInternal(key []byte, start, stop int, rev bool) ([][]byte, error) {
-	db.zsetIndex.mu.RLock()
-	defer db.zsetIndex.mu.RUnlock()
-	if db.zsetIndex.trees[string(key)] == nil {
-		db.zsetIndex.trees[string(key)] = art.NewART()
+	db.zsetIndex.locks.rLock(key)
+	defer db.zsetIndex.locks.rUnlock(key)
+	idxTree := db.zsetIndex.tree(key)
+	if idxTree == nil {
+		return nil, db.checkType(key, ZSet)
 	}
-	idxTree := db.zsetIndex.trees[string(key)]
 
 	var res [][]byte
 	var values []interface{}
@@ -151,17 +145,13 @@ func (db *GoDb) zRangeInternal(key []byte, start, stop int, rev bool) ([][]byte,
 }
 
 func (db *GoDb) zRankInternal(key []byte, member []byte, rev bool) (ok bool, rank int) {
-	db.zsetIndex.mu.RLock()
-	defer db.zsetIndex.mu.RUnlock()
-	if db.zsetIndex.trees[string(key)] == nil {
+	db.zsetIndex.locks.rLock(key)
+	defer db.zsetIndex.locks.rUnlock(key)
+	if db.zsetIndex.tree(key) == nil {
 		return
 	}
 
-	if err := db.zsetIndex.murhash.Write(member); err != nil {
-		return
-	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
+	sum := util.Sum128(member)
 
 	var result int64
 	if rev {